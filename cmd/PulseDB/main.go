@@ -4,10 +4,12 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"os"
 	"os/signal"
 	"syscall"
 
+	"github.com/DNahar74/PulseDB/internal/config"
 	"github.com/DNahar74/PulseDB/internal/server"
 )
 
@@ -19,11 +21,14 @@ var (
 
 func main() {
 	var (
-		addr    = flag.String("addr", "0.0.0.0:6380", "Server address to bind to")
-		help    = flag.Bool("help", false, "Show help information")
-		ver     = flag.Bool("version", false, "Show version information")
-		verbose = flag.Bool("verbose", false, "Enable verbose logging")
+		configFile = flag.String("config", "", "redis.conf style config file, the other flags override its settings")
+		addr       = flag.String("addr", "", "Server address to bind to, e.g. 0.0.0.0:6380, sets bind & port (empty port to only accept TLS or the Unix socket)")
+		help       = flag.Bool("help", false, "Show help information")
+		ver        = flag.Bool("version", false, "Show version information")
+		verbose    = flag.Bool("verbose", false, "Enable verbose logging")
 	)
+	// Every setting of the config file is a flag too
+	flags := config.RegisterFlags(flag.CommandLine)
 	flag.Parse()
 
 	if *help {
@@ -40,10 +45,44 @@ func main() {
 		log.SetFlags(log.LstdFlags | log.Lshortfile)
 	}
 
-	fmt.Printf("Starting PulseDB server on %s\n", *addr)
+	cfg := config.Default()
+	if *configFile != "" {
+		err := cfg.Load(*configFile)
+		if err != nil {
+			log.Fatalf("Error loading the config file: %v", err)
+		}
+	}
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name != "addr" {
+			return
+		}
+		if *addr == "" {
+			cfg.Port = 0
+			return
+		}
+		host, port, err := net.SplitHostPort(*addr)
+		if err != nil {
+			log.Fatalf("Invalid -addr: %v", err)
+		}
+		if host != "" {
+			cfg.Bind = host
+		}
+		if port == "" {
+			port = "0"
+		}
+		if err := cfg.Set("port", port); err != nil {
+			log.Fatalf("Invalid -addr: %v", err)
+		}
+	})
+	err := flags.Apply(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("Starting PulseDB server on %s\n", cfg.Address())
 	fmt.Printf("Version: %s\n", version)
 
-	redisServer := server.NewServer(*addr)
+	redisServer := server.NewServer(cfg)
 
 	// Graceful shutdown
 	c := make(chan os.Signal, 1)
@@ -55,7 +94,20 @@ func main() {
 		}
 	}()
 
+	// SIGHUP reloads the TLS certificates
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := redisServer.ReloadTLS(); err != nil {
+				fmt.Println("Error reloading the TLS certificates:", err)
+				continue
+			}
+			fmt.Println("TLS certificates reloaded")
+		}
+	}()
+
 	<-c
 	fmt.Println("\nShutting down server...")
-	// Add graceful shutdown logic here
+	redisServer.Close()
 }
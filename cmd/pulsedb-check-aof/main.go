@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/DNahar74/PulseDB/internal/aof"
+)
+
+func main() {
+	fix := flag.Bool("fix", false, "Truncate the file to the last valid record")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [-fix] <file.aof>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	path := flag.Arg(0)
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Println("Cannot read the AOF file:", err)
+		os.Exit(1)
+	}
+
+	records, err := aof.Parse(string(content))
+	if err == nil {
+		fmt.Printf("AOF analyzed: size=%d, records=%d\n", len(content), len(records))
+		fmt.Println("AOF is valid")
+		return
+	}
+
+	var corrupt *aof.CorruptError
+	if !errors.As(err, &corrupt) {
+		fmt.Println("Cannot parse the AOF file:", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("0x%08x: %v\n", corrupt.Offset, corrupt.Err)
+	fmt.Printf("AOF analyzed: size=%d, ok_up_to=%d, records_ok=%d, diff=%d\n",
+		len(content), corrupt.Offset, len(records), int64(len(content))-corrupt.Offset)
+	if corrupt.Truncated {
+		fmt.Println("The last record is incomplete")
+	} else {
+		fmt.Println("The AOF is corrupted before its last record, truncating it will also drop the valid records after the offset")
+	}
+
+	if !*fix {
+		fmt.Println("AOF is not valid. Use the -fix option to try fixing it")
+		os.Exit(1)
+	}
+
+	err = os.Truncate(path, corrupt.Offset)
+	if err != nil {
+		fmt.Println("Failed to truncate the AOF:", err)
+		os.Exit(1)
+	}
+	fmt.Println("Successfully truncated AOF")
+}
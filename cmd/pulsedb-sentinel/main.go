@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/DNahar74/PulseDB/internal/sentinel"
+)
+
+func main() {
+	cfg := sentinel.DefaultConfig()
+
+	var peers string
+
+	flag.StringVar(&cfg.Address, "addr", cfg.Address, "Sentinel address to bind to")
+	flag.StringVar(&cfg.Name, "name", cfg.Name, "Name of the monitored primary")
+	flag.StringVar(&cfg.MasterAddr, "master", "", "Address (host:port) of the monitored primary")
+	flag.StringVar(&cfg.AuthPass, "auth-pass", "", "Password of the primary & its replicas")
+	flag.StringVar(&cfg.RequirePass, "requirepass", "", "Password of this sentinel & of its peers")
+	flag.IntVar(&cfg.Quorum, "quorum", cfg.Quorum, "Number of sentinels that must agree that the primary is down")
+	flag.StringVar(&peers, "sentinels", "", "Comma separated addresses of the other sentinels")
+	flag.DurationVar(&cfg.DownAfter, "down-after", cfg.DownAfter, "Time without a reply before an instance is considered down")
+	flag.DurationVar(&cfg.FailoverTimeout, "failover-timeout", cfg.FailoverTimeout, "Time before a failover that did not complete is retried")
+	flag.Parse()
+
+	if cfg.MasterAddr == "" {
+		fmt.Fprintln(os.Stderr, "The -master address is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	for _, p := range strings.Split(peers, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			cfg.Peers = append(cfg.Peers, p)
+		}
+	}
+
+	s := sentinel.New(cfg)
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		if err := s.Start(); err != nil {
+			log.Fatalf("Error starting sentinel: %v", err)
+		}
+	}()
+
+	<-c
+	fmt.Println("\nShutting down sentinel...")
+	_ = s.Close()
+}
@@ -0,0 +1,683 @@
+// Package acl holds the users of the server & what they are allowed to do: their passwords, the commands & the
+// categories of commands they can run, & the patterns of the keys & the pub/sub channels they can access
+package acl
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/DNahar74/PulseDB/internal/utils"
+)
+
+// DefaultUsername is the user of the connections that did not authenticate, which can't be deleted
+const DefaultUsername = "default"
+
+// Perm is a set of permissions on a key
+type Perm int
+
+const (
+	PermRead Perm = 1 << iota
+	PermWrite
+)
+
+var (
+	errSyntax          = errors.New("Syntax error")
+	errUnknownCommand  = errors.New("Unknown command or category name in ACL")
+	errPatternAfterAll = errors.New("Adding a pattern after the * pattern (or the 'allkeys' flag) is not valid and does not have any effect. Try 'resetkeys' to start with an empty list of patterns")
+	errChannelAfterAll = errors.New("Adding a pattern after the * pattern (or the 'allchannels' flag) is not valid and does not have any effect. Try 'resetchannels' to start with an empty list of channels")
+	errBadHash         = errors.New("The password hash must be exactly 64 characters and contain only lowercase hexadecimal characters")
+	errNoSuchPassword  = errors.New("The password you are trying to remove from the user does not exist")
+)
+
+// The commands known to the rules & their categories, registered by the command package
+var (
+	commands   = map[string][]string{}
+	categories = map[string][]string{}
+)
+
+// RegisterCommand makes a command & its categories known to the rules, before they are applied
+func RegisterCommand(name string, cats ...string) {
+	name = strings.ToLower(name)
+	commands[name] = cats
+	for _, cat := range cats {
+		categories[cat] = append(categories[cat], name)
+	}
+}
+
+// Categories returns the names of the categories, sorted
+func Categories() []string {
+	names := make([]string, 0, len(categories))
+	for cat := range categories {
+		names = append(names, cat)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CategoryCommands returns the commands of a category sorted, & false if the category does not exist
+func CategoryCommands(cat string) ([]string, bool) {
+	names, ok := categories[strings.ToLower(cat)]
+	if !ok {
+		return nil, false
+	}
+	names = append([]string(nil), names...)
+	sort.Strings(names)
+	return names, true
+}
+
+// User is a user of the server
+// Its rules are only changed & checked through the ACL, which holds the lock
+type User struct {
+	name    string
+	enabled bool
+	nopass  bool
+	// passwords are the hex SHA-256 digests of the passwords, the passwords themselves are never kept
+	passwords []string
+
+	// allCommands tells whether the user can run the commands that allowed doesn't hold, & firstArgs holds the first
+	// arguments allowed or denied for a command whatever the rest says
+	allCommands bool
+	allowed     map[string]bool
+	firstArgs   map[string]map[string]bool
+	// commandRules are the command rules applied since the last +@all or -@all, to describe the user
+	commandRules []string
+
+	allKeys bool
+	keys    []keyPattern
+
+	allChannels bool
+	channels    []string
+
+	// deleted is set when the user is removed, its connections must authenticate again
+	deleted bool
+}
+
+// keyPattern is a glob-style pattern of keys & the permissions it gives on them
+type keyPattern struct {
+	pattern string
+	perm    Perm
+}
+
+func newUser(name string) *User {
+	return &User{name: name, allowed: make(map[string]bool), firstArgs: make(map[string]map[string]bool)}
+}
+
+// Name returns the name of the user
+func (u *User) Name() string {
+	return u.name
+}
+
+func (u *User) clone() *User {
+	c := *u
+	c.passwords = append([]string(nil), u.passwords...)
+	c.allowed = make(map[string]bool, len(u.allowed))
+	for name, ok := range u.allowed {
+		c.allowed[name] = ok
+	}
+	c.firstArgs = make(map[string]map[string]bool, len(u.firstArgs))
+	for name, args := range u.firstArgs {
+		c.firstArgs[name] = make(map[string]bool, len(args))
+		for arg, ok := range args {
+			c.firstArgs[name][arg] = ok
+		}
+	}
+	c.commandRules = append([]string(nil), u.commandRules...)
+	c.keys = append([]keyPattern(nil), u.keys...)
+	c.channels = append([]string(nil), u.channels...)
+	return &c
+}
+
+// apply changes the user with a rule of ACL SETUSER
+func (u *User) apply(rule string) error {
+	switch lower := strings.ToLower(rule); lower {
+	case "on":
+		u.enabled = true
+	case "off":
+		u.enabled = false
+	case "nopass":
+		u.nopass = true
+		u.passwords = nil
+	case "resetpass":
+		u.nopass = false
+		u.passwords = nil
+	case "allkeys", "~*", "%rw~*":
+		u.allKeys = true
+		u.keys = nil
+	case "resetkeys":
+		u.allKeys = false
+		u.keys = nil
+	case "allchannels", "&*":
+		u.allChannels = true
+		u.channels = nil
+	case "resetchannels":
+		u.allChannels = false
+		u.channels = nil
+	case "allcommands", "+@all":
+		u.setCommands(true)
+	case "nocommands", "-@all":
+		u.setCommands(false)
+	case "reset":
+		for _, r := range []string{"resetpass", "resetkeys", "resetchannels", "off", "-@all"} {
+			_ = u.apply(r)
+		}
+	default:
+		if rule == "" {
+			return errSyntax
+		}
+		switch rule[0] {
+		case '>', '<', '#', '!':
+			return u.applyPassword(rule)
+		case '~', '%':
+			return u.applyKeyPattern(rule)
+		case '&':
+			if u.allChannels {
+				return errChannelAfterAll
+			}
+			u.channels = appendUnique(u.channels, rule[1:])
+		case '+', '-':
+			return u.applyCommand(rule)
+		default:
+			return errSyntax
+		}
+	}
+	return nil
+}
+
+func (u *User) applyPassword(rule string) error {
+	hash := rule[1:]
+	switch rule[0] {
+	case '>', '<':
+		hash = hashPassword(rule[1:])
+	default:
+		if !validHash(hash) {
+			return errBadHash
+		}
+	}
+
+	if rule[0] == '<' || rule[0] == '!' {
+		i := indexOf(u.passwords, hash)
+		if i < 0 {
+			return errNoSuchPassword
+		}
+		u.passwords = append(u.passwords[:i], u.passwords[i+1:]...)
+		return nil
+	}
+	u.passwords = appendUnique(u.passwords, hash)
+	u.nopass = false
+	return nil
+}
+
+// applyKeyPattern adds a pattern given as ~pattern for read & write, or %R~pattern, %W~pattern or %RW~pattern
+func (u *User) applyKeyPattern(rule string) error {
+	perm, pattern := PermRead|PermWrite, rule[1:]
+	if rule[0] == '%' {
+		flags, p, ok := strings.Cut(rule[1:], "~")
+		if !ok || flags == "" {
+			return errSyntax
+		}
+		perm = 0
+		for _, f := range strings.ToUpper(flags) {
+			switch f {
+			case 'R':
+				perm |= PermRead
+			case 'W':
+				perm |= PermWrite
+			default:
+				return errSyntax
+			}
+		}
+		pattern = p
+	}
+
+	if u.allKeys {
+		return errPatternAfterAll
+	}
+	for i, k := range u.keys {
+		if k.pattern == pattern {
+			u.keys[i].perm |= perm
+			return nil
+		}
+	}
+	u.keys = append(u.keys, keyPattern{pattern: pattern, perm: perm})
+	return nil
+}
+
+// applyCommand allows or denies a command, a category with @, or the first argument of a command with |
+func (u *User) applyCommand(rule string) error {
+	allow, name := rule[0] == '+', strings.ToLower(rule[1:])
+
+	if cat, ok := strings.CutPrefix(name, "@"); ok {
+		names, ok := categories[cat]
+		if !ok {
+			return errUnknownCommand
+		}
+		for _, n := range names {
+			u.allowed[n] = allow
+			delete(u.firstArgs, n)
+		}
+		u.commandRules = append(u.commandRules, rule[:1]+name)
+		return nil
+	}
+
+	cmd, arg, hasArg := strings.Cut(name, "|")
+	if _, ok := commands[cmd]; !ok || hasArg && arg == "" {
+		return errUnknownCommand
+	}
+	if hasArg {
+		if u.firstArgs[cmd] == nil {
+			u.firstArgs[cmd] = make(map[string]bool)
+		}
+		u.firstArgs[cmd][arg] = allow
+	} else {
+		u.allowed[cmd] = allow
+		delete(u.firstArgs, cmd)
+	}
+
+	// The previous rules for the same command don't describe the user anymore
+	rules := u.commandRules[:0]
+	for _, r := range u.commandRules {
+		if r[1:] != name && !(!hasArg && strings.HasPrefix(r[1:], name+"|")) {
+			rules = append(rules, r)
+		}
+	}
+	u.commandRules = append(rules, rule[:1]+name)
+	return nil
+}
+
+func (u *User) setCommands(allow bool) {
+	u.allowed = make(map[string]bool)
+	u.firstArgs = make(map[string]map[string]bool)
+	u.allCommands = allow
+	u.commandRules = nil
+}
+
+func (u *User) canRun(command, firstArg string) bool {
+	if args, ok := u.firstArgs[command]; ok && firstArg != "" {
+		if allow, ok := args[strings.ToLower(firstArg)]; ok {
+			return allow
+		}
+	}
+	if allow, ok := u.allowed[command]; ok {
+		return allow
+	}
+	return u.allCommands
+}
+
+// canAccessKey reports whether one pattern gives all the permissions on a key
+func (u *User) canAccessKey(key string, perm Perm) bool {
+	if u.allKeys {
+		return true
+	}
+	for _, k := range u.keys {
+		if k.perm&perm == perm && utils.GlobMatch(k.pattern, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// canAccessChannel checks a channel, or a pattern of channels which must then be one of the patterns of the user
+func (u *User) canAccessChannel(channel string, isPattern bool) bool {
+	if u.allChannels {
+		return true
+	}
+	for _, c := range u.channels {
+		if isPattern && c == channel || !isPattern && utils.GlobMatch(c, channel) {
+			return true
+		}
+	}
+	return false
+}
+
+func (u *User) flags() []string {
+	flags := []string{"off"}
+	if u.enabled {
+		flags[0] = "on"
+	}
+	if u.nopass {
+		flags = append(flags, "nopass")
+	}
+	return flags
+}
+
+func (u *User) describeCommands() string {
+	rules := []string{"-@all"}
+	if u.allCommands {
+		rules[0] = "+@all"
+	}
+	return strings.Join(append(rules, u.commandRules...), " ")
+}
+
+func (u *User) describeKeys() string {
+	if u.allKeys {
+		return "~*"
+	}
+	patterns := make([]string, len(u.keys))
+	for i, k := range u.keys {
+		switch k.perm {
+		case PermRead:
+			patterns[i] = "%R~" + k.pattern
+		case PermWrite:
+			patterns[i] = "%W~" + k.pattern
+		default:
+			patterns[i] = "~" + k.pattern
+		}
+	}
+	return strings.Join(patterns, " ")
+}
+
+func (u *User) describeChannels() string {
+	if u.allChannels {
+		return "&*"
+	}
+	patterns := make([]string, len(u.channels))
+	for i, c := range u.channels {
+		patterns[i] = "&" + c
+	}
+	return strings.Join(patterns, " ")
+}
+
+// describe returns the rules that create the user, as listed by ACL LIST & saved in the ACL file
+func (u *User) describe() string {
+	parts := append([]string{"user", u.name}, u.flags()...)
+	for _, p := range u.passwords {
+		parts = append(parts, "#"+p)
+	}
+	if keys := u.describeKeys(); keys != "" {
+		parts = append(parts, keys)
+	}
+	if channels := u.describeChannels(); channels != "" {
+		parts = append(parts, channels)
+	} else {
+		parts = append(parts, "resetchannels")
+	}
+	parts = append(parts, u.describeCommands())
+	return strings.Join(parts, " ")
+}
+
+// UserInfo describes a user for ACL GETUSER
+type UserInfo struct {
+	Flags     []string
+	Passwords []string
+	Commands  string
+	Keys      string
+	Channels  string
+}
+
+// ACL holds the users of the server
+type ACL struct {
+	mu    sync.RWMutex
+	users map[string]*User
+
+	log       []*LogEntry
+	lastLogID int64
+
+	// file is where ACL LOAD & ACL SAVE read & write the users, empty when there is none
+	file string
+}
+
+// New creates the users of a server, with the default user allowed to run everything without a password
+// file is the ACL file, it is not loaded yet
+func New(file string) *ACL {
+	a := &ACL{users: make(map[string]*User), file: file}
+	a.users[DefaultUsername] = newDefaultUser()
+	return a
+}
+
+func newDefaultUser() *User {
+	u := newUser(DefaultUsername)
+	for _, rule := range []string{"on", "nopass", "allkeys", "allchannels", "allcommands"} {
+		_ = u.apply(rule)
+	}
+	return u
+}
+
+// DefaultUser returns the user of the connections that did not authenticate
+func (a *ACL) DefaultUser() *User {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return a.users[DefaultUsername]
+}
+
+// SetRequirePass sets the only password of the default user, or lets it in without one when password is empty
+func (a *ACL) SetRequirePass(password string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	u := a.users[DefaultUsername]
+	if password == "" {
+		_ = u.apply("nopass")
+		return
+	}
+	_ = u.apply("resetpass")
+	_ = u.apply(">" + password)
+}
+
+// AuthRequired reports whether the connections must authenticate, which they don't when the default user is enabled &
+// has no password
+func (a *ACL) AuthRequired() bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	u := a.users[DefaultUsername]
+	return !u.enabled || !u.nopass
+}
+
+// Authenticate returns the user of a username & a password, & false if the user does not exist, is disabled, or has
+// another password
+// The digests of all the passwords are compared in constant time, so that the time doesn't tell how much of a password
+// is right
+func (a *ACL) Authenticate(username, password string) (*User, bool) {
+	hash := []byte(hashPassword(password))
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	u, ok := a.users[username]
+	if !ok || !u.enabled {
+		return nil, false
+	}
+	if u.nopass {
+		return u, true
+	}
+	match := 0
+	for _, p := range u.passwords {
+		match |= subtle.ConstantTimeCompare(hash, []byte(p))
+	}
+	return u, match == 1
+}
+
+// Lookup returns an enabled user without checking its passwords, for the clients authenticated by other means such as
+// their TLS certificate
+func (a *ACL) Lookup(username string) (*User, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	u, ok := a.users[username]
+	if !ok || !u.enabled {
+		return nil, false
+	}
+	return u, true
+}
+
+// Valid reports whether a user still exists
+func (a *ACL) Valid(u *User) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return !u.deleted
+}
+
+// CanRun reports whether a user can run a command, given with its first argument when it has one
+func (a *ACL) CanRun(u *User, command, firstArg string) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return !u.deleted && u.canRun(strings.ToLower(command), firstArg)
+}
+
+// CanAccessKey reports whether a user has the permissions on a key
+func (a *ACL) CanAccessKey(u *User, key string, perm Perm) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return u.canAccessKey(key, perm)
+}
+
+// CanAccessChannel reports whether a user can publish or subscribe to a channel, or subscribe to a pattern of channels
+func (a *ACL) CanAccessChannel(u *User, channel string, isPattern bool) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return u.canAccessChannel(channel, isPattern)
+}
+
+// SetUser creates a user or changes it with rules, which are all applied or none if one of them is invalid
+// The error tells which rule is invalid
+func (a *ACL) SetUser(name string, rules []string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	u, ok := a.users[name]
+	updated := newUser(name)
+	if ok {
+		updated = u.clone()
+	}
+	for _, rule := range rules {
+		err := updated.apply(rule)
+		if err != nil {
+			return &RuleError{Rule: rule, Err: err}
+		}
+	}
+
+	// The connections of the user keep it, it is updated in place
+	if ok {
+		*u = *updated
+	} else {
+		a.users[name] = updated
+	}
+	return nil
+}
+
+// RuleError is an invalid rule given to SetUser
+type RuleError struct {
+	Rule string
+	Err  error
+}
+
+func (e *RuleError) Error() string {
+	return "Error in ACL SETUSER modifier '" + e.Rule + "': " + e.Err.Error()
+}
+
+// GetUser describes a user, & returns false if it does not exist
+func (a *ACL) GetUser(name string) (UserInfo, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	u, ok := a.users[name]
+	if !ok {
+		return UserInfo{}, false
+	}
+	return UserInfo{
+		Flags:     u.flags(),
+		Passwords: append([]string{}, u.passwords...),
+		Commands:  u.describeCommands(),
+		Keys:      u.describeKeys(),
+		Channels:  u.describeChannels(),
+	}, true
+}
+
+// DeleteUsers removes users & returns how many existed, the default user can't be removed
+func (a *ACL) DeleteUsers(names ...string) (int, error) {
+	for _, name := range names {
+		if name == DefaultUsername {
+			return 0, errors.New("The 'default' user cannot be removed")
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	deleted := 0
+	for _, name := range names {
+		if u, ok := a.users[name]; ok {
+			u.deleted = true
+			delete(a.users, name)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// Usernames returns the names of the users, sorted
+func (a *ACL) Usernames() []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return a.usernamesLocked()
+}
+
+func (a *ACL) usernamesLocked() []string {
+	names := make([]string, 0, len(a.users))
+	for name := range a.users {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// List returns the rules of every user, sorted by name
+func (a *ACL) List() []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return a.listLocked()
+}
+
+func (a *ACL) listLocked() []string {
+	names := a.usernamesLocked()
+	lines := make([]string, len(names))
+	for i, name := range names {
+		lines[i] = a.users[name].describe()
+	}
+	return lines
+}
+
+func hashPassword(password string) string {
+	h := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(h[:])
+}
+
+func validHash(hash string) bool {
+	if len(hash) != 2*sha256.Size {
+		return false
+	}
+	for _, c := range hash {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func indexOf(list []string, s string) int {
+	for i, item := range list {
+		if item == s {
+			return i
+		}
+	}
+	return -1
+}
+
+func appendUnique(list []string, s string) []string {
+	if indexOf(list, s) >= 0 {
+		return list
+	}
+	return append(list, s)
+}
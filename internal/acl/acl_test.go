@@ -0,0 +1,233 @@
+package acl
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func init() {
+	RegisterCommand("get", "read", "string")
+	RegisterCommand("set", "write", "string")
+	RegisterCommand("del", "write", "keyspace")
+	RegisterCommand("config", "admin")
+}
+
+func TestRules(t *testing.T) {
+	a := New("")
+
+	err := a.SetUser("analytics", []string{"on", ">s3cret", "+@read", "%R~stats:*", "~tmp:*", "+config|get", "&news.*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, ok := a.Authenticate("analytics", "s3cret")
+	if !ok {
+		t.Fatal("Authenticate failed")
+	}
+
+	for _, tt := range []struct {
+		command, arg string
+		want         bool
+	}{
+		{command: "GET", want: true},
+		{command: "set"},
+		{command: "config", arg: "GET", want: true},
+		{command: "config", arg: "set"},
+		{command: "unknown"},
+	} {
+		if got := a.CanRun(u, tt.command, tt.arg); got != tt.want {
+			t.Errorf("CanRun(%s %s) = %v", tt.command, tt.arg, got)
+		}
+	}
+
+	for _, tt := range []struct {
+		key  string
+		perm Perm
+		want bool
+	}{
+		{key: "stats:daily", perm: PermRead, want: true},
+		{key: "stats:daily", perm: PermWrite},
+		{key: "stats:daily", perm: PermRead | PermWrite},
+		{key: "tmp:1", perm: PermRead | PermWrite, want: true},
+		{key: "users:1", perm: PermRead},
+	} {
+		if got := a.CanAccessKey(u, tt.key, tt.perm); got != tt.want {
+			t.Errorf("CanAccessKey(%s, %d) = %v", tt.key, tt.perm, got)
+		}
+	}
+
+	if !a.CanAccessChannel(u, "news.tech", false) || a.CanAccessChannel(u, "sport", false) {
+		t.Error("channel patterns are not applied")
+	}
+	if !a.CanAccessChannel(u, "news.*", true) || a.CanAccessChannel(u, "*", true) {
+		t.Error("a pattern subscription must be one of the patterns of the user")
+	}
+
+	want := "user analytics on #" + hashPassword("s3cret") + " %R~stats:* ~tmp:* &news.* -@all +@read +config|get"
+	if got := a.List()[0]; got != want {
+		t.Errorf("List = %q, want %q", got, want)
+	}
+
+	// The rules for the same command replace each other
+	err = a.SetUser("analytics", []string{"-config|get", "+config"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := a.GetUser("analytics"); info.Commands != "-@all +@read +config" {
+		t.Errorf("commands = %q", info.Commands)
+	}
+}
+
+func TestSetUserErrors(t *testing.T) {
+	a := New("")
+
+	for _, tt := range []struct {
+		rules   []string
+		wantErr string
+	}{
+		{rules: []string{"+nosuchcommand"}, wantErr: "Unknown command or category name in ACL"},
+		{rules: []string{"+@nosuchcategory"}, wantErr: "Unknown command or category name in ACL"},
+		{rules: []string{"#abc"}, wantErr: "The password hash must be exactly 64 characters"},
+		{rules: []string{"<notset"}, wantErr: "The password you are trying to remove from the user does not exist"},
+		{rules: []string{"allkeys", "~foo"}, wantErr: "Adding a pattern after the * pattern"},
+		{rules: []string{"%X~foo"}, wantErr: "Syntax error"},
+		{rules: []string{"bogus"}, wantErr: "Syntax error"},
+	} {
+		err := a.SetUser("alice", append([]string{"on", "+get"}, tt.rules...))
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%v: error %v, want %q", tt.rules, err, tt.wantErr)
+		}
+	}
+
+	// An invalid rule leaves the user as it was
+	if _, ok := a.GetUser("alice"); ok {
+		t.Error("a failed SETUSER created the user")
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	a := New("")
+	if a.AuthRequired() {
+		t.Error("AuthRequired without a password")
+	}
+
+	a.SetRequirePass("secret")
+	if !a.AuthRequired() {
+		t.Error("AuthRequired is false with a password")
+	}
+	if _, ok := a.Authenticate(DefaultUsername, "secret"); !ok {
+		t.Error("the default user can't authenticate with requirepass")
+	}
+
+	_ = a.SetUser("bob", []string{">one", ">two"})
+	if _, ok := a.Authenticate("bob", "one"); ok {
+		t.Error("a disabled user authenticated")
+	}
+	_ = a.SetUser("bob", []string{"on"})
+	for _, password := range []string{"one", "two"} {
+		if _, ok := a.Authenticate("bob", password); !ok {
+			t.Errorf("bob can't authenticate with %q", password)
+		}
+	}
+	if _, ok := a.Authenticate("bob", "three"); ok {
+		t.Error("bob authenticated with a wrong password")
+	}
+
+	u, _ := a.Authenticate("bob", "one")
+	if n, err := a.DeleteUsers("bob", "nobody"); n != 1 || err != nil {
+		t.Errorf("DeleteUsers = %d, %v", n, err)
+	}
+	if a.Valid(u) || a.CanRun(u, "get", "") {
+		t.Error("a deleted user is still valid")
+	}
+	if _, err := a.DeleteUsers(DefaultUsername); err == nil {
+		t.Error("the default user was deleted")
+	}
+}
+
+func TestLog(t *testing.T) {
+	a := New("")
+
+	a.LogDenied(ReasonCommand, "toplevel", "set", "alice", "id=1")
+	a.LogDenied(ReasonCommand, "toplevel", "set", "alice", "id=2")
+	a.LogDenied(ReasonKey, "toplevel", "users:1", "alice", "id=2")
+
+	entries := a.Log(10)
+	if len(entries) != 2 {
+		t.Fatalf("%d entries, want 2", len(entries))
+	}
+	if entries[0].Reason != ReasonKey || entries[1].Count != 2 || entries[1].ClientInfo != "id=2" {
+		t.Errorf("entries = %+v", entries)
+	}
+	if len(a.Log(1)) != 1 {
+		t.Error("Log(1) returned more than 1 entry")
+	}
+
+	for range logMaxLen + 10 {
+		a.LogDenied(ReasonAuth, "toplevel", "AUTH", strings.Repeat("x", len(a.log)+1), "")
+	}
+	if len(a.Log(1000)) != logMaxLen {
+		t.Errorf("the log holds %d entries, want %d", len(a.Log(1000)), logMaxLen)
+	}
+
+	a.ResetLog()
+	if len(a.Log(10)) != 0 {
+		t.Error("the log is not empty after ResetLog")
+	}
+}
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.acl")
+	a := New(path)
+	a.SetRequirePass("secret")
+
+	if err := a.Load(); !os.IsNotExist(err) {
+		t.Fatalf("Load of a missing file: %v", err)
+	}
+
+	_ = a.SetUser("alice", []string{"on", ">pw", "~cache:*", "+get"})
+	_ = a.SetUser("bob", []string{"on", "nopass", "+@all"})
+	if err := a.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	b := New(path)
+	if err := b.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(b.List(), "\n") != strings.Join(a.List(), "\n") {
+		t.Errorf("loaded\n%s\nwant\n%s", strings.Join(b.List(), "\n"), strings.Join(a.List(), "\n"))
+	}
+
+	// The users loaded again keep their connections, the others are deleted
+	alice, _ := a.Authenticate("alice", "pw")
+	bob, _ := a.Authenticate("bob", "")
+	err := os.WriteFile(path, []byte("# users\nuser alice on >new ~* +@all\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if !a.Valid(alice) || !a.CanRun(alice, "set", "") || a.Valid(bob) {
+		t.Error("Load did not update the users in place")
+	}
+	if _, ok := a.Authenticate(DefaultUsername, "secret"); !ok {
+		t.Error("Load changed the default user that the file does not define")
+	}
+
+	for _, content := range []string{"user alice on\nuser alice off\n", "alice on\n", "user alice +nosuchcommand\n"} {
+		_ = os.WriteFile(path, []byte(content), 0600)
+		if err := a.Load(); err == nil {
+			t.Errorf("Load of %q succeeded", content)
+		}
+	}
+	if !a.CanRun(alice, "set", "") {
+		t.Error("a failed Load changed the users")
+	}
+
+	if err := New("").Save(); err != ErrNoFile {
+		t.Errorf("Save without a file: %v", err)
+	}
+}
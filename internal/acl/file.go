@@ -0,0 +1,88 @@
+package acl
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+//* ACL file *//
+
+// ErrNoFile is returned by Load & Save when the server has no ACL file
+var ErrNoFile = errors.New("This Redis instance is not configured to use an ACL file. You may want to specify users via the ACL SETUSER command and then issue a CONFIG REWRITE (assuming you have a Redis configuration file set) in order to store users in the Redis configuration.")
+
+// Load replaces the users with those of the ACL file, where every line is "user <name> <rules>..."
+// Nothing changes if a line is invalid. The users that exist in both keep their connections, the others are deleted,
+// & the default user stays as it is when the file doesn't define it
+func (a *ACL) Load() error {
+	if a.file == "" {
+		return ErrNoFile
+	}
+
+	content, err := os.ReadFile(a.file)
+	if err != nil {
+		return err
+	}
+
+	loaded := make(map[string]*User)
+	for i, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		if fields[0] != "user" || len(fields) < 2 {
+			return fmt.Errorf("%s:%d: line should start with user keyword", a.file, i+1)
+		}
+		name := fields[1]
+		if _, ok := loaded[name]; ok {
+			return fmt.Errorf("%s:%d: duplicate user '%s' found", a.file, i+1, name)
+		}
+
+		u := newUser(name)
+		for _, rule := range fields[2:] {
+			err := u.apply(rule)
+			if err != nil {
+				return fmt.Errorf("%s:%d: %v", a.file, i+1, &RuleError{Rule: rule, Err: err})
+			}
+		}
+		loaded[name] = u
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := loaded[DefaultUsername]; !ok {
+		loaded[DefaultUsername] = a.users[DefaultUsername].clone()
+	}
+	for name, u := range a.users {
+		if l, ok := loaded[name]; ok {
+			*u = *l
+			loaded[name] = u
+		} else {
+			u.deleted = true
+		}
+	}
+	a.users = loaded
+	return nil
+}
+
+// Save writes the users to the ACL file
+func (a *ACL) Save() error {
+	if a.file == "" {
+		return ErrNoFile
+	}
+
+	a.mu.RLock()
+	content := strings.Join(a.listLocked(), "\n") + "\n"
+	a.mu.RUnlock()
+
+	// The file holds the password digests, so it is only readable by the owner
+	tmp := a.file + ".tmp"
+	err := os.WriteFile(tmp, []byte(content), 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, a.file)
+}
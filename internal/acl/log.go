@@ -0,0 +1,91 @@
+package acl
+
+import "time"
+
+const (
+	// logMaxLen is the number of entries kept in the log, the oldest ones are dropped
+	logMaxLen = 128
+	// logGroupWindow is how long the same denial updates its entry instead of adding a new one
+	logGroupWindow = 60 * time.Second
+)
+
+// Reasons of the entries of the log
+const (
+	ReasonAuth    = "auth"
+	ReasonCommand = "command"
+	ReasonKey     = "key"
+	ReasonChannel = "channel"
+)
+
+// LogEntry is a denied command or a failed authentication, as listed by ACL LOG
+type LogEntry struct {
+	// Count is the number of times it happened within logGroupWindow of each other
+	Count int
+	// Reason is one of the Reason constants, & Object the command, key, channel or username it was about
+	Reason  string
+	Context string
+	Object  string
+	// Username is the user of the client, or the one it tried to authenticate as
+	Username   string
+	ClientInfo string
+
+	ID      int64
+	Created time.Time
+	Updated time.Time
+}
+
+// LogDenied adds a denial to the log
+// It updates the last entry with the same reason, object & user if it is recent enough
+func (a *ACL) LogDenied(reason, context, object, username, clientInfo string) {
+	now := time.Now()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, e := range a.log {
+		if e.Reason == reason && e.Context == context && e.Object == object && e.Username == username &&
+			now.Sub(e.Updated) < logGroupWindow {
+			e.Count++
+			e.Updated = now
+			e.ClientInfo = clientInfo
+			return
+		}
+	}
+
+	a.lastLogID++
+	e := &LogEntry{
+		Count:      1,
+		Reason:     reason,
+		Context:    context,
+		Object:     object,
+		Username:   username,
+		ClientInfo: clientInfo,
+		ID:         a.lastLogID,
+		Created:    now,
+		Updated:    now,
+	}
+	a.log = append([]*LogEntry{e}, a.log...)
+	if len(a.log) > logMaxLen {
+		a.log = a.log[:logMaxLen]
+	}
+}
+
+// Log returns the count most recent entries of the log, the most recent first
+func (a *ACL) Log(count int) []LogEntry {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	entries := make([]LogEntry, 0, min(count, len(a.log)))
+	for _, e := range a.log[:min(count, len(a.log))] {
+		entries = append(entries, *e)
+	}
+	return entries
+}
+
+// ResetLog clears the log
+func (a *ACL) ResetLog() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.log = nil
+}
@@ -0,0 +1,79 @@
+package aof
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/DNahar74/PulseDB/internal/resp"
+)
+
+// Separator is written after every command stored in the AOF
+const Separator = "\n#\n"
+
+// Record is a single command read back from the AOF
+type Record struct {
+	Offset  int64
+	Command resp.Type
+}
+
+// CorruptError reports the first record of the AOF that could not be read
+type CorruptError struct {
+	// Offset is the byte offset where the bad record starts, which is also the size of the valid prefix
+	Offset int64
+	// Truncated is true when the bad record is the incomplete tail of the file (e.g. the process died mid-write)
+	Truncated bool
+	Err       error
+}
+
+func (e *CorruptError) Error() string {
+	if e.Truncated {
+		return fmt.Sprintf("truncated AOF record at offset %d: %v", e.Offset, e.Err)
+	}
+	return fmt.Sprintf("corrupt AOF record at offset %d: %v", e.Offset, e.Err)
+}
+
+func (e *CorruptError) Unwrap() error {
+	return e.Err
+}
+
+// ErrMissingSeparator is the cause of a CorruptError for a tail record that was never terminated
+var ErrMissingSeparator = errors.New("record is not terminated by a separator")
+
+// ErrNotCommand is the cause of a CorruptError for a record that is not an array
+var ErrNotCommand = errors.New("record is not a command")
+
+// Parse reads the AOF content as a stream of commands, each followed by a separator
+// The commands are read by their RESP lengths, so that a value may contain the separator
+// It returns every record before the first bad one, along with a *CorruptError describing the bad record
+func Parse(content string) ([]Record, error) {
+	records := make([]Record, 0)
+	reader := resp.NewReader(strings.NewReader(content))
+	offset := 0
+
+	for offset < len(content) {
+		cmd, n, err := reader.ReadValue()
+		if err != nil {
+			// The file ends in the middle of the record, it was never completely written
+			truncated := errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+			return records, &CorruptError{Offset: int64(offset), Truncated: truncated, Err: err}
+		}
+		if _, ok := cmd.(resp.Array); !ok {
+			return records, &CorruptError{Offset: int64(offset), Err: ErrNotCommand}
+		}
+
+		end := offset + n
+		if !strings.HasPrefix(content[end:], Separator) {
+			// A separator cut short is the end of the file too
+			truncated := strings.HasPrefix(Separator, content[end:])
+			return records, &CorruptError{Offset: int64(offset), Truncated: truncated, Err: ErrMissingSeparator}
+		}
+		_, _ = reader.Discard(len(Separator))
+
+		records = append(records, Record{Offset: int64(offset), Command: cmd})
+		offset = end + len(Separator)
+	}
+
+	return records, nil
+}
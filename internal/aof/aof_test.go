@@ -0,0 +1,103 @@
+package aof
+
+import (
+	"errors"
+	"testing"
+)
+
+const (
+	setCmd  = "*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$1\r\nv\r\n"
+	incrCmd = "*2\r\n$4\r\nINCR\r\n$1\r\nn\r\n"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		wantRecords int
+		wantOffset  int64
+		truncated   bool
+		wantErr     bool
+	}{
+		{
+			name:        "Empty file",
+			input:       "",
+			wantRecords: 0,
+		},
+		{
+			name:        "Valid records",
+			input:       setCmd + Separator + incrCmd + Separator,
+			wantRecords: 2,
+		},
+		{
+			name:        "Value containing the separator",
+			input:       "*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$5\r\na\n#\nb\r\n" + Separator + incrCmd + Separator,
+			wantRecords: 2,
+		},
+		{
+			name:        "Tail without separator",
+			input:       setCmd + Separator + incrCmd,
+			wantRecords: 1,
+			wantOffset:  int64(len(setCmd + Separator)),
+			truncated:   true,
+			wantErr:     true,
+		},
+		{
+			name:        "Partially written tail",
+			input:       setCmd + Separator + "*2\r\n$4\r\nIN",
+			wantRecords: 1,
+			wantOffset:  int64(len(setCmd + Separator)),
+			truncated:   true,
+			wantErr:     true,
+		},
+		{
+			name:        "Partially written separator",
+			input:       setCmd + Separator + incrCmd + "\n#",
+			wantRecords: 1,
+			wantOffset:  int64(len(setCmd + Separator)),
+			truncated:   true,
+			wantErr:     true,
+		},
+		{
+			name:        "Record that is not a command",
+			input:       setCmd + Separator + "+OK\r\n" + Separator,
+			wantRecords: 1,
+			wantOffset:  int64(len(setCmd + Separator)),
+			wantErr:     true,
+		},
+		{
+			name:        "Corrupt record in the middle",
+			input:       setCmd + Separator + "*2\r\n$9\r\nINCR\r\n" + Separator + incrCmd + Separator,
+			wantRecords: 1,
+			wantOffset:  int64(len(setCmd + Separator)),
+			truncated:   false,
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := Parse(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(records) != tt.wantRecords {
+				t.Errorf("Parse() returned %d records, want %d", len(records), tt.wantRecords)
+			}
+			if err == nil {
+				return
+			}
+
+			var cerr *CorruptError
+			if !errors.As(err, &cerr) {
+				t.Fatalf("Parse() error = %T, want *CorruptError", err)
+			}
+			if cerr.Offset != tt.wantOffset {
+				t.Errorf("CorruptError.Offset = %d, want %d", cerr.Offset, tt.wantOffset)
+			}
+			if cerr.Truncated != tt.truncated {
+				t.Errorf("CorruptError.Truncated = %v, want %v", cerr.Truncated, tt.truncated)
+			}
+		})
+	}
+}
@@ -0,0 +1,342 @@
+package cluster
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DNahar74/PulseDB/internal/resp"
+	"github.com/DNahar74/PulseDB/internal/utils"
+)
+
+const busTimeout = time.Second
+
+// message is a packet of the cluster bus
+// Every node sends PINGs to the nodes it knows & answers with a PONG, both carry the slots of the sender & gossip about other nodes
+type message struct {
+	typ          string
+	id           string
+	host         string
+	port         int
+	busPort      int
+	configEpoch  int64
+	currentEpoch int64
+	slots        []int
+	gossip       []*node
+}
+
+const messageFields = 8
+
+func (m *message) encode() []string {
+	argv := []string{
+		m.typ,
+		m.id,
+		m.host,
+		strconv.Itoa(m.port),
+		strconv.Itoa(m.busPort),
+		strconv.FormatInt(m.configEpoch, 10),
+		strconv.FormatInt(m.currentEpoch, 10),
+		formatRanges(m.slots),
+	}
+
+	for _, g := range m.gossip {
+		argv = append(argv, g.id, g.host, strconv.Itoa(g.port), strconv.Itoa(g.busPort))
+	}
+	return argv
+}
+
+var errInvalidMessage = errors.New("invalid cluster bus message")
+
+func decodeMessage(v resp.Type) (*message, error) {
+	arr, ok := v.(resp.Array)
+	if !ok || len(arr.Items) < messageFields || (len(arr.Items)-messageFields)%4 != 0 {
+		return nil, errInvalidMessage
+	}
+
+	argv := make([]string, len(arr.Items))
+	for i, item := range arr.Items {
+		b, ok := item.(resp.BulkString)
+		if !ok {
+			return nil, errInvalidMessage
+		}
+		argv[i] = b.Value
+	}
+
+	m := &message{typ: strings.ToUpper(argv[0]), id: argv[1], host: argv[2]}
+
+	var err error
+	if m.port, err = strconv.Atoi(argv[3]); err != nil {
+		return nil, errInvalidMessage
+	}
+	if m.busPort, err = strconv.Atoi(argv[4]); err != nil {
+		return nil, errInvalidMessage
+	}
+	if m.configEpoch, err = strconv.ParseInt(argv[5], 10, 64); err != nil {
+		return nil, errInvalidMessage
+	}
+	if m.currentEpoch, err = strconv.ParseInt(argv[6], 10, 64); err != nil {
+		return nil, errInvalidMessage
+	}
+	if m.slots, err = parseRanges(argv[7]); err != nil {
+		return nil, errInvalidMessage
+	}
+
+	for i := messageFields; i < len(argv); i += 4 {
+		port, err1 := strconv.Atoi(argv[i+2])
+		busPort, err2 := strconv.Atoi(argv[i+3])
+		if err1 != nil || err2 != nil {
+			return nil, errInvalidMessage
+		}
+		m.gossip = append(m.gossip, &node{id: argv[i], host: argv[i+1], port: port, busPort: busPort})
+	}
+
+	return m, nil
+}
+
+// buildMessageLocked describes this node & the nodes it knows, except the receiver
+func (c *Cluster) buildMessageLocked(typ, receiver string) *message {
+	m := &message{
+		typ:          typ,
+		id:           c.myself.id,
+		host:         c.myself.host,
+		port:         c.myself.port,
+		busPort:      c.myself.busPort,
+		configEpoch:  c.myself.configEpoch,
+		currentEpoch: c.currentEpoch,
+	}
+
+	for slot, owner := range c.slots {
+		if owner == c.myself {
+			m.slots = append(m.slots, slot)
+		}
+	}
+
+	for _, n := range c.nodes {
+		if n.myself || n.id == receiver || n.host == "" {
+			continue
+		}
+		m.gossip = append(m.gossip, &node{id: n.id, host: n.host, port: n.port, busPort: n.busPort})
+	}
+
+	return m
+}
+
+// gossip pings every known node & retries the pending MEETs
+func (c *Cluster) gossip() {
+	ticker := time.NewTicker(c.pingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+		}
+
+		c.mu.Lock()
+		now := time.Now()
+		targets := make(map[string]string)
+		for _, n := range c.nodes {
+			if n.myself || n.host == "" {
+				continue
+			}
+			if n.pingSent.IsZero() {
+				n.pingSent = now
+			}
+			targets[n.busAddr()] = n.id
+		}
+		meets := make([]string, 0, len(c.meets))
+		for addr := range c.meets {
+			meets = append(meets, addr)
+		}
+		c.mu.Unlock()
+
+		for addr, id := range targets {
+			go func() {
+				_ = c.exchange(addr, "PING", id)
+			}()
+		}
+
+		for _, addr := range meets {
+			go func() {
+				if c.exchange(addr, "MEET", "") == nil {
+					c.mu.Lock()
+					delete(c.meets, addr)
+					c.mu.Unlock()
+				}
+			}()
+		}
+	}
+}
+
+// exchange sends a PING or MEET to a node & processes its PONG
+func (c *Cluster) exchange(addr, typ, receiver string) error {
+	conn, err := net.DialTimeout("tcp", addr, busTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(busTimeout))
+
+	c.mu.Lock()
+	c.learnHostLocked(conn.LocalAddr())
+	msg := c.buildMessageLocked(typ, receiver)
+	c.mu.Unlock()
+
+	reply, err := utils.SendCommand(conn, resp.NewReader(conn), msg.encode()...)
+	if err != nil {
+		return err
+	}
+
+	pong, err := decodeMessage(reply)
+	if err != nil {
+		return err
+	}
+
+	c.process(pong, conn.RemoteAddr(), true)
+	return nil
+}
+
+func (c *Cluster) handleBusConnection(conn net.Conn) {
+	defer conn.Close()
+
+	reader := resp.NewReader(conn)
+	for {
+		_ = conn.SetDeadline(time.Now().Add(busTimeout))
+
+		v, _, err := reader.ReadValue()
+		if err != nil {
+			return
+		}
+
+		msg, err := decodeMessage(v)
+		if err != nil {
+			_ = writeReply(conn, resp.SimpleError{Value: err.Error()})
+			return
+		}
+
+		c.mu.Lock()
+		c.learnHostLocked(conn.LocalAddr())
+		_, known := c.nodes[msg.id]
+		c.mu.Unlock()
+
+		// Only a MEET lets an unknown node join, other nodes are learned through gossip
+		c.process(msg, conn.RemoteAddr(), known || msg.typ == "MEET")
+
+		c.mu.Lock()
+		pong := c.buildMessageLocked("PONG", msg.id)
+		c.mu.Unlock()
+
+		if writeReply(conn, encodeReply(pong)) != nil {
+			return
+		}
+	}
+}
+
+func writeReply(conn net.Conn, v resp.Type) error {
+	str, err := v.Serialize()
+	if err != nil {
+		return err
+	}
+	_, err = conn.Write([]byte(str))
+	return err
+}
+
+func encodeReply(m *message) resp.Type {
+	argv := m.encode()
+	items := make([]resp.Type, len(argv))
+	for i, a := range argv {
+		items[i] = resp.BulkString{Value: a, Length: len(a)}
+	}
+	return resp.Array{Length: len(items), Items: items}
+}
+
+// learnHostLocked sets the IP of this node from a bus connection when it was not announced
+func (c *Cluster) learnHostLocked(local net.Addr) {
+	if c.myself.host != "" {
+		return
+	}
+	if tcp, ok := local.(*net.TCPAddr); ok {
+		c.myself.host = tcp.IP.String()
+	}
+}
+
+// process updates the configuration from a message
+// Slots move to the sender when they are unassigned or when the sender has a greater config epoch than their owner
+func (c *Cluster) process(msg *message, remote net.Addr, trusted bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if msg.id == c.myself.id {
+		return
+	}
+
+	changed := false
+	if msg.currentEpoch > c.currentEpoch {
+		c.currentEpoch = msg.currentEpoch
+		changed = true
+	}
+
+	sender, known := c.nodes[msg.id]
+	if !known {
+		if !trusted {
+			return
+		}
+		sender = &node{id: msg.id}
+		c.nodes[msg.id] = sender
+		changed = true
+	}
+
+	host := msg.host
+	if host == "" {
+		if tcp, ok := remote.(*net.TCPAddr); ok {
+			host = tcp.IP.String()
+		}
+	}
+	if sender.host != host || sender.port != msg.port || sender.busPort != msg.busPort || sender.configEpoch != msg.configEpoch {
+		sender.host, sender.port, sender.busPort = host, msg.port, msg.busPort
+		sender.configEpoch = msg.configEpoch
+		changed = true
+	}
+
+	if msg.typ == "PONG" {
+		sender.pongRecv = time.Now()
+		sender.pingSent = time.Time{}
+	}
+
+	for _, slot := range msg.slots {
+		owner := c.slots[slot]
+		if owner == sender || c.importing[slot] != nil {
+			continue
+		}
+		if owner == nil || owner.configEpoch < sender.configEpoch {
+			c.slots[slot] = sender
+			if c.migrating[slot] == sender {
+				c.migrating[slot] = nil
+			}
+			changed = true
+		}
+	}
+
+	// Two nodes can't share a config epoch, the one with the smaller ID moves on
+	if sender.configEpoch == c.myself.configEpoch && c.myself.id < sender.id {
+		c.bumpEpochLocked()
+		changed = true
+	}
+
+	for _, g := range msg.gossip {
+		if g.id == c.myself.id || g.host == "" {
+			continue
+		}
+		if _, ok := c.nodes[g.id]; !ok {
+			c.nodes[g.id] = &node{id: g.id, host: g.host, port: g.port, busPort: g.busPort}
+			changed = true
+		}
+	}
+
+	if changed {
+		_ = c.saveLocked()
+	}
+}
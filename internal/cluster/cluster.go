@@ -0,0 +1,641 @@
+package cluster
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// busPortOffset is added to the client port to get the port of the cluster bus
+	busPortOffset = 10000
+	pingPeriod    = time.Second
+	// DefaultNodeTimeout is how long a node may not answer pings before it is flagged as failing
+	DefaultNodeTimeout = 15 * time.Second
+)
+
+// node is a member of the cluster as seen by this node
+type node struct {
+	id      string
+	host    string
+	port    int
+	busPort int
+
+	configEpoch int64
+	myself      bool
+
+	pingSent time.Time
+	pongRecv time.Time
+}
+
+func (n *node) addr() string {
+	return net.JoinHostPort(n.host, strconv.Itoa(n.port))
+}
+
+func (n *node) busAddr() string {
+	return net.JoinHostPort(n.host, strconv.Itoa(n.busPort))
+}
+
+// Cluster holds the cluster configuration of this node & talks to the other nodes over the cluster bus
+type Cluster struct {
+	mu sync.Mutex
+
+	myself *node
+	nodes  map[string]*node
+
+	// slots maps every slot to the node serving it, nil when unassigned
+	slots [Slots]*node
+	// migrating & importing hold the other end of slots being moved with SETSLOT
+	migrating [Slots]*node
+	importing [Slots]*node
+
+	currentEpoch int64
+
+	// meets are the bus addresses given to CLUSTER MEET that did not answer yet
+	meets map[string]struct{}
+
+	configFile  string
+	pingPeriod  time.Duration
+	nodeTimeout time.Duration
+
+	listener net.Listener
+	stop     chan struct{}
+}
+
+// New creates the cluster state of a node serving clients on port
+// The configuration is loaded from configFile if it exists, otherwise the node starts alone with a new ID
+func New(announceHost string, port int, configFile string) (*Cluster, error) {
+	c := &Cluster{
+		nodes:       make(map[string]*node),
+		meets:       make(map[string]struct{}),
+		configFile:  configFile,
+		pingPeriod:  pingPeriod,
+		nodeTimeout: DefaultNodeTimeout,
+		stop:        make(chan struct{}),
+	}
+
+	loaded, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+
+	if !loaded {
+		c.myself = &node{id: newNodeID(), myself: true}
+		c.nodes[c.myself.id] = c.myself
+	}
+
+	// The address given on the command line wins over the saved one
+	c.myself.port = port
+	c.myself.busPort = port + busPortOffset
+	if announceHost != "" {
+		c.myself.host = announceHost
+	}
+
+	return c, c.save()
+}
+
+func newNodeID() string {
+	b := make([]byte, 20)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// MyID returns the ID of this node
+func (c *Cluster) MyID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.myself.id
+}
+
+// Start listens on the cluster bus & starts gossiping with the other nodes
+// The bus listens on the address the clients are served on, bindHost, so that a node bound to loopback doesn't take
+// gossip from other hosts
+func (c *Cluster) Start(bindHost string) error {
+	listener, err := net.Listen("tcp", net.JoinHostPort(bindHost, strconv.Itoa(c.myself.busPort)))
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.listener = listener
+	c.mu.Unlock()
+
+	fmt.Println("Cluster bus listening on port", c.myself.busPort, "node ID", c.myself.id)
+
+	go c.gossip()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-c.stop:
+				return nil
+			default:
+				return err
+			}
+		}
+
+		go c.handleBusConnection(conn)
+	}
+}
+
+// Close stops the cluster bus
+func (c *Cluster) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	select {
+	case <-c.stop:
+		return nil
+	default:
+	}
+
+	close(c.stop)
+	if c.listener != nil {
+		return c.listener.Close()
+	}
+	return nil
+}
+
+//* Routing *//
+
+// Route tells where the keys of a slot are served
+type Route struct {
+	// Assigned is false when no node serves the slot
+	Assigned bool
+	// Mine is true when this node serves the slot
+	Mine bool
+	// Addr is the client address of the node serving the slot
+	Addr string
+	// MigratingTo is the address of the node the slot is being moved to, when this node is the source
+	MigratingTo string
+	// Importing is true when this node is the target of a migration of the slot
+	Importing bool
+}
+
+// Route returns where the keys of a slot are served
+func (c *Cluster) Route(slot int) Route {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	owner := c.slots[slot]
+	if owner == nil {
+		return Route{Importing: c.importing[slot] != nil}
+	}
+
+	r := Route{Assigned: true, Mine: owner == c.myself, Addr: owner.addr(), Importing: c.importing[slot] != nil}
+	if target := c.migrating[slot]; target != nil {
+		r.MigratingTo = target.addr()
+	}
+	return r
+}
+
+//* Slot management *//
+
+// AddSlots assigns unassigned slots to this node
+func (c *Cluster) AddSlots(slots []int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, slot := range slots {
+		if c.slots[slot] != nil {
+			return fmt.Errorf("Slot %d is already busy", slot)
+		}
+	}
+
+	for _, slot := range slots {
+		c.slots[slot] = c.myself
+		c.importing[slot] = nil
+	}
+
+	return c.saveLocked()
+}
+
+// DelSlots unassigns slots
+func (c *Cluster) DelSlots(slots []int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, slot := range slots {
+		if c.slots[slot] == nil {
+			return fmt.Errorf("Slot %d is already unassigned", slot)
+		}
+	}
+
+	for _, slot := range slots {
+		c.slots[slot] = nil
+		c.migrating[slot] = nil
+		c.importing[slot] = nil
+	}
+
+	return c.saveLocked()
+}
+
+func (c *Cluster) lookupNode(id string) (*node, error) {
+	n, ok := c.nodes[id]
+	if !ok {
+		return nil, fmt.Errorf("I don't know about node %s", id)
+	}
+	return n, nil
+}
+
+// SetSlotMigrating marks a slot of this node as being moved to another node
+func (c *Cluster) SetSlotMigrating(slot int, id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.slots[slot] != c.myself {
+		return fmt.Errorf("I'm not the owner of hash slot %d", slot)
+	}
+	target, err := c.lookupNode(id)
+	if err != nil {
+		return err
+	}
+	if target == c.myself {
+		return errors.New("I'm already the owner of the slot, can't migrate it to myself")
+	}
+
+	c.migrating[slot] = target
+	return c.saveLocked()
+}
+
+// SetSlotImporting marks a slot as being moved to this node from another node
+func (c *Cluster) SetSlotImporting(slot int, id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.slots[slot] == c.myself {
+		return fmt.Errorf("I'm already the owner of hash slot %d", slot)
+	}
+	source, err := c.lookupNode(id)
+	if err != nil {
+		return err
+	}
+	if source == c.myself {
+		return errors.New("Can't import a slot from myself")
+	}
+
+	c.importing[slot] = source
+	return c.saveLocked()
+}
+
+// SetSlotStable cancels the migration of a slot
+func (c *Cluster) SetSlotStable(slot int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.migrating[slot] = nil
+	c.importing[slot] = nil
+	return c.saveLocked()
+}
+
+// SetSlotNode assigns a slot to a node, which ends its migration
+// When this node takes over an imported slot, it bumps its config epoch so that the rest of the cluster accepts the change
+func (c *Cluster) SetSlotNode(slot int, id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n, err := c.lookupNode(id)
+	if err != nil {
+		return err
+	}
+
+	if n != c.myself {
+		c.migrating[slot] = nil
+	}
+
+	if n == c.myself && c.importing[slot] != nil {
+		c.importing[slot] = nil
+		c.bumpEpochLocked()
+	}
+
+	c.slots[slot] = n
+	return c.saveLocked()
+}
+
+// bumpEpochLocked gives this node a config epoch greater than any other
+func (c *Cluster) bumpEpochLocked() {
+	c.currentEpoch++
+	c.myself.configEpoch = c.currentEpoch
+}
+
+// Meet starts a handshake with the node listening on host:busPort, which then joins the cluster
+func (c *Cluster) Meet(host string, port, busPort int) error {
+	if busPort == 0 {
+		busPort = port + busPortOffset
+	}
+	if net.ParseIP(host) == nil {
+		return fmt.Errorf("Invalid node address specified: %s:%d", host, port)
+	}
+
+	c.mu.Lock()
+	c.meets[net.JoinHostPort(host, strconv.Itoa(busPort))] = struct{}{}
+	c.mu.Unlock()
+
+	return nil
+}
+
+//* Introspection *//
+
+// NodeInfo describes a node for CLUSTER NODES, SLOTS & SHARDS
+type NodeInfo struct {
+	ID          string
+	Host        string
+	Port        int
+	BusPort     int
+	Myself      bool
+	Failing     bool
+	ConfigEpoch int64
+	PingSent    time.Time
+	PongRecv    time.Time
+	// Ranges are the inclusive slot ranges served by the node
+	Ranges [][2]int
+}
+
+// Nodes returns every node of the cluster, sorted by ID
+func (c *Cluster) Nodes() []NodeInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.nodesLocked()
+}
+
+func (c *Cluster) nodesLocked() []NodeInfo {
+	owned := make(map[*node][]int)
+	for slot, owner := range c.slots {
+		if owner != nil {
+			owned[owner] = append(owned[owner], slot)
+		}
+	}
+
+	infos := make([]NodeInfo, 0, len(c.nodes))
+	for _, n := range c.nodes {
+		info := NodeInfo{
+			ID:          n.id,
+			Host:        n.host,
+			Port:        n.port,
+			BusPort:     n.busPort,
+			Myself:      n.myself,
+			Failing:     c.failingLocked(n),
+			ConfigEpoch: n.configEpoch,
+			PingSent:    n.pingSent,
+			PongRecv:    n.pongRecv,
+		}
+		for _, r := range toRanges(owned[n]) {
+			info.Ranges = append(info.Ranges, [2]int{r.start, r.end})
+		}
+		infos = append(infos, info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
+
+// failingLocked is true when a node did not answer a ping for longer than the node timeout
+func (c *Cluster) failingLocked(n *node) bool {
+	return !n.myself && !n.pingSent.IsZero() && time.Since(n.pingSent) > c.nodeTimeout
+}
+
+// NodesText returns the configuration in the format of CLUSTER NODES & nodes.conf
+func (c *Cluster) NodesText() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.nodesTextLocked()
+}
+
+func (c *Cluster) nodesTextLocked() string {
+	infos := c.nodesLocked()
+
+	var sb strings.Builder
+	for _, info := range infos {
+		flags := "master"
+		if info.Myself {
+			flags = "myself,master"
+		}
+		if info.Failing {
+			flags += ",fail?"
+		}
+
+		link := "connected"
+		if info.Failing || (!info.Myself && info.PongRecv.IsZero()) {
+			link = "disconnected"
+		}
+
+		fmt.Fprintf(&sb, "%s %s:%d@%d %s - %d %d %d %s", info.ID, info.Host, info.Port, info.BusPort, flags,
+			unixMilli(info.PingSent), unixMilli(info.PongRecv), info.ConfigEpoch, link)
+
+		for _, r := range info.Ranges {
+			sb.WriteString(" " + slotRange{start: r[0], end: r[1]}.String())
+		}
+
+		if info.Myself {
+			for slot := range Slots {
+				if target := c.migrating[slot]; target != nil {
+					fmt.Fprintf(&sb, " [%d->-%s]", slot, target.id)
+				}
+				if source := c.importing[slot]; source != nil {
+					fmt.Fprintf(&sb, " [%d-<-%s]", slot, source.id)
+				}
+			}
+		}
+
+		sb.WriteString("\n")
+	}
+
+	return sb.String()
+}
+
+func unixMilli(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+// Info returns the fields of CLUSTER INFO
+func (c *Cluster) Info() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	assigned := 0
+	failing := 0
+	size := make(map[*node]struct{})
+	for _, owner := range c.slots {
+		if owner == nil {
+			continue
+		}
+		assigned++
+		size[owner] = struct{}{}
+		if c.failingLocked(owner) {
+			failing++
+		}
+	}
+
+	state := "ok"
+	if assigned < Slots {
+		state = "fail"
+	}
+
+	return []string{
+		"cluster_enabled:1",
+		"cluster_state:" + state,
+		fmt.Sprintf("cluster_slots_assigned:%d", assigned),
+		fmt.Sprintf("cluster_slots_ok:%d", assigned-failing),
+		fmt.Sprintf("cluster_slots_pfail:%d", failing),
+		"cluster_slots_fail:0",
+		fmt.Sprintf("cluster_known_nodes:%d", len(c.nodes)),
+		fmt.Sprintf("cluster_size:%d", len(size)),
+		fmt.Sprintf("cluster_current_epoch:%d", c.currentEpoch),
+		fmt.Sprintf("cluster_my_epoch:%d", c.myself.configEpoch),
+	}
+}
+
+//* nodes.conf *//
+
+func (c *Cluster) save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.saveLocked()
+}
+
+// saveLocked writes the configuration to the config file, the caller must hold the lock
+func (c *Cluster) saveLocked() error {
+	if c.configFile == "" {
+		return nil
+	}
+
+	content := c.nodesTextLocked()
+	content += fmt.Sprintf("vars currentEpoch %d lastVoteEpoch 0\n", c.currentEpoch)
+
+	tmp := c.configFile + ".tmp"
+	err := os.WriteFile(tmp, []byte(content), 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.configFile)
+}
+
+// load reads the config file, it returns false if there is no file yet
+func (c *Cluster) load() (bool, error) {
+	if c.configFile == "" {
+		return false, nil
+	}
+
+	content, err := os.ReadFile(c.configFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	type pending struct {
+		slot     int
+		id       string
+		outgoing bool
+	}
+	migrations := make([]pending, 0)
+
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if fields[0] == "vars" {
+			for i := 1; i+1 < len(fields); i += 2 {
+				if fields[i] == "currentEpoch" {
+					c.currentEpoch, _ = strconv.ParseInt(fields[i+1], 10, 64)
+				}
+			}
+			continue
+		}
+
+		if len(fields) < 8 {
+			return false, fmt.Errorf("invalid line in cluster config file: %q", line)
+		}
+
+		n, err := parseNodeAddr(fields[0], fields[1])
+		if err != nil {
+			return false, err
+		}
+		n.configEpoch, _ = strconv.ParseInt(fields[6], 10, 64)
+		if strings.Contains(fields[2], "myself") {
+			n.myself = true
+			c.myself = n
+		}
+		c.nodes[n.id] = n
+
+		for _, s := range fields[8:] {
+			if strings.HasPrefix(s, "[") {
+				s = strings.Trim(s, "[]")
+				if slotStr, id, ok := strings.Cut(s, "->-"); ok {
+					slot, _ := strconv.Atoi(slotStr)
+					migrations = append(migrations, pending{slot: slot, id: id, outgoing: true})
+				} else if slotStr, id, ok := strings.Cut(s, "-<-"); ok {
+					slot, _ := strconv.Atoi(slotStr)
+					migrations = append(migrations, pending{slot: slot, id: id})
+				}
+				continue
+			}
+
+			slots, err := parseRanges(s)
+			if err != nil {
+				return false, err
+			}
+			for _, slot := range slots {
+				c.slots[slot] = n
+			}
+		}
+	}
+
+	if c.myself == nil {
+		return false, errors.New("cluster config file does not contain the myself node")
+	}
+
+	for _, m := range migrations {
+		if n, ok := c.nodes[m.id]; ok && m.slot >= 0 && m.slot < Slots {
+			if m.outgoing {
+				c.migrating[m.slot] = n
+			} else {
+				c.importing[m.slot] = n
+			}
+		}
+	}
+
+	return true, nil
+}
+
+// parseNodeAddr reads a node from the ID & "ip:port@busport" fields of nodes.conf
+func parseNodeAddr(id, addr string) (*node, error) {
+	hostPort, busPortStr, ok := strings.Cut(addr, "@")
+	if !ok {
+		return nil, fmt.Errorf("invalid node address: %s", addr)
+	}
+
+	host, portStr, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, err
+	}
+	busPort, err := strconv.Atoi(strings.Split(busPortStr, ",")[0])
+	if err != nil {
+		return nil, err
+	}
+
+	return &node{id: id, host: host, port: port, busPort: busPort}, nil
+}
@@ -0,0 +1,213 @@
+package cluster
+
+import (
+	"net"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// freePort returns a port whose cluster bus port is free as well
+func freePort(t *testing.T) int {
+	t.Helper()
+
+	for range 100 {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		port := l.Addr().(*net.TCPAddr).Port
+		l.Close()
+
+		if port+busPortOffset > 65535 {
+			continue
+		}
+		bus, err := net.Listen("tcp", ":"+strconv.Itoa(port+busPortOffset))
+		if err != nil {
+			continue
+		}
+		bus.Close()
+		return port
+	}
+
+	t.Fatal("no free port")
+	return 0
+}
+
+func startNode(t *testing.T, dir string) *Cluster {
+	t.Helper()
+
+	port := freePort(t)
+	c, err := New("127.0.0.1", port, filepath.Join(dir, strconv.Itoa(port)+".conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.pingPeriod = 20 * time.Millisecond
+
+	go func() {
+		_ = c.Start("127.0.0.1")
+	}()
+	t.Cleanup(func() { _ = c.Close() })
+
+	return c
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+func owner(c *Cluster, slot int) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.slots[slot] == nil {
+		return ""
+	}
+	return c.slots[slot].id
+}
+
+func TestGossip(t *testing.T) {
+	dir := t.TempDir()
+	nodes := []*Cluster{startNode(t, dir), startNode(t, dir), startNode(t, dir)}
+
+	// Meeting a single node is enough, the others are learned through gossip
+	for _, n := range nodes[1:] {
+		if err := n.Meet("127.0.0.1", nodes[0].myself.port, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := nodes[0].AddSlots([]int{0, 1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := nodes[1].AddSlots([]int{3}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the nodes to know each other & their slots", func() bool {
+		for _, n := range nodes {
+			if len(n.Nodes()) != 3 || owner(n, 0) != nodes[0].MyID() || owner(n, 3) != nodes[1].MyID() {
+				return false
+			}
+		}
+		return true
+	})
+	if err := nodes[1].AddSlots([]int{0}); err == nil {
+		t.Error("ADDSLOTS of a slot served by another node succeeded")
+	}
+
+	waitFor(t, "unique config epochs", func() bool {
+		seen := make(map[int64]bool)
+		for _, info := range nodes[0].Nodes() {
+			if seen[info.ConfigEpoch] {
+				return false
+			}
+			seen[info.ConfigEpoch] = true
+		}
+		return true
+	})
+
+	// Move slot 2 from the first node to the third one
+	source, target := nodes[0], nodes[2]
+	if err := target.SetSlotImporting(2, source.MyID()); err != nil {
+		t.Fatal(err)
+	}
+	if err := source.SetSlotMigrating(2, target.MyID()); err != nil {
+		t.Fatal(err)
+	}
+	if r := source.Route(2); !r.Mine || r.MigratingTo != target.myself.addr() {
+		t.Errorf("source route = %+v", r)
+	}
+	if r := target.Route(2); r.Mine || !r.Importing {
+		t.Errorf("target route = %+v", r)
+	}
+
+	if err := target.SetSlotNode(2, target.MyID()); err != nil {
+		t.Fatal(err)
+	}
+	if err := source.SetSlotNode(2, target.MyID()); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "the slot to move", func() bool {
+		for _, n := range nodes {
+			if owner(n, 2) != target.MyID() {
+				return false
+			}
+		}
+		return true
+	})
+	if r := source.Route(2); r.Mine || r.MigratingTo != "" || r.Addr != target.myself.addr() {
+		t.Errorf("source route after migration = %+v", r)
+	}
+}
+
+func TestConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nodes.conf")
+
+	c, err := New("127.0.0.1", 7000, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AddSlots([]int{0, 1, 2, 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	c.mu.Lock()
+	other := &node{id: newNodeID(), host: "127.0.0.1", port: 7001, busPort: 17001, configEpoch: 3}
+	c.nodes[other.id] = other
+	c.slots[20] = other
+	c.currentEpoch = 5
+	c.mu.Unlock()
+
+	if err := c.SetSlotMigrating(10, other.id); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := New("127.0.0.1", 7000, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.MyID() != c.MyID() {
+		t.Errorf("ID = %s, want %s", loaded.MyID(), c.MyID())
+	}
+	if loaded.currentEpoch != 5 {
+		t.Errorf("currentEpoch = %d, want 5", loaded.currentEpoch)
+	}
+	if owner(loaded, 1) != c.MyID() || owner(loaded, 20) != other.id || owner(loaded, 3) != "" {
+		t.Error("slots were not restored")
+	}
+	if r := loaded.Route(10); r.MigratingTo != "127.0.0.1:7001" {
+		t.Errorf("migration was not restored: %+v", r)
+	}
+	if loaded.NodesText() != c.NodesText() {
+		t.Errorf("NodesText() =\n%s\nwant\n%s", loaded.NodesText(), c.NodesText())
+	}
+}
+
+func TestBusBind(t *testing.T) {
+	c := startNode(t, t.TempDir())
+
+	// The bus of a node bound to loopback is only reachable from the same host
+	waitFor(t, "the bus to listen", func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.listener != nil
+	})
+	c.mu.Lock()
+	addr := c.listener.Addr().(*net.TCPAddr)
+	c.mu.Unlock()
+	if !addr.IP.IsLoopback() || addr.Port != c.myself.busPort {
+		t.Errorf("the bus listens on %v", addr)
+	}
+}
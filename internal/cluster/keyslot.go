@@ -0,0 +1,120 @@
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Slots is the number of hash slots the keyspace is split into
+const Slots = 16384
+
+// crc16Table is the lookup table of the CRC16-CCITT (XMODEM) polynomial 0x1021, used by Redis for key slots
+var crc16Table = func() [256]uint16 {
+	var table [256]uint16
+	for i := range table {
+		crc := uint16(i) << 8
+		for range 8 {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}()
+
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^s[i]]
+	}
+	return crc
+}
+
+// KeySlot returns the hash slot of a key
+// Only the part between the first { and the next } is hashed when it is not empty, so that related keys share a slot
+func KeySlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start != -1 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16(key)) & (Slots - 1)
+}
+
+// ParseSlot parses a slot number given as a command argument
+func ParseSlot(s string) (int, error) {
+	slot, err := strconv.Atoi(s)
+	if err != nil || slot < 0 || slot >= Slots {
+		return 0, errors.New("Invalid or out of range slot")
+	}
+	return slot, nil
+}
+
+// slotRange is an inclusive range of slots
+type slotRange struct {
+	start, end int
+}
+
+func (r slotRange) String() string {
+	if r.start == r.end {
+		return strconv.Itoa(r.start)
+	}
+	return fmt.Sprintf("%d-%d", r.start, r.end)
+}
+
+// toRanges groups sorted slots into ranges
+func toRanges(slots []int) []slotRange {
+	sort.Ints(slots)
+
+	ranges := make([]slotRange, 0)
+	for _, s := range slots {
+		if n := len(ranges); n > 0 && ranges[n-1].end == s-1 {
+			ranges[n-1].end = s
+			continue
+		}
+		ranges = append(ranges, slotRange{start: s, end: s})
+	}
+	return ranges
+}
+
+// formatRanges returns slots as "0-5460,5462" for the cluster bus & nodes.conf
+func formatRanges(slots []int) string {
+	parts := make([]string, 0)
+	for _, r := range toRanges(slots) {
+		parts = append(parts, r.String())
+	}
+	return strings.Join(parts, ",")
+}
+
+// parseRanges reads slots written by formatRanges, or space separated by nodes.conf
+func parseRanges(s string) ([]int, error) {
+	slots := make([]int, 0)
+
+	for _, part := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' }) {
+		startStr, endStr, isRange := strings.Cut(part, "-")
+		if !isRange {
+			endStr = startStr
+		}
+
+		start, err := ParseSlot(startStr)
+		if err != nil {
+			return nil, err
+		}
+		end, err := ParseSlot(endStr)
+		if err != nil {
+			return nil, err
+		}
+
+		for slot := start; slot <= end; slot++ {
+			slots = append(slots, slot)
+		}
+	}
+
+	return slots, nil
+}
@@ -0,0 +1,51 @@
+package cluster
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKeySlot(t *testing.T) {
+	tests := []struct {
+		key  string
+		want int
+	}{
+		{key: "123456789", want: 12739},
+		{key: "foo", want: 12182},
+		{key: "somekey", want: 11058},
+		{key: "{user1000}.following", want: KeySlot("user1000")},
+		{key: "{user1000}.followers", want: KeySlot("user1000")},
+		{key: "foo{}{bar}", want: KeySlot("foo{}{bar}")},
+		{key: "foo{{bar}}zap", want: KeySlot("{bar")},
+		{key: "foo{bar}{zap}", want: KeySlot("bar")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := KeySlot(tt.key); got != tt.want {
+				t.Errorf("KeySlot(%q) = %d, want %d", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRanges(t *testing.T) {
+	slots := []int{5, 0, 1, 2, 7, 6, 100}
+
+	str := formatRanges(slots)
+	if str != "0-2,5-7,100" {
+		t.Errorf("formatRanges() = %q, want %q", str, "0-2,5-7,100")
+	}
+
+	got, err := parseRanges(str)
+	if err != nil {
+		t.Fatalf("parseRanges() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, []int{0, 1, 2, 5, 6, 7, 100}) {
+		t.Errorf("parseRanges() = %v", got)
+	}
+
+	if _, err := parseRanges("0-16384"); err == nil {
+		t.Errorf("parseRanges() accepted an out of range slot")
+	}
+}
@@ -0,0 +1,262 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DNahar74/PulseDB/internal/acl"
+	"github.com/DNahar74/PulseDB/internal/resp"
+)
+
+// aclCategories maps the ACL categories to the flag of their commands
+var aclCategories = []struct {
+	name string
+	flag int
+}{
+	{name: "keyspace", flag: flagKeyspace},
+	{name: "read", flag: flagReadOnly},
+	{name: "write", flag: flagWrite},
+	{name: "string", flag: flagString},
+	{name: "bitmap", flag: flagBitmap},
+	{name: "hyperloglog", flag: flagHyperLogLog},
+	{name: "geo", flag: flagGeo},
+	{name: "hash", flag: flagHash},
+	{name: "admin", flag: flagAdmin},
+	{name: "dangerous", flag: flagDangerous},
+	{name: "connection", flag: flagConnection},
+}
+
+// registerACLCommands makes the commands of the registry & their categories known to the ACL rules
+func registerACLCommands() {
+	for _, cs := range commandTable {
+		cats := make([]string, 0)
+		for _, c := range aclCategories {
+			if cs.is(c.flag) {
+				cats = append(cats, c.name)
+			}
+		}
+		acl.RegisterCommand(cs.name, cats...)
+	}
+}
+
+// Authorize checks that the client of a session may run a command the server handles itself
+func Authorize(sess *Session, commands resp.Type) error {
+	str, ok := commands.(resp.Array)
+	if !ok {
+		return errors.New("invalid datatype")
+	}
+	cmd, argv, err := parseCommand(str)
+	if err != nil {
+		return err
+	}
+	return authorize(sess, cmd, argv)
+}
+
+// authorize checks that the client of a session is authenticated & that its user can run a command on its keys
+// The denials are recorded in the ACL log
+func authorize(sess *Session, cmd *commandSpec, argv []string) error {
+	// AUTH & HELLO are allowed to every user, so that a client can switch to another one
+	if cmd.is(flagNoAuth) {
+		return nil
+	}
+	if !sess.Authenticated() {
+		return errNoAuth
+	}
+
+	firstArg := ""
+	if len(argv) > 1 {
+		firstArg = argv[1]
+	}
+	if !accessControl().CanRun(sess.user, cmd.name, firstArg) {
+		accessControl().LogDenied(acl.ReasonCommand, "toplevel", cmd.name, sess.user.Name(), sess.clientInfo())
+		return fmt.Errorf("NOPERM User %s has no permissions to run the '%s' command", sess.user.Name(), cmd.name)
+	}
+
+	keys, perm := aclKeys(cmd, argv)
+	for _, key := range keys {
+		if !accessControl().CanAccessKey(sess.user, key, perm) {
+			accessControl().LogDenied(acl.ReasonKey, "toplevel", key, sess.user.Name(), sess.clientInfo())
+			return errors.New("NOPERM No permissions to access a key")
+		}
+	}
+	return nil
+}
+
+// aclKeys returns the keys of a command checked against the key patterns of the user, & the permissions it needs on them
+// Read-only commands need to read their keys & write commands to write them, & to read them too when they return
+// data of their keys
+func aclKeys(cmd *commandSpec, argv []string) ([]string, acl.Perm) {
+	keys := cmd.keys(argv)
+	var perm acl.Perm
+	if cmd.is(flagReadOnly) {
+		perm |= acl.PermRead
+	}
+	if cmd.is(flagWrite) {
+		perm |= acl.PermWrite
+		if cmd.is(flagKeyAccess) {
+			perm |= acl.PermRead
+		}
+	}
+
+	switch cmd.name {
+	case "set":
+		// SET returns the old value with GET
+		for _, a := range argv[3:] {
+			if strings.EqualFold(a, "GET") {
+				perm |= acl.PermRead
+			}
+		}
+	case "migrate":
+		// The keys of MIGRATE are not at a fixed position, so that the registry doesn't give them for routing
+		keys = []string{argv[3]}
+		for i, a := range argv[6:] {
+			if strings.EqualFold(a, "KEYS") {
+				keys = argv[6+i+1:]
+				break
+			}
+		}
+	}
+	return keys, perm
+}
+
+// handleSYNC is never called, the server handles the replication handshake & MONITOR on the connection itself
+// PSYNC, SYNC, REPLCONF & MONITOR are registered for their ACL categories
+func handleSYNC(c *call) (resp.Type, error) {
+	return nil, fmt.Errorf("%s is only accepted on a client connection", strings.ToUpper(c.cmd.name))
+}
+
+func handleACL(c *call) (resp.Type, error) {
+	sub, args := strings.ToUpper(c.args[0]), c.args[1:]
+	switch sub {
+	case "SETUSER":
+		if len(args) < 1 {
+			return nil, errors.New("wrong number of arguments for 'acl|setuser' command")
+		}
+		if strings.ContainsAny(args[0], " \x00") {
+			return nil, errors.New("Usernames can't contain spaces or null characters")
+		}
+		err := accessControl().SetUser(args[0], args[1:])
+		if err != nil {
+			return nil, err
+		}
+		return resp.SimpleString{Value: "OK"}, nil
+	case "GETUSER":
+		if len(args) != 1 {
+			return nil, errors.New("wrong number of arguments for 'acl|getuser' command")
+		}
+		return aclGetUser(args[0]), nil
+	case "DELUSER":
+		if len(args) < 1 {
+			return nil, errors.New("wrong number of arguments for 'acl|deluser' command")
+		}
+		deleted, err := accessControl().DeleteUsers(args...)
+		if err != nil {
+			return nil, err
+		}
+		return resp.Integer{Value: deleted}, nil
+	case "LIST", "USERS":
+		if len(args) != 0 {
+			return nil, fmt.Errorf("wrong number of arguments for 'acl|%s' command", strings.ToLower(sub))
+		}
+		lines := accessControl().List()
+		if sub == "USERS" {
+			lines = accessControl().Usernames()
+		}
+		return bulkStrings(lines), nil
+	case "WHOAMI":
+		if len(args) != 0 {
+			return nil, errors.New("wrong number of arguments for 'acl|whoami' command")
+		}
+		return bulkString(c.session.user.Name()), nil
+	case "CAT":
+		if len(args) > 1 {
+			return nil, errors.New("wrong number of arguments for 'acl|cat' command")
+		}
+		if len(args) == 0 {
+			return bulkStrings(acl.Categories()), nil
+		}
+		names, ok := acl.CategoryCommands(args[0])
+		if !ok {
+			return nil, fmt.Errorf("Unknown category '%s'", args[0])
+		}
+		return bulkStrings(names), nil
+	case "LOG":
+		return aclLog(args)
+	case "LOAD", "SAVE":
+		if len(args) != 0 {
+			return nil, fmt.Errorf("wrong number of arguments for 'acl|%s' command", strings.ToLower(sub))
+		}
+		var err error
+		if sub == "LOAD" {
+			err = accessControl().Load()
+		} else {
+			err = accessControl().Save()
+		}
+		if err != nil {
+			return nil, err
+		}
+		return resp.SimpleString{Value: "OK"}, nil
+	default:
+		return nil, fmt.Errorf("unknown subcommand '%s'. Try ACL HELP.", c.args[0])
+	}
+}
+
+func aclGetUser(name string) resp.Type {
+	info, ok := accessControl().GetUser(name)
+	if !ok {
+		return resp.Null{}
+	}
+
+	items := []resp.Type{
+		bulkString("flags"), bulkStrings(info.Flags),
+		bulkString("passwords"), bulkStrings(info.Passwords),
+		bulkString("commands"), bulkString(info.Commands),
+		bulkString("keys"), bulkString(info.Keys),
+		bulkString("channels"), bulkString(info.Channels),
+		bulkString("selectors"), resp.Array{Length: 0, Items: []resp.Type{}},
+	}
+	return resp.Array{Length: len(items), Items: items}
+}
+
+// aclLog handles ACL LOG [count | RESET], the entries are listed from the most recent
+func aclLog(args []string) (resp.Type, error) {
+	if len(args) > 1 {
+		return nil, errors.New("wrong number of arguments for 'acl|log' command")
+	}
+
+	count := 10
+	if len(args) == 1 {
+		if strings.EqualFold(args[0], "RESET") {
+			accessControl().ResetLog()
+			return resp.SimpleString{Value: "OK"}, nil
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 0 {
+			return nil, errors.New("value is out of range, must be positive")
+		}
+		count = n
+	}
+
+	now := time.Now()
+	entries := accessControl().Log(count)
+	items := make([]resp.Type, len(entries))
+	for i, e := range entries {
+		fields := []resp.Type{
+			bulkString("count"), resp.Integer{Value: e.Count},
+			bulkString("reason"), bulkString(e.Reason),
+			bulkString("context"), bulkString(e.Context),
+			bulkString("object"), bulkString(e.Object),
+			bulkString("username"), bulkString(e.Username),
+			bulkString("age-seconds"), bulkString(strconv.FormatFloat(now.Sub(e.Created).Seconds(), 'f', 3, 64)),
+			bulkString("client-info"), bulkString(e.ClientInfo),
+			bulkString("entry-id"), resp.Integer{Value: int(e.ID)},
+			bulkString("timestamp-created"), resp.Integer{Value: int(e.Created.UnixMilli())},
+			bulkString("timestamp-last-updated"), resp.Integer{Value: int(e.Updated.UnixMilli())},
+		}
+		items[i] = resp.Array{Length: len(fields), Items: fields}
+	}
+	return resp.Array{Length: len(items), Items: items}, nil
+}
@@ -0,0 +1,141 @@
+package command
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/DNahar74/PulseDB/internal/acl"
+	"github.com/DNahar74/PulseDB/internal/resp"
+	"github.com/DNahar74/PulseDB/internal/store"
+)
+
+func TestACLPermissions(t *testing.T) {
+	d := store.CreateDatabases(1)
+	InitDatabases(d)
+	InitACL(acl.New(""))
+	t.Cleanup(func() { InitACL(acl.New("")) })
+
+	admin := NewSession()
+	run(t, admin, "SET", "stats:daily", "42")
+	run(t, admin, "SET", "users:1", "alice")
+	run(t, admin, "ACL", "SETUSER", "analytics", "on", ">pw", "+@read", "-keys", "%R~stats:*", "+acl|whoami")
+
+	sess := NewSession()
+	run(t, sess, "AUTH", "analytics", "pw")
+	if reply := run(t, sess, "ACL", "WHOAMI"); reply != bulkString("analytics") {
+		t.Errorf("ACL WHOAMI = %v", reply)
+	}
+	if reply := run(t, sess, "GET", "stats:daily"); reply != bulkString("42") {
+		t.Errorf("GET = %v", reply)
+	}
+	run(t, sess, "MGET", "stats:a", "stats:b")
+
+	for _, tt := range []struct {
+		args    []string
+		wantErr string
+	}{
+		{args: []string{"SET", "stats:daily", "0"}, wantErr: "NOPERM User analytics has no permissions to run the 'set' command"},
+		{args: []string{"KEYS", "*"}, wantErr: "NOPERM User analytics has no permissions to run the 'keys' command"},
+		{args: []string{"ACL", "LIST"}, wantErr: "NOPERM User analytics has no permissions to run the 'acl' command"},
+		{args: []string{"GET", "users:1"}, wantErr: "NOPERM No permissions to access a key"},
+		{args: []string{"MGET", "stats:a", "users:1"}, wantErr: "NOPERM No permissions to access a key"},
+	} {
+		_, err := HandleCommands(sess, newCommand(tt.args...))
+		if err == nil || err.Error() != tt.wantErr {
+			t.Errorf("%v: error %v, want %q", tt.args, err, tt.wantErr)
+		}
+	}
+
+	// Write permissions alone don't allow the commands that return the data of their keys
+	run(t, admin, "ACL", "SETUSER", "writer", "on", "nopass", "+@all", "%W~jobs:*")
+	run(t, sess, "AUTH", "writer", "")
+	run(t, sess, "SET", "jobs:1", "queued")
+	run(t, sess, "DEL", "jobs:1")
+	for _, args := range [][]string{{"GET", "jobs:1"}, {"GETSET", "jobs:1", "x"}, {"SET", "jobs:1", "x", "GET"}, {"INCR", "jobs:2"}} {
+		if _, err := HandleCommands(sess, newCommand(args...)); err == nil || err.Error() != "NOPERM No permissions to access a key" {
+			t.Errorf("%v: %v", args, err)
+		}
+	}
+
+	// The changes apply to the connections of the user
+	run(t, admin, "ACL", "SETUSER", "writer", "-set")
+	if _, err := HandleCommands(sess, newCommand("SET", "jobs:1", "x")); err == nil {
+		t.Error("SET succeeded after it was denied")
+	}
+	run(t, admin, "ACL", "DELUSER", "writer")
+	if _, err := HandleCommands(sess, newCommand("DEL", "jobs:1")); err == nil || err.Error() != "NOAUTH Authentication required." {
+		t.Errorf("DEL by a deleted user: %v", err)
+	}
+
+	entries, ok := run(t, admin, "ACL", "LOG").(resp.Array)
+	if !ok || entries.Length == 0 {
+		t.Fatalf("ACL LOG = %v", entries)
+	}
+	last := entries.Items[0].(resp.Array)
+	if last.Items[2] != bulkString("reason") || last.Items[3] != bulkString("command") || last.Items[7] != bulkString("set") {
+		t.Errorf("last ACL LOG entry = %v", last)
+	}
+}
+
+func TestACLCommand(t *testing.T) {
+	d := store.CreateDatabases(1)
+	InitDatabases(d)
+	InitACL(acl.New(""))
+	t.Cleanup(func() { InitACL(acl.New("")) })
+
+	sess := NewSession()
+	if reply := run(t, sess, "ACL", "WHOAMI"); reply != bulkString("default") {
+		t.Errorf("ACL WHOAMI = %v", reply)
+	}
+
+	_, err := HandleCommands(sess, newCommand("ACL", "SETUSER", "alice", "on", "+get", "~cache:*", "+bogus"))
+	if err == nil || err.Error() != "Error in ACL SETUSER modifier '+bogus': Unknown command or category name in ACL" {
+		t.Errorf("ACL SETUSER with an invalid rule: %v", err)
+	}
+	if reply := run(t, sess, "ACL", "GETUSER", "alice"); reply != (resp.Null{}) {
+		t.Errorf("ACL GETUSER of a user that failed to be created = %v", reply)
+	}
+
+	run(t, sess, "ACL", "SETUSER", "alice", "on", ">pw", "+@hash", "+get", "~cache:*")
+	user := run(t, sess, "ACL", "GETUSER", "alice").(resp.Array)
+	if user.Items[5] != bulkString("-@all +@hash +get") || user.Items[7] != bulkString("~cache:*") {
+		t.Errorf("ACL GETUSER = %v", user)
+	}
+
+	list := run(t, sess, "ACL", "LIST").(resp.Array)
+	if list.Length != 2 || !strings.HasPrefix(list.Items[0].(resp.BulkString).Value, "user alice on #") {
+		t.Errorf("ACL LIST = %v", list)
+	}
+	if names := keyNames(run(t, sess, "ACL", "USERS")); strings.Join(names, " ") != "alice default" {
+		t.Errorf("ACL USERS = %v", names)
+	}
+
+	hash := run(t, sess, "ACL", "CAT", "hash").(resp.Array)
+	if hash.Length != 17 {
+		t.Errorf("ACL CAT hash has %d commands", hash.Length)
+	}
+	if _, err := HandleCommands(sess, newCommand("ACL", "CAT", "nope")); err == nil {
+		t.Error("ACL CAT of an unknown category succeeded")
+	}
+
+	if _, err := HandleCommands(sess, newCommand("ACL", "DELUSER", "default")); err == nil {
+		t.Error("ACL DELUSER default succeeded")
+	}
+	if reply := run(t, sess, "ACL", "DELUSER", "alice", "nobody"); reply != (resp.Integer{Value: 1}) {
+		t.Errorf("ACL DELUSER = %v", reply)
+	}
+
+	if _, err := HandleCommands(sess, newCommand("ACL", "SAVE")); err == nil || !strings.HasPrefix(err.Error(), "This Redis instance is not configured to use an ACL file") {
+		t.Errorf("ACL SAVE without a file: %v", err)
+	}
+
+	_, _ = HandleCommands(NewSession(), newCommand("AUTH", "alice", "wrong"))
+	entry := run(t, sess, "ACL", "LOG", "1").(resp.Array).Items[0].(resp.Array)
+	if entry.Items[3] != bulkString("auth") || entry.Items[9] != bulkString("alice") {
+		t.Errorf("ACL LOG entry of a failed AUTH = %v", entry)
+	}
+	run(t, sess, "ACL", "LOG", "RESET")
+	if reply := run(t, sess, "ACL", "LOG"); reply.(resp.Array).Length != 0 {
+		t.Errorf("ACL LOG after RESET = %v", reply)
+	}
+}
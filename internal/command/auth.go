@@ -0,0 +1,174 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/DNahar74/PulseDB/internal/acl"
+	"github.com/DNahar74/PulseDB/internal/resp"
+)
+
+// redisVersion is the version of Redis whose commands are implemented, given to the clients by HELLO
+const redisVersion = "7.4.0"
+
+var (
+	errNoAuth    = errors.New("NOAUTH Authentication required.")
+	errWrongPass = errors.New("WRONGPASS invalid username-password pair or user is disabled.")
+)
+
+var (
+	aclHandle handle[*acl.ACL]
+	// defaultACL is used until the server passes its own users, its default user is allowed to run everything without a
+	// password
+	defaultACL = acl.New("")
+)
+
+// accessControl returns the users
+func accessControl() *acl.ACL {
+	if a := aclHandle.get(); a != nil {
+		return a
+	}
+	return defaultACL
+}
+
+// InitACL passes the server's users for access in this package
+func InitACL(a *acl.ACL) {
+	aclHandle.set(a)
+}
+
+// Authenticated reports whether the client of a session may run commands other than AUTH & HELLO
+// The connections of a deleted user must authenticate again
+func (s *Session) Authenticated() bool {
+	return accessControl().Valid(s.user) && (s.authenticated || !accessControl().AuthRequired())
+}
+
+// SetAddr records the address of the client of a session, which identifies it in the ACL log
+func (s *Session) SetAddr(addr string) {
+	s.addr = addr
+}
+
+// clientInfo describes the client of a session in the ACL log
+func (s *Session) clientInfo() string {
+	return fmt.Sprintf("id=%d addr=%s user=%s db=%d", s.id, s.addr, s.user.Name(), s.db)
+}
+
+// authenticate checks the credentials of AUTH & HELLO & makes the session use the user
+func authenticate(sess *Session, username, password string) error {
+	u, ok := accessControl().Authenticate(username, password)
+	if !ok {
+		accessControl().LogDenied(acl.ReasonAuth, "toplevel", "AUTH", username, sess.clientInfo())
+		return errWrongPass
+	}
+	sess.user = u
+	sess.authenticated = true
+	return nil
+}
+
+// AuthenticateAs makes a session use an enabled user without its password, & reports whether the user exists
+func (s *Session) AuthenticateAs(username string) bool {
+	u, ok := accessControl().Lookup(username)
+	if !ok {
+		return false
+	}
+	s.user = u
+	s.authenticated = true
+	return true
+}
+
+// validClientName checks a name given with HELLO SETNAME, which must not contain spaces or special characters
+func validClientName(name string) error {
+	for i := 0; i < len(name); i++ {
+		if name[i] < '!' || name[i] > '~' {
+			return errors.New("Client names cannot contain spaces, newlines or special characters.")
+		}
+	}
+	return nil
+}
+
+func handleAUTH(c *call) (resp.Type, error) {
+	if len(c.args) > 2 {
+		return nil, errors.New("syntax error")
+	}
+
+	username, password := acl.DefaultUsername, c.args[0]
+	if len(c.args) == 2 {
+		username, password = c.args[0], c.args[1]
+	} else if !accessControl().AuthRequired() {
+		return nil, errors.New("AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?")
+	}
+
+	err := authenticate(c.session, username, password)
+	if err != nil {
+		return nil, err
+	}
+	return resp.SimpleString{Value: "OK"}, nil
+}
+
+// handleHELLO only speaks RESP2, it authenticates the client & describes the server
+func handleHELLO(c *call) (resp.Type, error) {
+	if len(c.args) > 0 {
+		proto, err := strconv.Atoi(c.args[0])
+		if err != nil {
+			return nil, errors.New("Protocol version is not an integer or out of range")
+		}
+		if proto != 2 {
+			return nil, errors.New("NOPROTO unsupported protocol version")
+		}
+	}
+
+	var username, password, name string
+	auth, setName := false, false
+	for i := 1; i < len(c.args); i++ {
+		if strings.EqualFold(c.args[i], "AUTH") && i+2 < len(c.args) {
+			username, password = c.args[i+1], c.args[i+2]
+			auth = true
+			i += 2
+			continue
+		}
+		if strings.EqualFold(c.args[i], "SETNAME") && i+1 < len(c.args) {
+			name = c.args[i+1]
+			setName = true
+			i++
+			continue
+		}
+		return nil, errors.New("Syntax error in HELLO option '" + c.args[i] + "'")
+	}
+
+	if auth {
+		err := authenticate(c.session, username, password)
+		if err != nil {
+			return nil, err
+		}
+	} else if !c.session.Authenticated() {
+		return nil, errors.New("NOAUTH HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time")
+	}
+	if setName {
+		err := validClientName(name)
+		if err != nil {
+			return nil, err
+		}
+		c.session.name = name
+	}
+
+	mode := "standalone"
+	if clusterState() != nil {
+		mode = "cluster"
+	}
+	role := "master"
+	if replication() != nil && replication().IsReplica() {
+		role = "replica"
+	}
+
+	fields := []resp.Type{
+		bulkString("server"), bulkString("redis"),
+		bulkString("version"), bulkString(redisVersion),
+		bulkString("proto"), resp.Integer{Value: 2},
+		bulkString("id"), resp.Integer{Value: int(c.session.id)},
+		bulkString("mode"), bulkString(mode),
+		bulkString("role"), bulkString(role),
+		bulkString("modules"), resp.Array{Length: 0, Items: []resp.Type{}},
+	}
+	return resp.Array{Length: len(fields), Items: fields}, nil
+}
@@ -0,0 +1,106 @@
+package command
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/DNahar74/PulseDB/internal/acl"
+	"github.com/DNahar74/PulseDB/internal/resp"
+	"github.com/DNahar74/PulseDB/internal/store"
+)
+
+// requirePass gives the test new users whose default user has a password
+func requirePass(t *testing.T, password string) *acl.ACL {
+	t.Helper()
+
+	users := acl.New("")
+	users.SetRequirePass(password)
+	InitACL(users)
+	t.Cleanup(func() { InitACL(acl.New("")) })
+	return users
+}
+
+func TestAuth(t *testing.T) {
+	d := store.CreateDatabases(1)
+	InitDatabases(d)
+
+	if _, err := HandleCommands(NewSession(), newCommand("AUTH", "secret")); err == nil {
+		t.Error("AUTH without requirepass succeeded")
+	}
+
+	// A connection made before the password is set stays authenticated
+	before := NewSession()
+	users := requirePass(t, "secret")
+	run(t, before, "SET", "key", "value")
+
+	sess := NewSession()
+	for _, args := range [][]string{{"GET", "key"}, {"PING"}, {"HELLO", "2"}} {
+		_, err := HandleCommands(sess, newCommand(args...))
+		if err == nil || !strings.HasPrefix(err.Error(), "NOAUTH ") {
+			t.Errorf("%v before AUTH: %v", args, err)
+		}
+	}
+
+	for _, args := range [][]string{{"AUTH", "wrong"}, {"AUTH", "secre"}, {"AUTH", "admin", "secret"}} {
+		_, err := HandleCommands(sess, newCommand(args...))
+		if err == nil || err.Error() != "WRONGPASS invalid username-password pair or user is disabled." {
+			t.Errorf("%v: %v", args, err)
+		}
+	}
+	if _, err := HandleCommands(sess, newCommand("GET", "key")); err == nil {
+		t.Error("GET succeeded after a failed AUTH")
+	}
+
+	if reply := run(t, sess, "AUTH", "secret"); reply != (resp.SimpleString{Value: "OK"}) {
+		t.Errorf("AUTH = %v", reply)
+	}
+	if reply := run(t, sess, "GET", "key"); reply != bulkString("value") {
+		t.Errorf("GET = %v", reply)
+	}
+
+	other := NewSession()
+	run(t, other, "AUTH", "default", "secret")
+	run(t, other, "GET", "key")
+
+	// Removing the password lets the connections that never authenticated in
+	users.SetRequirePass("")
+	run(t, NewSession(), "GET", "key")
+}
+
+func TestHello(t *testing.T) {
+	d := store.CreateDatabases(1)
+	InitDatabases(d)
+	requirePass(t, "secret")
+
+	sess := NewSession()
+	for _, tt := range []struct {
+		args    []string
+		wantErr string
+	}{
+		{args: []string{"HELLO", "3"}, wantErr: "NOPROTO unsupported protocol version"},
+		{args: []string{"HELLO", "two"}, wantErr: "Protocol version is not an integer or out of range"},
+		{args: []string{"HELLO", "2", "AUTH", "default"}, wantErr: "Syntax error in HELLO option 'AUTH'"},
+		{args: []string{"HELLO", "2", "AUTH", "default", "wrong"}, wantErr: "WRONGPASS invalid username-password pair or user is disabled."},
+	} {
+		_, err := HandleCommands(sess, newCommand(tt.args...))
+		if err == nil || err.Error() != tt.wantErr {
+			t.Errorf("%v: error %v, want %q", tt.args, err, tt.wantErr)
+		}
+	}
+	if _, err := HandleCommands(sess, newCommand("HELLO")); err == nil {
+		t.Error("HELLO without AUTH succeeded")
+	}
+
+	reply, ok := run(t, sess, "HELLO", "2", "AUTH", "default", "secret").(resp.Array)
+	if !ok || reply.Length != 14 {
+		t.Fatalf("HELLO = %v", reply)
+	}
+	if reply.Items[4] != bulkString("proto") || reply.Items[5] != (resp.Integer{Value: 2}) {
+		t.Errorf("HELLO proto = %v %v", reply.Items[4], reply.Items[5])
+	}
+	if reply.Items[7] != (resp.Integer{Value: int(sess.id)}) {
+		t.Errorf("HELLO id = %v, want %d", reply.Items[7], sess.id)
+	}
+	run(t, sess, "PING")
+	run(t, sess, "HELLO")
+}
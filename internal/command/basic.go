@@ -5,87 +5,80 @@ package command
 import (
 	"errors"
 	"fmt"
+	"math"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/DNahar74/PulseDB/internal/resp"
 	"github.com/DNahar74/PulseDB/internal/store"
 )
 
-func handlePING() resp.Type {
-	return resp.SimpleString{Value: "PONG"}
-}
-
-func handleECHO(value resp.Type) (resp.Type, error) {
-	if cmd, ok := value.(resp.BulkString); ok {
-		return resp.BulkString{Value: cmd.Value, Length: len(cmd.Value)}, nil
+func handlePING(c *call) (resp.Type, error) {
+	if len(c.args) > 1 {
+		return nil, fmt.Errorf("wrong number of arguments for '%s' command", c.cmd.name)
+	} else if len(c.args) == 1 {
+		return resp.BulkString{Value: c.args[0], Length: len(c.args[0])}, nil
 	}
-
-	return nil, errors.New("invalid input type")
+	return resp.SimpleString{Value: "PONG"}, nil
 }
 
-func handleSET(k, v resp.Type, specs ...resp.Type) (resp.Type, error) {
-	key, ok := k.(resp.BulkString)
-	if !ok {
-		return nil, errors.New("invalid key type")
-	}
-
-	_, err := strconv.Atoi(key.Value)
-	if err == nil {
-		return nil, errors.New("key cannot be a number")
-	}
+func handleECHO(c *call) (resp.Type, error) {
+	return resp.BulkString{Value: c.args[0], Length: len(c.args[0])}, nil
+}
 
-	value, ok := v.(resp.BulkString)
-	if !ok {
-		return nil, errors.New("invalid value type")
-	}
+func handleSET(c *call) (resp.Type, error) {
+	key, value := c.args[0], c.args[1]
 
-	storageData := store.Data{Value: value}
+	storageData := store.Data{Value: store.NewString(value)}
 
-	val, err := strconv.Atoi(value.Value)
-	if err == nil {
-		storageData.Value = resp.Integer{Value: val}
-	}
+	specifics := c.args[2:]
 
-	specifics := make([]resp.BulkString, 0)
-
-	for _, val := range specs {
-		s, ok := val.(resp.BulkString)
-		if !ok {
-			return nil, errors.New("invalid specs type")
+	for i := 0; i < len(specifics); i += 2 {
+		if i+1 >= len(specifics) {
+			return nil, errors.New("syntax error")
 		}
 
-		specifics = append(specifics, s)
-	}
+		val, err := strconv.ParseInt(specifics[i+1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		if val <= 0 {
+			return nil, fmt.Errorf("invalid expire time in '%s' command", c.cmd.name)
+		}
 
-	for i := 0; i < len(specifics); i += 2 {
-		switch specifics[i].Value {
+		switch strings.ToUpper(specifics[i]) {
 		case "EX":
-			val, err := strconv.Atoi(specifics[i+1].Value)
-			if err != nil {
-				return nil, err
-			}
-
 			storageData.Expiry = time.Now().Add(time.Duration(val) * time.Second)
+		case "PX":
+			storageData.Expiry = time.Now().Add(time.Duration(val) * time.Millisecond)
+		case "EXAT":
+			storageData.Expiry = time.Unix(val, 0)
+		case "PXAT":
+			storageData.Expiry = time.UnixMilli(val)
 		default:
 			return nil, errors.New("unknown specifier")
 		}
 	}
 
-	fmt.Println(storageData)
+	c.db.SET(key, storageData)
 
-	redisStore.SET(key.Value, storageData)
+	// Relative TTLs are logged as absolute ones, so that they are not extended every time the AOF is loaded
+	c.propagate(setCommand(key, value, storageData.Expiry)...)
 
 	return resp.SimpleString{Value: "OK"}, nil
 }
 
-func handleGET(k resp.Type) (resp.Type, error) {
-	key, ok := k.(resp.BulkString)
-	if !ok {
-		return nil, errors.New("invalid key type")
+// setCommand builds the canonical SET command for a key, with an absolute expiry if it has one
+func setCommand(key, value string, expiry time.Time) []string {
+	if expiry.IsZero() {
+		return []string{"SET", key, value}
 	}
+	return []string{"SET", key, value, "PXAT", strconv.FormatInt(expiry.UnixMilli(), 10)}
+}
 
-	data, err := redisStore.GET(key.Value)
+func handleGET(c *call) (resp.Type, error) {
+	data, err := c.db.GET(c.args[0])
 	if err != nil {
 		return nil, err
 	}
@@ -93,30 +86,62 @@ func handleGET(k resp.Type) (resp.Type, error) {
 	return data.Value, nil
 }
 
-func handleDEL(k resp.Type) (resp.Type, error) {
-	key, ok := k.(resp.BulkString)
-	if !ok {
-		return nil, errors.New("invalid key type")
+func handleIncr(c *call) (resp.Type, error) {
+	return incrBy(c, 1)
+}
+
+func handleDECR(c *call) (resp.Type, error) {
+	return incrBy(c, -1)
+}
+
+func handleINCRBY(c *call) (resp.Type, error) {
+	delta, err := strconv.ParseInt(c.args[1], 10, 64)
+	if err != nil {
+		return nil, store.ErrNotInteger
+	}
+	return incrBy(c, delta)
+}
+
+func handleDECRBY(c *call) (resp.Type, error) {
+	delta, err := strconv.ParseInt(c.args[1], 10, 64)
+	if err != nil {
+		return nil, store.ErrNotInteger
+	}
+	if delta == math.MinInt64 {
+		return nil, errors.New("decrement would overflow")
 	}
+	return incrBy(c, -delta)
+}
+
+// incrBy adds delta to a counter & logs the resulting value rather than the increment, so that replaying the AOF is idempotent
+func incrBy(c *call, delta int64) (resp.Type, error) {
+	key := c.args[0]
 
-	err := redisStore.DEL(key.Value)
+	data, err := c.db.INCRBY(key, delta)
 	if err != nil {
 		return nil, err
 	}
+	n, _ := data.Value.(store.String).Int()
+	c.propagate(setCommand(key, strconv.FormatInt(n, 10), data.Expiry)...)
 
-	return resp.SimpleString{Value: "OK"}, nil
+	return resp.Integer{Value: int(n)}, nil
 }
 
-func handleIncr(k resp.Type) (resp.Type, error) {
-	key, ok := k.(resp.BulkString)
-	if !ok {
-		return nil, errors.New("invalid key type")
+func handleINCRBYFLOAT(c *call) (resp.Type, error) {
+	key := c.args[0]
+
+	delta, err := store.ParseFloat(c.args[1])
+	if err != nil {
+		return nil, err
 	}
 
-	val, err := redisStore.INCR(key.Value)
+	// Like in Redis, the result is logged, so that the replicas don't depend on their float arithmetic
+	data, err := c.db.INCRBYFLOAT(key, delta)
 	if err != nil {
 		return nil, err
 	}
+	value := data.Value.(store.String).String()
+	c.propagate(setCommand(key, value, data.Expiry)...)
 
-	return val, nil
+	return bulkString(value), nil
 }
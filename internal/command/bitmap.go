@@ -0,0 +1,593 @@
+package command
+
+import (
+	"errors"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+
+	"github.com/DNahar74/PulseDB/internal/resp"
+	"github.com/DNahar74/PulseDB/internal/store"
+)
+
+// maxBitOffset is the last bit of a string of maxStringLength bytes
+const maxBitOffset = maxStringLength*8 - 1
+
+var (
+	errBitOffset = errors.New("bit offset is not an integer or out of range")
+	errBitValue  = errors.New("bit is not an integer or out of range")
+)
+
+// Bits are numbered from the most significant bit of the first byte, like in Redis
+
+func getBit(b []byte, pos uint64) int {
+	if pos/8 >= uint64(len(b)) {
+		return 0
+	}
+	return int(b[pos/8]>>(7-pos%8)) & 1
+}
+
+func setBit(b []byte, pos uint64, v int) {
+	if v == 1 {
+		b[pos/8] |= 1 << (7 - pos%8)
+	} else {
+		b[pos/8] &^= 1 << (7 - pos%8)
+	}
+}
+
+// growBits pads a bitmap with zero bytes, so that it holds the bit at pos
+func growBits(b []byte, pos uint64) []byte {
+	if need := int(pos/8) + 1; len(b) < need {
+		b = append(b, make([]byte, need-len(b))...)
+	}
+	return b
+}
+
+func parseBitOffset(s string) (uint64, error) {
+	offset, err := strconv.ParseUint(s, 10, 64)
+	if err != nil || offset > maxBitOffset {
+		return 0, errBitOffset
+	}
+	return offset, nil
+}
+
+// writeBits stores a bitmap modified in place by the command
+// A key without a TTL is logged as the command itself, so that the AOF does not grow with the size of the bitmap on
+// every write. A key with a TTL is logged as a SET of the whole value, so that replaying the command after the key
+// expired does not create it again.
+func writeBits(c *call, key string, b []byte, data store.Data) {
+	value := string(b)
+	c.db.SET(key, store.Data{Value: store.NewRawString(value), Expiry: data.Expiry})
+
+	if !data.Expiry.IsZero() {
+		c.propagate(setCommand(key, value, data.Expiry)...)
+	}
+}
+
+func handleSETBIT(c *call) (resp.Type, error) {
+	key := c.args[0]
+
+	offset, err := parseBitOffset(c.args[1])
+	if err != nil {
+		return nil, err
+	}
+	if c.args[2] != "0" && c.args[2] != "1" {
+		return nil, errBitValue
+	}
+	bit := int(c.args[2][0] - '0')
+
+	value, data, _, err := lookupString(c, key)
+	if err != nil {
+		return nil, err
+	}
+
+	b := growBits([]byte(value), offset)
+	old := getBit(b, offset)
+	setBit(b, offset, bit)
+	writeBits(c, key, b, data)
+
+	return resp.Integer{Value: old}, nil
+}
+
+func handleGETBIT(c *call) (resp.Type, error) {
+	offset, err := parseBitOffset(c.args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	value, _, _, err := lookupString(c, c.args[0])
+	if err != nil {
+		return nil, err
+	}
+	return resp.Integer{Value: getBit([]byte(value), offset)}, nil
+}
+
+// bitRange reads the optional start, end & BYTE|BIT unit of BITCOUNT & BITPOS, & returns the range in bits
+// Negative positions count from the end. ok is false when the range is empty.
+func bitRange(args []string, length int) (first, last int64, endGiven, ok bool, err error) {
+	if len(args) == 0 {
+		return 0, int64(length)*8 - 1, false, length > 0, nil
+	}
+	if len(args) > 3 {
+		return 0, 0, false, false, errors.New("syntax error")
+	}
+
+	start, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return 0, 0, false, false, store.ErrNotInteger
+	}
+	end := int64(math.MaxInt64)
+	if len(args) >= 2 {
+		end, err = strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return 0, 0, false, false, store.ErrNotInteger
+		}
+		endGiven = true
+	}
+
+	unit := int64(8)
+	if len(args) == 3 {
+		switch strings.ToUpper(args[2]) {
+		case "BYTE":
+		case "BIT":
+			unit = 1
+		default:
+			return 0, 0, false, false, errors.New("syntax error")
+		}
+	}
+
+	total := int64(length) * 8 / unit
+	if start < 0 {
+		start = max(total+start, 0)
+	}
+	if end < 0 {
+		end = max(total+end, 0)
+	}
+	end = min(end, total-1)
+	if start > end || total == 0 {
+		return 0, 0, endGiven, false, nil
+	}
+
+	return start * unit, end*unit + unit - 1, endGiven, true, nil
+}
+
+func handleBITCOUNT(c *call) (resp.Type, error) {
+	// Like in Redis, a start without an end is an error
+	if len(c.args) == 2 {
+		return nil, errors.New("syntax error")
+	}
+
+	value, _, _, err := lookupString(c, c.args[0])
+	if err != nil {
+		return nil, err
+	}
+	first, last, _, ok, err := bitRange(c.args[1:], len(value))
+	if err != nil || !ok {
+		return resp.Integer{Value: 0}, err
+	}
+
+	b := []byte(value)
+	count := 0
+	for pos := first; pos <= last; {
+		// Whole bytes are counted at once
+		if pos%8 == 0 && pos+7 <= last {
+			count += bits.OnesCount8(b[pos/8])
+			pos += 8
+			continue
+		}
+		count += getBit(b, uint64(pos))
+		pos++
+	}
+	return resp.Integer{Value: count}, nil
+}
+
+func handleBITPOS(c *call) (resp.Type, error) {
+	if c.args[1] != "0" && c.args[1] != "1" {
+		return nil, errors.New("The bit argument must be 1 or 0.")
+	}
+	bit := int(c.args[1][0] - '0')
+
+	value, _, exists, err := lookupString(c, c.args[0])
+	if err != nil {
+		return nil, err
+	}
+	first, last, endGiven, ok, err := bitRange(c.args[2:], len(value))
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		// A missing key is an empty string: its first clear bit is the first one
+		if bit == 0 {
+			return resp.Integer{Value: 0}, nil
+		}
+		return resp.Integer{Value: -1}, nil
+	}
+	if !ok {
+		return resp.Integer{Value: -1}, nil
+	}
+
+	b := []byte(value)
+	for pos := first; pos <= last; {
+		// Skip the whole bytes without the bit
+		if pos%8 == 0 && pos+7 <= last && ((bit == 1 && b[pos/8] == 0) || (bit == 0 && b[pos/8] == 0xff)) {
+			pos += 8
+			continue
+		}
+		if getBit(b, uint64(pos)) == bit {
+			return resp.Integer{Value: int(pos)}, nil
+		}
+		pos++
+	}
+
+	// The string is padded with clear bits on the right, unless the range has an explicit end
+	if bit == 0 && !endGiven {
+		return resp.Integer{Value: int(last + 1)}, nil
+	}
+	return resp.Integer{Value: -1}, nil
+}
+
+// handleBITOP combines bitmaps into a destination key: BITOP AND|OR|XOR|NOT destkey key [key ...]
+// Missing keys & shorter strings are padded with zero bytes
+func handleBITOP(c *call) (resp.Type, error) {
+	op, dest, keys := strings.ToUpper(c.args[0]), c.args[1], c.args[2:]
+
+	switch op {
+	case "AND", "OR", "XOR":
+	case "NOT":
+		if len(keys) != 1 {
+			return nil, errors.New("BITOP NOT must be called with a single source key.")
+		}
+	default:
+		return nil, errors.New("syntax error")
+	}
+
+	sources := make([][]byte, len(keys))
+	length := 0
+	for i, key := range keys {
+		value, _, _, err := lookupString(c, key)
+		if err != nil {
+			return nil, err
+		}
+		sources[i] = []byte(value)
+		length = max(length, len(value))
+	}
+
+	result := make([]byte, length)
+	for i := range result {
+		byteAt := func(src []byte) byte {
+			if i < len(src) {
+				return src[i]
+			}
+			return 0
+		}
+
+		r := byteAt(sources[0])
+		for _, src := range sources[1:] {
+			switch op {
+			case "AND":
+				r &= byteAt(src)
+			case "OR":
+				r |= byteAt(src)
+			case "XOR":
+				r ^= byteAt(src)
+			}
+		}
+		if op == "NOT" {
+			r = ^r
+		}
+		result[i] = r
+	}
+
+	// The result is logged, so that replaying it does not depend on the sources, which may have expired
+	if length == 0 {
+		if c.db.DEL(dest) != nil {
+			c.dontPropagate()
+		} else {
+			c.propagate("DEL", dest)
+		}
+		return resp.Integer{Value: 0}, nil
+	}
+
+	value := string(result)
+	c.db.SET(dest, store.Data{Value: store.NewRawString(value)})
+	c.propagate("SET", dest, value)
+
+	return resp.Integer{Value: length}, nil
+}
+
+// Overflow modes of BITFIELD
+const (
+	overflowWrap = iota
+	overflowSat
+	overflowFail
+)
+
+// bitfieldOp is a GET, SET or INCRBY of a BITFIELD command
+type bitfieldOp struct {
+	op       string
+	signed   bool
+	bits     uint
+	offset   uint64
+	value    int64
+	overflow int
+}
+
+func parseBitfieldType(s string) (bool, uint, error) {
+	errType := errors.New("Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
+
+	if len(s) < 2 || (s[0] != 'i' && s[0] != 'u' && s[0] != 'I' && s[0] != 'U') {
+		return false, 0, errType
+	}
+	signed := s[0] == 'i' || s[0] == 'I'
+	n, err := strconv.Atoi(s[1:])
+	if err != nil || n < 1 || (signed && n > 64) || (!signed && n > 63) {
+		return false, 0, errType
+	}
+	return signed, uint(n), nil
+}
+
+// parseBitfieldOffset reads an offset in bits, or in multiples of the width when it starts with #
+func parseBitfieldOffset(s string, width uint) (uint64, error) {
+	multiply := strings.HasPrefix(s, "#")
+	if multiply {
+		s = s[1:]
+	}
+
+	offset, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, errBitOffset
+	}
+	if multiply {
+		if offset > maxBitOffset/uint64(width) {
+			return 0, errBitOffset
+		}
+		offset *= uint64(width)
+	}
+	if offset+uint64(width)-1 > maxBitOffset {
+		return 0, errBitOffset
+	}
+	return offset, nil
+}
+
+// parseBitfield reads the operations of BITFIELD, readOnly only allows GET like BITFIELD_RO
+func parseBitfield(args []string, readOnly bool) ([]bitfieldOp, error) {
+	ops := make([]bitfieldOp, 0)
+	overflow := overflowWrap
+
+	for i := 0; i < len(args); {
+		sub := strings.ToUpper(args[i])
+
+		if sub == "OVERFLOW" && !readOnly {
+			if i+1 >= len(args) {
+				return nil, errors.New("syntax error")
+			}
+			switch strings.ToUpper(args[i+1]) {
+			case "WRAP":
+				overflow = overflowWrap
+			case "SAT":
+				overflow = overflowSat
+			case "FAIL":
+				overflow = overflowFail
+			default:
+				return nil, errors.New("Invalid OVERFLOW type specified")
+			}
+			i += 2
+			continue
+		}
+
+		n := 3
+		switch sub {
+		case "GET":
+		case "SET", "INCRBY":
+			if readOnly {
+				return nil, errors.New("BITFIELD_RO only supports the GET subcommand")
+			}
+			n = 4
+		default:
+			return nil, errors.New("syntax error")
+		}
+		if i+n > len(args) {
+			return nil, errors.New("syntax error")
+		}
+
+		signed, width, err := parseBitfieldType(args[i+1])
+		if err != nil {
+			return nil, err
+		}
+		offset, err := parseBitfieldOffset(args[i+2], width)
+		if err != nil {
+			return nil, err
+		}
+		op := bitfieldOp{op: sub, signed: signed, bits: width, offset: offset, overflow: overflow}
+		if n == 4 {
+			op.value, err = strconv.ParseInt(args[i+3], 10, 64)
+			if err != nil {
+				return nil, store.ErrNotInteger
+			}
+		}
+
+		ops = append(ops, op)
+		i += n
+	}
+
+	return ops, nil
+}
+
+func getUnsignedBits(b []byte, offset uint64, width uint) uint64 {
+	v := uint64(0)
+	for i := uint64(0); i < uint64(width); i++ {
+		v = v<<1 | uint64(getBit(b, offset+i))
+	}
+	return v
+}
+
+func getSignedBits(b []byte, offset uint64, width uint) int64 {
+	v := getUnsignedBits(b, offset, width)
+	// Sign extension
+	if width < 64 && v&(1<<(width-1)) != 0 {
+		v |= math.MaxUint64 << width
+	}
+	return int64(v)
+}
+
+func setBits(b []byte, offset uint64, width uint, v uint64) {
+	for i := uint64(0); i < uint64(width); i++ {
+		setBit(b, offset+i, int(v>>(uint64(width)-1-i))&1)
+	}
+}
+
+// unsignedOverflow adds incr to an unsigned field & returns the result after the overflow mode, & whether it overflowed
+func unsignedOverflow(value uint64, incr int64, width uint, mode int) (uint64, bool) {
+	maxValue := uint64(1)<<width - 1
+	maxIncr := int64(maxValue - value)
+	minIncr := -int64(value)
+
+	overflow, high := false, false
+	if value > maxValue || (incr > 0 && incr > maxIncr) {
+		overflow, high = true, true
+	} else if incr < 0 && incr < minIncr {
+		overflow = true
+	}
+	if !overflow {
+		return value + uint64(incr), false
+	}
+
+	switch mode {
+	case overflowSat:
+		if high {
+			return maxValue, true
+		}
+		return 0, true
+	default:
+		return (value + uint64(incr)) & maxValue, true
+	}
+}
+
+// signedOverflow adds incr to a signed field & returns the result after the overflow mode, & whether it overflowed
+func signedOverflow(value, incr int64, width uint, mode int) (int64, bool) {
+	maxValue := int64(math.MaxInt64)
+	if width < 64 {
+		maxValue = 1<<(width-1) - 1
+	}
+	minValue := -maxValue - 1
+	maxIncr := maxValue - value
+	minIncr := minValue - value
+
+	overflow, high := false, false
+	if value > maxValue || (width != 64 && incr > maxIncr) || (value >= 0 && incr > 0 && incr > maxIncr) {
+		overflow, high = true, true
+	} else if value < minValue || (width != 64 && incr < minIncr) || (value < 0 && incr < 0 && incr < minIncr) {
+		overflow = true
+	}
+	if !overflow {
+		return value + incr, false
+	}
+
+	switch mode {
+	case overflowSat:
+		if high {
+			return maxValue, true
+		}
+		return minValue, true
+	default:
+		// Add as unsigned, so that the result wraps around, then sign extend it
+		c := uint64(value) + uint64(incr)
+		if width < 64 {
+			mask := uint64(math.MaxUint64) << width
+			if c&(1<<(width-1)) != 0 {
+				c |= mask
+			} else {
+				c &^= mask
+			}
+		}
+		return int64(c), true
+	}
+}
+
+func handleBITFIELD(c *call) (resp.Type, error) {
+	return bitfield(c, false)
+}
+
+func handleBITFIELDRO(c *call) (resp.Type, error) {
+	return bitfield(c, true)
+}
+
+// bitfield runs the operations of BITFIELD on integers of any width stored at any bit offset of a string:
+// BITFIELD key [GET type offset] [SET type offset value] [INCRBY type offset increment] [OVERFLOW WRAP|SAT|FAIL] ...
+func bitfield(c *call, readOnly bool) (resp.Type, error) {
+	key := c.args[0]
+
+	ops, err := parseBitfield(c.args[1:], readOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	value, data, _, err := lookupString(c, key)
+	if err != nil {
+		return nil, err
+	}
+	b := []byte(value)
+
+	// The string grows to hold every field that is written, like in Redis
+	writes := false
+	for _, op := range ops {
+		if op.op != "GET" {
+			b = growBits(b, op.offset+uint64(op.bits)-1)
+			writes = true
+		}
+	}
+
+	items := make([]resp.Type, 0, len(ops))
+	for _, op := range ops {
+		if op.op == "GET" {
+			if op.signed {
+				items = append(items, resp.Integer{Value: int(getSignedBits(b, op.offset, op.bits))})
+			} else {
+				items = append(items, resp.Integer{Value: int(getUnsignedBits(b, op.offset, op.bits))})
+			}
+			continue
+		}
+
+		// SET returns the old value, INCRBY the new one
+		var reply int64
+		var stored uint64
+		var overflow bool
+		if op.signed {
+			old := getSignedBits(b, op.offset, op.bits)
+			var result int64
+			if op.op == "INCRBY" {
+				result, overflow = signedOverflow(old, op.value, op.bits, op.overflow)
+				reply = result
+			} else {
+				result, overflow = signedOverflow(op.value, 0, op.bits, op.overflow)
+				reply = old
+			}
+			stored = uint64(result)
+		} else {
+			old := getUnsignedBits(b, op.offset, op.bits)
+			if op.op == "INCRBY" {
+				stored, overflow = unsignedOverflow(old, op.value, op.bits, op.overflow)
+				reply = int64(stored)
+			} else {
+				stored, overflow = unsignedOverflow(uint64(op.value), 0, op.bits, op.overflow)
+				reply = int64(old)
+			}
+		}
+
+		if overflow && op.overflow == overflowFail {
+			items = append(items, resp.Null{})
+			continue
+		}
+		setBits(b, op.offset, op.bits, stored)
+		items = append(items, resp.Integer{Value: int(reply)})
+	}
+
+	if writes {
+		writeBits(c, key, b, data)
+	} else if !readOnly {
+		c.dontPropagate()
+	}
+
+	return resp.Array{Length: len(items), Items: items}, nil
+}
@@ -0,0 +1,219 @@
+package command
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/DNahar74/PulseDB/internal/resp"
+	"github.com/DNahar74/PulseDB/internal/store"
+)
+
+// integers returns the items of an array reply, with -1 for the nulls
+func integers(t *testing.T, v resp.Type) []int {
+	t.Helper()
+
+	arr := v.(resp.Array)
+	values := make([]int, len(arr.Items))
+	for i, item := range arr.Items {
+		switch item := item.(type) {
+		case resp.Integer:
+			values[i] = item.Value
+		case resp.Null:
+			values[i] = -1
+		default:
+			t.Fatalf("unexpected item %v", item)
+		}
+	}
+	return values
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSetGetBit(t *testing.T) {
+	d := store.CreateDatabases(1)
+	InitDatabases(d)
+	sess := NewSession()
+
+	if reply := run(t, sess, "SETBIT", "k", "7", "1"); reply != (resp.Integer{Value: 0}) {
+		t.Errorf("SETBIT = %v, want 0", reply)
+	}
+	if reply := run(t, sess, "SETBIT", "k", "7", "0"); reply != (resp.Integer{Value: 1}) {
+		t.Errorf("SETBIT = %v, want the old bit 1", reply)
+	}
+	run(t, sess, "SETBIT", "k", "17", "1")
+	if reply := run(t, sess, "GET", "k"); reply != bulkString("\x00\x00\x40") {
+		t.Errorf("GET = %q, want 3 bytes with the bit 17 set", reply)
+	}
+	if reply := run(t, sess, "GETBIT", "k", "17"); reply != (resp.Integer{Value: 1}) {
+		t.Errorf("GETBIT 17 = %v, want 1", reply)
+	}
+	if reply := run(t, sess, "GETBIT", "k", "1000"); reply != (resp.Integer{Value: 0}) {
+		t.Errorf("GETBIT past the end = %v, want 0", reply)
+	}
+
+	// A bitmap without a TTL is logged as the command, one with a TTL as a SET so that a replay after the expiry
+	// doesn't bring it back
+	drainAOF(d)
+	run(t, sess, "SETBIT", "k", "0", "1")
+	if got := drainAOF(d); len(got) != 1 || !strings.Contains(got[0], "SETBIT") {
+		t.Errorf("propagated %q, want the SETBIT", got)
+	}
+	run(t, sess, "SETEX", "v", "100", "x")
+	drainAOF(d)
+	run(t, sess, "SETBIT", "v", "0", "1")
+	if got := drainAOF(d); len(got) != 1 || !strings.Contains(got[0], "SET\r\n$1\r\nv\r\n$1\r\n\xf8") {
+		t.Errorf("propagated %q, want SET v with its expiry", got)
+	}
+
+	for _, args := range [][]string{{"k", "-1", "1"}, {"k", "4294967296", "1"}, {"k", "0", "2"}} {
+		if _, err := HandleCommands(sess, newCommand(append([]string{"SETBIT"}, args...)...)); err == nil {
+			t.Errorf("SETBIT %v succeeded", args)
+		}
+	}
+}
+
+func TestBitCountPos(t *testing.T) {
+	d := store.CreateDatabases(1)
+	InitDatabases(d)
+	sess := NewSession()
+
+	// The examples of the Redis documentation
+	run(t, sess, "SET", "foo", "foobar")
+	counts := map[string][]string{
+		"26": nil,
+		"4":  {"0", "0"},
+		"6":  {"1", "1", "BYTE"},
+		"17": {"5", "30", "BIT"},
+	}
+	for want, args := range counts {
+		reply := run(t, sess, append([]string{"BITCOUNT", "foo"}, args...)...)
+		if str, _ := reply.Serialize(); str != ":"+want+"\r\n" {
+			t.Errorf("BITCOUNT %v = %v, want %s", args, reply, want)
+		}
+	}
+
+	run(t, sess, "SET", "a", "\xff\xf0\x00")
+	run(t, sess, "SET", "b", "\x00\xff\xf0")
+	run(t, sess, "SET", "c", "\x00\x00\x00")
+	run(t, sess, "SET", "ones", "\xff\xff")
+	positions := []struct {
+		args []string
+		want int
+	}{
+		{[]string{"a", "0"}, 12},
+		{[]string{"b", "1", "0"}, 8},
+		{[]string{"b", "1", "2"}, 16},
+		{[]string{"b", "1", "2", "-1", "BYTE"}, 16},
+		{[]string{"b", "1", "7", "15", "BIT"}, 8},
+		{[]string{"c", "1"}, -1},
+		{[]string{"c", "1", "7", "-3", "BIT"}, -1},
+		{[]string{"ones", "0"}, 16},
+		{[]string{"ones", "0", "0", "-1"}, -1},
+		{[]string{"missing", "0"}, 0},
+		{[]string{"missing", "1"}, -1},
+	}
+	for _, tt := range positions {
+		reply := run(t, sess, append([]string{"BITPOS"}, tt.args...)...)
+		if reply != (resp.Integer{Value: tt.want}) {
+			t.Errorf("BITPOS %v = %v, want %d", tt.args, reply, tt.want)
+		}
+	}
+}
+
+func TestBitOp(t *testing.T) {
+	d := store.CreateDatabases(1)
+	InitDatabases(d)
+	sess := NewSession()
+
+	run(t, sess, "SET", "key1", "foobar")
+	run(t, sess, "SET", "key2", "abcdef")
+
+	results := map[string]string{
+		"AND": "`bc`ab",
+		"OR":  "goofev",
+		"XOR": "\x07\x0d\x0c\x06\x04\x14",
+	}
+	for op, want := range results {
+		if reply := run(t, sess, "BITOP", op, "dest", "key1", "key2"); reply != (resp.Integer{Value: 6}) {
+			t.Errorf("BITOP %s = %v, want 6", op, reply)
+		}
+		if reply := run(t, sess, "GET", "dest"); reply != bulkString(want) {
+			t.Errorf("BITOP %s gives %q, want %q", op, reply, want)
+		}
+	}
+
+	// Shorter & missing keys are padded with zero bytes
+	run(t, sess, "SET", "short", "\xff")
+	run(t, sess, "BITOP", "OR", "dest", "short", "missing", "key1")
+	if reply := run(t, sess, "STRLEN", "dest"); reply != (resp.Integer{Value: 6}) {
+		t.Errorf("STRLEN of the OR = %v, want 6", reply)
+	}
+	run(t, sess, "BITOP", "NOT", "dest", "short")
+	if reply := run(t, sess, "GET", "dest"); reply != bulkString("\x00") {
+		t.Errorf("BITOP NOT gives %q", reply)
+	}
+	if _, err := HandleCommands(sess, newCommand("BITOP", "NOT", "dest", "key1", "key2")); err == nil {
+		t.Error("BITOP NOT with two keys succeeded")
+	}
+}
+
+func TestBitfield(t *testing.T) {
+	d := store.CreateDatabases(1)
+	InitDatabases(d)
+	sess := NewSession()
+
+	if got := integers(t, run(t, sess, "BITFIELD", "k", "INCRBY", "i5", "100", "1", "GET", "u4", "0")); !equalInts(got, []int{1, 0}) {
+		t.Errorf("BITFIELD INCRBY & GET = %v, want [1 0]", got)
+	}
+
+	// The overflow example of the Redis documentation
+	steps := [][]int{{1, 1}, {2, 2}, {3, 3}, {0, 3}}
+	for _, want := range steps {
+		got := integers(t, run(t, sess, "BITFIELD", "o", "INCRBY", "u2", "100", "1", "OVERFLOW", "SAT", "INCRBY", "u2", "102", "1"))
+		if !equalInts(got, want) {
+			t.Errorf("BITFIELD WRAP & SAT = %v, want %v", got, want)
+		}
+	}
+	if got := integers(t, run(t, sess, "BITFIELD", "o", "OVERFLOW", "FAIL", "INCRBY", "u2", "102", "1")); !equalInts(got, []int{-1}) {
+		t.Errorf("BITFIELD FAIL = %v, want a null", got)
+	}
+
+	tests := []struct {
+		args []string
+		want []int
+	}{
+		{[]string{"SET", "i8", "0", "-100", "GET", "i8", "0"}, []int{0, -100}},
+		{[]string{"SET", "u8", "#1", "200", "GET", "u8", "8"}, []int{0, 200}},
+		{[]string{"SET", "u8", "#1", "300", "GET", "u8", "8"}, []int{200, 44}},
+		{[]string{"OVERFLOW", "SAT", "SET", "i8", "#2", "1000", "GET", "i8", "16"}, []int{0, 127}},
+		{[]string{"SET", "i64", "64", "-9223372036854775808", "INCRBY", "i64", "64", "-1"}, []int{0, 9223372036854775807}},
+		{[]string{"OVERFLOW", "SAT", "INCRBY", "i64", "64", "1"}, []int{9223372036854775807}},
+		{[]string{"SET", "u63", "128", "-1"}, []int{0}},
+		{[]string{"GET", "u63", "128"}, []int{9223372036854775807}},
+	}
+	for _, tt := range tests {
+		got := integers(t, run(t, sess, append([]string{"BITFIELD", "f"}, tt.args...)...))
+		if !equalInts(got, tt.want) {
+			t.Errorf("BITFIELD %v = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+
+	if got := integers(t, run(t, sess, "BITFIELD_RO", "f", "GET", "i8", "0")); !equalInts(got, []int{-100}) {
+		t.Errorf("BITFIELD_RO = %v, want [-100]", got)
+	}
+	for _, args := range [][]string{{"BITFIELD_RO", "f", "SET", "i8", "0", "1"}, {"BITFIELD", "f", "GET", "u64", "0"}, {"BITFIELD", "f", "GET", "i8"}} {
+		if _, err := HandleCommands(sess, newCommand(args...)); err == nil {
+			t.Errorf("%v succeeded", args)
+		}
+	}
+}
@@ -0,0 +1,356 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DNahar74/PulseDB/internal/resp"
+)
+
+// ClientFilter selects the clients of CLIENT LIST & CLIENT KILL, its zero value matches every client
+type ClientFilter struct {
+	IDs  []int64
+	Addr string
+	User string
+	// Type is normal, replica, master or pubsub
+	Type string
+	// SkipID leaves a client out, CLIENT KILL skips the client running it unless SKIPME no is given
+	SkipID int64
+}
+
+// ClientHandler gives CLIENT the clients connected to the server
+type ClientHandler interface {
+	// Clients describes the clients matched by a filter, one line per client in the order they connected
+	Clients(f ClientFilter) []string
+	// KillClients disconnects the clients matched by a filter & returns their number
+	// The client with the id self is disconnected once its reply is sent
+	KillClients(f ClientFilter, self int64) int
+}
+
+var clientsHandle handle[ClientHandler]
+
+func clientRegistry() ClientHandler {
+	return clientsHandle.get()
+}
+
+// InitClients passes the server's registry of the connected clients for access in this package
+func InitClients(h ClientHandler) {
+	clientsHandle.set(h)
+}
+
+// ID returns the unique number of the connection of a session
+func (s *Session) ID() int64 {
+	return s.id
+}
+
+// DB returns the index of the database selected by a session
+func (s *Session) DB() int {
+	return s.db
+}
+
+// Name returns the name the client of a session gave itself
+func (s *Session) Name() string {
+	return s.name
+}
+
+// Username returns the name of the user that runs the commands of a session
+func (s *Session) Username() string {
+	return s.user.Name()
+}
+
+// NoEvict reports whether the client of a session set CLIENT NO-EVICT on
+// The clients are never evicted, the flag is accepted for compatibility only & shown in CLIENT LIST
+func (s *Session) NoEvict() bool {
+	return s.noEvict
+}
+
+// Replies reports whether the reply of the command just run is sent, it must be called once for every command
+// CLIENT REPLY OFF drops every reply, CLIENT REPLY SKIP its own & the one of the next command
+func (s *Session) Replies() bool {
+	if s.skipReplies > 0 {
+		s.skipReplies--
+		return false
+	}
+	return !s.repliesOff
+}
+
+// clientPause holds back the commands of the clients during CLIENT PAUSE
+var clientPause = struct {
+	mu    sync.Mutex
+	until time.Time
+	// all pauses every command, only the write commands are paused otherwise
+	all bool
+	// resumed is closed by CLIENT UNPAUSE
+	resumed chan struct{}
+}{resumed: make(chan struct{})}
+
+// pauseClients pauses the commands until a time, a pause already running is only extended
+func pauseClients(until time.Time, all bool) {
+	clientPause.mu.Lock()
+	defer clientPause.mu.Unlock()
+
+	if time.Now().Before(clientPause.until) {
+		all = all || clientPause.all
+		until = maxTime(until, clientPause.until)
+	}
+	clientPause.until = until
+	clientPause.all = all
+}
+
+// unpauseClients ends a pause & lets the commands held back run
+func unpauseClients() {
+	clientPause.mu.Lock()
+	defer clientPause.mu.Unlock()
+
+	clientPause.until = time.Time{}
+	close(clientPause.resumed)
+	clientPause.resumed = make(chan struct{})
+}
+
+// writesPaused reports whether the write commands are paused, the active expiry stops with them so that the keyspace
+// doesn't change
+func writesPaused() bool {
+	clientPause.mu.Lock()
+	defer clientPause.mu.Unlock()
+
+	return time.Now().Before(clientPause.until)
+}
+
+// waitPause holds a command back until the pause ends
+// CLIENT itself is never paused, so that the pause can be lifted
+func waitPause(cmd *commandSpec) {
+	if cmd.name == "client" {
+		return
+	}
+	for {
+		clientPause.mu.Lock()
+		until, all, resumed := clientPause.until, clientPause.all, clientPause.resumed
+		clientPause.mu.Unlock()
+
+		wait := time.Until(until)
+		if wait <= 0 || !all && !cmd.is(flagWrite) {
+			return
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-resumed:
+			timer.Stop()
+		}
+	}
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// listClients returns the lines of CLIENT LIST, there are none without a server
+func listClients(f ClientFilter) []string {
+	if clientRegistry() == nil {
+		return nil
+	}
+	return clientRegistry().Clients(f)
+}
+
+// clientTypes are the types of CLIENT LIST TYPE & CLIENT KILL TYPE
+var clientTypes = map[string]bool{"normal": true, "master": true, "replica": true, "slave": true, "pubsub": true}
+
+// parseClientType checks a client type, slave is another name for replica
+func parseClientType(t string) (string, error) {
+	t = strings.ToLower(t)
+	if !clientTypes[t] {
+		return "", fmt.Errorf("Unknown client type '%s'", t)
+	}
+	if t == "slave" {
+		t = "replica"
+	}
+	return t, nil
+}
+
+// parseClientIDs parses the ids of CLIENT LIST ID & CLIENT KILL ID
+func parseClientIDs(args []string) ([]int64, error) {
+	ids := make([]int64, len(args))
+	for i, a := range args {
+		id, err := strconv.ParseInt(a, 10, 64)
+		if err != nil || id <= 0 {
+			return nil, errors.New("Invalid client ID")
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// handleCLIENT handles the CLIENT subcommands that inspect & manage the connections
+func handleCLIENT(c *call) (resp.Type, error) {
+	sub, args := strings.ToUpper(c.args[0]), c.args[1:]
+	sess := c.session
+
+	switch {
+	case sub == "ID" && len(args) == 0:
+		return resp.Integer{Value: int(sess.id)}, nil
+	case sub == "SETNAME" && len(args) == 1:
+		err := validClientName(args[0])
+		if err != nil {
+			return nil, err
+		}
+		sess.name = args[0]
+		return resp.SimpleString{Value: "OK"}, nil
+	case sub == "GETNAME" && len(args) == 0:
+		if sess.name == "" {
+			return resp.Null{}, nil
+		}
+		return bulkString(sess.name), nil
+	case sub == "LIST":
+		return clientList(args)
+	case sub == "INFO" && len(args) == 0:
+		lines := listClients(ClientFilter{IDs: []int64{sess.id}})
+		return bulkString(strings.Join(lines, "\n") + "\n"), nil
+	case sub == "KILL" && len(args) >= 1:
+		return clientKill(sess, args)
+	case sub == "PAUSE" && (len(args) == 1 || len(args) == 2):
+		timeout, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil || timeout < 0 {
+			return nil, errors.New("timeout is not an integer or out of range")
+		}
+		all := true
+		if len(args) == 2 {
+			switch strings.ToUpper(args[1]) {
+			case "WRITE":
+				all = false
+			case "ALL":
+			default:
+				return nil, errors.New("syntax error")
+			}
+		}
+		pauseClients(time.Now().Add(time.Duration(timeout)*time.Millisecond), all)
+		return resp.SimpleString{Value: "OK"}, nil
+	case sub == "UNPAUSE" && len(args) == 0:
+		unpauseClients()
+		return resp.SimpleString{Value: "OK"}, nil
+	case sub == "REPLY" && len(args) == 1:
+		switch strings.ToUpper(args[0]) {
+		case "ON":
+			sess.repliesOff = false
+			sess.skipReplies = 0
+		case "OFF":
+			sess.repliesOff = true
+		case "SKIP":
+			// The reply of CLIENT REPLY SKIP is dropped too
+			sess.skipReplies = 2
+		default:
+			return nil, errors.New("syntax error")
+		}
+		return resp.SimpleString{Value: "OK"}, nil
+	case sub == "NO-EVICT" && len(args) == 1:
+		// Accepted for compatibility only, there is no client eviction to exempt the client from
+		switch strings.ToUpper(args[0]) {
+		case "ON":
+			sess.noEvict = true
+		case "OFF":
+			sess.noEvict = false
+		default:
+			return nil, errors.New("syntax error")
+		}
+		return resp.SimpleString{Value: "OK"}, nil
+	case sub == "ID" || sub == "SETNAME" || sub == "GETNAME" || sub == "INFO" || sub == "KILL" || sub == "PAUSE" ||
+		sub == "UNPAUSE" || sub == "REPLY" || sub == "NO-EVICT":
+		return nil, fmt.Errorf("wrong number of arguments for 'client|%s' command", strings.ToLower(sub))
+	default:
+		return nil, fmt.Errorf("unknown subcommand '%s'. Try CLIENT HELP.", c.args[0])
+	}
+}
+
+// clientList handles CLIENT LIST [TYPE type] [ID id ...]
+func clientList(args []string) (resp.Type, error) {
+	var f ClientFilter
+	for i := 0; i < len(args); i++ {
+		switch {
+		case strings.EqualFold(args[i], "TYPE") && i+1 < len(args):
+			t, err := parseClientType(args[i+1])
+			if err != nil {
+				return nil, err
+			}
+			f.Type = t
+			i++
+		case strings.EqualFold(args[i], "ID") && i+1 < len(args):
+			ids, err := parseClientIDs(args[i+1:])
+			if err != nil {
+				return nil, err
+			}
+			f.IDs = ids
+			i = len(args)
+		default:
+			return nil, errors.New("syntax error")
+		}
+	}
+
+	var sb strings.Builder
+	for _, line := range listClients(f) {
+		sb.WriteString(line + "\n")
+	}
+	return bulkString(sb.String()), nil
+}
+
+// clientKill handles CLIENT KILL addr, which kills one client, & CLIENT KILL with filters, which returns the number of
+// clients killed & skips the client running it unless SKIPME no is given
+func clientKill(sess *Session, args []string) (resp.Type, error) {
+	if clientRegistry() == nil {
+		return nil, errors.New("No such client")
+	}
+
+	if len(args) == 1 {
+		if clientRegistry().KillClients(ClientFilter{Addr: args[0]}, sess.id) == 0 {
+			return nil, errors.New("No such client")
+		}
+		return resp.SimpleString{Value: "OK"}, nil
+	}
+	if len(args)%2 != 0 {
+		return nil, errors.New("syntax error")
+	}
+
+	f := ClientFilter{SkipID: sess.id}
+	for i := 0; i < len(args); i += 2 {
+		value := args[i+1]
+		switch strings.ToUpper(args[i]) {
+		case "ID":
+			ids, err := parseClientIDs([]string{value})
+			if err != nil {
+				return nil, err
+			}
+			f.IDs = ids
+		case "ADDR":
+			f.Addr = value
+		case "USER":
+			// The clients of a disabled user can still be killed
+			if _, ok := accessControl().GetUser(value); !ok {
+				return nil, fmt.Errorf("No such user '%s'", value)
+			}
+			f.User = value
+		case "TYPE":
+			t, err := parseClientType(value)
+			if err != nil {
+				return nil, err
+			}
+			f.Type = t
+		case "SKIPME":
+			switch strings.ToLower(value) {
+			case "yes":
+				f.SkipID = sess.id
+			case "no":
+				f.SkipID = 0
+			default:
+				return nil, errors.New("syntax error")
+			}
+		default:
+			return nil, errors.New("syntax error")
+		}
+	}
+	return resp.Integer{Value: clientRegistry().KillClients(f, sess.id)}, nil
+}
@@ -0,0 +1,73 @@
+package command
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DNahar74/PulseDB/internal/resp"
+	"github.com/DNahar74/PulseDB/internal/store"
+)
+
+func TestClient(t *testing.T) {
+	InitDatabases(store.CreateDatabases(1))
+	sess := NewSession()
+
+	if reply := run(t, sess, "CLIENT", "ID"); reply != (resp.Integer{Value: int(sess.ID())}) {
+		t.Errorf("CLIENT ID = %v", reply)
+	}
+	if reply := run(t, sess, "CLIENT", "GETNAME"); reply != (resp.Null{}) {
+		t.Errorf("CLIENT GETNAME without a name = %v", reply)
+	}
+	run(t, sess, "CLIENT", "SETNAME", "worker")
+	if reply := run(t, sess, "CLIENT", "GETNAME"); reply != bulkString("worker") {
+		t.Errorf("CLIENT GETNAME = %v", reply)
+	}
+	if _, err := HandleCommands(sess, newCommand("CLIENT", "SETNAME", "two words")); err == nil {
+		t.Error("CLIENT SETNAME accepted a name with a space")
+	}
+
+	// CLIENT REPLY SKIP drops its own reply & the next one, OFF drops them all until ON
+	run(t, sess, "CLIENT", "REPLY", "SKIP")
+	sent := []bool{sess.Replies(), sess.Replies(), sess.Replies()}
+	if sent[0] || sent[1] || !sent[2] {
+		t.Errorf("replies sent after CLIENT REPLY SKIP = %v", sent)
+	}
+	run(t, sess, "CLIENT", "REPLY", "OFF")
+	if sess.Replies() {
+		t.Error("CLIENT REPLY OFF sent its reply")
+	}
+	run(t, sess, "CLIENT", "REPLY", "ON")
+	if !sess.Replies() {
+		t.Error("CLIENT REPLY ON didn't send its reply")
+	}
+
+	// A write pause only holds back the write commands, until it ends
+	run(t, sess, "CLIENT", "PAUSE", "50", "WRITE")
+	start := time.Now()
+	run(t, sess, "EXISTS", "k")
+	if time.Since(start) > 40*time.Millisecond {
+		t.Error("EXISTS was paused by CLIENT PAUSE WRITE")
+	}
+	run(t, sess, "SET", "k", "v")
+	if time.Since(start) < 40*time.Millisecond {
+		t.Error("SET wasn't paused by CLIENT PAUSE WRITE")
+	}
+
+	done := make(chan struct{})
+	run(t, sess, "CLIENT", "PAUSE", "10000")
+	go func() {
+		defer close(done)
+		run(t, NewSession(), "EXISTS", "k")
+	}()
+	select {
+	case <-done:
+		t.Error("EXISTS wasn't paused by CLIENT PAUSE ALL")
+	case <-time.After(20 * time.Millisecond):
+	}
+	run(t, sess, "CLIENT", "UNPAUSE")
+	<-done
+
+	if _, err := HandleCommands(sess, newCommand("CLIENT", "PAUSE", "10", "READ")); err == nil {
+		t.Error("CLIENT PAUSE accepted a mode other than WRITE & ALL")
+	}
+}
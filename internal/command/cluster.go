@@ -0,0 +1,519 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DNahar74/PulseDB/internal/cluster"
+	"github.com/DNahar74/PulseDB/internal/resp"
+	"github.com/DNahar74/PulseDB/internal/store"
+	"github.com/DNahar74/PulseDB/internal/utils"
+)
+
+var clusterHandle handle[*cluster.Cluster]
+
+// clusterState is nil unless the server runs in cluster mode
+func clusterState() *cluster.Cluster {
+	return clusterHandle.get()
+}
+
+// InitCluster passes the server's cluster state for access in this package
+func InitCluster(c *cluster.Cluster) {
+	clusterHandle.set(c)
+}
+
+var errClusterDisabled = errors.New("This instance has cluster support disabled")
+
+// routeCommand checks that the keys of a command are served by this node
+// Otherwise the client is redirected with MOVED, or with ASK while the slot is being migrated
+func routeCommand(cmd *commandSpec, argv []string, asking bool) error {
+	if clusterState() == nil {
+		return nil
+	}
+
+	keys := cmd.keys(argv)
+	if len(keys) == 0 {
+		return nil
+	}
+
+	slot := cluster.KeySlot(keys[0])
+	for _, key := range keys[1:] {
+		if cluster.KeySlot(key) != slot {
+			return errors.New("CROSSSLOT Keys in request don't hash to the same slot")
+		}
+	}
+
+	route := clusterState().Route(slot)
+
+	if route.Mine {
+		if route.MigratingTo == "" {
+			return nil
+		}
+
+		// Keys that are gone from a migrating slot may already be on the target
+		missing := 0
+		for _, key := range keys {
+			// Cluster mode only has database 0
+			if _, ok := databases().DB(0).Lookup(key); !ok {
+				missing++
+			}
+		}
+		if missing == 0 {
+			return nil
+		}
+		if missing < len(keys) {
+			return errors.New("TRYAGAIN Multiple keys request during rehashing of slot")
+		}
+		return fmt.Errorf("ASK %d %s", slot, route.MigratingTo)
+	}
+
+	if route.Importing && asking {
+		return nil
+	}
+	if !route.Assigned {
+		return errors.New("CLUSTERDOWN Hash slot not served")
+	}
+	return fmt.Errorf("MOVED %d %s", slot, route.Addr)
+}
+
+func handleASKING(c *call) (resp.Type, error) {
+	if clusterState() == nil {
+		return nil, errClusterDisabled
+	}
+
+	c.session.asking = true
+	return resp.SimpleString{Value: "OK"}, nil
+}
+
+func handleCLUSTER(c *call) (resp.Type, error) {
+	if clusterState() == nil {
+		return nil, errClusterDisabled
+	}
+
+	sub, args := strings.ToUpper(c.args[0]), c.args[1:]
+	switch sub {
+	case "INFO":
+		info := strings.Join(clusterState().Info(), "\r\n") + "\r\n"
+		return resp.BulkString{Value: info, Length: len(info)}, nil
+	case "MYID":
+		return bulkString(clusterState().MyID()), nil
+	case "NODES":
+		return bulkString(clusterState().NodesText()), nil
+	case "SLOTS":
+		return clusterSlots(), nil
+	case "SHARDS":
+		return clusterShards(), nil
+	case "KEYSLOT":
+		if len(args) != 1 {
+			return nil, errors.New("wrong number of arguments for 'cluster|keyslot' command")
+		}
+		return resp.Integer{Value: cluster.KeySlot(args[0])}, nil
+	case "COUNTKEYSINSLOT":
+		if len(args) != 1 {
+			return nil, errors.New("wrong number of arguments for 'cluster|countkeysinslot' command")
+		}
+		slot, err := cluster.ParseSlot(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return resp.Integer{Value: len(keysInSlot(slot, -1))}, nil
+	case "GETKEYSINSLOT":
+		if len(args) != 2 {
+			return nil, errors.New("wrong number of arguments for 'cluster|getkeysinslot' command")
+		}
+		slot, err := cluster.ParseSlot(args[0])
+		if err != nil {
+			return nil, err
+		}
+		count, err := strconv.Atoi(args[1])
+		if err != nil || count < 0 {
+			return nil, errors.New("Invalid number of keys")
+		}
+		items := make([]resp.Type, 0)
+		for _, key := range keysInSlot(slot, count) {
+			items = append(items, bulkString(key))
+		}
+		return resp.Array{Length: len(items), Items: items}, nil
+	case "ADDSLOTS", "DELSLOTS":
+		if len(args) == 0 {
+			return nil, fmt.Errorf("wrong number of arguments for 'cluster|%s' command", strings.ToLower(sub))
+		}
+		slots := make([]int, len(args))
+		for i, a := range args {
+			slot, err := cluster.ParseSlot(a)
+			if err != nil {
+				return nil, err
+			}
+			slots[i] = slot
+		}
+		return okReply(updateSlots(sub == "ADDSLOTS", slots))
+	case "ADDSLOTSRANGE", "DELSLOTSRANGE":
+		if len(args) == 0 || len(args)%2 != 0 {
+			return nil, fmt.Errorf("wrong number of arguments for 'cluster|%s' command", strings.ToLower(sub))
+		}
+		slots := make([]int, 0)
+		for i := 0; i < len(args); i += 2 {
+			start, err := cluster.ParseSlot(args[i])
+			if err != nil {
+				return nil, err
+			}
+			end, err := cluster.ParseSlot(args[i+1])
+			if err != nil {
+				return nil, err
+			}
+			if start > end {
+				return nil, fmt.Errorf("start slot number %d is greater than end slot number %d", start, end)
+			}
+			for slot := start; slot <= end; slot++ {
+				slots = append(slots, slot)
+			}
+		}
+		return okReply(updateSlots(sub == "ADDSLOTSRANGE", slots))
+	case "SETSLOT":
+		return handleSETSLOT(args)
+	case "MEET":
+		if len(args) != 2 && len(args) != 3 {
+			return nil, errors.New("wrong number of arguments for 'cluster|meet' command")
+		}
+		port, err := strconv.Atoi(args[1])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid base port specified: %s", args[1])
+		}
+		busPort := 0
+		if len(args) == 3 {
+			busPort, err = strconv.Atoi(args[2])
+			if err != nil {
+				return nil, fmt.Errorf("Invalid bus port specified: %s", args[2])
+			}
+		}
+		return okReply(clusterState().Meet(args[0], port, busPort))
+	default:
+		return nil, fmt.Errorf("unknown subcommand '%s'. Try CLUSTER HELP.", c.args[0])
+	}
+}
+
+func okReply(err error) (resp.Type, error) {
+	if err != nil {
+		return nil, err
+	}
+	return resp.SimpleString{Value: "OK"}, nil
+}
+
+func updateSlots(add bool, slots []int) error {
+	if add {
+		return clusterState().AddSlots(slots)
+	}
+	return clusterState().DelSlots(slots)
+}
+
+func handleSETSLOT(args []string) (resp.Type, error) {
+	if len(args) < 2 {
+		return nil, errors.New("wrong number of arguments for 'cluster|setslot' command")
+	}
+
+	slot, err := cluster.ParseSlot(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	action := strings.ToUpper(args[1])
+	if action == "STABLE" {
+		if len(args) != 2 {
+			return nil, errors.New("syntax error")
+		}
+		return okReply(clusterState().SetSlotStable(slot))
+	}
+
+	if len(args) != 3 {
+		return nil, errors.New("syntax error")
+	}
+	id := args[2]
+
+	switch action {
+	case "MIGRATING":
+		return okReply(clusterState().SetSlotMigrating(slot, id))
+	case "IMPORTING":
+		return okReply(clusterState().SetSlotImporting(slot, id))
+	case "NODE":
+		// A slot can't be given away while it still holds keys
+		if id != clusterState().MyID() && clusterState().Route(slot).Mine && len(keysInSlot(slot, 1)) > 0 {
+			return nil, fmt.Errorf("Can't assign hashslot %d to a different node while I still hold keys for this hash slot.", slot)
+		}
+		return okReply(clusterState().SetSlotNode(slot, id))
+	default:
+		return nil, errors.New("Invalid CLUSTER SETSLOT action or number of arguments. Try CLUSTER HELP")
+	}
+}
+
+// keysInSlot returns up to count keys of a slot, all of them when count is negative
+func keysInSlot(slot, count int) []string {
+	keys := make([]string, 0)
+	for _, key := range databases().DB(0).KEYS() {
+		if count >= 0 && len(keys) >= count {
+			break
+		}
+		if cluster.KeySlot(key) == slot {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func clusterSlots() resp.Type {
+	items := make([]resp.Type, 0)
+	for _, n := range clusterState().Nodes() {
+		for _, r := range n.Ranges {
+			entry := []resp.Type{
+				resp.Integer{Value: r[0]},
+				resp.Integer{Value: r[1]},
+				resp.Array{Length: 3, Items: []resp.Type{bulkString(n.Host), resp.Integer{Value: n.Port}, bulkString(n.ID)}},
+			}
+			items = append(items, resp.Array{Length: len(entry), Items: entry})
+		}
+	}
+	return resp.Array{Length: len(items), Items: items}
+}
+
+func clusterShards() resp.Type {
+	shards := make([]resp.Type, 0)
+	for _, n := range clusterState().Nodes() {
+		slots := make([]resp.Type, 0)
+		for _, r := range n.Ranges {
+			slots = append(slots, resp.Integer{Value: r[0]}, resp.Integer{Value: r[1]})
+		}
+
+		health := "online"
+		if n.Failing {
+			health = "fail"
+		}
+		info := []resp.Type{
+			bulkString("id"), bulkString(n.ID),
+			bulkString("port"), resp.Integer{Value: n.Port},
+			bulkString("ip"), bulkString(n.Host),
+			bulkString("endpoint"), bulkString(n.Host),
+			bulkString("role"), bulkString("master"),
+			bulkString("replication-offset"), resp.Integer{Value: 0},
+			bulkString("health"), bulkString(health),
+		}
+
+		shard := []resp.Type{
+			bulkString("slots"), resp.Array{Length: len(slots), Items: slots},
+			bulkString("nodes"), resp.Array{Length: 1, Items: []resp.Type{resp.Array{Length: len(info), Items: info}}},
+		}
+		shards = append(shards, resp.Array{Length: len(shard), Items: shard})
+	}
+	return resp.Array{Length: len(shards), Items: shards}
+}
+
+func bulkString(s string) resp.BulkString {
+	return resp.BulkString{Value: s, Length: len(s)}
+}
+
+func bulkStrings(list []string) resp.Array {
+	items := make([]resp.Type, len(list))
+	for i, s := range list {
+		items[i] = bulkString(s)
+	}
+	return resp.Array{Length: len(items), Items: items}
+}
+
+//* DUMP, RESTORE & MIGRATE *//
+
+func handleDUMP(c *call) (resp.Type, error) {
+	data, ok := c.lookup(c.args[0])
+	if !ok {
+		return resp.Null{}, nil
+	}
+
+	payload, err := store.Dump(data.Value)
+	if err != nil {
+		return nil, err
+	}
+	return bulkString(payload), nil
+}
+
+// handleRESTORE creates a key from a DUMP payload: RESTORE key ttl payload [REPLACE] [ABSTTL]
+// It is propagated with an absolute expiry, so that replaying it later does not extend the TTL
+func handleRESTORE(c *call) (resp.Type, error) {
+	key, payload := c.args[0], c.args[2]
+
+	ttl, err := strconv.ParseInt(c.args[1], 10, 64)
+	if err != nil || ttl < 0 {
+		return nil, errors.New("Invalid TTL value, must be >= 0")
+	}
+
+	replace, absTTL := false, false
+	for _, opt := range c.args[3:] {
+		switch strings.ToUpper(opt) {
+		case "REPLACE":
+			replace = true
+		case "ABSTTL":
+			absTTL = true
+		default:
+			return nil, errors.New("syntax error")
+		}
+	}
+
+	if _, ok := c.lookup(key); ok && !replace {
+		return nil, errors.New("BUSYKEY Target key name already exists.")
+	}
+
+	value, err := store.Restore(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	data := store.Data{Value: value}
+	if ttl > 0 {
+		if absTTL {
+			data.Expiry = time.UnixMilli(ttl)
+		} else {
+			data.Expiry = time.Now().Add(time.Duration(ttl) * time.Millisecond)
+		}
+	}
+
+	c.db.SET(key, data)
+	c.propagate(restoreCommand(key, payload, data.Expiry)...)
+
+	return resp.SimpleString{Value: "OK"}, nil
+}
+
+// restoreCommand builds the canonical RESTORE of a payload, with an absolute expiry if it has one
+// It is also how the commands that write a value copied from another key are logged
+func restoreCommand(key, payload string, expiry time.Time) []string {
+	if expiry.IsZero() {
+		return []string{"RESTORE", key, "0", payload, "REPLACE"}
+	}
+	return []string{"RESTORE", key, strconv.FormatInt(expiry.UnixMilli(), 10), payload, "REPLACE", "ABSTTL"}
+}
+
+// handleMIGRATE moves keys to another node: MIGRATE host port key|"" destination-db timeout [COPY] [REPLACE] [KEYS key...]
+// The keys are sent with RESTORE-ASKING, so that the target accepts them while it imports their slot
+func handleMIGRATE(c *call) (resp.Type, error) {
+	host, port, db := c.args[0], c.args[1], c.args[3]
+
+	timeout, err := strconv.ParseInt(c.args[4], 10, 64)
+	if err != nil || timeout < 0 {
+		return nil, errors.New("value is not an integer or out of range")
+	}
+	if timeout == 0 {
+		timeout = 1000
+	}
+	if index, err := strconv.Atoi(db); err != nil || index < 0 {
+		return nil, errors.New("invalid DB index")
+	}
+
+	copyKeys, replace := false, false
+	// auth is the AUTH command sent first when the target requires a password
+	var auth []string
+	keys := []string{c.args[2]}
+	opts := c.args[5:]
+	for i := 0; i < len(opts); i++ {
+		switch strings.ToUpper(opts[i]) {
+		case "COPY":
+			copyKeys = true
+		case "REPLACE":
+			replace = true
+		case "AUTH":
+			if i+1 >= len(opts) {
+				return nil, errors.New("syntax error")
+			}
+			auth = []string{"AUTH", opts[i+1]}
+			i++
+		case "AUTH2":
+			if i+2 >= len(opts) {
+				return nil, errors.New("syntax error")
+			}
+			auth = []string{"AUTH", opts[i+1], opts[i+2]}
+			i += 2
+		case "KEYS":
+			if c.args[2] != "" {
+				return nil, errors.New("When using MIGRATE KEYS option, the key argument must be set to the empty string")
+			}
+			keys = opts[i+1:]
+			i = len(opts)
+		default:
+			return nil, errors.New("syntax error")
+		}
+	}
+
+	type entry struct {
+		key  string
+		data store.Data
+	}
+	found := make([]entry, 0, len(keys))
+	for _, key := range keys {
+		if data, ok := c.lookup(key); ok {
+			found = append(found, entry{key: key, data: data})
+		}
+	}
+	if len(found) == 0 {
+		return resp.SimpleString{Value: "NOKEY"}, nil
+	}
+
+	deadline := time.Duration(timeout) * time.Millisecond
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, port), deadline)
+	if err != nil {
+		return nil, errors.New("IOERR error or timeout connecting to the client")
+	}
+	defer conn.Close()
+	reader := resp.NewReader(conn)
+
+	if auth != nil {
+		_ = conn.SetDeadline(time.Now().Add(deadline))
+		_, err = utils.SendCommand(conn, reader, auth...)
+		if err != nil {
+			return nil, fmt.Errorf("Target instance replied with error: %s", strings.TrimPrefix(err.Error(), "error reply to AUTH: "))
+		}
+	}
+
+	if db != "0" {
+		_ = conn.SetDeadline(time.Now().Add(deadline))
+		_, err = utils.SendCommand(conn, reader, "SELECT", db)
+		if err != nil {
+			return nil, fmt.Errorf("Target instance replied with error: %s", strings.TrimPrefix(err.Error(), "error reply to SELECT: "))
+		}
+	}
+
+	for _, e := range found {
+		payload, err := store.Dump(e.data.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		ttl := int64(0)
+		if !e.data.Expiry.IsZero() {
+			ttl = max(time.Until(e.data.Expiry).Milliseconds(), 1)
+		}
+
+		argv := []string{"RESTORE-ASKING", e.key, strconv.FormatInt(ttl, 10), payload}
+		if replace {
+			argv = append(argv, "REPLACE")
+		}
+
+		_ = conn.SetDeadline(time.Now().Add(deadline))
+		_, err = utils.SendCommand(conn, reader, argv...)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				return nil, errors.New("IOERR error or timeout reading to target instance")
+			}
+			return nil, fmt.Errorf("Target instance replied with error: %s", strings.TrimPrefix(err.Error(), "error reply to RESTORE-ASKING: "))
+		}
+	}
+
+	if copyKeys {
+		c.dontPropagate()
+		return resp.SimpleString{Value: "OK"}, nil
+	}
+
+	for _, e := range found {
+		_ = c.db.DEL(e.key)
+		c.propagate("DEL", e.key)
+	}
+
+	return resp.SimpleString{Value: "OK"}, nil
+}
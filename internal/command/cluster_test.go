@@ -0,0 +1,131 @@
+package command
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DNahar74/PulseDB/internal/cluster"
+	"github.com/DNahar74/PulseDB/internal/resp"
+	"github.com/DNahar74/PulseDB/internal/store"
+)
+
+const (
+	myID    = "1111111111111111111111111111111111111111"
+	otherID = "2222222222222222222222222222222222222222"
+)
+
+// setupCluster starts a node from a config file where it serves slots 0-8191 & another node serves 8192-16383
+func setupCluster(t *testing.T) *cluster.Cluster {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "nodes.conf")
+	conf := myID + " 127.0.0.1:7000@17000 myself,master - 0 0 1 connected 0-8191\n" +
+		otherID + " 127.0.0.1:7001@17001 master - 0 0 2 connected 8192-16383\n" +
+		"vars currentEpoch 2 lastVoteEpoch 0\n"
+	if err := os.WriteFile(path, []byte(conf), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := cluster.New("127.0.0.1", 7000, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	InitDatabases(store.CreateDatabases(16))
+	InitCluster(c)
+	t.Cleanup(func() { InitCluster(nil) })
+
+	return c
+}
+
+func TestClusterRedirects(t *testing.T) {
+	c := setupCluster(t)
+	sess := NewSession()
+
+	// "bar" hashes to slot 5061 on this node & "foo" to slot 12182 on the other one
+	tests := []struct {
+		name    string
+		command []string
+		wantErr string
+	}{
+		{name: "local slot", command: []string{"SET", "bar", "1"}},
+		{name: "remote slot", command: []string{"GET", "foo"}, wantErr: "MOVED 12182 127.0.0.1:7001"},
+		{name: "keyless command", command: []string{"PING"}},
+		{name: "hashtag", command: []string{"SET", "{bar}x", "1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := HandleCommands(sess, newCommand(tt.command...))
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Fatalf("error = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+
+	// A migrating slot answers for the keys it still has & sends the others to the target
+	if err := c.SetSlotMigrating(5061, otherID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := HandleCommands(sess, newCommand("GET", "bar")); err != nil {
+		t.Errorf("GET of a key still on the source: %v", err)
+	}
+	if err := databases().DB(0).DEL("bar"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := HandleCommands(sess, newCommand("GET", "bar")); err == nil || err.Error() != "ASK 5061 127.0.0.1:7001" {
+		t.Errorf("GET of a migrated key: %v, want ASK", err)
+	}
+
+	// An importing slot only accepts commands right after ASKING
+	if err := c.SetSlotImporting(12182, otherID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := HandleCommands(sess, newCommand("SET", "foo", "1")); err == nil {
+		t.Error("SET on an importing slot succeeded without ASKING")
+	}
+	if _, err := HandleCommands(sess, newCommand("ASKING")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := HandleCommands(sess, newCommand("SET", "foo", "1")); err != nil {
+		t.Errorf("SET after ASKING: %v", err)
+	}
+	if _, err := HandleCommands(sess, newCommand("GET", "foo")); err == nil {
+		t.Error("ASKING applied to more than one command")
+	}
+}
+
+func TestDumpRestore(t *testing.T) {
+	setupCluster(t)
+	sess := NewSession()
+
+	if _, err := HandleCommands(sess, newCommand("SET", "bar", "42")); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := HandleCommands(sess, newCommand("DUMP", "bar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := reply.(resp.BulkString).Value
+
+	if _, err := HandleCommands(sess, newCommand("RESTORE", "bar", "0", payload)); err == nil {
+		t.Error("RESTORE over an existing key succeeded without REPLACE")
+	}
+	if _, err := HandleCommands(sess, newCommand("RESTORE", "{bar}copy", "0", payload)); err != nil {
+		t.Fatal(err)
+	}
+
+	data, ok := databases().DB(0).Lookup("{bar}copy")
+	if !ok || data.Value != store.NewInt(42) {
+		t.Errorf("restored value = %v, want the integer 42", data.Value)
+	}
+
+	corrupted := payload[:len(payload)-1] + "x"
+	if _, err := HandleCommands(sess, newCommand("RESTORE", "{bar}bad", "0", corrupted)); err == nil {
+		t.Error("RESTORE of a corrupted payload succeeded")
+	}
+}
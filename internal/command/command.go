@@ -3,21 +3,82 @@ package command
 import (
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/DNahar74/PulseDB/internal/acl"
 	"github.com/DNahar74/PulseDB/internal/resp"
 	"github.com/DNahar74/PulseDB/internal/store"
 )
 
-var redisStore *store.Store
+// handle holds what the server passes to this package with the Init functions
+// A server started after another one replaces it while the goroutines of the first one may still read it
+type handle[T any] struct {
+	p atomic.Pointer[T]
+}
+
+// get returns the value passed by the server, or the zero value before it is passed
+func (h *handle[T]) get() T {
+	if p := h.p.Load(); p != nil {
+		return *p
+	}
+	var zero T
+	return zero
+}
+
+func (h *handle[T]) set(v T) {
+	h.p.Store(&v)
+}
+
+var databasesHandle handle[*store.Databases]
+
+func databases() *store.Databases {
+	return databasesHandle.get()
+}
+
+// InitDatabases passes the server's databases for access in this package
+func InitDatabases(d *store.Databases) {
+	databasesHandle.set(d)
+
+	// The first command propagated for the new databases starts with a SELECT
+	propagateMu.Lock()
+	defer propagateMu.Unlock()
+	aofDB, replDB = -1, -1
+}
 
-// InitStore passes the RedisStore global variable's pointer for access in this package
-func InitStore(rs *store.Store) {
-	redisStore = rs
+// Session holds the state of a client connection between its commands
+type Session struct {
+	// id is a unique number given to every connection
+	id int64
+	// db is the index of the selected database
+	db int
+	// asking is set by ASKING & lets the next command run on a slot being imported
+	asking bool
+	// addr is the address of the client, name the one it gave itself
+	addr string
+	name string
+	// user runs the commands, authenticated is set by AUTH or on creation when no password is required
+	user          *acl.User
+	authenticated bool
+	// repliesOff & skipReplies are set by CLIENT REPLY, noEvict by CLIENT NO-EVICT
+	repliesOff  bool
+	skipReplies int
+	noEvict     bool
+}
+
+// lastSessionID is the id of the last session created
+var lastSessionID atomic.Int64
+
+// NewSession creates the state of a new client connection
+func NewSession() *Session {
+	return &Session{id: lastSessionID.Add(1), user: accessControl().DefaultUser(), authenticated: !accessControl().AuthRequired()}
 }
 
 // HandleCommands takes a Type and handles it based on the command type
-func HandleCommands(commands resp.Type) (resp.Type, error) {
+func HandleCommands(sess *Session, commands resp.Type) (resp.Type, error) {
 	switch commands.(type) {
 	case resp.SimpleString:
 		val, err := handleSimpleString(commands)
@@ -48,17 +109,15 @@ func HandleCommands(commands resp.Type) (resp.Type, error) {
 
 		return val, nil
 	case resp.Array:
-		val, err := handleArray(commands)
+		val, err := handleArray(sess, commands)
 		if err != nil {
 			return nil, err
 		}
 
 		return val, nil
 	default:
-		fmt.Printf("Unknown type: %T", commands)
+		return nil, errors.New("invalid datatype")
 	}
-
-	return nil, nil
 }
 
 func handleSimpleString(command resp.Type) (resp.Type, error) {
@@ -89,77 +148,320 @@ func handleBulkString(command resp.Type) (resp.Type, error) {
 	return nil, errors.New("invalid datatype")
 }
 
-func handleArray(command resp.Type) (resp.Type, error) {
+func handleArray(sess *Session, command resp.Type) (resp.Type, error) {
 	if str, ok := command.(resp.Array); ok {
-		// If the command is an array, check if the first element is a BulkString(all command names are BulkStrings)
-		if cmd, ok := str.Items[0].(resp.BulkString); ok {
-			switch strings.ToUpper(cmd.Value) {
-			case "PING":
-				v := handlePING()
-				return v, nil
-			case "ECHO":
-				if len(str.Items) < 2 {
-					return nil, errors.New("ECHO requires an argument")
-				}
-				v, err := handleECHO(str.Items[1])
-				if err != nil {
-					return nil, err
-				}
-				return v, nil
-			case "SET":
-				if len(str.Items) < 3 {
-					return nil, errors.New("SET requires a key and a value")
-				} else if len(str.Items) == 3 {
-					v, err := handleSET(str.Items[1], str.Items[2])
-					if err != nil {
-						return nil, err
-					}
-					return v, nil
-				} else {
-					v, err := handleSET(str.Items[1], str.Items[2], str.Items[3:]...)
-					if err != nil {
-						return nil, err
-					}
-					return v, nil
-				}
-			case "GET":
-				if len(str.Items) < 2 {
-					return nil, errors.New("GET requires a key")
-				} else if len(str.Items) > 2 {
-					return nil, errors.New("GET supports only one key")
-				}
-				v, err := handleGET(str.Items[1])
-				if err != nil {
-					return nil, err
-				}
-				return v, nil
-			case "DEL":
-				if len(str.Items) < 2 {
-					return nil, errors.New("DEL requires a key")
-				} else if len(str.Items) > 2 {
-					return nil, errors.New("DEL supports only one key")
-				}
-				v, err := handleDEL(str.Items[1])
-				if err != nil {
-					return nil, err
-				}
-				return v, nil
-			case "INCR":
-				if len(str.Items) < 2 {
-					return nil, errors.New("INCR requires a key")
-				} else if len(str.Items) > 2 {
-					return nil, errors.New("INCR supports only one key")
-				}
-				v, err := handleIncr(str.Items[1])
-				if err != nil {
-					return nil, err
-				}
-				return v, nil
-			default:
-				return nil, errors.New("unknown Command")
+		return dispatch(sess, str, originClient)
+	}
+	return nil, errors.New("invalid datatype")
+}
+
+// ReplayCommands executes a command read back from the AOF, without propagating it again
+// The same session is used for the whole file, so that its SELECT commands apply to the commands after them
+func ReplayCommands(sess *Session, commands resp.Type) error {
+	str, ok := commands.(resp.Array)
+	if !ok {
+		return errors.New("invalid datatype")
+	}
+
+	_, err := dispatch(sess, str, originAOF)
+	return err
+}
+
+// ApplyReplicated executes a command received from the primary on a replica
+// The same session is used for the whole replication stream
+func ApplyReplicated(sess *Session, commands resp.Type) error {
+	str, ok := commands.(resp.Array)
+	if !ok {
+		return errors.New("invalid datatype")
+	}
+
+	_, err := dispatch(sess, str, originMaster)
+	return err
+}
+
+// Where a command comes from, which decides where it is propagated
+const (
+	// originClient commands are propagated to the AOF & the replicas
+	originClient = iota
+	// originAOF commands are already in the AOF, they are not propagated
+	originAOF
+	// originMaster commands are logged to the AOF, the replication link forwards the stream to the replicas itself
+	originMaster
+)
+
+// call holds a single invocation of a command
+type call struct {
+	cmd     *commandSpec
+	args    []string
+	session *Session
+	// db is the selected database
+	db *store.Store
+	// origin tells where the command comes from, a replayed command must not depend on when it is replayed
+	origin int
+
+	// propagated replaces the original command in the AOF when rewritten is set
+	propagated []propagation
+	rewritten  bool
+}
+
+// propagation is a command logged in the AOF & sent to the replicas, with the database it applies to
+type propagation struct {
+	db   int
+	argv []string
+}
+
+// propagate records the deterministic form of the command that is logged instead of the original one
+// It can be called several times, or not at all to log nothing
+func (c *call) propagate(argv ...string) {
+	c.propagateTo(c.session.db, argv...)
+}
+
+// propagateTo is propagate for a command that applies to another database than the selected one
+func (c *call) propagateTo(db int, argv ...string) {
+	c.rewritten = true
+	if len(argv) > 0 {
+		c.propagated = append(c.propagated, propagation{db: db, argv: argv})
+	}
+}
+
+// now is the time the command sees the expiries at
+// A replayed command sees nothing expired, like the data was when it was logged, the deletions that followed are logged
+func (c *call) now() time.Time {
+	if c.origin == originClient {
+		return time.Now()
+	}
+	return time.Time{}
+}
+
+// lookup finds a key in the selected database, the lookups of the read-only commands count as keyspace hits & misses
+func (c *call) lookup(key string) (store.Data, bool) {
+	return c.lookupAt(key, time.Now())
+}
+
+// lookupAt is lookup at a given time, nothing has expired at the zero time
+// The lookups of the clients count as accesses for the eviction policies, the replayed commands leave them as they are
+func (c *call) lookupAt(key string, now time.Time) (store.Data, bool) {
+	data, ok := c.db.LookupAt(key, now)
+	if ok && c.origin == originClient {
+		data.Touch()
+	}
+	if c.cmd.is(flagReadOnly) {
+		c.db.CountLookup(ok)
+	}
+	return data, ok
+}
+
+// dontPropagate stops a write command that did not change anything from being logged
+func (c *call) dontPropagate() {
+	c.rewritten = true
+}
+
+// propagateValue logs a value modified in place as a RESTORE when its key has a TTL, because the command replayed after
+// the expiry would create the key again without it, & leaves the command to be logged as is otherwise
+func (c *call) propagateValue(key string, v resp.Type, expiry time.Time) error {
+	if expiry.IsZero() {
+		return nil
+	}
+	payload, err := store.Dump(v)
+	if err != nil {
+		return err
+	}
+	c.propagate(restoreCommand(key, payload, expiry)...)
+	return nil
+}
+
+// propagateUpdate leaves a command that updates the value of a key in place to be logged as is, it replays to the same
+// value whatever its size, & the key keeps its TTL
+// It must be called before the update: a key that exists but has expired is deleted first in the log, because the
+// replayed command sees the keys that have expired since & would update the old value
+func (c *call) propagateUpdate(key string, found bool) {
+	if found {
+		return
+	}
+	if _, ok := c.db.LookupAt(key, time.Time{}); !ok {
+		return
+	}
+	c.propagate("DEL", key)
+	c.propagate(append([]string{strings.ToUpper(c.cmd.name)}, c.args...)...)
+}
+
+// parseCommand finds the command spec for an array of BulkStrings & checks its arguments
+func parseCommand(str resp.Array) (*commandSpec, []string, error) {
+	if len(str.Items) == 0 {
+		return nil, nil, errors.New("not a valid command format")
+	}
+
+	// All command names & arguments are BulkStrings
+	argv := make([]string, len(str.Items))
+	for i, item := range str.Items {
+		bs, ok := item.(resp.BulkString)
+		if !ok {
+			return nil, nil, errors.New("not a valid command format")
+		}
+		argv[i] = bs.Value
+	}
+
+	cmd, ok := lookupCommand(argv[0])
+	if !ok {
+		return nil, nil, errors.New("unknown Command")
+	}
+	if !cmd.checkArity(len(argv)) {
+		return nil, nil, fmt.Errorf("wrong number of arguments for '%s' command", cmd.name)
+	}
+
+	return cmd, argv, nil
+}
+
+func dispatch(sess *Session, str resp.Array, origin int) (resp.Type, error) {
+	cmd, argv, err := parseCommand(str)
+	if err != nil {
+		return nil, err
+	}
+
+	if origin == originClient {
+		err = authorize(sess, cmd, argv)
+		if err != nil {
+			return reject(cmd, err)
+		}
+		waitPause(cmd)
+	}
+
+	// ASKING only applies to the command right after it
+	asking := sess.asking || cmd.is(flagAsking)
+	sess.asking = false
+
+	if !cmd.is(flagWrite) {
+		execLock.RLock()
+		defer execLock.RUnlock()
+
+		if origin == originClient {
+			err = routeCommand(cmd, argv, asking)
+			if err != nil {
+				return reject(cmd, err)
 			}
 		}
-		return nil, errors.New("not a valid command format")
+		return execute(sess, cmd, argv, origin)
 	}
-	return nil, errors.New("invalid datatype")
+
+	if origin == originClient && replication() != nil && replication().IsReplica() {
+		return reject(cmd, errors.New("READONLY You can't write against a read only replica."))
+	}
+
+	execLock.Lock()
+	defer execLock.Unlock()
+
+	if origin == originClient {
+		err = routeCommand(cmd, argv, asking)
+		if err != nil {
+			return reject(cmd, err)
+		}
+
+		// Replicas don't evict, the primary propagates the deletion of its evicted keys
+		if cmd.is(flagDenyOOM) {
+			err = performEvictions()
+			if err != nil {
+				return reject(cmd, err)
+			}
+		}
+	}
+	return execute(sess, cmd, argv, origin)
+}
+
+// performEvictions makes room for a command that may use more memory, the caller must hold the execLock
+func performEvictions() error {
+	evicted, err := databases().Evict()
+	for _, e := range evicted {
+		propagate(e.DB, []string{"DEL", e.Key}, true)
+	}
+	return err
+}
+
+// execute runs a command & propagates it, the caller must hold the execLock
+func execute(sess *Session, cmd *commandSpec, argv []string, origin int) (resp.Type, error) {
+	c := &call{cmd: cmd, args: argv[1:], session: sess, db: databases().DB(sess.db), origin: origin}
+
+	// The administrative commands are not shown to the monitors, neither is the AOF loaded on startup
+	if origin != originAOF && !cmd.is(flagAdmin) {
+		feedMonitors(sess, argv)
+	}
+
+	// Only the handler is timed, not the wait for a pause or for the execLock
+	start := time.Now()
+	v, err := cmd.handler(c)
+	duration := time.Since(start)
+	cmd.stats.record(duration, err)
+	if origin == originClient {
+		logSlow(sess, argv, duration)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if cmd.is(flagWrite) && origin != originAOF {
+		if !c.rewritten {
+			c.propagated = []propagation{{db: sess.db, argv: argv}}
+		}
+		for _, p := range c.propagated {
+			propagate(p.db, p.argv, origin == originClient)
+		}
+	}
+
+	return v, nil
+}
+
+// The database selected in the AOF & in the replication stream, -1 when the next command must be preceded by a SELECT
+var (
+	propagateMu sync.Mutex
+	aofDB       = -1
+	replDB      = -1
+)
+
+// resetReplicationDB makes the next command sent to the replicas start with a SELECT
+func resetReplicationDB() {
+	propagateMu.Lock()
+	defer propagateMu.Unlock()
+
+	replDB = -1
+}
+
+// propagate sends a command to the AOF writer & optionally to the replicas
+// A SELECT is sent first when the command applies to another database than the previous one
+func propagate(db int, argv []string, toReplicas bool) {
+	str, err := serializeCommand(argv)
+	if err != nil {
+		fmt.Println("Error serializing command for propagation:", err)
+		return
+	}
+
+	selectDB, err := serializeCommand([]string{"SELECT", strconv.Itoa(db)})
+	if err != nil {
+		fmt.Println("Error serializing command for propagation:", err)
+		return
+	}
+
+	propagateMu.Lock()
+	defer propagateMu.Unlock()
+
+	if aofDB != db {
+		databases().AOFChan <- selectDB
+		aofDB = db
+	}
+	databases().AOFChan <- str
+
+	if toReplicas && replication() != nil {
+		if replDB != db {
+			replication().Feed(selectDB)
+			replDB = db
+		}
+		replication().Feed(str)
+	}
+}
+
+func serializeCommand(argv []string) (string, error) {
+	items := make([]resp.Type, len(argv))
+	for i, a := range argv {
+		items[i] = resp.BulkString{Value: a, Length: len(a)}
+	}
+
+	return resp.Array{Length: len(items), Items: items}.Serialize()
 }
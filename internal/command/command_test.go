@@ -0,0 +1,167 @@
+package command
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DNahar74/PulseDB/internal/resp"
+	"github.com/DNahar74/PulseDB/internal/store"
+)
+
+func newCommand(args ...string) resp.Array {
+	items := make([]resp.Type, len(args))
+	for i, a := range args {
+		items[i] = resp.BulkString{Value: a, Length: len(a)}
+	}
+	return resp.Array{Length: len(items), Items: items}
+}
+
+// drainAOF returns every command propagated since the last call
+func drainAOF(d *store.Databases) []string {
+	cmds := make([]string, 0)
+	for {
+		select {
+		case c := <-d.AOFChan:
+			cmds = append(cmds, c)
+		default:
+			return cmds
+		}
+	}
+}
+
+func TestPropagation(t *testing.T) {
+	d := store.CreateDatabases(16)
+	InitDatabases(d)
+
+	tests := []struct {
+		name    string
+		command []string
+		want    []string
+	}{
+		{
+			name:    "PING is not propagated",
+			command: []string{"PING"},
+			want:    []string{},
+		},
+		{
+			name:    "SET is propagated as is",
+			command: []string{"SET", "key", "value"},
+			want:    []string{"*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n"},
+		},
+		{
+			name:    "GET is not propagated",
+			command: []string{"GET", "key"},
+			want:    []string{},
+		},
+		{
+			name:    "INCR is propagated as SET",
+			command: []string{"INCR", "counter"},
+			want:    []string{"*3\r\n$3\r\nSET\r\n$7\r\ncounter\r\n$1\r\n8\r\n"},
+		},
+		{
+			name:    "Failed commands are not propagated",
+			command: []string{"INCR", "key"},
+			want:    []string{},
+		},
+	}
+
+	_, err := HandleCommands(NewSession(), newCommand("SET", "counter", "7"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	drainAOF(d)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _ = HandleCommands(NewSession(), newCommand(tt.command...))
+			got := drainAOF(d)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("propagated %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPropagateRelativeExpiry(t *testing.T) {
+	d := store.CreateDatabases(16)
+	InitDatabases(d)
+
+	_, err := HandleCommands(NewSession(), newCommand("SET", "key", "value", "EX", "100"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The first propagated command is the SELECT of the database
+	got := drainAOF(d)
+	if len(got) != 2 || !strings.Contains(got[1], "PXAT") || strings.Contains(got[1], "EX\r\n") {
+		t.Errorf("expected SET with an absolute PXAT expiry, got %q", got)
+	}
+}
+
+func TestMaxMemory(t *testing.T) {
+	d := store.CreateDatabases(16)
+	InitDatabases(d)
+
+	_, err := HandleCommands(NewSession(), newCommand("SET", "old", "value"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	drainAOF(d)
+
+	d.SetMaxMemory(1, store.NoEviction)
+	_, err = HandleCommands(NewSession(), newCommand("SET", "new", "value"))
+	if err == nil || !strings.HasPrefix(err.Error(), "OOM") {
+		t.Errorf("SET over maxmemory with noeviction: %v, want an OOM error", err)
+	}
+	if _, err := HandleCommands(NewSession(), newCommand("GET", "old")); err != nil {
+		t.Errorf("GET over maxmemory: %v", err)
+	}
+
+	// The evicted key is deleted from the AOF before the command that needed the memory
+	d.SetMaxMemory(1, store.AllKeysLRU)
+	_, err = HandleCommands(NewSession(), newCommand("SET", "new", "value"))
+	if err != nil {
+		t.Fatalf("SET with allkeys-lru: %v", err)
+	}
+	got := drainAOF(d)
+	if len(got) != 2 || got[0] != "*2\r\n$3\r\nDEL\r\n$3\r\nold\r\n" {
+		t.Errorf("propagated %q, want DEL old then SET", got)
+	}
+}
+
+func TestEvictionTouch(t *testing.T) {
+	d := store.CreateDatabases(1)
+	InitDatabases(d)
+	sess := NewSession()
+
+	// The hot keys are created first, but they are read afterwards by commands other than GET
+	for i := range 10 {
+		run(t, sess, "HSET", "hot"+strconv.Itoa(i), "f", "v")
+	}
+	time.Sleep(20 * time.Millisecond)
+	for i := range 40 {
+		run(t, sess, "HSET", "cold"+strconv.Itoa(i), "f", "v")
+	}
+	time.Sleep(20 * time.Millisecond)
+	for i := range 10 {
+		key := "hot" + strconv.Itoa(i)
+		run(t, sess, "HGET", key, "f")
+		run(t, sess, "EXISTS", key)
+	}
+
+	d.SetMaxMemory(d.DB(0).UsedMemory()/2, store.AllKeysLRU)
+	run(t, sess, "SET", "new", "v")
+
+	evicted := 0
+	for i := range 10 {
+		if reply := run(t, sess, "EXISTS", "hot"+strconv.Itoa(i)); reply != (resp.Integer{Value: 1}) {
+			evicted++
+		}
+	}
+	// Sampling is approximate, but the keys read recently should survive
+	if evicted > 2 {
+		t.Errorf("evicted %d of the keys read with HGET & EXISTS", evicted)
+	}
+}
@@ -0,0 +1,69 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/DNahar74/PulseDB/internal/resp"
+)
+
+// ConfigHandler gives CONFIG access to the settings of the server
+type ConfigHandler interface {
+	// GetConfig returns the names & the values of the parameters matching glob patterns
+	GetConfig(patterns []string) []string
+	// SetConfig changes parameters from name/value pairs, all of them or none
+	SetConfig(pairs []string) error
+	// RewriteConfig writes the settings back to the config file
+	RewriteConfig() error
+}
+
+var configHandle handle[ConfigHandler]
+
+func configuration() ConfigHandler {
+	return configHandle.get()
+}
+
+// InitConfig passes the server's settings for access in this package
+func InitConfig(c ConfigHandler) {
+	configHandle.set(c)
+}
+
+func handleCONFIG(c *call) (resp.Type, error) {
+	sub, args := strings.ToUpper(c.args[0]), c.args[1:]
+	if configuration() == nil && sub != "RESETSTAT" {
+		return nil, errors.New("CONFIG is not available")
+	}
+
+	switch sub {
+	case "GET":
+		if len(args) == 0 {
+			return nil, errors.New("wrong number of arguments for 'config|get' command")
+		}
+		return bulkStrings(configuration().GetConfig(args)), nil
+	case "SET":
+		if len(args) == 0 || len(args)%2 != 0 {
+			return nil, errors.New("wrong number of arguments for 'config|set' command")
+		}
+		err := configuration().SetConfig(args)
+		if err != nil {
+			return nil, err
+		}
+		return resp.SimpleString{Value: "OK"}, nil
+	case "REWRITE", "RESETSTAT":
+		if len(args) != 0 {
+			return nil, fmt.Errorf("wrong number of arguments for 'config|%s' command", strings.ToLower(sub))
+		}
+		if sub == "RESETSTAT" {
+			resetStats()
+			return resp.SimpleString{Value: "OK"}, nil
+		}
+		err := configuration().RewriteConfig()
+		if err != nil {
+			return nil, fmt.Errorf("Rewriting config file: %v", err)
+		}
+		return resp.SimpleString{Value: "OK"}, nil
+	default:
+		return nil, fmt.Errorf("unknown subcommand '%s'. Try CONFIG HELP.", c.args[0])
+	}
+}
@@ -0,0 +1,124 @@
+package command
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/DNahar74/PulseDB/internal/resp"
+)
+
+var errDBIndexOutOfRange = errors.New("DB index is out of range")
+
+// parseDBIndex reads the index of a database
+func parseDBIndex(s string) (int, error) {
+	index, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, errors.New("value is not an integer or out of range")
+	}
+	if index < 0 || index >= databases().Len() {
+		return 0, errDBIndexOutOfRange
+	}
+	return index, nil
+}
+
+// parseFlushMode checks the optional ASYNC or SYNC argument of FLUSHDB & FLUSHALL
+// Both modes are the same here: the old keys are only dropped, the garbage collector frees them in the background
+func parseFlushMode(args []string) error {
+	if len(args) > 1 {
+		return errors.New("syntax error")
+	}
+	if len(args) == 1 && !strings.EqualFold(args[0], "ASYNC") && !strings.EqualFold(args[0], "SYNC") {
+		return errors.New("syntax error")
+	}
+	return nil
+}
+
+func handleSELECT(c *call) (resp.Type, error) {
+	index, err := parseDBIndex(c.args[0])
+	if err != nil {
+		return nil, err
+	}
+	if clusterState() != nil && index != 0 {
+		return nil, errors.New("SELECT is not allowed in cluster mode")
+	}
+
+	c.session.db = index
+	return resp.SimpleString{Value: "OK"}, nil
+}
+
+func handleDBSIZE(c *call) (resp.Type, error) {
+	return resp.Integer{Value: c.db.Size()}, nil
+}
+
+func handleMOVE(c *call) (resp.Type, error) {
+	if clusterState() != nil {
+		return nil, errors.New("MOVE is not allowed in cluster mode")
+	}
+
+	key := c.args[0]
+	index, err := parseDBIndex(c.args[1])
+	if err != nil {
+		return nil, err
+	}
+	if index == c.session.db {
+		return nil, errors.New("source and destination objects are the same")
+	}
+	dst := databases().DB(index)
+
+	data, ok := c.lookup(key)
+	if !ok {
+		c.dontPropagate()
+		return resp.Integer{Value: 0}, nil
+	}
+	if _, ok := dst.Lookup(key); ok {
+		c.dontPropagate()
+		return resp.Integer{Value: 0}, nil
+	}
+
+	dst.SET(key, data)
+	_ = c.db.DEL(key)
+
+	return resp.Integer{Value: 1}, nil
+}
+
+func handleSWAPDB(c *call) (resp.Type, error) {
+	if clusterState() != nil {
+		return nil, errors.New("SWAPDB is not allowed in cluster mode")
+	}
+
+	a, err := strconv.Atoi(c.args[0])
+	if err != nil {
+		return nil, errors.New("invalid first DB index")
+	}
+	b, err := strconv.Atoi(c.args[1])
+	if err != nil {
+		return nil, errors.New("invalid second DB index")
+	}
+	if a < 0 || a >= databases().Len() || b < 0 || b >= databases().Len() {
+		return nil, errDBIndexOutOfRange
+	}
+
+	databases().Swap(a, b)
+	return resp.SimpleString{Value: "OK"}, nil
+}
+
+func handleFLUSHDB(c *call) (resp.Type, error) {
+	err := parseFlushMode(c.args)
+	if err != nil {
+		return nil, err
+	}
+
+	c.db.FLUSH()
+	return resp.SimpleString{Value: "OK"}, nil
+}
+
+func handleFLUSHALL(c *call) (resp.Type, error) {
+	err := parseFlushMode(c.args)
+	if err != nil {
+		return nil, err
+	}
+
+	databases().FlushAll()
+	return resp.SimpleString{Value: "OK"}, nil
+}
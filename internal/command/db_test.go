@@ -0,0 +1,107 @@
+package command
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/DNahar74/PulseDB/internal/resp"
+	"github.com/DNahar74/PulseDB/internal/store"
+)
+
+// run executes a command & fails the test on error
+func run(t *testing.T, sess *Session, args ...string) resp.Type {
+	t.Helper()
+
+	reply, err := HandleCommands(sess, newCommand(args...))
+	if err != nil {
+		t.Fatalf("%s: %v", strings.Join(args, " "), err)
+	}
+	return reply
+}
+
+func TestSelect(t *testing.T) {
+	d := store.CreateDatabases(4)
+	InitDatabases(d)
+	sess := NewSession()
+
+	run(t, sess, "SET", "key", "zero")
+	run(t, sess, "SELECT", "1")
+	if _, err := HandleCommands(sess, newCommand("GET", "key")); err == nil {
+		t.Error("GET in database 1 found the key of database 0")
+	}
+	run(t, sess, "SET", "key", "one")
+
+	// Sessions select their database independently
+	if reply := run(t, NewSession(), "GET", "key"); reply != (resp.BulkString{Value: "zero", Length: 4}) {
+		t.Errorf("GET in database 0 = %v", reply)
+	}
+
+	for _, index := range []string{"4", "-1", "x"} {
+		if _, err := HandleCommands(sess, newCommand("SELECT", index)); err == nil {
+			t.Errorf("SELECT %s succeeded", index)
+		}
+	}
+}
+
+func TestMoveSwapFlush(t *testing.T) {
+	d := store.CreateDatabases(4)
+	InitDatabases(d)
+	sess := NewSession()
+
+	run(t, sess, "SET", "a", "1")
+	run(t, sess, "SET", "b", "1")
+	d.DB(2).SET("b", store.Data{Value: resp.BulkString{Value: "2", Length: 1}})
+
+	if reply := run(t, sess, "MOVE", "a", "2"); reply != (resp.Integer{Value: 1}) {
+		t.Errorf("MOVE a = %v, want 1", reply)
+	}
+	if reply := run(t, sess, "MOVE", "b", "2"); reply != (resp.Integer{Value: 0}) {
+		t.Errorf("MOVE to a database with the key = %v, want 0", reply)
+	}
+	if _, err := HandleCommands(sess, newCommand("MOVE", "b", "0")); err == nil {
+		t.Error("MOVE to the same database succeeded")
+	}
+	if d.DB(0).Size() != 1 || d.DB(2).Size() != 2 {
+		t.Fatalf("sizes after MOVE: %d & %d", d.DB(0).Size(), d.DB(2).Size())
+	}
+
+	run(t, sess, "SWAPDB", "0", "2")
+	if reply := run(t, sess, "DBSIZE"); reply != (resp.Integer{Value: 2}) {
+		t.Errorf("DBSIZE after SWAPDB = %v, want 2", reply)
+	}
+
+	run(t, sess, "FLUSHDB", "ASYNC")
+	if d.DB(0).Size() != 0 || d.DB(2).Size() != 1 {
+		t.Errorf("FLUSHDB flushed %d & %d keys left", d.DB(0).Size(), d.DB(2).Size())
+	}
+	run(t, sess, "FLUSHALL")
+	if d.UsedMemory() != 0 {
+		t.Errorf("used memory after FLUSHALL = %d", d.UsedMemory())
+	}
+}
+
+func TestPropagateSelect(t *testing.T) {
+	d := store.CreateDatabases(4)
+	InitDatabases(d)
+	sess := NewSession()
+
+	run(t, sess, "SET", "a", "1")
+	run(t, sess, "SELECT", "3")
+	run(t, sess, "SET", "b", "1")
+	run(t, sess, "SET", "c", "1")
+
+	// SELECT itself is not propagated, it is sent when the database of the written keys changes
+	want := []string{"SELECT 0", "SET a 1", "SELECT 3", "SET b 1", "SET c 1"}
+	got := make([]string, 0)
+	for _, c := range drainAOF(d) {
+		parts := strings.Split(strings.TrimSuffix(c, "\r\n"), "\r\n")
+		args := make([]string, 0)
+		for i := 2; i < len(parts); i += 2 {
+			args = append(args, parts[i])
+		}
+		got = append(got, strings.Join(args, " "))
+	}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("propagated %q, want %q", got, want)
+	}
+}
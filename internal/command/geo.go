@@ -0,0 +1,527 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DNahar74/PulseDB/internal/geohash"
+	"github.com/DNahar74/PulseDB/internal/resp"
+	"github.com/DNahar74/PulseDB/internal/store"
+)
+
+var errGeoUnit = errors.New("unsupported unit provided. please use M, KM, FT, MI")
+
+// geoUnits gives the number of meters of every unit accepted by the geo commands
+var geoUnits = map[string]float64{
+	"m":  1,
+	"km": 1000,
+	"ft": 0.3048,
+	"mi": 1609.34,
+}
+
+func parseGeoUnit(s string) (float64, error) {
+	unit, ok := geoUnits[strings.ToLower(s)]
+	if !ok {
+		return 0, errGeoUnit
+	}
+	return unit, nil
+}
+
+func parseGeoFloat(s string) (float64, error) {
+	f, err := store.ParseFloat(s)
+	if err != nil {
+		return 0, errors.New("value is not a valid float")
+	}
+	return f, nil
+}
+
+// parseCoordinates reads a longitude & a latitude, which must be within the limits of the geohashes
+func parseCoordinates(longStr, latStr string) (float64, float64, error) {
+	long, err := parseGeoFloat(longStr)
+	if err != nil {
+		return 0, 0, err
+	}
+	lat, err := parseGeoFloat(latStr)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !geohash.Valid(long, lat) {
+		return 0, 0, fmt.Errorf("invalid longitude,latitude pair %f,%f", long, lat)
+	}
+	return long, lat, nil
+}
+
+// lookupGeo returns the geo index stored at a key, & false if the key does not exist
+func lookupGeo(c *call, key string) (*store.GeoIndex, store.Data, bool, error) {
+	data, ok := c.lookup(key)
+	if !ok {
+		return nil, store.Data{}, false, nil
+	}
+	g, ok := data.Value.(*store.GeoIndex)
+	if !ok {
+		return nil, store.Data{}, false, store.ErrWrongType
+	}
+	return g, data, true, nil
+}
+
+func formatCoordinate(f float64) resp.Type {
+	return bulkString(strconv.FormatFloat(f, 'f', -1, 64))
+}
+
+func formatDistance(meters, unit float64) resp.Type {
+	return bulkString(strconv.FormatFloat(meters/unit, 'f', 4, 64))
+}
+
+// handleGEOADD adds members at coordinates: GEOADD key [NX|XX] [CH] longitude latitude member [...]
+// It returns the number of members added, or added & moved with CH
+func handleGEOADD(c *call) (resp.Type, error) {
+	key := c.args[0]
+
+	nx, xx, ch := false, false, false
+	i := 1
+options:
+	for ; i < len(c.args); i++ {
+		switch strings.ToUpper(c.args[i]) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "CH":
+			ch = true
+		default:
+			break options
+		}
+	}
+	if nx && xx {
+		return nil, errors.New("XX and NX options at the same time are not compatible")
+	}
+
+	triplets := c.args[i:]
+	if len(triplets) == 0 || len(triplets)%3 != 0 {
+		return nil, errors.New("syntax error")
+	}
+	scores := make([]uint64, 0, len(triplets)/3)
+	for j := 0; j < len(triplets); j += 3 {
+		long, lat, err := parseCoordinates(triplets[j], triplets[j+1])
+		if err != nil {
+			return nil, err
+		}
+		scores = append(scores, geohash.Encode(long, lat))
+	}
+
+	g, data, exists, err := lookupGeo(c, key)
+	if err != nil {
+		return nil, err
+	}
+	if !exists && xx {
+		c.dontPropagate()
+		return resp.Integer{Value: 0}, nil
+	}
+
+	added, changed := 0, 0
+	apply := func() {
+		for j, score := range scores {
+			member := triplets[3*j+2]
+			_, ok := g.Score(member)
+			if (nx && ok) || (xx && !ok) {
+				continue
+			}
+			isNew, moved := g.Add(member, score)
+			if isNew {
+				added++
+			} else if moved {
+				changed++
+			}
+		}
+	}
+
+	if exists {
+		c.db.Mutate(key, apply)
+	} else {
+		g = store.NewGeoIndex()
+		apply()
+		c.db.SET(key, store.Data{Value: g})
+	}
+
+	if added+changed == 0 {
+		c.dontPropagate()
+	} else if err := c.propagateValue(key, g, data.Expiry); err != nil {
+		return nil, err
+	}
+
+	if ch {
+		return resp.Integer{Value: added + changed}, nil
+	}
+	return resp.Integer{Value: added}, nil
+}
+
+// handleGEODIST returns the distance between two members: GEODIST key member1 member2 [M|KM|FT|MI]
+func handleGEODIST(c *call) (resp.Type, error) {
+	if len(c.args) > 4 {
+		return nil, errors.New("syntax error")
+	}
+	unit := 1.0
+	if len(c.args) == 4 {
+		var err error
+		unit, err = parseGeoUnit(c.args[3])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	g, _, ok, err := lookupGeo(c, c.args[0])
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return resp.Null{}, nil
+	}
+	score1, ok1 := g.Score(c.args[1])
+	score2, ok2 := g.Score(c.args[2])
+	if !ok1 || !ok2 {
+		return resp.Null{}, nil
+	}
+
+	long1, lat1 := geohash.Decode(score1)
+	long2, lat2 := geohash.Decode(score2)
+	return formatDistance(geohash.Distance(long1, lat1, long2, lat2), unit), nil
+}
+
+// handleGEOPOS returns the coordinates of members, or a null for the missing ones: GEOPOS key [member ...]
+func handleGEOPOS(c *call) (resp.Type, error) {
+	g, _, ok, err := lookupGeo(c, c.args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]resp.Type, 0, len(c.args)-1)
+	for _, member := range c.args[1:] {
+		if !ok {
+			items = append(items, resp.Null{})
+			continue
+		}
+		score, found := g.Score(member)
+		if !found {
+			items = append(items, resp.Null{})
+			continue
+		}
+		long, lat := geohash.Decode(score)
+		items = append(items, resp.Array{Length: 2, Items: []resp.Type{formatCoordinate(long), formatCoordinate(lat)}})
+	}
+	return resp.Array{Length: len(items), Items: items}, nil
+}
+
+// handleGEOHASH returns the standard geohash strings of members: GEOHASH key [member ...]
+func handleGEOHASH(c *call) (resp.Type, error) {
+	g, _, ok, err := lookupGeo(c, c.args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]resp.Type, 0, len(c.args)-1)
+	for _, member := range c.args[1:] {
+		if !ok {
+			items = append(items, resp.Null{})
+			continue
+		}
+		score, found := g.Score(member)
+		if !found {
+			items = append(items, resp.Null{})
+			continue
+		}
+		items = append(items, bulkString(geohash.String(score)))
+	}
+	return resp.Array{Length: len(items), Items: items}, nil
+}
+
+// geoQuery is a parsed GEOSEARCH
+type geoQuery struct {
+	fromMember         string
+	long, lat          float64
+	hasMember, hasLong bool
+
+	// radius is set for BYRADIUS, width & height for BYBOX, all in meters
+	radius, width, height float64
+	byRadius, byBox       bool
+	unit                  float64
+
+	// order is 1 for ASC, -1 for DESC & 0 when the results are not sorted
+	order int
+	count int
+	any   bool
+
+	withCoord, withDist, withHash bool
+}
+
+// parseGeoSearch reads the options of GEOSEARCH & GEOSEARCHSTORE, which doesn't accept the WITH options
+func parseGeoSearch(args []string, storing bool) (*geoQuery, error) {
+	q := &geoQuery{}
+
+	for i := 0; i < len(args); i++ {
+		left := len(args) - i - 1
+		switch strings.ToUpper(args[i]) {
+		case "FROMMEMBER":
+			if left < 1 || q.hasMember || q.hasLong {
+				return nil, errors.New("syntax error")
+			}
+			q.fromMember, q.hasMember = args[i+1], true
+			i++
+		case "FROMLONLAT":
+			if left < 2 || q.hasMember || q.hasLong {
+				return nil, errors.New("syntax error")
+			}
+			long, lat, err := parseCoordinates(args[i+1], args[i+2])
+			if err != nil {
+				return nil, err
+			}
+			q.long, q.lat, q.hasLong = long, lat, true
+			i += 2
+		case "BYRADIUS":
+			if left < 2 || q.byRadius || q.byBox {
+				return nil, errors.New("syntax error")
+			}
+			radius, err := parseGeoFloat(args[i+1])
+			if err != nil {
+				return nil, err
+			}
+			if radius < 0 {
+				return nil, errors.New("radius cannot be negative")
+			}
+			q.unit, err = parseGeoUnit(args[i+2])
+			if err != nil {
+				return nil, err
+			}
+			q.radius, q.byRadius = radius*q.unit, true
+			i += 2
+		case "BYBOX":
+			if left < 3 || q.byRadius || q.byBox {
+				return nil, errors.New("syntax error")
+			}
+			width, err := parseGeoFloat(args[i+1])
+			if err != nil {
+				return nil, err
+			}
+			height, err := parseGeoFloat(args[i+2])
+			if err != nil {
+				return nil, err
+			}
+			if width < 0 || height < 0 {
+				return nil, errors.New("height or width cannot be negative")
+			}
+			q.unit, err = parseGeoUnit(args[i+3])
+			if err != nil {
+				return nil, err
+			}
+			q.width, q.height, q.byBox = width*q.unit, height*q.unit, true
+			i += 3
+		case "ASC":
+			q.order = 1
+		case "DESC":
+			q.order = -1
+		case "COUNT":
+			if left < 1 {
+				return nil, errors.New("syntax error")
+			}
+			count, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				return nil, errors.New("value is not an integer or out of range")
+			}
+			if count <= 0 {
+				return nil, errors.New("COUNT must be > 0")
+			}
+			q.count = count
+			i++
+			if i+1 < len(args) && strings.ToUpper(args[i+1]) == "ANY" {
+				q.any = true
+				i++
+			}
+		case "ANY":
+			return nil, errors.New("the ANY argument requires COUNT argument")
+		case "WITHCOORD", "WITHDIST", "WITHHASH":
+			if storing {
+				return nil, errors.New("syntax error")
+			}
+			switch strings.ToUpper(args[i]) {
+			case "WITHCOORD":
+				q.withCoord = true
+			case "WITHDIST":
+				q.withDist = true
+			default:
+				q.withHash = true
+			}
+		default:
+			return nil, errors.New("syntax error")
+		}
+	}
+
+	if !q.hasMember && !q.hasLong {
+		return nil, errors.New("exactly one of FROMMEMBER or FROMLONLAT can be specified for GEOSEARCH")
+	}
+	if !q.byRadius && !q.byBox {
+		return nil, errors.New("exactly one of BYRADIUS and BYBOX can be specified for GEOSEARCH")
+	}
+	// Like in Redis, the closest members are returned when a COUNT is given without an order
+	if q.count > 0 && q.order == 0 && !q.any {
+		q.order = 1
+	}
+	return q, nil
+}
+
+type geoMatch struct {
+	member    string
+	score     uint64
+	dist      float64
+	long, lat float64
+}
+
+// search returns the members within the area of the query, looking only at the cells around its center
+func (q *geoQuery) search(g *store.GeoIndex) ([]geoMatch, error) {
+	if q.hasMember {
+		score, ok := g.Score(q.fromMember)
+		if !ok {
+			return nil, errors.New("could not decode requested zset member")
+		}
+		q.long, q.lat = geohash.Decode(score)
+	}
+
+	var ranges []geohash.Range
+	if q.byRadius {
+		ranges = geohash.Cover(q.long, q.lat, q.radius, q.radius, q.radius)
+	} else {
+		halfWidth, halfHeight := q.width/2, q.height/2
+		radius := halfWidth*halfWidth + halfHeight*halfHeight
+		ranges = geohash.Cover(q.long, q.lat, math.Sqrt(radius), halfWidth, halfHeight)
+	}
+
+	matches := make([]geoMatch, 0)
+	for _, r := range ranges {
+		complete := g.Range(r.Min, r.Max, func(member string, score uint64) bool {
+			long, lat := geohash.Decode(score)
+
+			var dist float64
+			if q.byRadius {
+				dist = geohash.Distance(q.long, q.lat, long, lat)
+				if dist > q.radius {
+					return true
+				}
+			} else {
+				var ok bool
+				dist, ok = geohash.InBox(q.long, q.lat, q.width, q.height, long, lat)
+				if !ok {
+					return true
+				}
+			}
+
+			matches = append(matches, geoMatch{member: member, score: score, dist: dist, long: long, lat: lat})
+			// With ANY the search stops as soon as there are enough matches
+			return !q.any || len(matches) < q.count
+		})
+		if !complete {
+			break
+		}
+	}
+
+	switch q.order {
+	case 1:
+		sort.SliceStable(matches, func(i, j int) bool { return matches[i].dist < matches[j].dist })
+	case -1:
+		sort.SliceStable(matches, func(i, j int) bool { return matches[i].dist > matches[j].dist })
+	}
+	if q.count > 0 && len(matches) > q.count {
+		matches = matches[:q.count]
+	}
+	return matches, nil
+}
+
+// handleGEOSEARCH returns the members within a radius or a box: GEOSEARCH key FROMMEMBER member|FROMLONLAT long lat
+// BYRADIUS radius unit|BYBOX width height unit [ASC|DESC] [COUNT count [ANY]] [WITHCOORD] [WITHDIST] [WITHHASH]
+func handleGEOSEARCH(c *call) (resp.Type, error) {
+	q, err := parseGeoSearch(c.args[1:], false)
+	if err != nil {
+		return nil, err
+	}
+
+	g, _, ok, err := lookupGeo(c, c.args[0])
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return resp.Array{Length: 0, Items: []resp.Type{}}, nil
+	}
+	matches, err := q.search(g)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]resp.Type, len(matches))
+	for i, m := range matches {
+		if !q.withDist && !q.withHash && !q.withCoord {
+			items[i] = bulkString(m.member)
+			continue
+		}
+
+		fields := []resp.Type{bulkString(m.member)}
+		if q.withDist {
+			fields = append(fields, formatDistance(m.dist, q.unit))
+		}
+		if q.withHash {
+			fields = append(fields, resp.Integer{Value: int(m.score)})
+		}
+		if q.withCoord {
+			fields = append(fields, resp.Array{Length: 2, Items: []resp.Type{formatCoordinate(m.long), formatCoordinate(m.lat)}})
+		}
+		items[i] = resp.Array{Length: len(fields), Items: fields}
+	}
+	return resp.Array{Length: len(items), Items: items}, nil
+}
+
+// handleGEOSEARCHSTORE stores the members found by a GEOSEARCH in a new geo index: GEOSEARCHSTORE destination source ...
+// It returns their number, & deletes the destination when there is none
+// It is logged as a RESTORE of the result, the source may have changed or expired when it is replayed
+func handleGEOSEARCHSTORE(c *call) (resp.Type, error) {
+	dest := c.args[0]
+
+	q, err := parseGeoSearch(c.args[2:], true)
+	if err != nil {
+		return nil, err
+	}
+
+	g, _, ok, err := lookupGeo(c, c.args[1])
+	if err != nil {
+		return nil, err
+	}
+	var matches []geoMatch
+	if ok {
+		matches, err = q.search(g)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(matches) == 0 {
+		if c.db.DEL(dest) == nil {
+			c.propagate("DEL", dest)
+		} else {
+			c.dontPropagate()
+		}
+		return resp.Integer{Value: 0}, nil
+	}
+
+	result := store.NewGeoIndex()
+	for _, m := range matches {
+		result.Add(m.member, m.score)
+	}
+	payload, err := store.Dump(result)
+	if err != nil {
+		return nil, err
+	}
+	c.db.SET(dest, store.Data{Value: result})
+	c.propagate(restoreCommand(dest, payload, time.Time{})...)
+
+	return resp.Integer{Value: len(matches)}, nil
+}
@@ -0,0 +1,153 @@
+package command
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DNahar74/PulseDB/internal/resp"
+	"github.com/DNahar74/PulseDB/internal/store"
+)
+
+// The Sicily examples of the Redis documentation
+func TestGeo(t *testing.T) {
+	d := store.CreateDatabases(1)
+	InitDatabases(d)
+	sess := NewSession()
+
+	if reply := run(t, sess, "GEOADD", "Sicily", "13.361389", "38.115556", "Palermo", "15.087269", "37.502669", "Catania"); reply != (resp.Integer{Value: 2}) {
+		t.Errorf("GEOADD = %v, want 2", reply)
+	}
+	if reply := run(t, sess, "GEODIST", "Sicily", "Palermo", "Catania"); reply != bulkString("166274.1516") {
+		t.Errorf("GEODIST = %v", reply)
+	}
+	if reply := run(t, sess, "GEODIST", "Sicily", "Palermo", "Catania", "km"); reply != bulkString("166.2742") {
+		t.Errorf("GEODIST km = %v", reply)
+	}
+	if reply := run(t, sess, "GEODIST", "Sicily", "Palermo", "Rome"); reply != (resp.Null{}) {
+		t.Errorf("GEODIST of a missing member = %v", reply)
+	}
+	if _, err := HandleCommands(sess, newCommand("GET", "Sicily")); err != store.ErrWrongType {
+		t.Errorf("GET on a geospatial index: %v", err)
+	}
+
+	hashes := run(t, sess, "GEOHASH", "Sicily", "Palermo", "Catania", "Rome").(resp.Array)
+	if hashes.Items[0] != bulkString("sqc8b49rny0") || hashes.Items[1] != bulkString("sqdtr74hyu0") || hashes.Items[2] != (resp.Null{}) {
+		t.Errorf("GEOHASH = %v", hashes)
+	}
+
+	pos := run(t, sess, "GEOPOS", "Sicily", "Palermo", "Rome").(resp.Array)
+	coords := pos.Items[0].(resp.Array)
+	if !strings.HasPrefix(coords.Items[0].(resp.BulkString).Value, "13.36138") || !strings.HasPrefix(coords.Items[1].(resp.BulkString).Value, "38.11555") || pos.Items[1] != (resp.Null{}) {
+		t.Errorf("GEOPOS = %v", pos)
+	}
+
+	// NX doesn't move existing members, XX doesn't add new ones & CH counts the moved members
+	if reply := run(t, sess, "GEOADD", "Sicily", "NX", "13", "38", "Palermo"); reply != (resp.Integer{Value: 0}) {
+		t.Errorf("GEOADD NX = %v, want 0", reply)
+	}
+	if reply := run(t, sess, "GEOADD", "Sicily", "XX", "CH", "13.361389", "38.115556", "Palermo", "14", "37", "Agrigento"); reply != (resp.Integer{Value: 0}) {
+		t.Errorf("GEOADD XX CH = %v, want 0", reply)
+	}
+	if reply := run(t, sess, "GEOADD", "Sicily", "CH", "12.758489", "38.788135", "edge1", "17.241510", "38.788135", "edge2"); reply != (resp.Integer{Value: 2}) {
+		t.Errorf("GEOADD CH = %v, want 2", reply)
+	}
+
+	if _, err := HandleCommands(sess, newCommand("GEOADD", "Sicily", "200", "100", "nowhere")); err == nil || !strings.Contains(err.Error(), "invalid longitude,latitude pair") {
+		t.Errorf("GEOADD of invalid coordinates: %v", err)
+	}
+	if reply := run(t, sess, "TYPE", "Sicily"); reply != (resp.SimpleString{Value: "zset"}) {
+		t.Errorf("TYPE = %v, want zset", reply)
+	}
+}
+
+func TestGeoSearch(t *testing.T) {
+	d := store.CreateDatabases(1)
+	InitDatabases(d)
+	sess := NewSession()
+
+	run(t, sess, "GEOADD", "Sicily", "13.361389", "38.115556", "Palermo", "15.087269", "37.502669", "Catania")
+	run(t, sess, "GEOADD", "Sicily", "12.758489", "38.788135", "edge1", "17.241510", "38.788135", "edge2")
+
+	if got := keyNames(run(t, sess, "GEOSEARCH", "Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km", "ASC")); strings.Join(got, ",") != "Catania,Palermo" {
+		t.Errorf("GEOSEARCH BYRADIUS = %v", got)
+	}
+
+	// GEOSEARCH Sicily FROMLONLAT 15 37 BYBOX 400 400 km ASC WITHCOORD WITHDIST
+	reply := run(t, sess, "GEOSEARCH", "Sicily", "FROMLONLAT", "15", "37", "BYBOX", "400", "400", "km", "ASC", "WITHCOORD", "WITHDIST").(resp.Array)
+	want := []struct{ member, dist string }{{"Catania", "56.4413"}, {"Palermo", "190.4424"}, {"edge2", "279.7403"}, {"edge1", "279.7405"}}
+	if reply.Length != len(want) {
+		t.Fatalf("GEOSEARCH BYBOX = %v", reply)
+	}
+	for i, w := range want {
+		fields := reply.Items[i].(resp.Array)
+		if fields.Items[0] != bulkString(w.member) || fields.Items[1] != bulkString(w.dist) || fields.Items[2].(resp.Array).Length != 2 {
+			t.Errorf("GEOSEARCH BYBOX result %d = %v, want %s at %s km", i, fields, w.member, w.dist)
+		}
+	}
+
+	first := run(t, sess, "GEOSEARCH", "Sicily", "FROMMEMBER", "Palermo", "BYRADIUS", "500", "km", "DESC", "COUNT", "1").(resp.Array)
+	if first.Length != 1 || first.Items[0] != bulkString("edge2") {
+		t.Errorf("GEOSEARCH DESC COUNT 1 = %v, want edge2", first)
+	}
+	if any := run(t, sess, "GEOSEARCH", "Sicily", "FROMMEMBER", "Palermo", "BYRADIUS", "500", "km", "COUNT", "2", "ANY").(resp.Array); any.Length != 2 {
+		t.Errorf("GEOSEARCH COUNT ANY = %v, want 2 members", any)
+	}
+
+	for _, args := range [][]string{
+		{"GEOSEARCH", "Sicily", "BYRADIUS", "10", "km"},
+		{"GEOSEARCH", "Sicily", "FROMLONLAT", "15", "37"},
+		{"GEOSEARCH", "Sicily", "FROMMEMBER", "Rome", "BYRADIUS", "10", "km"},
+		{"GEOSEARCH", "Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "10", "parsecs"},
+		{"GEOSEARCH", "Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "10", "km", "ANY"},
+		{"GEOSEARCHSTORE", "dest", "Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "10", "km", "WITHDIST"},
+	} {
+		if _, err := HandleCommands(sess, newCommand(args...)); err == nil {
+			t.Errorf("%v succeeded", args)
+		}
+	}
+
+	// The result is logged as a RESTORE, the source may have changed when it is replayed
+	drainAOF(d)
+	if reply := run(t, sess, "GEOSEARCHSTORE", "near", "Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km"); reply != (resp.Integer{Value: 2}) {
+		t.Errorf("GEOSEARCHSTORE = %v, want 2", reply)
+	}
+	if got := drainAOF(d); len(got) != 1 || !strings.Contains(got[0], "RESTORE") {
+		t.Errorf("propagated %q, want a RESTORE", got)
+	}
+	if reply := run(t, sess, "GEODIST", "near", "Palermo", "Catania"); reply != bulkString("166274.1516") {
+		t.Errorf("GEODIST in the stored result = %v", reply)
+	}
+	if reply := run(t, sess, "GEOSEARCHSTORE", "near", "Sicily", "FROMLONLAT", "0", "0", "BYRADIUS", "1", "km"); reply != (resp.Integer{Value: 0}) {
+		t.Errorf("GEOSEARCHSTORE without results = %v, want 0", reply)
+	}
+	if reply := run(t, sess, "EXISTS", "near"); reply != (resp.Integer{Value: 0}) {
+		t.Error("GEOSEARCHSTORE without results kept the destination")
+	}
+}
+
+func TestGeoCopy(t *testing.T) {
+	d := store.CreateDatabases(1)
+	InitDatabases(d)
+	sess := NewSession()
+
+	run(t, sess, "GEOADD", "a", "13.361389", "38.115556", "Palermo")
+	run(t, sess, "COPY", "a", "b")
+	run(t, sess, "GEOADD", "b", "15.087269", "37.502669", "Catania")
+	if reply := run(t, sess, "GEOPOS", "a", "Catania").(resp.Array); reply.Items[0] != (resp.Null{}) {
+		t.Error("adding to the copy changed the original")
+	}
+
+	// A geo index with a TTL is logged as a RESTORE with the expiry
+	data, _ := d.DB(0).Lookup("a")
+	d.DB(0).SET("a", store.Data{Value: data.Value, Expiry: time.Now().Add(100 * time.Second)})
+	drainAOF(d)
+	run(t, sess, "GEOADD", "a", "15.087269", "37.502669", "Catania")
+	if got := drainAOF(d); len(got) != 1 || !strings.Contains(got[0], "ABSTTL") {
+		t.Errorf("propagated %q, want a RESTORE with its TTL", got)
+	}
+	data, _ = d.DB(0).Lookup("a")
+	if time.Until(data.Expiry) < 99*time.Second {
+		t.Error("GEOADD cleared the TTL")
+	}
+}
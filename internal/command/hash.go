@@ -0,0 +1,480 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DNahar74/PulseDB/internal/resp"
+	"github.com/DNahar74/PulseDB/internal/store"
+)
+
+// The replies of the field expiry commands for every field
+const (
+	fieldMissing   = -2
+	fieldNoExpiry  = -1
+	fieldSkipped   = 0
+	fieldUpdated   = 1
+	fieldDeleted   = 2
+	hashExpireHelp = "Mandatory argument FIELDS is missing or not at the right position"
+)
+
+// lookupHash returns the hash stored at a key, & false if the key does not exist
+func lookupHash(c *call, key string) (*store.Hash, store.Data, bool, error) {
+	data, ok := c.lookupAt(key, c.now())
+	if !ok {
+		return nil, store.Data{}, false, nil
+	}
+	h, ok := data.Value.(*store.Hash)
+	if !ok {
+		return nil, store.Data{}, false, store.ErrWrongType
+	}
+	return h, data, true, nil
+}
+
+// updateHash runs fn, which returns whether it changed the hash, on the hash of a key after removing its expired
+// fields, & creates the hash first if create is set
+// The key is deleted when fn leaves the hash empty; when the key has a TTL, a change is logged as a RESTORE
+func updateHash(c *call, key string, create bool, fn func(h *store.Hash) bool) error {
+	h, data, ok, err := lookupHash(c, key)
+	if err != nil {
+		return err
+	}
+
+	now := c.now()
+	if !ok {
+		if !create {
+			return nil
+		}
+		h = store.NewHash()
+		if fn(h) {
+			c.db.SET(key, store.Data{Value: h})
+		}
+		return nil
+	}
+
+	// The expired fields removed here are not logged, the replicas remove them the same way when they apply the command
+	changed := false
+	c.db.Mutate(key, func() {
+		h.RemoveExpired(now)
+		changed = fn(h)
+	})
+	if h.Len(now) == 0 {
+		_ = c.db.DEL(key)
+		return nil
+	}
+	if !changed {
+		return nil
+	}
+	return c.propagateValue(key, h, data.Expiry)
+}
+
+// handleHSET sets fields & returns the number of new ones: HSET key field value [field value ...]
+func handleHSET(c *call) (resp.Type, error) {
+	if len(c.args)%2 != 1 {
+		return nil, fmt.Errorf("wrong number of arguments for '%s' command", c.cmd.name)
+	}
+
+	added := 0
+	err := updateHash(c, c.args[0], true, func(h *store.Hash) bool {
+		now := c.now()
+		for i := 1; i < len(c.args); i += 2 {
+			if h.Set(c.args[i], c.args[i+1], now) {
+				added++
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Integer{Value: added}, nil
+}
+
+// handleHSETNX sets a field only if it does not exist: HSETNX key field value
+func handleHSETNX(c *call) (resp.Type, error) {
+	key, field := c.args[0], c.args[1]
+
+	h, _, ok, err := lookupHash(c, key)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		if _, exists := h.Get(field, c.now()); exists {
+			c.dontPropagate()
+			return resp.Integer{Value: 0}, nil
+		}
+	}
+
+	err = updateHash(c, key, true, func(h *store.Hash) bool {
+		return h.Set(field, c.args[2], c.now())
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Integer{Value: 1}, nil
+}
+
+func handleHGET(c *call) (resp.Type, error) {
+	h, _, ok, err := lookupHash(c, c.args[0])
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return resp.Null{}, nil
+	}
+	value, ok := h.Get(c.args[1], c.now())
+	if !ok {
+		return resp.Null{}, nil
+	}
+	return bulkString(value), nil
+}
+
+func handleHMGET(c *call) (resp.Type, error) {
+	h, _, ok, err := lookupHash(c, c.args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	now := c.now()
+	items := make([]resp.Type, len(c.args)-1)
+	for i, field := range c.args[1:] {
+		items[i] = resp.Null{}
+		if ok {
+			if value, found := h.Get(field, now); found {
+				items[i] = bulkString(value)
+			}
+		}
+	}
+	return resp.Array{Length: len(items), Items: items}, nil
+}
+
+// handleHDEL deletes fields & returns the number of fields that existed: HDEL key field [field ...]
+func handleHDEL(c *call) (resp.Type, error) {
+	deleted := 0
+	err := updateHash(c, c.args[0], false, func(h *store.Hash) bool {
+		now := c.now()
+		for _, field := range c.args[1:] {
+			if h.Delete(field, now) {
+				deleted++
+			}
+		}
+		return deleted > 0
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if deleted == 0 {
+		c.dontPropagate()
+	}
+	return resp.Integer{Value: deleted}, nil
+}
+
+func handleHLEN(c *call) (resp.Type, error) {
+	h, _, ok, err := lookupHash(c, c.args[0])
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return resp.Integer{Value: 0}, nil
+	}
+	return resp.Integer{Value: h.Len(c.now())}, nil
+}
+
+func handleHEXISTS(c *call) (resp.Type, error) {
+	h, _, ok, err := lookupHash(c, c.args[0])
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return resp.Integer{Value: 0}, nil
+	}
+	if _, found := h.Get(c.args[1], c.now()); !found {
+		return resp.Integer{Value: 0}, nil
+	}
+	return resp.Integer{Value: 1}, nil
+}
+
+// hashItems returns the fields, the values or both of the hash of a key, for HKEYS, HVALS & HGETALL
+func hashItems(c *call, fields, values bool) (resp.Type, error) {
+	h, _, ok, err := lookupHash(c, c.args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]resp.Type, 0)
+	if ok {
+		h.Range(c.now(), func(field, value string) {
+			if fields {
+				items = append(items, bulkString(field))
+			}
+			if values {
+				items = append(items, bulkString(value))
+			}
+		})
+	}
+	return resp.Array{Length: len(items), Items: items}, nil
+}
+
+func handleHGETALL(c *call) (resp.Type, error) {
+	return hashItems(c, true, true)
+}
+
+func handleHKEYS(c *call) (resp.Type, error) {
+	return hashItems(c, true, false)
+}
+
+func handleHVALS(c *call) (resp.Type, error) {
+	return hashItems(c, false, true)
+}
+
+// parseFields reads the FIELDS numfields field [field ...] part of the field expiry commands
+func parseFields(args []string) ([]string, error) {
+	if len(args) < 2 || strings.ToUpper(args[0]) != "FIELDS" {
+		return nil, errors.New(hashExpireHelp)
+	}
+	n, err := strconv.Atoi(args[1])
+	if err != nil || n <= 0 {
+		return nil, errors.New("Parameter `numFields` should be greater than 0")
+	}
+	if n != len(args)-2 {
+		return nil, errors.New("The `numfields` parameter must match the number of arguments")
+	}
+	return args[2:], nil
+}
+
+// fieldReplies builds the array of the per field replies
+func fieldReplies(replies []int) resp.Type {
+	items := make([]resp.Type, len(replies))
+	for i, r := range replies {
+		items[i] = resp.Integer{Value: r}
+	}
+	return resp.Array{Length: len(items), Items: items}
+}
+
+func handleHEXPIRE(c *call) (resp.Type, error) {
+	return hashExpire(c, time.Second, false)
+}
+
+func handleHPEXPIRE(c *call) (resp.Type, error) {
+	return hashExpire(c, time.Millisecond, false)
+}
+
+func handleHEXPIREAT(c *call) (resp.Type, error) {
+	return hashExpire(c, time.Second, true)
+}
+
+func handleHPEXPIREAT(c *call) (resp.Type, error) {
+	return hashExpire(c, time.Millisecond, true)
+}
+
+// hashExpire sets the expiry of fields: HEXPIRE key seconds [NX|XX|GT|LT] FIELDS numfields field [field ...]
+// For every field it replies -2 if it does not exist, 0 if the condition is not met, 1 if the expiry is set & 2 if the
+// field was deleted because the time is already past
+// It is logged as an HPEXPIREAT of the fields updated & an HDEL of the fields deleted
+func hashExpire(c *call, unit time.Duration, absolute bool) (resp.Type, error) {
+	key := c.args[0]
+
+	n, err := strconv.ParseInt(c.args[1], 10, 64)
+	if err != nil {
+		return nil, errors.New("value is not an integer or out of range")
+	}
+	invalid := fmt.Errorf("invalid expire time in '%s' command", strings.ToLower(c.cmd.name))
+	if n < 0 || n > math.MaxInt64/int64(unit) {
+		return nil, invalid
+	}
+
+	var expiry time.Time
+	if absolute {
+		expiry = time.UnixMilli(n * int64(unit/time.Millisecond))
+	} else {
+		expiry = time.Now().Add(time.Duration(n) * unit)
+	}
+
+	rest := c.args[2:]
+	condition := ""
+	if len(rest) > 0 {
+		switch cond := strings.ToUpper(rest[0]); cond {
+		case "NX", "XX", "GT", "LT":
+			condition = cond
+			rest = rest[1:]
+		}
+	}
+	fields, err := parseFields(rest)
+	if err != nil {
+		return nil, err
+	}
+
+	replies := make([]int, len(fields))
+	for i := range replies {
+		replies[i] = fieldMissing
+	}
+	updated, deleted := make([]string, 0), make([]string, 0)
+
+	err = updateHash(c, key, false, func(h *store.Hash) bool {
+		now := c.now()
+		for i, field := range fields {
+			current, ok := h.Expiry(field, now)
+			if !ok {
+				continue
+			}
+
+			// A field without an expiry has an infinite TTL for GT & LT
+			met := true
+			switch condition {
+			case "NX":
+				met = current.IsZero()
+			case "XX":
+				met = !current.IsZero()
+			case "GT":
+				met = !current.IsZero() && expiry.After(current)
+			case "LT":
+				met = current.IsZero() || expiry.Before(current)
+			}
+			if !met {
+				replies[i] = fieldSkipped
+				continue
+			}
+
+			// A replayed command only sets the expiry, the field may have been persisted by a later command
+			if !expiry.After(now) && !now.IsZero() {
+				h.Delete(field, now)
+				replies[i] = fieldDeleted
+				deleted = append(deleted, field)
+				continue
+			}
+			h.SetExpiry(field, expiry)
+			replies[i] = fieldUpdated
+			updated = append(updated, field)
+		}
+		return len(updated)+len(deleted) > 0
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// A RESTORE is already logged for a key with a TTL
+	if c.rewritten {
+		return fieldReplies(replies), nil
+	}
+	c.dontPropagate()
+	if len(updated) > 0 {
+		argv := []string{"HPEXPIREAT", key, strconv.FormatInt(expiry.UnixMilli(), 10), "FIELDS", strconv.Itoa(len(updated))}
+		c.propagate(append(argv, updated...)...)
+	}
+	if len(deleted) > 0 {
+		c.propagate(append([]string{"HDEL", key}, deleted...)...)
+	}
+	return fieldReplies(replies), nil
+}
+
+func handleHTTL(c *call) (resp.Type, error) {
+	return hashTTL(c, time.Second)
+}
+
+func handleHPTTL(c *call) (resp.Type, error) {
+	return hashTTL(c, time.Millisecond)
+}
+
+// hashTTL returns the remaining time to live of fields: HTTL key FIELDS numfields field [field ...]
+// It is -2 for a missing field & -1 for a field without an expiry
+func hashTTL(c *call, unit time.Duration) (resp.Type, error) {
+	fields, err := parseFields(c.args[1:])
+	if err != nil {
+		return nil, err
+	}
+	h, _, ok, err := lookupHash(c, c.args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	now := c.now()
+	replies := make([]int, len(fields))
+	for i, field := range fields {
+		replies[i] = fieldMissing
+		if !ok {
+			continue
+		}
+		expiry, found := h.Expiry(field, now)
+		switch {
+		case !found:
+		case expiry.IsZero():
+			replies[i] = fieldNoExpiry
+		default:
+			// Rounded up, so that a field about to expire doesn't report a TTL of 0
+			replies[i] = int((expiry.Sub(now) + unit - 1) / unit)
+		}
+	}
+	return fieldReplies(replies), nil
+}
+
+// handleHPERSIST removes the expiry of fields: HPERSIST key FIELDS numfields field [field ...]
+// For every field it replies -2 if it does not exist, -1 if it has no expiry & 1 if the expiry was removed
+func handleHPERSIST(c *call) (resp.Type, error) {
+	key := c.args[0]
+
+	fields, err := parseFields(c.args[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	replies := make([]int, len(fields))
+	for i := range replies {
+		replies[i] = fieldMissing
+	}
+	persisted := make([]string, 0)
+
+	err = updateHash(c, key, false, func(h *store.Hash) bool {
+		now := c.now()
+		for i, field := range fields {
+			expiry, ok := h.Expiry(field, now)
+			switch {
+			case !ok:
+			case expiry.IsZero():
+				replies[i] = fieldNoExpiry
+			default:
+				h.SetExpiry(field, time.Time{})
+				replies[i] = fieldUpdated
+				persisted = append(persisted, field)
+			}
+		}
+		return len(persisted) > 0
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if c.rewritten {
+		return fieldReplies(replies), nil
+	}
+	c.dontPropagate()
+	if len(persisted) > 0 {
+		argv := []string{"HPERSIST", key, "FIELDS", strconv.Itoa(len(persisted))}
+		c.propagate(append(argv, persisted...)...)
+	}
+	return fieldReplies(replies), nil
+}
+
+// ExpireHashFields is the active expiry of the hash fields: it removes the expired fields of a sample of the hashes of
+// every database, & deletes the hashes left empty
+// The removal is logged as HDEL, the replicas & the AOF don't expire the fields on their own
+// It stops while CLIENT PAUSE holds the writes back
+func ExpireHashFields(limit int) {
+	if replication() != nil && replication().IsReplica() || writesPaused() {
+		return
+	}
+
+	execLock.Lock()
+	defer execLock.Unlock()
+
+	now := time.Now()
+	for i := range databases().Len() {
+		for _, e := range databases().DB(i).ExpireHashFields(now, limit) {
+			propagate(i, append([]string{"HDEL", e.Key}, e.Fields...), true)
+		}
+	}
+}
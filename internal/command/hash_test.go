@@ -0,0 +1,161 @@
+package command
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DNahar74/PulseDB/internal/resp"
+	"github.com/DNahar74/PulseDB/internal/store"
+)
+
+func TestHash(t *testing.T) {
+	d := store.CreateDatabases(1)
+	InitDatabases(d)
+	sess := NewSession()
+
+	if reply := run(t, sess, "HSET", "user", "name", "ada", "lang", "en"); reply != (resp.Integer{Value: 2}) {
+		t.Errorf("HSET = %v, want 2", reply)
+	}
+	if reply := run(t, sess, "HSET", "user", "lang", "fr"); reply != (resp.Integer{Value: 0}) {
+		t.Errorf("HSET of an existing field = %v, want 0", reply)
+	}
+	if reply := run(t, sess, "HGET", "user", "lang"); reply != bulkString("fr") {
+		t.Errorf("HGET = %v, want fr", reply)
+	}
+	if reply := run(t, sess, "HSETNX", "user", "lang", "de"); reply != (resp.Integer{Value: 0}) {
+		t.Errorf("HSETNX of an existing field = %v, want 0", reply)
+	}
+	if got := keyNames(run(t, sess, "HKEYS", "user")); strings.Join(got, ",") != "lang,name" {
+		t.Errorf("HKEYS = %v", got)
+	}
+	if got := keyNames(run(t, sess, "HGETALL", "user")); strings.Join(got, ",") != "ada,fr,lang,name" {
+		t.Errorf("HGETALL = %v", got)
+	}
+	mget := run(t, sess, "HMGET", "user", "name", "age").(resp.Array)
+	if mget.Items[0] != bulkString("ada") || mget.Items[1] != (resp.Null{}) {
+		t.Errorf("HMGET = %v", mget)
+	}
+	if reply := run(t, sess, "TYPE", "user"); reply != (resp.SimpleString{Value: "hash"}) {
+		t.Errorf("TYPE = %v, want hash", reply)
+	}
+	if _, err := HandleCommands(sess, newCommand("GET", "user")); err != store.ErrWrongType {
+		t.Errorf("GET on a hash: %v", err)
+	}
+
+	// The key goes with its last field
+	if reply := run(t, sess, "HDEL", "user", "name", "lang", "age"); reply != (resp.Integer{Value: 2}) {
+		t.Errorf("HDEL = %v, want 2", reply)
+	}
+	if reply := run(t, sess, "EXISTS", "user"); reply != (resp.Integer{Value: 0}) {
+		t.Error("the hash still exists without fields")
+	}
+
+	run(t, sess, "SET", "str", "x")
+	if _, err := HandleCommands(sess, newCommand("HSET", "str", "a", "1")); err != store.ErrWrongType {
+		t.Errorf("HSET on a string: %v", err)
+	}
+	if _, err := HandleCommands(sess, newCommand("HSET", "user", "a")); err == nil {
+		t.Error("HSET with a field without a value succeeded")
+	}
+}
+
+func TestHashFieldExpiry(t *testing.T) {
+	d := store.CreateDatabases(1)
+	InitDatabases(d)
+	sess := NewSession()
+
+	run(t, sess, "HSET", "session", "csrf", "abc", "profile", "{}")
+
+	if got := integers(t, run(t, sess, "HEXPIRE", "session", "100", "FIELDS", "2", "csrf", "missing")); !equalInts(got, []int{1, -2}) {
+		t.Errorf("HEXPIRE = %v, want [1 -2]", got)
+	}
+	if got := integers(t, run(t, sess, "HTTL", "session", "FIELDS", "2", "csrf", "profile")); !equalInts(got, []int{100, -1}) {
+		t.Errorf("HTTL = %v, want [100 -1]", got)
+	}
+	if got := integers(t, run(t, sess, "HPTTL", "session", "FIELDS", "1", "csrf")); got[0] <= 99000 || got[0] > 100000 {
+		t.Errorf("HPTTL = %v", got)
+	}
+
+	// The conditions, a field without an expiry has an infinite TTL
+	conditions := []struct {
+		args []string
+		want []int
+	}{
+		{[]string{"50", "NX", "FIELDS", "2", "csrf", "profile"}, []int{0, 1}},
+		{[]string{"200", "XX", "FIELDS", "1", "csrf"}, []int{1}},
+		{[]string{"100", "GT", "FIELDS", "1", "csrf"}, []int{0}},
+		{[]string{"100", "LT", "FIELDS", "1", "csrf"}, []int{1}},
+	}
+	for _, tt := range conditions {
+		if got := integers(t, run(t, sess, append([]string{"HEXPIRE", "session"}, tt.args...)...)); !equalInts(got, tt.want) {
+			t.Errorf("HEXPIRE %v = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+
+	if got := integers(t, run(t, sess, "HPERSIST", "session", "FIELDS", "2", "profile", "missing")); !equalInts(got, []int{1, -2}) {
+		t.Errorf("HPERSIST = %v, want [1 -2]", got)
+	}
+	if got := integers(t, run(t, sess, "HPERSIST", "session", "FIELDS", "1", "profile")); !equalInts(got, []int{-1}) {
+		t.Errorf("HPERSIST of a field without expiry = %v, want [-1]", got)
+	}
+
+	// A time in the past deletes the field, & the key with its last field
+	drainAOF(d)
+	if got := integers(t, run(t, sess, "HEXPIREAT", "session", "1", "FIELDS", "1", "profile")); !equalInts(got, []int{2}) {
+		t.Errorf("HEXPIREAT in the past = %v, want [2]", got)
+	}
+	if got := drainAOF(d); len(got) != 1 || !strings.Contains(got[0], "HDEL") {
+		t.Errorf("propagated %q, want HDEL", got)
+	}
+	run(t, sess, "HPEXPIRE", "session", "1", "FIELDS", "1", "csrf")
+	if got := drainAOF(d); len(got) != 1 || !strings.Contains(got[0], "HPEXPIREAT") {
+		t.Errorf("propagated %q, want HPEXPIREAT", got)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if reply := run(t, sess, "EXISTS", "session"); reply != (resp.Integer{Value: 0}) {
+		t.Error("the hash exists once its last field expired")
+	}
+
+	for _, args := range [][]string{
+		{"HEXPIRE", "session", "10", "FIELDS", "2", "a"},
+		{"HEXPIRE", "session", "10", "FIELDS", "0", "a"},
+		{"HEXPIRE", "session", "10", "NX", "XX", "FIELDS", "1", "a"},
+		{"HEXPIRE", "session", "-1", "FIELDS", "1", "a"},
+		{"HTTL", "session", "FIELD", "1", "a"},
+	} {
+		if _, err := HandleCommands(sess, newCommand(args...)); err == nil {
+			t.Errorf("%v succeeded", args)
+		}
+	}
+}
+
+func TestHashActiveExpiry(t *testing.T) {
+	d := store.CreateDatabases(1)
+	InitDatabases(d)
+	sess := NewSession()
+
+	run(t, sess, "HSET", "h", "a", "1", "b", "2")
+	run(t, sess, "HPEXPIRE", "h", "1", "FIELDS", "1", "a")
+	time.Sleep(5 * time.Millisecond)
+	drainAOF(d)
+
+	ExpireHashFields(10)
+	if got := drainAOF(d); len(got) != 1 || !strings.Contains(got[0], "HDEL\r\n$1\r\nh\r\n$1\r\na") {
+		t.Errorf("propagated %q, want HDEL h a", got)
+	}
+	if reply := run(t, sess, "HLEN", "h"); reply != (resp.Integer{Value: 1}) {
+		t.Errorf("HLEN = %v, want 1", reply)
+	}
+
+	// A replayed expiry in the past only sets it, a later HPERSIST of the log may keep the field
+	if err := ReplayCommands(sess, newCommand("HPEXPIREAT", "h", "1", "FIELDS", "1", "b")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReplayCommands(sess, newCommand("HPERSIST", "h", "FIELDS", "1", "b")); err != nil {
+		t.Fatal(err)
+	}
+	if reply := run(t, sess, "HGET", "h", "b"); reply != bulkString("2") {
+		t.Errorf("HGET after the replay = %v, want 2", reply)
+	}
+}
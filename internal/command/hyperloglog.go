@@ -0,0 +1,121 @@
+package command
+
+import (
+	"github.com/DNahar74/PulseDB/internal/hll"
+	"github.com/DNahar74/PulseDB/internal/resp"
+	"github.com/DNahar74/PulseDB/internal/store"
+)
+
+// lookupHLL returns the HyperLogLog stored at a key, & false if the key does not exist
+func lookupHLL(c *call, key string) ([]byte, store.Data, bool, error) {
+	value, data, ok, err := lookupString(c, key)
+	if err != nil || !ok {
+		return nil, data, ok, err
+	}
+	b := []byte(value)
+	if !hll.Valid(b) {
+		return nil, data, false, hll.ErrInvalid
+	}
+	return b, data, true, nil
+}
+
+// handlePFADD adds elements to a HyperLogLog & returns 1 if its estimate may have changed: PFADD key [element ...]
+func handlePFADD(c *call) (resp.Type, error) {
+	key := c.args[0]
+
+	b, data, ok, err := lookupHLL(c, key)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		b = hll.New()
+	}
+
+	b, changed, err := hll.Add(b, c.args[1:]...)
+	if err != nil {
+		return nil, err
+	}
+	if !changed && ok {
+		c.dontPropagate()
+		return resp.Integer{Value: 0}, nil
+	}
+
+	writeBits(c, key, b, data)
+	return resp.Integer{Value: 1}, nil
+}
+
+// handlePFCOUNT estimates the number of distinct elements added to the union of HyperLogLogs: PFCOUNT key [key ...]
+// The estimate of a single key is cached in its header until the next PFADD changes a register
+func handlePFCOUNT(c *call) (resp.Type, error) {
+	if len(c.args) == 1 {
+		key := c.args[0]
+		b, data, ok, err := lookupHLL(c, key)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return resp.Integer{Value: 0}, nil
+		}
+
+		card, b, updated, err := hll.Count(b)
+		if err != nil {
+			return nil, err
+		}
+		// The cache is not a change of the content, it is neither logged nor sent to the replicas, which compute it
+		// again when they need it
+		if updated {
+			c.db.SET(key, store.Data{Value: store.NewRawString(string(b)), Expiry: data.Expiry})
+		}
+		return resp.Integer{Value: int(card)}, nil
+	}
+
+	values := make([][]byte, 0, len(c.args))
+	for _, key := range c.args {
+		b, _, ok, err := lookupHLL(c, key)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			values = append(values, b)
+		}
+	}
+	card, err := hll.CountUnion(values...)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Integer{Value: int(card)}, nil
+}
+
+// handlePFMERGE stores the union of HyperLogLogs in the destination, which is part of the union if it exists:
+// PFMERGE destkey [sourcekey ...]
+// It is logged as a SET of the result, the sources may have expired or changed when it is replayed
+func handlePFMERGE(c *call) (resp.Type, error) {
+	dest := c.args[0]
+
+	values := make([][]byte, 0, len(c.args))
+	var destData store.Data
+	for i, key := range c.args {
+		b, data, ok, err := lookupHLL(c, key)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		if i == 0 {
+			destData = data
+		}
+		values = append(values, b)
+	}
+
+	b, err := hll.Merge(values...)
+	if err != nil {
+		return nil, err
+	}
+
+	value := string(b)
+	c.db.SET(dest, store.Data{Value: store.NewRawString(value), Expiry: destData.Expiry})
+	c.propagate(setCommand(dest, value, destData.Expiry)...)
+
+	return resp.SimpleString{Value: "OK"}, nil
+}
@@ -0,0 +1,63 @@
+package command
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/DNahar74/PulseDB/internal/resp"
+	"github.com/DNahar74/PulseDB/internal/store"
+)
+
+func TestHyperLogLog(t *testing.T) {
+	d := store.CreateDatabases(1)
+	InitDatabases(d)
+	sess := NewSession()
+
+	// The examples of the Redis documentation
+	if reply := run(t, sess, "PFADD", "hll", "a", "b", "c", "d", "e", "f", "g"); reply != (resp.Integer{Value: 1}) {
+		t.Errorf("PFADD = %v, want 1", reply)
+	}
+	if reply := run(t, sess, "PFCOUNT", "hll"); reply != (resp.Integer{Value: 7}) {
+		t.Errorf("PFCOUNT = %v, want 7", reply)
+	}
+
+	run(t, sess, "PFADD", "hll1", "foo", "bar", "zap", "a")
+	run(t, sess, "PFADD", "hll2", "a", "b", "c", "foo")
+	if reply := run(t, sess, "PFCOUNT", "hll1", "hll2", "missing"); reply != (resp.Integer{Value: 6}) {
+		t.Errorf("PFCOUNT of the union = %v, want 6", reply)
+	}
+	run(t, sess, "PFMERGE", "hll3", "hll1", "hll2")
+	if reply := run(t, sess, "PFCOUNT", "hll3"); reply != (resp.Integer{Value: 6}) {
+		t.Errorf("PFCOUNT of the merge = %v, want 6", reply)
+	}
+
+	// A key created without elements counts as a change, adding known elements does not
+	if reply := run(t, sess, "PFADD", "empty"); reply != (resp.Integer{Value: 1}) {
+		t.Errorf("PFADD without elements = %v, want 1", reply)
+	}
+	drainAOF(d)
+	if reply := run(t, sess, "PFADD", "hll1", "foo", "zap"); reply != (resp.Integer{Value: 0}) {
+		t.Errorf("PFADD of known elements = %v, want 0", reply)
+	}
+	if got := drainAOF(d); len(got) != 0 {
+		t.Errorf("propagated %q for an unchanged HyperLogLog", got)
+	}
+
+	// The count is cached in the value, without logging anything
+	run(t, sess, "PFCOUNT", "hll1")
+	if got := drainAOF(d); len(got) != 0 {
+		t.Errorf("propagated %q for a PFCOUNT", got)
+	}
+	value, _ := d.DB(0).GET("hll1")
+	if str, _ := store.AsString(value.Value); !strings.HasPrefix(str.String(), "HYLL\x01\x00\x00\x00\x04\x00") {
+		t.Errorf("hll1 = %q, want the cached cardinality of 4", str.String())
+	}
+
+	run(t, sess, "SET", "str", "hello")
+	for _, args := range [][]string{{"PFADD", "str", "a"}, {"PFCOUNT", "str"}, {"PFMERGE", "hll", "str"}} {
+		_, err := HandleCommands(sess, newCommand(args...))
+		if err == nil || !strings.HasPrefix(err.Error(), "WRONGTYPE") {
+			t.Errorf("%v: %v, want WRONGTYPE", args, err)
+		}
+	}
+}
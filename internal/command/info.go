@@ -0,0 +1,163 @@
+package command
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/DNahar74/PulseDB/internal/resp"
+	"github.com/DNahar74/PulseDB/internal/utils"
+)
+
+// InfoHandler gives INFO the sections kept by the server
+type InfoHandler interface {
+	// Info returns the fields of the server, clients, persistence & stats sections that the server keeps
+	Info(section string) []string
+	// ResetStats clears the statistics of the server, for CONFIG RESETSTAT
+	ResetStats()
+}
+
+var infoHandle handle[InfoHandler]
+
+func serverInfo() InfoHandler {
+	return infoHandle.get()
+}
+
+// InitInfo passes the server's INFO sections for access in this package
+func InitInfo(h InfoHandler) {
+	infoHandle.set(h)
+}
+
+// infoSection builds the fields of one INFO section
+type infoSection struct {
+	name   string
+	fields func() []string
+	// extra sections are left out of the default INFO, like commandstats in Redis
+	extra bool
+}
+
+// infoSections lists the INFO sections in the order they are printed
+var infoSections = []infoSection{
+	{name: "server", fields: serverSectionInfo},
+	{name: "clients", fields: func() []string { return serverFields("clients") }},
+	{name: "memory", fields: memoryInfo},
+	{name: "persistence", fields: func() []string { return serverFields("persistence") }},
+	{name: "stats", fields: statsInfo},
+	{name: "replication", fields: replicationInfo},
+	{name: "commandstats", fields: commandStatsInfo, extra: true},
+	{name: "cluster", fields: clusterInfo},
+	{name: "keyspace", fields: keyspaceInfo},
+}
+
+func serverSectionInfo() []string {
+	return append([]string{"redis_version:" + redisVersion}, serverFields("server")...)
+}
+
+// serverFields returns the fields of a section kept by the server
+func serverFields(section string) []string {
+	if serverInfo() == nil {
+		return nil
+	}
+	return serverInfo().Info(section)
+}
+
+func clusterInfo() []string {
+	if clusterState() == nil {
+		return []string{"cluster_enabled:0"}
+	}
+	return []string{"cluster_enabled:1"}
+}
+
+// memoryInfo gives the estimated memory of the keys, & the memory of the process
+// The fragmentation is the RSS over the memory of the keys, like in Redis, the go_heap fields come from the Go runtime
+func memoryInfo() []string {
+	used := databases().UsedMemory()
+	peak := trackPeakMemory(used)
+	limit, policy := databases().MaxMemory()
+
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	rss, ok := utils.ResidentMemory()
+	if !ok {
+		// Without /proc, the memory the runtime holds from the system is the closest to the RSS
+		rss = int64(ms.Sys - ms.HeapReleased)
+	}
+	ratio := 0.0
+	if used > 0 {
+		ratio = float64(rss) / float64(used)
+	}
+
+	return []string{
+		fmt.Sprintf("used_memory:%d", used),
+		"used_memory_human:" + utils.FormatMemory(used),
+		fmt.Sprintf("used_memory_rss:%d", rss),
+		"used_memory_rss_human:" + utils.FormatMemory(rss),
+		fmt.Sprintf("used_memory_peak:%d", peak),
+		"used_memory_peak_human:" + utils.FormatMemory(peak),
+		fmt.Sprintf("mem_fragmentation_ratio:%.2f", ratio),
+		fmt.Sprintf("mem_fragmentation_bytes:%d", rss-used),
+		fmt.Sprintf("go_heap_alloc:%d", ms.HeapAlloc),
+		fmt.Sprintf("go_heap_inuse:%d", ms.HeapInuse),
+		fmt.Sprintf("go_heap_released:%d", ms.HeapReleased),
+		fmt.Sprintf("maxmemory:%d", limit),
+		"maxmemory_human:" + utils.FormatMemory(limit),
+		"maxmemory_policy:" + policy.String(),
+	}
+}
+
+func statsInfo() []string {
+	stats := databases().Stats()
+	return append(serverFields("stats"),
+		fmt.Sprintf("total_commands_processed:%d", commandsProcessed.Load()),
+		fmt.Sprintf("instantaneous_ops_per_sec:%d", instantaneousOps()),
+		fmt.Sprintf("expired_keys:%d", stats.ExpiredKeys),
+		fmt.Sprintf("evicted_keys:%d", stats.EvictedKeys),
+		fmt.Sprintf("keyspace_hits:%d", stats.Hits),
+		fmt.Sprintf("keyspace_misses:%d", stats.Misses),
+	)
+}
+
+// keyspaceInfo gives the number of keys & of keys with an expiry of every database that has keys
+func keyspaceInfo() []string {
+	fields := make([]string, 0)
+	for i := range databases().Len() {
+		db := databases().DB(i)
+		if keys := db.Size(); keys > 0 {
+			fields = append(fields, fmt.Sprintf("db%d:keys=%d,expires=%d", i, keys, db.Volatile()))
+		}
+	}
+	return fields
+}
+
+func replicationInfo() []string {
+	if replication() == nil {
+		return []string{"role:master", "connected_slaves:0"}
+	}
+	return replication().Info()
+}
+
+func handleINFO(c *call) (resp.Type, error) {
+	wanted := make(map[string]bool)
+	for _, a := range c.args {
+		wanted[strings.ToLower(a)] = true
+	}
+	all := wanted["all"] || wanted["everything"]
+	defaults := len(wanted) == 0 || wanted["default"]
+
+	var sb strings.Builder
+	for _, section := range infoSections {
+		if !all && !wanted[section.name] && (!defaults || section.extra) {
+			continue
+		}
+
+		if sb.Len() > 0 {
+			sb.WriteString("\r\n")
+		}
+		sb.WriteString("# " + strings.ToUpper(section.name[:1]) + section.name[1:] + "\r\n")
+		for _, f := range section.fields() {
+			sb.WriteString(f + "\r\n")
+		}
+	}
+
+	return resp.BulkString{Value: sb.String(), Length: sb.Len()}, nil
+}
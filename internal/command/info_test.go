@@ -0,0 +1,103 @@
+package command
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DNahar74/PulseDB/internal/resp"
+	"github.com/DNahar74/PulseDB/internal/store"
+)
+
+// infoFields runs INFO & returns its fields by name, with the section headers under "#"
+func infoFields(t *testing.T, args ...string) map[string]string {
+	t.Helper()
+
+	reply := run(t, NewSession(), append([]string{"INFO"}, args...)...)
+	fields := make(map[string]string)
+	for _, line := range strings.Split(reply.(resp.BulkString).Value, "\r\n") {
+		if strings.HasPrefix(line, "# ") {
+			fields["#"] += strings.ToLower(line[2:]) + " "
+			continue
+		}
+		if name, value, ok := strings.Cut(line, ":"); ok {
+			fields[name] = value
+		}
+	}
+	return fields
+}
+
+func TestInfo(t *testing.T) {
+	d := store.CreateDatabases(4)
+	InitDatabases(d)
+	sess := NewSession()
+	run(t, sess, "CONFIG", "RESETSTAT")
+
+	run(t, sess, "SET", "a", "1")
+	run(t, sess, "SET", "b", "1", "PX", "1")
+	run(t, sess, "SELECT", "2")
+	run(t, sess, "SET", "c", "1", "EX", "100")
+	run(t, sess, "GET", "c")
+	_, _ = HandleCommands(sess, newCommand("GET", "missing"))
+	_, _ = HandleCommands(sess, newCommand("INCR", "nope", "extra"))
+	_, _ = HandleCommands(sess, newCommand("HSET", "c", "f", "v"))
+	drainAOF(d)
+
+	fields := infoFields(t)
+	if fields["#"] != "server clients memory persistence stats replication cluster keyspace " {
+		t.Errorf("default sections = %q", fields["#"])
+	}
+	if fields["db0"] != "keys=2,expires=1" || fields["db2"] != "keys=1,expires=1" || fields["db1"] != "" {
+		t.Errorf("keyspace db0 %q, db1 %q, db2 %q", fields["db0"], fields["db1"], fields["db2"])
+	}
+	// Only the read commands count, the lookup of HSET doesn't
+	if fields["keyspace_hits"] != "1" || fields["keyspace_misses"] != "1" {
+		t.Errorf("keyspace_hits %q, keyspace_misses %q", fields["keyspace_hits"], fields["keyspace_misses"])
+	}
+	if fields["redis_version"] != redisVersion || fields["used_memory_peak"] == "" || fields["mem_fragmentation_ratio"] == "" {
+		t.Errorf("server & memory fields: %v", fields)
+	}
+	// The fragmentation is the RSS over the memory of the keys
+	rss, _ := strconv.ParseFloat(fields["used_memory_rss"], 64)
+	used, _ := strconv.ParseFloat(fields["used_memory"], 64)
+	if want := fmt.Sprintf("%.2f", rss/used); rss == 0 || fields["mem_fragmentation_ratio"] != want {
+		t.Errorf("used_memory_rss %v, mem_fragmentation_ratio %q, want %s", rss, fields["mem_fragmentation_ratio"], want)
+	}
+
+	// A key deleted when it is found expired counts as expired
+	time.Sleep(5 * time.Millisecond)
+	run(t, sess, "SELECT", "0")
+	_, _ = HandleCommands(sess, newCommand("GET", "b"))
+	if fields := infoFields(t, "stats"); fields["expired_keys"] != "1" || fields["keyspace_misses"] != "2" {
+		t.Errorf("expired_keys %q, keyspace_misses %q", fields["expired_keys"], fields["keyspace_misses"])
+	}
+
+	fields = infoFields(t, "commandstats", "KEYSPACE")
+	if fields["#"] != "commandstats keyspace " {
+		t.Errorf("sections of INFO commandstats keyspace = %q", fields["#"])
+	}
+	if got := fields["cmdstat_get"]; !strings.HasPrefix(got, "calls=3,usec=") || !strings.HasSuffix(got, ",rejected_calls=0,failed_calls=2") {
+		t.Errorf("cmdstat_get = %q", got)
+	}
+	if got := fields["cmdstat_hset"]; !strings.HasPrefix(got, "calls=1,") || !strings.HasSuffix(got, ",failed_calls=1") {
+		t.Errorf("cmdstat_hset = %q", got)
+	}
+	// A wrong number of arguments is refused before the command is looked at, like an unknown command
+	if _, ok := fields["cmdstat_incr"]; ok {
+		t.Errorf("cmdstat_incr = %q", fields["cmdstat_incr"])
+	}
+	if fields := infoFields(t, "everything"); fields["cmdstat_info"] == "" {
+		t.Error("INFO everything has no commandstats")
+	}
+
+	run(t, sess, "CONFIG", "RESETSTAT")
+	fields = infoFields(t, "stats", "commandstats")
+	if fields["keyspace_hits"] != "0" || fields["expired_keys"] != "0" || fields["total_commands_processed"] != "1" {
+		t.Errorf("stats after CONFIG RESETSTAT: %v", fields)
+	}
+	if len(fields) != 8 {
+		t.Errorf("commandstats after CONFIG RESETSTAT: %v", fields)
+	}
+}
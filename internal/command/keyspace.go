@@ -0,0 +1,287 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/DNahar74/PulseDB/internal/resp"
+	"github.com/DNahar74/PulseDB/internal/store"
+	"github.com/DNahar74/PulseDB/internal/utils"
+)
+
+var errNoSuchKey = errors.New("no such key")
+
+// handleDEL deletes keys & returns the number of keys that existed, UNLINK is the same command here
+func handleDEL(c *call) (resp.Type, error) {
+	deleted := 0
+	for _, key := range c.args {
+		if c.db.DEL(key) == nil {
+			deleted++
+		}
+	}
+
+	if deleted == 0 {
+		c.dontPropagate()
+	}
+	return resp.Integer{Value: deleted}, nil
+}
+
+// handleEXISTS counts the keys that exist, a key given several times is counted several times
+func handleEXISTS(c *call) (resp.Type, error) {
+	count := 0
+	for _, key := range c.args {
+		if _, ok := c.lookup(key); ok {
+			count++
+		}
+	}
+	return resp.Integer{Value: count}, nil
+}
+
+func handleTOUCH(c *call) (resp.Type, error) {
+	count := 0
+	for _, key := range c.args {
+		if c.db.Touch(key) {
+			count++
+		}
+	}
+	return resp.Integer{Value: count}, nil
+}
+
+func handleTYPE(c *call) (resp.Type, error) {
+	data, ok := c.lookup(c.args[0])
+	if !ok {
+		return resp.SimpleString{Value: "none"}, nil
+	}
+	return resp.SimpleString{Value: store.TypeName(data.Value)}, nil
+}
+
+func handleRENAME(c *call) (resp.Type, error) {
+	_, err := rename(c, false)
+	if err != nil {
+		return nil, err
+	}
+	return resp.SimpleString{Value: "OK"}, nil
+}
+
+func handleRENAMENX(c *call) (resp.Type, error) {
+	renamed, err := rename(c, true)
+	if err != nil {
+		return nil, err
+	}
+	if !renamed {
+		return resp.Integer{Value: 0}, nil
+	}
+	return resp.Integer{Value: 1}, nil
+}
+
+// rename moves a key to a new name, keeping its TTL, & returns false if nx is set & the new name exists
+// It is logged as a RESTORE of the new name & a DEL of the old one, so that replaying it does not depend on the old key
+// still existing, which it may not once it expired
+func rename(c *call, nx bool) (bool, error) {
+	key, newKey := c.args[0], c.args[1]
+
+	data, ok := c.lookup(key)
+	if !ok {
+		return false, errNoSuchKey
+	}
+	if key == newKey {
+		c.dontPropagate()
+		return !nx, nil
+	}
+	if _, ok := c.lookup(newKey); ok && nx {
+		c.dontPropagate()
+		return false, nil
+	}
+
+	payload, err := store.Dump(data.Value)
+	if err != nil {
+		return false, err
+	}
+
+	c.db.SET(newKey, data)
+	_ = c.db.DEL(key)
+
+	c.propagate(restoreCommand(newKey, payload, data.Expiry)...)
+	c.propagate("DEL", key)
+
+	return true, nil
+}
+
+// handleCOPY copies a value & its TTL to another key: COPY source destination [DB destination-db] [REPLACE]
+func handleCOPY(c *call) (resp.Type, error) {
+	key, newKey := c.args[0], c.args[1]
+
+	db, replace := c.session.db, false
+	for i := 2; i < len(c.args); i++ {
+		switch strings.ToUpper(c.args[i]) {
+		case "REPLACE":
+			replace = true
+		case "DB":
+			if i+1 >= len(c.args) {
+				return nil, errors.New("syntax error")
+			}
+			index, err := parseDBIndex(c.args[i+1])
+			if err != nil {
+				return nil, err
+			}
+			if clusterState() != nil && index != 0 {
+				return nil, errors.New("Copying to another database is not allowed in cluster mode")
+			}
+			db = index
+			i++
+		default:
+			return nil, errors.New("syntax error")
+		}
+	}
+
+	if db == c.session.db && key == newKey {
+		return nil, errors.New("source and destination objects are the same")
+	}
+	dst := databases().DB(db)
+
+	data, ok := c.lookup(key)
+	if !ok {
+		c.dontPropagate()
+		return resp.Integer{Value: 0}, nil
+	}
+	if _, ok := dst.Lookup(newKey); ok && !replace {
+		c.dontPropagate()
+		return resp.Integer{Value: 0}, nil
+	}
+
+	payload, err := store.Dump(data.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	// The copy is a new entry, it does not share the access tracking of the source
+	dst.SET(newKey, store.Data{Value: store.Clone(data.Value), Expiry: data.Expiry})
+	c.propagateTo(db, restoreCommand(newKey, payload, data.Expiry)...)
+
+	return resp.Integer{Value: 1}, nil
+}
+
+func handleKEYS(c *call) (resp.Type, error) {
+	pattern := c.args[0]
+
+	items := make([]resp.Type, 0)
+	for _, key := range c.db.KEYS() {
+		if utils.GlobMatch(pattern, key) {
+			items = append(items, bulkString(key))
+		}
+	}
+	return resp.Array{Length: len(items), Items: items}, nil
+}
+
+// handleSCAN iterates the keyspace: SCAN cursor [MATCH pattern] [COUNT count] [TYPE type]
+// Every key present from the first to the last call of a scan is returned at least once, see store.Scan
+func handleSCAN(c *call) (resp.Type, error) {
+	cursor, err := strconv.ParseUint(c.args[0], 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+
+	pattern, typeName, count := "", "", 10
+	for i := 1; i < len(c.args); i += 2 {
+		if i+1 >= len(c.args) {
+			return nil, errors.New("syntax error")
+		}
+		switch strings.ToUpper(c.args[i]) {
+		case "MATCH":
+			pattern = c.args[i+1]
+		case "COUNT":
+			count, err = strconv.Atoi(c.args[i+1])
+			if err != nil {
+				return nil, errors.New("value is not an integer or out of range")
+			}
+			if count < 1 {
+				return nil, errors.New("syntax error")
+			}
+		case "TYPE":
+			typeName = strings.ToLower(c.args[i+1])
+		default:
+			return nil, errors.New("syntax error")
+		}
+	}
+
+	next, keys := c.db.Scan(cursor, count)
+
+	// Like in Redis, the filters apply after the keys are collected, so a call may return no key with a non-zero cursor
+	items := make([]resp.Type, 0, len(keys))
+	for _, key := range keys {
+		if pattern != "" && !utils.GlobMatch(pattern, key) {
+			continue
+		}
+		if typeName != "" {
+			data, ok := c.lookup(key)
+			if !ok || store.TypeName(data.Value) != typeName {
+				continue
+			}
+		}
+		items = append(items, bulkString(key))
+	}
+
+	nextCursor := strconv.FormatUint(next, 10)
+	return resp.Array{Length: 2, Items: []resp.Type{
+		bulkString(nextCursor),
+		resp.Array{Length: len(items), Items: items},
+	}}, nil
+}
+
+func handleRANDOMKEY(c *call) (resp.Type, error) {
+	key, ok := c.db.RandomKey()
+	if !ok {
+		return resp.Null{}, nil
+	}
+	return bulkString(key), nil
+}
+
+// handleOBJECT inspects the internal representation of a value: OBJECT ENCODING key
+func handleOBJECT(c *call) (resp.Type, error) {
+	sub := strings.ToUpper(c.args[0])
+
+	switch {
+	case sub == "ENCODING" && len(c.args) == 2:
+		data, ok := c.lookup(c.args[1])
+		if !ok {
+			return resp.Null{}, nil
+		}
+		return bulkString(store.Encoding(data.Value)), nil
+	case sub == "HELP" && len(c.args) == 1:
+		lines := []string{
+			"OBJECT <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+			"ENCODING <key>",
+			"    Return the kind of internal representation used in order to store the value",
+			"    associated with a <key>.",
+			"HELP",
+			"    Print this help.",
+		}
+		items := make([]resp.Type, len(lines))
+		for i, line := range lines {
+			items[i] = resp.SimpleString{Value: line}
+		}
+		return resp.Array{Length: len(items), Items: items}, nil
+	default:
+		return nil, fmt.Errorf("unknown subcommand or wrong number of arguments for '%s'. Try OBJECT HELP.", c.args[0])
+	}
+}
+
+// ExpireKeys removes keys of a database found expired outside of a command, such as by a snapshot
+// The removal is logged as DEL like the active expiry of the hash fields, the replicas don't expire the keys on their
+// own
+func ExpireKeys(db int, keys []string) {
+	if replication() != nil && replication().IsReplica() || writesPaused() {
+		return
+	}
+
+	execLock.Lock()
+	defer execLock.Unlock()
+
+	for _, key := range keys {
+		if databases().DB(db).DeleteExpired(key) {
+			propagate(db, []string{"DEL", key}, true)
+		}
+	}
+}
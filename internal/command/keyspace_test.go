@@ -0,0 +1,173 @@
+package command
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DNahar74/PulseDB/internal/resp"
+	"github.com/DNahar74/PulseDB/internal/store"
+)
+
+// keyNames returns the sorted names of an array of keys
+func keyNames(v resp.Type) []string {
+	arr := v.(resp.Array)
+	names := make([]string, len(arr.Items))
+	for i, item := range arr.Items {
+		names[i] = item.(resp.BulkString).Value
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestDelExists(t *testing.T) {
+	d := store.CreateDatabases(1)
+	InitDatabases(d)
+	sess := NewSession()
+
+	run(t, sess, "SET", "a", "1")
+	run(t, sess, "SET", "b", "1")
+
+	if reply := run(t, sess, "EXISTS", "a", "a", "b", "c"); reply != (resp.Integer{Value: 3}) {
+		t.Errorf("EXISTS = %v, want 3", reply)
+	}
+	if reply := run(t, sess, "TYPE", "a"); reply != (resp.SimpleString{Value: "string"}) {
+		t.Errorf("TYPE = %v, want string", reply)
+	}
+	if reply := run(t, sess, "TYPE", "c"); reply != (resp.SimpleString{Value: "none"}) {
+		t.Errorf("TYPE of a missing key = %v, want none", reply)
+	}
+
+	drainAOF(d)
+	if reply := run(t, sess, "DEL", "a", "b", "c"); reply != (resp.Integer{Value: 2}) {
+		t.Errorf("DEL = %v, want 2", reply)
+	}
+	if reply := run(t, sess, "UNLINK", "a"); reply != (resp.Integer{Value: 0}) {
+		t.Errorf("UNLINK of a missing key = %v, want 0", reply)
+	}
+	if got := drainAOF(d); len(got) != 1 {
+		t.Errorf("propagated %q, want only the first DEL", got)
+	}
+}
+
+func TestRename(t *testing.T) {
+	d := store.CreateDatabases(1)
+	InitDatabases(d)
+	sess := NewSession()
+
+	run(t, sess, "SET", "a", "1", "EX", "100")
+	run(t, sess, "SET", "b", "2")
+
+	if reply := run(t, sess, "RENAMENX", "a", "b"); reply != (resp.Integer{Value: 0}) {
+		t.Errorf("RENAMENX to an existing key = %v, want 0", reply)
+	}
+	run(t, sess, "RENAME", "a", "b")
+
+	data, ok := d.DB(0).Lookup("b")
+	if !ok || data.Value != store.NewInt(1) || time.Until(data.Expiry) < 99*time.Second {
+		t.Errorf("b = %v, want the value & the TTL of a", data)
+	}
+	if _, err := HandleCommands(sess, newCommand("RENAME", "a", "c")); err == nil || err.Error() != "no such key" {
+		t.Errorf("RENAME of a missing key: %v", err)
+	}
+
+	// The rename is logged as a RESTORE, which does not depend on the source still existing when it is replayed
+	drainAOF(d)
+	run(t, sess, "RENAME", "b", "c")
+	got := drainAOF(d)
+	if len(got) != 2 || !strings.Contains(got[0], "RESTORE") || !strings.Contains(got[0], "ABSTTL") || !strings.Contains(got[1], "DEL") {
+		t.Errorf("propagated %q, want RESTORE c & DEL b", got)
+	}
+}
+
+func TestCopy(t *testing.T) {
+	d := store.CreateDatabases(2)
+	InitDatabases(d)
+	sess := NewSession()
+
+	run(t, sess, "SET", "a", "1")
+	run(t, sess, "SET", "b", "2")
+
+	if reply := run(t, sess, "COPY", "a", "b"); reply != (resp.Integer{Value: 0}) {
+		t.Errorf("COPY to an existing key = %v, want 0", reply)
+	}
+	if reply := run(t, sess, "COPY", "a", "b", "REPLACE"); reply != (resp.Integer{Value: 1}) {
+		t.Errorf("COPY REPLACE = %v, want 1", reply)
+	}
+	if reply := run(t, sess, "COPY", "a", "a", "DB", "1"); reply != (resp.Integer{Value: 1}) {
+		t.Errorf("COPY to another database = %v, want 1", reply)
+	}
+	if _, ok := d.DB(1).Lookup("a"); !ok {
+		t.Error("the key was not copied to database 1")
+	}
+	if _, err := HandleCommands(sess, newCommand("COPY", "a", "a")); err == nil {
+		t.Error("COPY of a key to itself succeeded")
+	}
+}
+
+func TestKeysScan(t *testing.T) {
+	d := store.CreateDatabases(1)
+	InitDatabases(d)
+	sess := NewSession()
+
+	for _, key := range []string{"user:1", "user:2", "user:10", "session:1"} {
+		run(t, sess, "SET", key, "x")
+	}
+
+	if got := keyNames(run(t, sess, "KEYS", "user:?")); strings.Join(got, ",") != "user:1,user:2" {
+		t.Errorf("KEYS user:? = %v", got)
+	}
+
+	found := make([]string, 0)
+	cursor := "0"
+	for {
+		reply := run(t, sess, "SCAN", cursor, "MATCH", "user:*", "COUNT", "1", "TYPE", "string").(resp.Array)
+		found = append(found, keyNames(reply.Items[1])...)
+		cursor = reply.Items[0].(resp.BulkString).Value
+		if cursor == "0" {
+			break
+		}
+	}
+	sort.Strings(found)
+	if strings.Join(found, ",") != "user:1,user:10,user:2" {
+		t.Errorf("SCAN MATCH user:* = %v", found)
+	}
+
+	reply := run(t, sess, "SCAN", "0", "TYPE", "hash", "COUNT", "100").(resp.Array)
+	if len(keyNames(reply.Items[1])) != 0 {
+		t.Errorf("SCAN TYPE hash = %v, want no key", reply.Items[1])
+	}
+	if _, err := HandleCommands(sess, newCommand("SCAN", "x")); err == nil {
+		t.Error("SCAN with an invalid cursor succeeded")
+	}
+
+	if reply := run(t, sess, "RANDOMKEY"); reply == (resp.Null{}) {
+		t.Error("RANDOMKEY = null on a non-empty database")
+	}
+	run(t, sess, "FLUSHDB")
+	if reply := run(t, sess, "RANDOMKEY"); reply != (resp.Null{}) {
+		t.Errorf("RANDOMKEY = %v on an empty database", reply)
+	}
+}
+
+func TestExpireKeys(t *testing.T) {
+	d := store.CreateDatabases(2)
+	InitDatabases(d)
+	sess := NewSession()
+
+	run(t, sess, "SELECT", "1")
+	run(t, sess, "SET", "gone", "v", "PX", "1")
+	run(t, sess, "SET", "kept", "v")
+	time.Sleep(5 * time.Millisecond)
+	drainAOF(d)
+
+	// A key that is not expired is left alone
+	ExpireKeys(1, []string{"gone", "kept"})
+	if got := drainAOF(d); len(got) != 1 || !strings.Contains(got[0], "DEL\r\n$4\r\ngone") {
+		t.Errorf("propagated %q, want DEL gone", got)
+	}
+	if d.DB(1).Size() != 1 {
+		t.Errorf("%d keys left, want 1", d.DB(1).Size())
+	}
+}
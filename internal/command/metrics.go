@@ -0,0 +1,64 @@
+package command
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/DNahar74/PulseDB/internal/metrics"
+)
+
+// WriteMetrics writes the metrics of the commands & of the keyspace
+// The commands that were never called or rejected are left out
+func WriteMetrics(w *metrics.Writer) {
+	cmds := make([]*commandSpec, 0)
+	for _, cmd := range commandTable {
+		if cmd.stats.calls.Load() > 0 || cmd.stats.rejected.Load() > 0 {
+			cmds = append(cmds, cmd)
+		}
+	}
+	sort.Slice(cmds, func(i, j int) bool { return cmds[i].name < cmds[j].name })
+
+	for _, counter := range []struct {
+		name, help string
+		value      func(s *commandStats) int64
+	}{
+		{"pulsedb_commands_total", "Commands run, by command.", func(s *commandStats) int64 { return s.calls.Load() }},
+		{"pulsedb_commands_rejected_total", "Commands refused before running, by command.", func(s *commandStats) int64 { return s.rejected.Load() }},
+		{"pulsedb_commands_failed_total", "Commands that returned an error, by command.", func(s *commandStats) int64 { return s.failed.Load() }},
+	} {
+		w.Family(counter.name, metrics.Counter, counter.help)
+		for _, cmd := range cmds {
+			w.Sample(counter.name, float64(counter.value(&cmd.stats)), "cmd", cmd.name)
+		}
+	}
+	w.Family("pulsedb_command_duration_seconds", metrics.Histogram, "Time spent running the commands, by command.")
+	for _, cmd := range cmds {
+		w.Latency("pulsedb_command_duration_seconds", &cmd.stats.latency, "cmd", cmd.name)
+	}
+
+	w.Family("pulsedb_keyspace_keys", metrics.Gauge, "Keys of every database, including the expired ones not deleted yet.")
+	for i := range databases().Len() {
+		w.Sample("pulsedb_keyspace_keys", float64(databases().DB(i).Size()), "db", strconv.Itoa(i))
+	}
+	w.Family("pulsedb_keyspace_expires", metrics.Gauge, "Keys with an expiry of every database.")
+	for i := range databases().Len() {
+		w.Sample("pulsedb_keyspace_expires", float64(databases().DB(i).Volatile()), "db", strconv.Itoa(i))
+	}
+
+	stats := databases().Stats()
+	limit, _ := databases().MaxMemory()
+	for _, m := range []struct {
+		name, kind, help string
+		value            int64
+	}{
+		{"pulsedb_expired_keys_total", metrics.Counter, "Keys deleted because they expired.", stats.ExpiredKeys},
+		{"pulsedb_evicted_keys_total", metrics.Counter, "Keys evicted to stay under maxmemory.", stats.EvictedKeys},
+		{"pulsedb_keyspace_hits_total", metrics.Counter, "Key lookups that found the key.", stats.Hits},
+		{"pulsedb_keyspace_misses_total", metrics.Counter, "Key lookups that did not find the key.", stats.Misses},
+		{"pulsedb_memory_used_bytes", metrics.Gauge, "Estimated memory used by the keys.", databases().UsedMemory()},
+		{"pulsedb_memory_max_bytes", metrics.Gauge, "The maxmemory limit, 0 when there is none.", limit},
+	} {
+		w.Family(m.name, m.kind, m.help)
+		w.Sample(m.name, float64(m.value))
+	}
+}
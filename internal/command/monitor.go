@@ -0,0 +1,117 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// monitorBacklog is the number of lines a monitor may fall behind, a monitor further behind is disconnected so that
+// it doesn't slow the server down
+const monitorBacklog = 10000
+
+// Monitor receives the commands run by every client, for MONITOR
+type Monitor struct {
+	lines chan string
+}
+
+// The monitors & their number, which keeps feedMonitors cheap when there are none
+var (
+	monitorsMu   sync.Mutex
+	monitors     = map[*Monitor]struct{}{}
+	monitorCount atomic.Int64
+)
+
+// AddMonitor starts feeding a new monitor
+func AddMonitor() *Monitor {
+	m := &Monitor{lines: make(chan string, monitorBacklog)}
+
+	monitorsMu.Lock()
+	defer monitorsMu.Unlock()
+
+	monitors[m] = struct{}{}
+	monitorCount.Add(1)
+	return m
+}
+
+// RemoveMonitor stops feeding a monitor
+func RemoveMonitor(m *Monitor) {
+	monitorsMu.Lock()
+	defer monitorsMu.Unlock()
+
+	removeMonitorLocked(m)
+}
+
+func removeMonitorLocked(m *Monitor) {
+	if _, ok := monitors[m]; ok {
+		delete(monitors, m)
+		monitorCount.Add(-1)
+		close(m.lines)
+	}
+}
+
+// Lines returns the commands of the monitor, one per line, it is closed when the monitor fell too far behind
+func (m *Monitor) Lines() <-chan string {
+	return m.lines
+}
+
+// feedMonitors sends a command to the monitors, as Redis prints it:
+//
+//	1700000000.123456 [0 127.0.0.1:50000] "SET" "key" "value"
+func feedMonitors(sess *Session, argv []string) {
+	if monitorCount.Load() == 0 {
+		return
+	}
+
+	now := time.Now()
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d.%06d [%d %s]", now.Unix(), now.Nanosecond()/1000, sess.db, sess.addr)
+	for _, a := range RedactArgs(argv) {
+		sb.WriteString(" " + reprArg(a))
+	}
+	line := sb.String()
+
+	monitorsMu.Lock()
+	defer monitorsMu.Unlock()
+
+	for m := range monitors {
+		select {
+		case m.lines <- line:
+		default:
+			removeMonitorLocked(m)
+		}
+	}
+}
+
+// reprArg quotes an argument, escaping the quotes, the backslashes & the bytes that are not printable
+func reprArg(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch ch := s[i]; ch {
+		case '\\', '"':
+			sb.WriteByte('\\')
+			sb.WriteByte(ch)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		case '\a':
+			sb.WriteString(`\a`)
+		case '\b':
+			sb.WriteString(`\b`)
+		default:
+			if ch < ' ' || ch > '~' {
+				fmt.Fprintf(&sb, `\x%02x`, ch)
+			} else {
+				sb.WriteByte(ch)
+			}
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
@@ -0,0 +1,48 @@
+package command
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/DNahar74/PulseDB/internal/store"
+)
+
+func TestMonitor(t *testing.T) {
+	InitDatabases(store.CreateDatabases(4))
+	m := AddMonitor()
+	defer RemoveMonitor(m)
+
+	sess := NewSession()
+	sess.SetAddr("127.0.0.1:5000")
+	run(t, sess, "SELECT", "2")
+	run(t, sess, "SET", "k", "a \"b\"\n\xff")
+	run(t, sess, "CONFIG", "RESETSTAT")
+	_, _ = HandleCommands(sess, newCommand("AUTH", "secret"))
+
+	for _, want := range []string{
+		`^\d+\.\d{6} \[0 127\.0\.0\.1:5000\] "SELECT" "2"$`,
+		`^\d+\.\d{6} \[2 127\.0\.0\.1:5000\] "SET" "k" "a \\"b\\"\\n\\xff"$`,
+		// CONFIG is an administrative command, AUTH is shown without its password
+		`^\d+\.\d{6} \[2 127\.0\.0\.1:5000\] "AUTH" "\(redacted\)"$`,
+	} {
+		line := <-m.Lines()
+		if !regexp.MustCompile(want).MatchString(line) {
+			t.Errorf("line %q, want %s", line, want)
+		}
+	}
+
+	// A monitor that falls too far behind is disconnected, without holding the other clients up
+	for range monitorBacklog + 1 {
+		run(t, sess, "PING")
+	}
+	n := 0
+	for range m.Lines() {
+		n++
+	}
+	if n != monitorBacklog {
+		t.Errorf("the monitor received %d lines before it was closed, want %d", n, monitorBacklog)
+	}
+	if monitorCount.Load() != 0 {
+		t.Errorf("%d monitors left", monitorCount.Load())
+	}
+}
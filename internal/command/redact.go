@@ -0,0 +1,44 @@
+package command
+
+import "strings"
+
+// redacted replaces the secrets in the arguments printed to the logs, the slow log & the monitors
+const redacted = "(redacted)"
+
+// secretParams are the parameters of CONFIG SET whose values are passwords
+var secretParams = map[string]bool{"requirepass": true, "masterauth": true}
+
+// RedactArgs leaves the secrets out of the arguments of a command: the arguments of AUTH & HELLO, the password rules
+// of ACL SETUSER & the passwords set by CONFIG SET
+func RedactArgs(argv []string) []string {
+	if len(argv) == 0 {
+		return argv
+	}
+
+	switch {
+	case strings.EqualFold(argv[0], "AUTH") || strings.EqualFold(argv[0], "HELLO"):
+		args := []string{argv[0]}
+		for range argv[1:] {
+			args = append(args, redacted)
+		}
+		return args
+	case strings.EqualFold(argv[0], "ACL") && len(argv) > 3 && strings.EqualFold(argv[1], "SETUSER"):
+		// >pass & <pass add & remove a password, #hash & !hash do the same with its SHA-256
+		args := append([]string(nil), argv...)
+		for i := 3; i < len(args); i++ {
+			if args[i] != "" && strings.ContainsRune("><#!", rune(args[i][0])) {
+				args[i] = args[i][:1] + redacted
+			}
+		}
+		return args
+	case strings.EqualFold(argv[0], "CONFIG") && len(argv) > 3 && strings.EqualFold(argv[1], "SET"):
+		args := append([]string(nil), argv...)
+		for i := 2; i+1 < len(args); i += 2 {
+			if secretParams[strings.ToLower(args[i])] {
+				args[i+1] = redacted
+			}
+		}
+		return args
+	}
+	return argv
+}
@@ -0,0 +1,40 @@
+package command
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/DNahar74/PulseDB/internal/resp"
+	"github.com/DNahar74/PulseDB/internal/store"
+)
+
+func TestRedactArgs(t *testing.T) {
+	tests := []struct {
+		argv, want string
+	}{
+		{"AUTH alice secret", "AUTH (redacted) (redacted)"},
+		{"HELLO 2 AUTH alice secret", "HELLO (redacted) (redacted) (redacted) (redacted)"},
+		{"ACL SETUSER alice on >secret <old #5e88 !5e88 ~app:* +get", "ACL SETUSER alice on >(redacted) <(redacted) #(redacted) !(redacted) ~app:* +get"},
+		{"ACL GETUSER alice", "ACL GETUSER alice"},
+		{"SET >key value", "SET >key value"},
+		{"CONFIG SET maxmemory 10mb requirepass secret MASTERAUTH other", "CONFIG SET maxmemory 10mb requirepass (redacted) MASTERAUTH (redacted)"},
+		{"CONFIG GET requirepass", "CONFIG GET requirepass"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(RedactArgs(strings.Fields(tt.argv)), " "); got != tt.want {
+			t.Errorf("RedactArgs(%s) = %s, want %s", tt.argv, got, tt.want)
+		}
+	}
+
+	// The slow log keeps the redacted arguments
+	InitDatabases(store.CreateDatabases(1))
+	t.Cleanup(func() { SetSlowlog(10000, 128) })
+	SetSlowlog(0, 1)
+	sess := NewSession()
+	run(t, sess, "ACL", "SETUSER", "analytics", "on", ">hunter2")
+	entry := run(t, sess, "SLOWLOG", "GET", "1").(resp.Array).Items[0].(resp.Array)
+	if got := entryArgs(entry); got != "ACL SETUSER analytics on >(redacted)" {
+		t.Errorf("the slow log kept the password of ACL SETUSER: %s", got)
+	}
+	run(t, sess, "ACL", "DELUSER", "analytics")
+}
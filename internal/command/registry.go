@@ -0,0 +1,218 @@
+package command
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/DNahar74/PulseDB/internal/resp"
+)
+
+// Command flags, used by the dispatcher to decide how a command is executed
+const (
+	// flagWrite marks commands that may modify the keyspace, they are propagated to the AOF
+	flagWrite = 1 << iota
+	// flagReadOnly marks commands that only read the keyspace
+	flagReadOnly
+	// flagAsking marks commands that are allowed on an importing slot without a prior ASKING
+	flagAsking
+	// flagDenyOOM marks commands that may use more memory, they are refused when nothing can be evicted
+	flagDenyOOM
+	// flagNoAuth marks commands that a client may run before it authenticates, they are allowed to every ACL user
+	flagNoAuth
+	// flagKeyAccess marks write commands that also return data read from their keys, which need both the read & the
+	// write permissions of the ACL key patterns
+	flagKeyAccess
+
+	// ACL categories, with @read & @write given by flagReadOnly & flagWrite
+	flagKeyspace
+	flagString
+	flagBitmap
+	flagHyperLogLog
+	flagGeo
+	flagHash
+	flagConnection
+	flagAdmin
+	flagDangerous
+)
+
+// commandFunc is the signature of every command handler
+type commandFunc func(c *call) (resp.Type, error)
+
+// commandSpec describes a command in the registry
+type commandSpec struct {
+	name string
+	// arity follows the Redis convention & counts the command name:
+	// a positive number is the exact number of arguments, a negative one is the minimum
+	arity int
+	flags int
+	// firstKey, lastKey & keyStep locate the keys in the arguments, counting the command name
+	// A negative lastKey counts from the end, a zero firstKey means the command takes no keys
+	firstKey int
+	lastKey  int
+	keyStep  int
+	handler  commandFunc
+
+	stats commandStats
+}
+
+func (cs *commandSpec) is(flag int) bool {
+	return cs.flags&flag != 0
+}
+
+// commandTable maps the upper case command names to their specs
+var commandTable = map[string]*commandSpec{}
+
+// execLock serializes write commands, so that they are applied & propagated in the same order
+var execLock sync.RWMutex
+
+func register(name string, arity, flags, firstKey, lastKey, keyStep int, handler commandFunc) {
+	commandTable[name] = &commandSpec{
+		name:     strings.ToLower(name),
+		arity:    arity,
+		flags:    flags,
+		firstKey: firstKey,
+		lastKey:  lastKey,
+		keyStep:  keyStep,
+		handler:  handler,
+	}
+}
+
+func init() {
+	register("PING", -1, flagConnection, 0, 0, 0, handlePING)
+	register("ECHO", 2, flagConnection, 0, 0, 0, handleECHO)
+	register("SET", -3, flagWrite|flagDenyOOM|flagString, 1, 1, 1, handleSET)
+	register("GET", 2, flagReadOnly|flagString, 1, 1, 1, handleGET)
+	register("INCR", 2, flagWrite|flagDenyOOM|flagKeyAccess|flagString, 1, 1, 1, handleIncr)
+	register("DECR", 2, flagWrite|flagDenyOOM|flagKeyAccess|flagString, 1, 1, 1, handleDECR)
+	register("INCRBY", 3, flagWrite|flagDenyOOM|flagKeyAccess|flagString, 1, 1, 1, handleINCRBY)
+	register("DECRBY", 3, flagWrite|flagDenyOOM|flagKeyAccess|flagString, 1, 1, 1, handleDECRBY)
+	register("INCRBYFLOAT", 3, flagWrite|flagDenyOOM|flagKeyAccess|flagString, 1, 1, 1, handleINCRBYFLOAT)
+
+	register("MGET", -2, flagReadOnly|flagString, 1, -1, 1, handleMGET)
+	register("MSET", -3, flagWrite|flagDenyOOM|flagString, 1, -1, 2, handleMSET)
+	register("MSETNX", -3, flagWrite|flagDenyOOM|flagString, 1, -1, 2, handleMSETNX)
+	register("SETNX", 3, flagWrite|flagDenyOOM|flagString, 1, 1, 1, handleSETNX)
+	register("SETEX", 4, flagWrite|flagDenyOOM|flagString, 1, 1, 1, handleSETEX)
+	register("PSETEX", 4, flagWrite|flagDenyOOM|flagString, 1, 1, 1, handlePSETEX)
+	register("APPEND", 3, flagWrite|flagDenyOOM|flagString, 1, 1, 1, handleAPPEND)
+	register("STRLEN", 2, flagReadOnly|flagString, 1, 1, 1, handleSTRLEN)
+	register("GETRANGE", 4, flagReadOnly|flagString, 1, 1, 1, handleGETRANGE)
+	register("SETRANGE", 4, flagWrite|flagDenyOOM|flagString, 1, 1, 1, handleSETRANGE)
+	register("GETSET", 3, flagWrite|flagDenyOOM|flagKeyAccess|flagString, 1, 1, 1, handleGETSET)
+	register("GETDEL", 2, flagWrite|flagKeyAccess|flagString, 1, 1, 1, handleGETDEL)
+	register("GETEX", -2, flagWrite|flagKeyAccess|flagString, 1, 1, 1, handleGETEX)
+	register("LCS", -3, flagReadOnly|flagString, 1, 2, 1, handleLCS)
+
+	register("SETBIT", 4, flagWrite|flagDenyOOM|flagKeyAccess|flagBitmap, 1, 1, 1, handleSETBIT)
+	register("GETBIT", 3, flagReadOnly|flagBitmap, 1, 1, 1, handleGETBIT)
+	register("BITCOUNT", -2, flagReadOnly|flagBitmap, 1, 1, 1, handleBITCOUNT)
+	register("BITPOS", -3, flagReadOnly|flagBitmap, 1, 1, 1, handleBITPOS)
+	register("BITOP", -4, flagWrite|flagDenyOOM|flagKeyAccess|flagBitmap, 2, -1, 1, handleBITOP)
+	register("BITFIELD", -2, flagWrite|flagDenyOOM|flagKeyAccess|flagBitmap, 1, 1, 1, handleBITFIELD)
+	register("BITFIELD_RO", -2, flagReadOnly|flagBitmap, 1, 1, 1, handleBITFIELDRO)
+
+	register("PFADD", -2, flagWrite|flagDenyOOM|flagHyperLogLog, 1, 1, 1, handlePFADD)
+	register("PFCOUNT", -2, flagReadOnly|flagHyperLogLog, 1, -1, 1, handlePFCOUNT)
+	register("PFMERGE", -2, flagWrite|flagDenyOOM|flagKeyAccess|flagHyperLogLog, 1, -1, 1, handlePFMERGE)
+
+	register("GEOADD", -5, flagWrite|flagDenyOOM|flagGeo, 1, 1, 1, handleGEOADD)
+	register("GEODIST", -4, flagReadOnly|flagGeo, 1, 1, 1, handleGEODIST)
+	register("GEOPOS", -2, flagReadOnly|flagGeo, 1, 1, 1, handleGEOPOS)
+	register("GEOHASH", -2, flagReadOnly|flagGeo, 1, 1, 1, handleGEOHASH)
+	register("GEOSEARCH", -7, flagReadOnly|flagGeo, 1, 1, 1, handleGEOSEARCH)
+	register("GEOSEARCHSTORE", -8, flagWrite|flagDenyOOM|flagKeyAccess|flagGeo, 1, 2, 1, handleGEOSEARCHSTORE)
+
+	register("HSET", -4, flagWrite|flagDenyOOM|flagHash, 1, 1, 1, handleHSET)
+	register("HSETNX", 4, flagWrite|flagDenyOOM|flagHash, 1, 1, 1, handleHSETNX)
+	register("HGET", 3, flagReadOnly|flagHash, 1, 1, 1, handleHGET)
+	register("HMGET", -3, flagReadOnly|flagHash, 1, 1, 1, handleHMGET)
+	register("HDEL", -3, flagWrite|flagHash, 1, 1, 1, handleHDEL)
+	register("HLEN", 2, flagReadOnly|flagHash, 1, 1, 1, handleHLEN)
+	register("HEXISTS", 3, flagReadOnly|flagHash, 1, 1, 1, handleHEXISTS)
+	register("HGETALL", 2, flagReadOnly|flagHash, 1, 1, 1, handleHGETALL)
+	register("HKEYS", 2, flagReadOnly|flagHash, 1, 1, 1, handleHKEYS)
+	register("HVALS", 2, flagReadOnly|flagHash, 1, 1, 1, handleHVALS)
+	register("HEXPIRE", -6, flagWrite|flagHash, 1, 1, 1, handleHEXPIRE)
+	register("HPEXPIRE", -6, flagWrite|flagHash, 1, 1, 1, handleHPEXPIRE)
+	register("HEXPIREAT", -6, flagWrite|flagHash, 1, 1, 1, handleHEXPIREAT)
+	register("HPEXPIREAT", -6, flagWrite|flagHash, 1, 1, 1, handleHPEXPIREAT)
+	register("HTTL", -5, flagReadOnly|flagHash, 1, 1, 1, handleHTTL)
+	register("HPTTL", -5, flagReadOnly|flagHash, 1, 1, 1, handleHPTTL)
+	register("HPERSIST", -5, flagWrite|flagHash, 1, 1, 1, handleHPERSIST)
+
+	register("DEL", -2, flagWrite|flagKeyspace, 1, -1, 1, handleDEL)
+	register("UNLINK", -2, flagWrite|flagKeyspace, 1, -1, 1, handleDEL)
+	register("EXISTS", -2, flagReadOnly|flagKeyspace, 1, -1, 1, handleEXISTS)
+	register("TOUCH", -2, flagReadOnly|flagKeyspace, 1, -1, 1, handleTOUCH)
+	register("TYPE", 2, flagReadOnly|flagKeyspace, 1, 1, 1, handleTYPE)
+	register("RENAME", 3, flagWrite|flagKeyAccess|flagKeyspace, 1, 2, 1, handleRENAME)
+	register("RENAMENX", 3, flagWrite|flagKeyAccess|flagKeyspace, 1, 2, 1, handleRENAMENX)
+	register("COPY", -3, flagWrite|flagDenyOOM|flagKeyAccess|flagKeyspace, 1, 2, 1, handleCOPY)
+	register("KEYS", 2, flagReadOnly|flagKeyspace|flagDangerous, 0, 0, 0, handleKEYS)
+	register("SCAN", -2, flagReadOnly|flagKeyspace, 0, 0, 0, handleSCAN)
+	register("RANDOMKEY", 1, flagReadOnly|flagKeyspace, 0, 0, 0, handleRANDOMKEY)
+	register("OBJECT", -2, flagReadOnly|flagKeyspace, 2, 2, 1, handleOBJECT)
+
+	register("SELECT", 2, flagConnection, 0, 0, 0, handleSELECT)
+	register("DBSIZE", 1, flagReadOnly|flagKeyspace, 0, 0, 0, handleDBSIZE)
+	register("MOVE", 3, flagWrite|flagKeyAccess|flagKeyspace, 1, 1, 1, handleMOVE)
+	register("SWAPDB", 3, flagWrite|flagKeyspace|flagDangerous, 0, 0, 0, handleSWAPDB)
+	register("FLUSHDB", -1, flagWrite|flagKeyspace|flagDangerous, 0, 0, 0, handleFLUSHDB)
+	register("FLUSHALL", -1, flagWrite|flagKeyspace|flagDangerous, 0, 0, 0, handleFLUSHALL)
+
+	register("AUTH", -2, flagNoAuth|flagConnection, 0, 0, 0, handleAUTH)
+	register("HELLO", -1, flagNoAuth|flagConnection, 0, 0, 0, handleHELLO)
+
+	register("ACL", -2, flagAdmin|flagDangerous, 0, 0, 0, handleACL)
+	register("PSYNC", -3, flagAdmin|flagDangerous, 0, 0, 0, handleSYNC)
+	register("SYNC", 1, flagAdmin|flagDangerous, 0, 0, 0, handleSYNC)
+	register("REPLCONF", -1, flagAdmin|flagDangerous, 0, 0, 0, handleSYNC)
+
+	register("INFO", -1, flagDangerous, 0, 0, 0, handleINFO)
+	register("CONFIG", -2, flagAdmin|flagDangerous, 0, 0, 0, handleCONFIG)
+	register("SLOWLOG", -2, flagAdmin|flagDangerous, 0, 0, 0, handleSLOWLOG)
+	register("MONITOR", 1, flagAdmin|flagDangerous, 0, 0, 0, handleSYNC)
+	register("CLIENT", -2, flagAdmin|flagDangerous|flagConnection, 0, 0, 0, handleCLIENT)
+	register("REPLICAOF", 3, flagAdmin|flagDangerous, 0, 0, 0, handleREPLICAOF)
+	register("SLAVEOF", 3, flagAdmin|flagDangerous, 0, 0, 0, handleREPLICAOF)
+	register("ROLE", 1, flagAdmin|flagDangerous, 0, 0, 0, handleROLE)
+
+	register("CLUSTER", -2, flagAdmin|flagDangerous, 0, 0, 0, handleCLUSTER)
+	register("ASKING", 1, flagConnection, 0, 0, 0, handleASKING)
+	register("DUMP", 2, flagReadOnly|flagKeyspace, 1, 1, 1, handleDUMP)
+	register("RESTORE", -4, flagWrite|flagDenyOOM|flagKeyspace|flagDangerous, 1, 1, 1, handleRESTORE)
+	register("RESTORE-ASKING", -4, flagWrite|flagAsking|flagDenyOOM|flagKeyspace|flagDangerous, 1, 1, 1, handleRESTORE)
+	register("MIGRATE", -6, flagWrite|flagKeyAccess|flagKeyspace|flagDangerous, 0, 0, 0, handleMIGRATE)
+
+	registerACLCommands()
+}
+
+func lookupCommand(name string) (*commandSpec, bool) {
+	cs, ok := commandTable[strings.ToUpper(name)]
+	return cs, ok
+}
+
+// keys returns the keys of an invocation of the command
+func (cs *commandSpec) keys(argv []string) []string {
+	if cs.firstKey == 0 {
+		return nil
+	}
+
+	last := cs.lastKey
+	if last < 0 {
+		last += len(argv)
+	}
+
+	keys := make([]string, 0)
+	for i := cs.firstKey; i <= last && i < len(argv); i += cs.keyStep {
+		keys = append(keys, argv[i])
+	}
+	return keys
+}
+
+func (cs *commandSpec) checkArity(argc int) bool {
+	if cs.arity >= 0 {
+		return argc == cs.arity
+	}
+	return argc >= -cs.arity
+}
@@ -0,0 +1,183 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DNahar74/PulseDB/internal/resp"
+	"github.com/DNahar74/PulseDB/internal/store"
+)
+
+// ReplicationHandler is implemented by the server's replication layer
+type ReplicationHandler interface {
+	// Feed sends a serialized command to the replicas & the replication backlog
+	Feed(cmd string)
+	// ReplicaOf makes the server a replica of the given primary
+	ReplicaOf(host, port string) error
+	// NoReplicaOf turns a replica into a primary
+	NoReplicaOf() error
+	// IsReplica is true while the server follows a primary
+	IsReplica() bool
+	// Role returns the reply of the ROLE command
+	Role() resp.Type
+	// Info returns the fields of the replication section of INFO
+	Info() []string
+}
+
+var replicationHandle handle[ReplicationHandler]
+
+func replication() ReplicationHandler {
+	return replicationHandle.get()
+}
+
+// InitReplication passes the server's replication layer for access in this package
+func InitReplication(r ReplicationHandler) {
+	replicationHandle.set(r)
+}
+
+func handleREPLICAOF(c *call) (resp.Type, error) {
+	if replication() == nil {
+		return nil, errors.New("replication is not available")
+	}
+
+	host, port := c.args[0], c.args[1]
+
+	if strings.EqualFold(host, "NO") && strings.EqualFold(port, "ONE") {
+		err := replication().NoReplicaOf()
+		if err != nil {
+			return nil, err
+		}
+		// The replicas of this node last saw the SELECT of the old primary
+		resetReplicationDB()
+		return resp.SimpleString{Value: "OK"}, nil
+	}
+
+	p, err := strconv.Atoi(port)
+	if err != nil || p <= 0 || p > 65535 {
+		return nil, errors.New("Invalid master port")
+	}
+
+	err = replication().ReplicaOf(host, port)
+	if err != nil {
+		return nil, err
+	}
+	return resp.SimpleString{Value: "OK"}, nil
+}
+
+func handleROLE(c *call) (resp.Type, error) {
+	if replication() == nil {
+		return resp.Array{Length: 3, Items: []resp.Type{
+			resp.BulkString{Value: "master", Length: 6},
+			resp.Integer{Value: 0},
+			resp.Array{Length: 0, Items: []resp.Type{}},
+		}}, nil
+	}
+
+	return replication().Role(), nil
+}
+
+// Dump returns the serialized commands that rebuild the whole dataset, used for a full resync
+// fn is called while writes are blocked, so that the dump matches a single point of the replication stream
+func Dump(fn func()) (string, error) {
+	execLock.Lock()
+	defer execLock.Unlock()
+
+	var sb strings.Builder
+
+	for i := range databases().Len() {
+		err := dumpDB(&sb, i)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// The stream that follows the dump must select its database again
+	resetReplicationDB()
+	fn()
+
+	return sb.String(), nil
+}
+
+// dumpDB writes the commands that rebuild a database, preceded by a SELECT when it has keys
+func dumpDB(sb *strings.Builder, index int) error {
+	db := databases().DB(index)
+
+	db.Lock.RLock()
+	defer db.Lock.RUnlock()
+
+	selected := false
+	for key, data := range db.Items {
+		if !data.Expiry.IsZero() && data.Expiry.Before(time.Now()) {
+			continue
+		}
+
+		// Strings are sent as SET, the other types as the RESTORE of their DUMP payload
+		var argv []string
+		if str, ok := store.AsString(data.Value); ok {
+			argv = setCommand(key, str.String(), data.Expiry)
+		} else {
+			payload, err := store.Dump(data.Value)
+			if err != nil {
+				return fmt.Errorf("cannot dump value of type %T: %w", data.Value, err)
+			}
+			argv = restoreCommand(key, payload, data.Expiry)
+		}
+
+		if !selected {
+			str, err := serializeCommand([]string{"SELECT", strconv.Itoa(index)})
+			if err != nil {
+				return err
+			}
+			sb.WriteString(str)
+			selected = true
+		}
+
+		str, err := serializeCommand(argv)
+		if err != nil {
+			return err
+		}
+		sb.WriteString(str)
+	}
+
+	return nil
+}
+
+// LoadDump replaces the dataset with the one produced by Dump on the primary
+// The new dataset is logged to the AOF, but not sent to the replicas
+func LoadDump(payload string) error {
+	execLock.Lock()
+	defer execLock.Unlock()
+
+	databases().FlushAll()
+	propagate(0, []string{"FLUSHALL"}, false)
+
+	sess := NewSession()
+	reader := resp.NewReader(strings.NewReader(payload))
+	for {
+		v, _, err := reader.ReadValue()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		str, ok := v.(resp.Array)
+		if !ok {
+			return errors.New("invalid datatype")
+		}
+
+		cmd, argv, err := parseCommand(str)
+		if err != nil {
+			return err
+		}
+
+		_, err = execute(sess, cmd, argv, originMaster)
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DNahar74/PulseDB/internal/resp"
+)
+
+// The arguments of a command are cut in its slow log entry, like in Redis
+const (
+	slowlogMaxArgc   = 32
+	slowlogMaxArgLen = 128
+)
+
+// slowlogEntry is a command that ran slower than slowlog-log-slower-than
+type slowlogEntry struct {
+	id       int64
+	time     time.Time
+	duration time.Duration
+	args     []string
+	addr     string
+	name     string
+}
+
+// slowlog keeps the last slow commands in a ring, the oldest entry is at start once the ring is full
+var slowlog = struct {
+	mu         sync.Mutex
+	entries    []slowlogEntry
+	start      int
+	lastID     int64
+	slowerThan time.Duration
+	maxLen     int
+}{slowerThan: 10 * time.Millisecond, maxLen: 128}
+
+// SetSlowlog changes the threshold in microseconds of the slow log, a negative one disables it & 0 logs every
+// command, & the number of entries it keeps
+func SetSlowlog(slowerThan, maxLen int) {
+	slowlog.mu.Lock()
+	defer slowlog.mu.Unlock()
+
+	slowlog.slowerThan = time.Duration(slowerThan) * time.Microsecond
+	if maxLen != slowlog.maxLen {
+		// The entries are put back in order, the newest ones that fit are kept
+		entries := slowlogNewest(len(slowlog.entries))
+		kept := min(len(entries), maxLen)
+		slowlog.entries = make([]slowlogEntry, kept)
+		for i := range kept {
+			slowlog.entries[i] = entries[kept-1-i]
+		}
+		slowlog.start = 0
+		slowlog.maxLen = maxLen
+	}
+}
+
+// logSlow adds a command to the slow log when it took longer than the threshold
+func logSlow(sess *Session, argv []string, duration time.Duration) {
+	slowlog.mu.Lock()
+	defer slowlog.mu.Unlock()
+
+	if slowlog.slowerThan < 0 || duration < slowlog.slowerThan || slowlog.maxLen == 0 {
+		return
+	}
+
+	slowlog.lastID++
+	e := slowlogEntry{
+		id:       slowlog.lastID,
+		time:     time.Now(),
+		duration: duration,
+		args:     slowlogArgs(argv),
+		addr:     sess.addr,
+		name:     sess.name,
+	}
+	if len(slowlog.entries) < slowlog.maxLen {
+		slowlog.entries = append(slowlog.entries, e)
+		return
+	}
+	slowlog.entries[slowlog.start] = e
+	slowlog.start = (slowlog.start + 1) % len(slowlog.entries)
+}
+
+// slowlogArgs cuts the arguments of a command for its entry
+func slowlogArgs(argv []string) []string {
+	argv = RedactArgs(argv)
+	args := make([]string, 0, min(len(argv), slowlogMaxArgc))
+	for i, a := range argv {
+		if i == slowlogMaxArgc-1 && len(argv) > slowlogMaxArgc {
+			args = append(args, fmt.Sprintf("... (%d more arguments)", len(argv)-i))
+			break
+		}
+		if len(a) > slowlogMaxArgLen {
+			a = fmt.Sprintf("%s... (%d more bytes)", a[:slowlogMaxArgLen], len(a)-slowlogMaxArgLen)
+		}
+		args = append(args, a)
+	}
+	return args
+}
+
+// slowlogNewest returns up to count entries, the most recent first, the caller must hold the lock
+func slowlogNewest(count int) []slowlogEntry {
+	n := len(slowlog.entries)
+	entries := make([]slowlogEntry, 0, min(count, n))
+	for i := 0; i < min(count, n); i++ {
+		entries = append(entries, slowlog.entries[(slowlog.start+n-1-i)%n])
+	}
+	return entries
+}
+
+// handleSLOWLOG handles SLOWLOG GET [count], SLOWLOG LEN & SLOWLOG RESET
+func handleSLOWLOG(c *call) (resp.Type, error) {
+	sub, args := strings.ToUpper(c.args[0]), c.args[1:]
+
+	slowlog.mu.Lock()
+	defer slowlog.mu.Unlock()
+
+	switch {
+	case sub == "GET" && len(args) <= 1:
+		count := 10
+		if len(args) == 1 {
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n < -1 {
+				return nil, errors.New("count should be greater than or equal to -1")
+			}
+			count = n
+			if n == -1 {
+				count = len(slowlog.entries)
+			}
+		}
+
+		entries := slowlogNewest(count)
+		items := make([]resp.Type, len(entries))
+		for i, e := range entries {
+			fields := []resp.Type{
+				resp.Integer{Value: int(e.id)},
+				resp.Integer{Value: int(e.time.Unix())},
+				resp.Integer{Value: int(e.duration.Microseconds())},
+				bulkStrings(e.args),
+				bulkString(e.addr),
+				bulkString(e.name),
+			}
+			items[i] = resp.Array{Length: len(fields), Items: fields}
+		}
+		return resp.Array{Length: len(items), Items: items}, nil
+	case sub == "LEN" && len(args) == 0:
+		return resp.Integer{Value: len(slowlog.entries)}, nil
+	case sub == "RESET" && len(args) == 0:
+		slowlog.entries = nil
+		slowlog.start = 0
+		return resp.SimpleString{Value: "OK"}, nil
+	case sub == "GET" || sub == "LEN" || sub == "RESET":
+		return nil, fmt.Errorf("wrong number of arguments for 'slowlog|%s' command", strings.ToLower(sub))
+	default:
+		return nil, fmt.Errorf("unknown subcommand '%s'. Try SLOWLOG HELP.", c.args[0])
+	}
+}
@@ -0,0 +1,90 @@
+package command
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/DNahar74/PulseDB/internal/resp"
+	"github.com/DNahar74/PulseDB/internal/store"
+)
+
+// slowlogArgv returns the arguments of the entries of SLOWLOG GET, joined by spaces
+func slowlogArgv(t *testing.T, sess *Session, args ...string) []string {
+	t.Helper()
+
+	reply := run(t, sess, append([]string{"SLOWLOG", "GET"}, args...)...).(resp.Array)
+	commands := make([]string, len(reply.Items))
+	for i, item := range reply.Items {
+		commands[i] = entryArgs(item.(resp.Array))
+	}
+	return commands
+}
+
+// entryArgs returns the arguments of a slow log entry, joined by spaces
+func entryArgs(entry resp.Array) string {
+	args := make([]string, 0)
+	for _, a := range entry.Items[3].(resp.Array).Items {
+		args = append(args, a.(resp.BulkString).Value)
+	}
+	return strings.Join(args, " ")
+}
+
+func TestSlowlog(t *testing.T) {
+	InitDatabases(store.CreateDatabases(1))
+	t.Cleanup(func() { SetSlowlog(10000, 128) })
+
+	sess := NewSession()
+	sess.SetAddr("127.0.0.1:5000")
+	SetSlowlog(0, 3)
+	run(t, sess, "SLOWLOG", "RESET")
+	run(t, sess, "HELLO", "2", "SETNAME", "worker")
+	run(t, sess, "SET", "a", "1")
+	_, _ = HandleCommands(sess, newCommand("AUTH", "secret"))
+
+	entry := run(t, sess, "SLOWLOG", "GET", "1").(resp.Array).Items[0].(resp.Array)
+	if entry.Length != 6 || entry.Items[4] != bulkString("127.0.0.1:5000") || entry.Items[5] != bulkString("worker") {
+		t.Errorf("entry = %v", entry)
+	}
+	if got := entryArgs(entry); got != "AUTH (redacted)" {
+		t.Errorf("the password of AUTH was logged: %v", got)
+	}
+
+	// The ring keeps the newest entries, the most recent first
+	if got := slowlogArgv(t, sess); len(got) != 3 || got[0] != "SLOWLOG GET 1" || got[1] != "AUTH (redacted)" || got[2] != "SET a 1" {
+		t.Errorf("SLOWLOG GET = %q", got)
+	}
+	if reply := run(t, sess, "SLOWLOG", "LEN"); reply != (resp.Integer{Value: 3}) {
+		t.Errorf("SLOWLOG LEN = %v", reply)
+	}
+
+	long := make([]string, 40)
+	for i := range long {
+		long[i] = "k"
+	}
+	long[1] = strings.Repeat("x", 130)
+	run(t, sess, append([]string{"DEL"}, long...)...)
+	// A disabled slow log logs nothing, & keeps its newest entries when it shrinks
+	SetSlowlog(-1, 1)
+	run(t, sess, "GET", "a")
+	entry = run(t, sess, "SLOWLOG", "GET", "-1").(resp.Array).Items[0].(resp.Array)
+	args := entry.Items[3].(resp.Array).Items
+	if len(args) != 32 || args[31] != bulkString("... (10 more arguments)") || args[2] != bulkString(strings.Repeat("x", 128)+"... (2 more bytes)") {
+		t.Errorf("cut arguments = %v", args)
+	}
+
+	run(t, sess, "SLOWLOG", "RESET")
+	if reply := run(t, sess, "SLOWLOG", "LEN"); reply != (resp.Integer{Value: 0}) {
+		t.Errorf("SLOWLOG LEN after RESET = %v", reply)
+	}
+	if _, err := HandleCommands(sess, newCommand("HELLO", "2", "SETNAME", "two words")); err == nil {
+		t.Error("HELLO SETNAME accepted a name with a space")
+	}
+
+	// The time a command waits for a pause is not counted
+	SetSlowlog(20000, 3)
+	run(t, sess, "CLIENT", "PAUSE", "50")
+	run(t, sess, "GET", "a")
+	if reply := run(t, sess, "SLOWLOG", "LEN"); reply != (resp.Integer{Value: 0}) {
+		t.Errorf("SLOWLOG LEN after a paused GET = %v", reply)
+	}
+}
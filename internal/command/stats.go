@@ -0,0 +1,150 @@
+package command
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/DNahar74/PulseDB/internal/metrics"
+	"github.com/DNahar74/PulseDB/internal/resp"
+)
+
+// commandStats are the statistics of a command given by INFO commandstats
+type commandStats struct {
+	calls atomic.Int64
+	usec  atomic.Int64
+	// rejected counts the calls refused before running, failed the ones whose handler returned an error
+	rejected atomic.Int64
+	failed   atomic.Int64
+	latency  metrics.Latency
+}
+
+// commandsProcessed counts the commands run since the start or the last CONFIG RESETSTAT
+var commandsProcessed atomic.Int64
+
+// record counts a run of the command
+func (s *commandStats) record(d time.Duration, err error) {
+	commandsProcessed.Add(1)
+	s.calls.Add(1)
+	s.usec.Add(d.Microseconds())
+	s.latency.Observe(d)
+	if err != nil {
+		s.failed.Add(1)
+	}
+}
+
+func (s *commandStats) reset() {
+	s.calls.Store(0)
+	s.usec.Store(0)
+	s.rejected.Store(0)
+	s.failed.Store(0)
+	s.latency.Reset()
+}
+
+// reject counts a command refused before running & returns its error
+func reject(cmd *commandSpec, err error) (resp.Type, error) {
+	cmd.stats.rejected.Add(1)
+	return nil, err
+}
+
+// opsSamples is the number of samples instantaneous_ops_per_sec averages
+const opsSamples = 16
+
+// opsTracker keeps the rate of the commands processed between the last samples
+var opsTracker struct {
+	mu        sync.Mutex
+	lastTime  time.Time
+	lastCount int64
+	samples   [opsSamples]float64
+	next      int
+}
+
+// peakMemory is the highest used memory seen by SampleStats & INFO
+var peakMemory atomic.Int64
+
+// SampleStats samples the number of commands processed & the used memory, the server calls it every 100 milliseconds
+func SampleStats() {
+	now := time.Now()
+	count := commandsProcessed.Load()
+
+	opsTracker.mu.Lock()
+	if !opsTracker.lastTime.IsZero() {
+		elapsed := now.Sub(opsTracker.lastTime).Seconds()
+		if elapsed > 0 {
+			opsTracker.samples[opsTracker.next] = float64(count-opsTracker.lastCount) / elapsed
+			opsTracker.next = (opsTracker.next + 1) % opsSamples
+		}
+	}
+	opsTracker.lastTime, opsTracker.lastCount = now, count
+	opsTracker.mu.Unlock()
+
+	if databases() != nil {
+		trackPeakMemory(databases().UsedMemory())
+	}
+}
+
+// instantaneousOps returns the average number of commands per second over the last samples
+func instantaneousOps() int64 {
+	opsTracker.mu.Lock()
+	defer opsTracker.mu.Unlock()
+
+	var sum float64
+	for _, s := range opsTracker.samples {
+		sum += s
+	}
+	return int64(sum / opsSamples)
+}
+
+// trackPeakMemory raises the peak memory to used when it is higher & returns the peak
+func trackPeakMemory(used int64) int64 {
+	for {
+		peak := peakMemory.Load()
+		if used <= peak {
+			return peak
+		}
+		if peakMemory.CompareAndSwap(peak, used) {
+			return used
+		}
+	}
+}
+
+// commandStatsInfo returns a cmdstat_<name> field for every command that was called or rejected
+func commandStatsInfo() []string {
+	fields := make([]string, 0)
+	for _, cmd := range commandTable {
+		calls, usec := cmd.stats.calls.Load(), cmd.stats.usec.Load()
+		rejected, failed := cmd.stats.rejected.Load(), cmd.stats.failed.Load()
+		if calls == 0 && rejected == 0 {
+			continue
+		}
+
+		perCall := 0.0
+		if calls > 0 {
+			perCall = float64(usec) / float64(calls)
+		}
+		fields = append(fields, fmt.Sprintf("cmdstat_%s:calls=%d,usec=%d,usec_per_call=%.2f,rejected_calls=%d,failed_calls=%d",
+			cmd.name, calls, usec, perCall, rejected, failed))
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// resetStats clears the statistics given by INFO
+func resetStats() {
+	databases().ResetStats()
+	if serverInfo() != nil {
+		serverInfo().ResetStats()
+	}
+
+	commandsProcessed.Store(0)
+	for _, cmd := range commandTable {
+		cmd.stats.reset()
+	}
+	opsTracker.mu.Lock()
+	opsTracker.samples = [opsSamples]float64{}
+	opsTracker.lastTime, opsTracker.lastCount = time.Time{}, 0
+	opsTracker.mu.Unlock()
+	peakMemory.Store(databases().UsedMemory())
+}
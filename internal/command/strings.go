@@ -0,0 +1,454 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DNahar74/PulseDB/internal/resp"
+	"github.com/DNahar74/PulseDB/internal/store"
+)
+
+// maxStringLength is the size limit of a string value, like proto-max-bulk-len
+const maxStringLength = 512 * 1024 * 1024
+
+// stringValue returns the bytes of a string value
+func stringValue(v resp.Type) (string, error) {
+	str, ok := store.AsString(v)
+	if !ok {
+		return "", store.ErrWrongType
+	}
+	return str.String(), nil
+}
+
+// lookupString returns the string value of a key & false if it does not exist
+// A replayed command sees the keys that have expired since, like lookupHash
+func lookupString(c *call, key string) (string, store.Data, bool, error) {
+	data, ok := c.lookupAt(key, c.now())
+	if !ok {
+		return "", store.Data{}, false, nil
+	}
+	value, err := stringValue(data.Value)
+	if err != nil {
+		return "", store.Data{}, false, err
+	}
+	return value, data, true, nil
+}
+
+// parseExpire reads the relative expire time of SETEX & PSETEX
+func parseExpire(c *call, s string, unit time.Duration) (time.Time, error) {
+	val, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, errors.New("value is not an integer or out of range")
+	}
+	if val <= 0 {
+		return time.Time{}, fmt.Errorf("invalid expire time in '%s' command", c.cmd.name)
+	}
+	return time.Now().Add(time.Duration(val) * unit), nil
+}
+
+func handleMGET(c *call) (resp.Type, error) {
+	items := make([]resp.Type, len(c.args))
+	for i, key := range c.args {
+		// MGET never fails, a missing key or a value of another type is a null
+		value, _, ok, err := lookupString(c, key)
+		if !ok || err != nil {
+			items[i] = resp.Null{}
+			continue
+		}
+		items[i] = bulkString(value)
+	}
+	return resp.Array{Length: len(items), Items: items}, nil
+}
+
+func handleMSET(c *call) (resp.Type, error) {
+	_, err := mset(c, false)
+	if err != nil {
+		return nil, err
+	}
+	return resp.SimpleString{Value: "OK"}, nil
+}
+
+func handleMSETNX(c *call) (resp.Type, error) {
+	set, err := mset(c, true)
+	if err != nil {
+		return nil, err
+	}
+	if !set {
+		return resp.Integer{Value: 0}, nil
+	}
+	return resp.Integer{Value: 1}, nil
+}
+
+// mset sets every key value pair of the arguments, or none of them if nx is set & one of the keys exists
+// The execLock keeps other clients from seeing only some of the keys set
+func mset(c *call, nx bool) (bool, error) {
+	if len(c.args)%2 != 0 {
+		return false, fmt.Errorf("wrong number of arguments for '%s' command", c.cmd.name)
+	}
+	for i := 0; i < len(c.args); i += 2 {
+		if _, ok := c.lookup(c.args[i]); ok && nx {
+			c.dontPropagate()
+			return false, nil
+		}
+	}
+
+	for i := 0; i < len(c.args); i += 2 {
+		c.db.SET(c.args[i], store.Data{Value: store.NewString(c.args[i+1])})
+	}
+	if nx {
+		c.propagate(append([]string{"MSET"}, c.args...)...)
+	}
+	return true, nil
+}
+
+func handleSETNX(c *call) (resp.Type, error) {
+	key, value := c.args[0], c.args[1]
+
+	if _, ok := c.lookup(key); ok {
+		c.dontPropagate()
+		return resp.Integer{Value: 0}, nil
+	}
+
+	c.db.SET(key, store.Data{Value: store.NewString(value)})
+	c.propagate("SET", key, value)
+
+	return resp.Integer{Value: 1}, nil
+}
+
+func handleSETEX(c *call) (resp.Type, error) {
+	return setWithExpire(c, time.Second)
+}
+
+func handlePSETEX(c *call) (resp.Type, error) {
+	return setWithExpire(c, time.Millisecond)
+}
+
+// setWithExpire implements SETEX & PSETEX: key, expire time in the unit, value
+func setWithExpire(c *call, unit time.Duration) (resp.Type, error) {
+	key, value := c.args[0], c.args[2]
+
+	expiry, err := parseExpire(c, c.args[1], unit)
+	if err != nil {
+		return nil, err
+	}
+
+	c.db.SET(key, store.Data{Value: store.NewString(value), Expiry: expiry})
+	c.propagate(setCommand(key, value, expiry)...)
+
+	return resp.SimpleString{Value: "OK"}, nil
+}
+
+func handleAPPEND(c *call) (resp.Type, error) {
+	key := c.args[0]
+
+	value, data, ok, err := lookupString(c, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(value)+len(c.args[1]) > maxStringLength {
+		return nil, errors.New("string exceeds maximum allowed size (proto-max-bulk-len)")
+	}
+	value += c.args[1]
+
+	// The key keeps its TTL
+	c.propagateUpdate(key, ok)
+	c.db.SET(key, store.Data{Value: store.NewRawString(value), Expiry: data.Expiry})
+
+	return resp.Integer{Value: len(value)}, nil
+}
+
+func handleSTRLEN(c *call) (resp.Type, error) {
+	value, _, _, err := lookupString(c, c.args[0])
+	if err != nil {
+		return nil, err
+	}
+	return resp.Integer{Value: len(value)}, nil
+}
+
+func handleGETRANGE(c *call) (resp.Type, error) {
+	start, err1 := strconv.Atoi(c.args[1])
+	end, err2 := strconv.Atoi(c.args[2])
+	if err1 != nil || err2 != nil {
+		return nil, errors.New("value is not an integer or out of range")
+	}
+
+	value, _, _, err := lookupString(c, c.args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	// Negative offsets count from the end, like in Redis
+	if start < 0 && end < 0 && start > end {
+		return bulkString(""), nil
+	}
+	if start < 0 {
+		start = max(len(value)+start, 0)
+	}
+	if end < 0 {
+		end = max(len(value)+end, 0)
+	}
+	end = min(end, len(value)-1)
+	if start > end || len(value) == 0 {
+		return bulkString(""), nil
+	}
+
+	return bulkString(value[start : end+1]), nil
+}
+
+func handleSETRANGE(c *call) (resp.Type, error) {
+	key, patch := c.args[0], c.args[2]
+
+	offset, err := strconv.Atoi(c.args[1])
+	if err != nil {
+		return nil, errors.New("value is not an integer or out of range")
+	}
+	if offset < 0 {
+		return nil, errors.New("offset is out of range")
+	}
+
+	value, data, ok, err := lookupString(c, key)
+	if err != nil {
+		return nil, err
+	}
+
+	// An empty patch does not change the value, nor create the key
+	if len(patch) == 0 {
+		c.dontPropagate()
+		return resp.Integer{Value: len(value)}, nil
+	}
+	if offset+len(patch) > maxStringLength {
+		return nil, errors.New("string exceeds maximum allowed size (proto-max-bulk-len)")
+	}
+
+	// The value is padded with zero bytes up to the offset
+	b := []byte(value)
+	if len(b) < offset+len(patch) {
+		b = append(b, make([]byte, offset+len(patch)-len(b))...)
+	}
+	copy(b[offset:], patch)
+	value = string(b)
+
+	c.propagateUpdate(key, ok)
+	c.db.SET(key, store.Data{Value: store.NewRawString(value), Expiry: data.Expiry})
+
+	return resp.Integer{Value: len(value)}, nil
+}
+
+func handleGETSET(c *call) (resp.Type, error) {
+	key, value := c.args[0], c.args[1]
+
+	old, _, ok, err := lookupString(c, key)
+	if err != nil {
+		return nil, err
+	}
+
+	// Like SET, GETSET removes the TTL
+	c.db.SET(key, store.Data{Value: store.NewString(value)})
+	c.propagate("SET", key, value)
+
+	if !ok {
+		return resp.Null{}, nil
+	}
+	return bulkString(old), nil
+}
+
+func handleGETDEL(c *call) (resp.Type, error) {
+	key := c.args[0]
+
+	value, _, ok, err := lookupString(c, key)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		c.dontPropagate()
+		return resp.Null{}, nil
+	}
+
+	_ = c.db.DEL(key)
+	c.propagate("DEL", key)
+
+	return bulkString(value), nil
+}
+
+// handleGETEX returns a value & changes its TTL: GETEX key [EX seconds | PX milliseconds | EXAT timestamp | PXAT timestamp | PERSIST]
+func handleGETEX(c *call) (resp.Type, error) {
+	key := c.args[0]
+
+	value, data, ok, err := lookupString(c, key)
+	if err != nil {
+		return nil, err
+	}
+
+	var expiry time.Time
+	change := false
+	switch opts := c.args[1:]; {
+	case len(opts) == 0:
+	case len(opts) == 1 && strings.EqualFold(opts[0], "PERSIST"):
+		change = true
+	case len(opts) == 2:
+		val, err := strconv.ParseInt(opts[1], 10, 64)
+		if err != nil {
+			return nil, errors.New("value is not an integer or out of range")
+		}
+		if val <= 0 {
+			return nil, fmt.Errorf("invalid expire time in '%s' command", c.cmd.name)
+		}
+
+		switch strings.ToUpper(opts[0]) {
+		case "EX":
+			expiry = time.Now().Add(time.Duration(val) * time.Second)
+		case "PX":
+			expiry = time.Now().Add(time.Duration(val) * time.Millisecond)
+		case "EXAT":
+			expiry = time.Unix(val, 0)
+		case "PXAT":
+			expiry = time.UnixMilli(val)
+		default:
+			return nil, errors.New("syntax error")
+		}
+		change = true
+	default:
+		return nil, errors.New("syntax error")
+	}
+
+	if !ok {
+		c.dontPropagate()
+		return resp.Null{}, nil
+	}
+	if !change {
+		c.dontPropagate()
+		return bulkString(value), nil
+	}
+
+	data.Expiry = expiry
+	c.db.SET(key, data)
+	c.propagate(setCommand(key, value, expiry)...)
+
+	return bulkString(value), nil
+}
+
+// handleLCS finds the longest common subsequence of two strings: LCS key1 key2 [LEN] [IDX] [MINMATCHLEN len] [WITHMATCHLEN]
+func handleLCS(c *call) (resp.Type, error) {
+	getLen, getIdx, withMatchLen, minMatchLen := false, false, false, 0
+	for i := 2; i < len(c.args); i++ {
+		switch strings.ToUpper(c.args[i]) {
+		case "LEN":
+			getLen = true
+		case "IDX":
+			getIdx = true
+		case "WITHMATCHLEN":
+			withMatchLen = true
+		case "MINMATCHLEN":
+			if i+1 >= len(c.args) {
+				return nil, errors.New("syntax error")
+			}
+			n, err := strconv.Atoi(c.args[i+1])
+			if err != nil {
+				return nil, errors.New("value is not an integer or out of range")
+			}
+			minMatchLen = max(n, 0)
+			i++
+		default:
+			return nil, errors.New("syntax error")
+		}
+	}
+	if getLen && getIdx {
+		return nil, errors.New("If you want both the length and indexes, please just use IDX.")
+	}
+
+	a, _, _, err := lookupString(c, c.args[0])
+	if err != nil {
+		return nil, err
+	}
+	b, _, _, err := lookupString(c, c.args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	// The table is checked against the limit of a value before it is allocated, like in Redis
+	cells := uint64(len(a)+1) * uint64(len(b)+1)
+	if cells >= math.MaxUint32 || cells*4 > maxStringLength {
+		return nil, errors.New("Insufficient memory, transient memory for LCS exceeds proto-max-bulk-len")
+	}
+
+	// table[i][j] is the length of the LCS of a[:i] & b[:j]
+	width := len(b) + 1
+	table := make([]uint32, (len(a)+1)*width)
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			if a[i-1] == b[j-1] {
+				table[i*width+j] = table[(i-1)*width+j-1] + 1
+			} else {
+				table[i*width+j] = max(table[(i-1)*width+j], table[i*width+j-1])
+			}
+		}
+	}
+	length := int(table[len(a)*width+len(b)])
+
+	if getLen {
+		return resp.Integer{Value: length}, nil
+	}
+
+	// Walk the table back from the end, collecting the LCS & the ranges of contiguous matches
+	lcs := make([]byte, length)
+	matches := make([]resp.Type, 0)
+	idx := length
+	i, j := len(a), len(b)
+	aStart, aEnd, bStart, bEnd := -1, -1, -1, -1
+	emit := func() {
+		if aStart < 0 {
+			return
+		}
+		if matchLen := aEnd - aStart + 1; matchLen >= minMatchLen {
+			match := []resp.Type{lcsRange(aStart, aEnd), lcsRange(bStart, bEnd)}
+			if withMatchLen {
+				match = append(match, resp.Integer{Value: matchLen})
+			}
+			matches = append(matches, resp.Array{Length: len(match), Items: match})
+		}
+		aStart = -1
+	}
+	for i > 0 && j > 0 {
+		if a[i-1] == b[j-1] {
+			lcs[idx-1] = a[i-1]
+			idx--
+			if aStart >= 0 && (aStart != i || bStart != j) {
+				emit()
+			}
+			if aStart < 0 {
+				aStart, aEnd, bStart, bEnd = i-1, i-1, j-1, j-1
+			} else {
+				aStart, bStart = i-1, j-1
+			}
+			i--
+			j--
+			continue
+		}
+
+		emit()
+		if table[(i-1)*width+j] > table[i*width+j-1] {
+			i--
+		} else {
+			j--
+		}
+	}
+	emit()
+
+	if !getIdx {
+		return bulkString(string(lcs)), nil
+	}
+	return resp.Array{Length: 4, Items: []resp.Type{
+		bulkString("matches"),
+		resp.Array{Length: len(matches), Items: matches},
+		bulkString("len"),
+		resp.Integer{Value: length},
+	}}, nil
+}
+
+func lcsRange(start, end int) resp.Array {
+	return resp.Array{Length: 2, Items: []resp.Type{resp.Integer{Value: start}, resp.Integer{Value: end}}}
+}
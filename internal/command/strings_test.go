@@ -0,0 +1,264 @@
+package command
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DNahar74/PulseDB/internal/resp"
+	"github.com/DNahar74/PulseDB/internal/store"
+)
+
+func TestMultiKeyStrings(t *testing.T) {
+	d := store.CreateDatabases(1)
+	InitDatabases(d)
+	sess := NewSession()
+
+	run(t, sess, "MSET", "a", "1", "b", "two")
+	reply := run(t, sess, "MGET", "a", "b", "missing").(resp.Array)
+	want := []resp.Type{bulkString("1"), bulkString("two"), resp.Null{}}
+	for i := range want {
+		if reply.Items[i] != want[i] {
+			t.Errorf("MGET item %d = %v, want %v", i, reply.Items[i], want[i])
+		}
+	}
+
+	if reply := run(t, sess, "MSETNX", "c", "3", "a", "x"); reply != (resp.Integer{Value: 0}) {
+		t.Errorf("MSETNX with an existing key = %v, want 0", reply)
+	}
+	if _, ok := d.DB(0).Lookup("c"); ok {
+		t.Error("MSETNX set some of the keys")
+	}
+	if reply := run(t, sess, "MSETNX", "c", "3", "d", "4"); reply != (resp.Integer{Value: 1}) {
+		t.Errorf("MSETNX = %v, want 1", reply)
+	}
+	if _, err := HandleCommands(sess, newCommand("MSET", "a", "1", "b")); err == nil {
+		t.Error("MSET with an odd number of arguments succeeded")
+	}
+
+	if reply := run(t, sess, "SETNX", "a", "x"); reply != (resp.Integer{Value: 0}) {
+		t.Errorf("SETNX of an existing key = %v, want 0", reply)
+	}
+}
+
+func TestStringEditing(t *testing.T) {
+	d := store.CreateDatabases(1)
+	InitDatabases(d)
+	sess := NewSession()
+
+	// The value is stored as an integer, but edited as a string
+	run(t, sess, "SET", "n", "12")
+	if reply := run(t, sess, "APPEND", "n", "34"); reply != (resp.Integer{Value: 4}) {
+		t.Errorf("APPEND = %v, want 4", reply)
+	}
+	if reply := run(t, sess, "SETRANGE", "n", "6", "x"); reply != (resp.Integer{Value: 7}) {
+		t.Errorf("SETRANGE = %v, want 7", reply)
+	}
+	if reply := run(t, sess, "GET", "n"); reply != bulkString("1234\x00\x00x") {
+		t.Errorf("GET after SETRANGE = %q", reply)
+	}
+	if reply := run(t, sess, "STRLEN", "n"); reply != (resp.Integer{Value: 7}) {
+		t.Errorf("STRLEN = %v, want 7", reply)
+	}
+
+	run(t, sess, "SET", "s", "Hello World")
+	ranges := map[[2]string]string{
+		{"0", "4"}:    "Hello",
+		{"-5", "-1"}:  "World",
+		{"6", "100"}:  "World",
+		{"5", "2"}:    "",
+		{"-1", "-5"}:  "",
+		{"-100", "0"}: "H",
+	}
+	for r, want := range ranges {
+		if reply := run(t, sess, "GETRANGE", "s", r[0], r[1]); reply != bulkString(want) {
+			t.Errorf("GETRANGE %s %s = %v, want %q", r[0], r[1], reply, want)
+		}
+	}
+
+	// Numbers that are not in their canonical form keep their bytes
+	run(t, sess, "SET", "z", "007")
+	if reply := run(t, sess, "GET", "z"); reply != bulkString("007") {
+		t.Errorf("GET z = %v, want 007", reply)
+	}
+}
+
+func TestStringEditingPropagation(t *testing.T) {
+	d := store.CreateDatabases(1)
+	InitDatabases(d)
+	sess := NewSession()
+
+	// The edits are logged as received, a key that was only there expired is deleted first
+	run(t, sess, "SET", "k", "a", "PX", "100000")
+	run(t, sess, "APPEND", "k", "b")
+	run(t, sess, "SETRANGE", "k", "3", "c")
+	run(t, sess, "SET", "gone", "old", "PX", "1")
+	time.Sleep(5 * time.Millisecond)
+	run(t, sess, "APPEND", "gone", "new")
+	aof := drainAOF(d)
+
+	// The log starts with SELECT
+	if len(aof) != 7 {
+		t.Fatalf("propagated %q", aof)
+	}
+	for i, w := range map[int]string{2: "APPEND k b", 3: "SETRANGE k 3 c", 5: "DEL gone", 6: "APPEND gone new"} {
+		if want, _ := newCommand(strings.Fields(w)...).Serialize(); aof[i] != want {
+			t.Errorf("propagated %q, want %s", aof[i], w)
+		}
+	}
+
+	// Replaying the log, when nothing has expired, gives the same values
+	replayed := store.CreateDatabases(1)
+	InitDatabases(replayed)
+	replay := NewSession()
+	for _, cmd := range aof {
+		v, _, err := resp.NewReader(strings.NewReader(cmd)).ReadValue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ReplayCommands(replay, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for key, want := range map[string]string{"k": "ab\x00c", "gone": "new"} {
+		if data, ok := replayed.DB(0).LookupAt(key, time.Time{}); !ok || data.Value.(store.String).String() != want {
+			t.Errorf("replayed %s = %v, want %q", key, data.Value, want)
+		}
+	}
+	if data, _ := replayed.DB(0).LookupAt("k", time.Time{}); data.Expiry.IsZero() {
+		t.Error("the replayed edits lost the TTL")
+	}
+}
+
+func TestGetVariants(t *testing.T) {
+	d := store.CreateDatabases(1)
+	InitDatabases(d)
+	sess := NewSession()
+
+	run(t, sess, "SETEX", "k", "100", "v")
+	if reply := run(t, sess, "GETSET", "k", "w"); reply != bulkString("v") {
+		t.Errorf("GETSET = %v, want v", reply)
+	}
+	if data, _ := d.DB(0).Lookup("k"); !data.Expiry.IsZero() {
+		t.Error("GETSET kept the TTL")
+	}
+
+	run(t, sess, "GETEX", "k", "PX", "100000")
+	if data, _ := d.DB(0).Lookup("k"); time.Until(data.Expiry) < 99*time.Second {
+		t.Errorf("GETEX PX set the expiry to %v", data.Expiry)
+	}
+	run(t, sess, "GETEX", "k", "PERSIST")
+	if data, _ := d.DB(0).Lookup("k"); !data.Expiry.IsZero() {
+		t.Error("GETEX PERSIST kept the TTL")
+	}
+
+	if reply := run(t, sess, "GETDEL", "k"); reply != bulkString("w") {
+		t.Errorf("GETDEL = %v, want w", reply)
+	}
+	if reply := run(t, sess, "GETDEL", "k"); reply != (resp.Null{}) {
+		t.Errorf("GETDEL of a deleted key = %v, want null", reply)
+	}
+	if _, err := HandleCommands(sess, newCommand("SETEX", "k", "0", "v")); err == nil {
+		t.Error("SETEX with a zero expire time succeeded")
+	}
+}
+
+func TestLCS(t *testing.T) {
+	d := store.CreateDatabases(1)
+	InitDatabases(d)
+	sess := NewSession()
+
+	run(t, sess, "MSET", "key1", "ohmytext", "key2", "mynewtext")
+
+	if reply := run(t, sess, "LCS", "key1", "key2"); reply != bulkString("mytext") {
+		t.Errorf("LCS = %v, want mytext", reply)
+	}
+	if reply := run(t, sess, "LCS", "key1", "key2", "LEN"); reply != (resp.Integer{Value: 6}) {
+		t.Errorf("LCS LEN = %v, want 6", reply)
+	}
+
+	// The example of the Redis documentation
+	reply := run(t, sess, "LCS", "key1", "key2", "IDX", "MINMATCHLEN", "4", "WITHMATCHLEN")
+	str, _ := reply.Serialize()
+	want := "*4\r\n$7\r\nmatches\r\n*1\r\n*3\r\n*2\r\n:4\r\n:7\r\n*2\r\n:5\r\n:8\r\n:4\r\n$3\r\nlen\r\n:6\r\n"
+	if str != want {
+		t.Errorf("LCS IDX = %q, want %q", str, want)
+	}
+
+	reply = run(t, sess, "LCS", "key1", "key2", "IDX")
+	if str, _ := reply.Serialize(); !strings.Contains(str, "*2\r\n:2\r\n:3\r\n*2\r\n:0\r\n:1\r\n") {
+		t.Errorf("LCS IDX = %q, want the match of \"my\"", str)
+	}
+
+	// The table of two large values is refused instead of allocated
+	run(t, sess, "SET", "big1", strings.Repeat("a", 100000))
+	run(t, sess, "SET", "big2", strings.Repeat("b", 100000))
+	if _, err := HandleCommands(sess, newCommand("LCS", "big1", "big2")); err == nil ||
+		err.Error() != "Insufficient memory, transient memory for LCS exceeds proto-max-bulk-len" {
+		t.Errorf("LCS of two 100KB values: %v", err)
+	}
+}
+
+func TestCounters(t *testing.T) {
+	d := store.CreateDatabases(1)
+	InitDatabases(d)
+	sess := NewSession()
+
+	if reply := run(t, sess, "INCR", "n"); reply != (resp.Integer{Value: 1}) {
+		t.Errorf("INCR of a missing key = %v, want 1", reply)
+	}
+	run(t, sess, "DECRBY", "n", "5")
+	if reply := run(t, sess, "DECR", "n"); reply != (resp.Integer{Value: -5}) {
+		t.Errorf("DECR = %v, want -5", reply)
+	}
+	if _, err := HandleCommands(sess, newCommand("DECRBY", "n", "-9223372036854775808")); err == nil {
+		t.Error("DECRBY of the minimum integer succeeded")
+	}
+	if _, err := HandleCommands(sess, newCommand("INCRBY", "n", "1.5")); err == nil {
+		t.Error("INCRBY of a float succeeded")
+	}
+
+	// The TTL is kept & the result is logged with it
+	run(t, sess, "SETEX", "f", "100", "1.5")
+	drainAOF(d)
+	if reply := run(t, sess, "INCRBYFLOAT", "f", "1.25"); reply != bulkString("2.75") {
+		t.Errorf("INCRBYFLOAT = %v, want 2.75", reply)
+	}
+	got := drainAOF(d)
+	if len(got) != 1 || !strings.Contains(got[0], "2.75") || !strings.Contains(got[0], "PXAT") {
+		t.Errorf("propagated %q, want SET f 2.75 PXAT", got)
+	}
+	if _, err := HandleCommands(sess, newCommand("INCRBY", "f", "1")); err == nil {
+		t.Error("INCRBY of a float value succeeded")
+	}
+}
+
+func TestObjectEncoding(t *testing.T) {
+	d := store.CreateDatabases(1)
+	InitDatabases(d)
+	sess := NewSession()
+
+	// Keys may look like numbers
+	run(t, sess, "SET", "1001", "007")
+	if reply := run(t, sess, "GET", "1001"); reply != bulkString("007") {
+		t.Errorf("GET = %v, want 007", reply)
+	}
+
+	encodings := map[string]string{"1001": "embstr"}
+	run(t, sess, "SET", "n", "42")
+	encodings["n"] = "int"
+	run(t, sess, "SET", "long", strings.Repeat("x", 100))
+	encodings["long"] = "raw"
+	run(t, sess, "SET", "appended", "a")
+	run(t, sess, "APPEND", "appended", "b")
+	encodings["appended"] = "raw"
+
+	for key, want := range encodings {
+		if reply := run(t, sess, "OBJECT", "ENCODING", key); reply != bulkString(want) {
+			t.Errorf("OBJECT ENCODING %s = %v, want %s", key, reply, want)
+		}
+	}
+	if reply := run(t, sess, "OBJECT", "ENCODING", "missing"); reply != (resp.Null{}) {
+		t.Errorf("OBJECT ENCODING of a missing key = %v, want null", reply)
+	}
+}
@@ -0,0 +1,444 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DNahar74/PulseDB/internal/store"
+	"github.com/DNahar74/PulseDB/internal/utils"
+)
+
+// Values of TLSAuthClients
+const (
+	TLSAuthClientsNo       = "no"
+	TLSAuthClientsOptional = "optional"
+	TLSAuthClientsYes      = "yes"
+)
+
+// Config holds the settings of a server, read from a redis.conf style file & the command line
+type Config struct {
+	// Bind & Port are the plain TCP address, Port 0 disables it so that the server only accepts TLS or the Unix socket
+	Bind string
+	Port int
+
+	// TLSPort is the port of the TLS listener on Bind, 0 disables TLS
+	TLSPort int
+	// TLSCertFile & TLSKeyFile are the certificate of the server, TLSCACertFile holds the CAs that verify the
+	// certificates of the clients & of the primary
+	TLSCertFile   string
+	TLSKeyFile    string
+	TLSCACertFile string
+	// TLSAuthClients is yes, no or optional, whether the clients must give a certificate
+	TLSAuthClients string
+	// TLSAuthClientsUser set to CN authenticates the clients as the ACL user named by the CN of their certificate
+	TLSAuthClientsUser string
+	// TLSReplication connects to the primary over TLS when the server is a replica
+	TLSReplication bool
+
+	// UnixSocket is the path of a Unix socket listened on alongside the TCP ports, its file gets the mode
+	// UnixSocketPerm when it is not 0
+	UnixSocket     string
+	UnixSocketPerm os.FileMode
+
+	// MetricsPort is the port of the HTTP listener on MetricsBind that serves the Prometheus metrics, 0 disables it
+	// The metrics have no authentication, so they are only served on the loopback interface by default
+	MetricsPort int
+	MetricsBind string
+
+	// Databases is the number of databases selectable with SELECT
+	Databases int
+
+	// RequirePass is the password of the default user, which the clients must send with AUTH, an empty password lets
+	// every client in
+	RequirePass string
+	// ACLFile holds the users, it is loaded on startup & by ACL LOAD, & written by ACL SAVE
+	ACLFile string
+	// MasterUser & MasterAuth are the credentials sent to the primary when the server is a replica, MasterUser is the
+	// default user when empty
+	MasterUser string
+	MasterAuth string
+
+	// MaxMemory is the memory limit of the keyspace in bytes, 0 means no limit
+	MaxMemory int64
+	// MaxMemoryPolicy picks the keys evicted when the keyspace goes over MaxMemory
+	MaxMemoryPolicy store.Policy
+
+	// Dir is the directory of the AOF & the snapshot
+	Dir            string
+	AppendFilename string
+	DBFilename     string
+	// AOFLoadTruncated allows the server to start from an AOF whose last record was only partially written
+	AOFLoadTruncated bool
+	// AOFFlushInterval is the period of the writes of the queued commands to the AOF, AOFBufferSize the number of
+	// commands that can be queued
+	AOFFlushInterval time.Duration
+	AOFBufferSize    int
+	// SnapshotInterval is the period of the snapshots of the keyspace
+	SnapshotInterval time.Duration
+	// Hz is the number of runs per second of the active expiry
+	Hz int
+
+	// SlowlogLogSlowerThan is the duration in microseconds over which a command goes to the slow log, a negative one
+	// disables it; SlowlogMaxLen is the number of entries the slow log keeps
+	SlowlogLogSlowerThan int
+	SlowlogMaxLen        int
+
+	// ReplBacklogSize is the size of the history kept for the partial resyncs of the replicas
+	ReplBacklogSize int64
+
+	// ClusterEnabled runs the server as a node of a cluster, its state is kept in ClusterConfigFile
+	ClusterEnabled    bool
+	ClusterConfigFile string
+	// ClusterAnnounceIP is the address given to the other nodes, it is learned from the cluster bus when empty
+	ClusterAnnounceIP string
+
+	// File is the config file the settings were read from, written back by CONFIG REWRITE
+	File string
+}
+
+// Default returns the settings of a server started without a config file
+func Default() *Config {
+	return &Config{
+		Bind:                 "0.0.0.0",
+		MetricsBind:          "127.0.0.1",
+		Port:                 6380,
+		TLSAuthClients:       TLSAuthClientsYes,
+		Databases:            16,
+		MaxMemoryPolicy:      store.NoEviction,
+		Dir:                  ".",
+		AppendFilename:       "commands.aof",
+		DBFilename:           "memory.dat",
+		AOFLoadTruncated:     true,
+		AOFFlushInterval:     time.Second,
+		AOFBufferSize:        100000,
+		SnapshotInterval:     10 * time.Second,
+		Hz:                   10,
+		SlowlogLogSlowerThan: 10000,
+		SlowlogMaxLen:        128,
+		ReplBacklogSize:      1024 * 1024,
+		ClusterConfigFile:    "nodes.conf",
+	}
+}
+
+// Address is the plain TCP address, empty when Port is 0
+func (c *Config) Address() string {
+	if c.Port == 0 {
+		return ""
+	}
+	return net.JoinHostPort(c.Bind, strconv.Itoa(c.Port))
+}
+
+// TLSAddress is the address of the TLS listener, empty when TLSPort is 0
+func (c *Config) TLSAddress() string {
+	if c.TLSPort == 0 {
+		return ""
+	}
+	return net.JoinHostPort(c.Bind, strconv.Itoa(c.TLSPort))
+}
+
+// MetricsAddress is the address of the metrics listener, empty when MetricsPort is 0
+func (c *Config) MetricsAddress() string {
+	if c.MetricsPort == 0 {
+		return ""
+	}
+	return net.JoinHostPort(c.MetricsBind, strconv.Itoa(c.MetricsPort))
+}
+
+//* Parameters *//
+
+// param is a setting as it is named in the config file, by CONFIG & on the command line
+type param struct {
+	name  string
+	usage string
+	// mutable parameters can be changed by CONFIG SET while the server runs
+	mutable bool
+	isBool  bool
+	get     func(c *Config) string
+	set     func(c *Config, value string) error
+}
+
+func stringParam(name, usage string, mutable bool, field func(c *Config) *string) param {
+	return param{
+		name: name, usage: usage, mutable: mutable,
+		get: func(c *Config) string { return *field(c) },
+		set: func(c *Config, value string) error {
+			*field(c) = value
+			return nil
+		},
+	}
+}
+
+func enumParam(name, usage string, mutable bool, values []string, field func(c *Config) *string) param {
+	return param{
+		name: name, usage: usage, mutable: mutable,
+		get: func(c *Config) string { return *field(c) },
+		set: func(c *Config, value string) error {
+			for _, v := range values {
+				if strings.EqualFold(v, value) {
+					*field(c) = v
+					return nil
+				}
+			}
+			return fmt.Errorf("argument(s) must be one of the following: %s", strings.Join(values, ", "))
+		},
+	}
+}
+
+func intParam(name, usage string, mutable bool, lower, upper int, field func(c *Config) *int) param {
+	return param{
+		name: name, usage: usage, mutable: mutable,
+		get: func(c *Config) string { return strconv.Itoa(*field(c)) },
+		set: func(c *Config, value string) error {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("argument couldn't be parsed into an integer")
+			}
+			if n < lower || n > upper {
+				return fmt.Errorf("argument must be between %d and %d inclusive", lower, upper)
+			}
+			*field(c) = n
+			return nil
+		},
+	}
+}
+
+func boolParam(name, usage string, mutable bool, field func(c *Config) *bool) param {
+	return param{
+		name: name, usage: usage, mutable: mutable, isBool: true,
+		get: func(c *Config) string { return formatBool(*field(c)) },
+		set: func(c *Config, value string) error {
+			b, err := parseBool(value)
+			if err != nil {
+				return err
+			}
+			*field(c) = b
+			return nil
+		},
+	}
+}
+
+func memoryParam(name, usage string, mutable bool, lower int64, field func(c *Config) *int64) param {
+	return param{
+		name: name, usage: usage, mutable: mutable,
+		get: func(c *Config) string { return strconv.FormatInt(*field(c), 10) },
+		set: func(c *Config, value string) error {
+			n, err := utils.ParseMemory(value)
+			if err != nil {
+				return fmt.Errorf("argument must be a memory value")
+			}
+			if n < lower {
+				return fmt.Errorf("argument must be at least %d", lower)
+			}
+			*field(c) = n
+			return nil
+		},
+	}
+}
+
+// secondsParam is a period given in seconds
+func secondsParam(name, usage string, mutable bool, field func(c *Config) *time.Duration) param {
+	return param{
+		name: name, usage: usage, mutable: mutable,
+		get: func(c *Config) string { return strconv.Itoa(int(field(c).Seconds())) },
+		set: func(c *Config, value string) error {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("argument couldn't be parsed into an integer")
+			}
+			if n < 1 || n > 3600 {
+				return fmt.Errorf("argument must be between 1 and 3600 inclusive")
+			}
+			*field(c) = time.Duration(n) * time.Second
+			return nil
+		},
+	}
+}
+
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "yes", "true":
+		return true, nil
+	case "no", "false":
+		return false, nil
+	}
+	return false, fmt.Errorf("argument must be 'yes' or 'no'")
+}
+
+func formatBool(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+// params lists the settings, in the order they are written to a new config file
+var params = []param{
+	stringParam("bind", "Address the TCP & TLS listeners bind to", false, func(c *Config) *string { return &c.Bind }),
+	intParam("port", "Port of the plain TCP listener (0 to only accept TLS or the Unix socket)", false, 0, 65535, func(c *Config) *int { return &c.Port }),
+	intParam("tls-port", "Port of the TLS listener (0 disables TLS)", false, 0, 65535, func(c *Config) *int { return &c.TLSPort }),
+	stringParam("tls-cert-file", "Certificate of the server, in PEM", true, func(c *Config) *string { return &c.TLSCertFile }),
+	stringParam("tls-key-file", "Private key of the server certificate, in PEM", true, func(c *Config) *string { return &c.TLSKeyFile }),
+	stringParam("tls-ca-cert-file", "CA certificates that verify the client certificates & the primary, in PEM", true, func(c *Config) *string { return &c.TLSCACertFile }),
+	enumParam("tls-auth-clients", "Whether the TLS clients must give a certificate: yes, no or optional", true,
+		[]string{TLSAuthClientsYes, TLSAuthClientsNo, TLSAuthClientsOptional}, func(c *Config) *string { return &c.TLSAuthClients }),
+	param{
+		name: "tls-auth-clients-user", usage: "CN authenticates the TLS clients as the ACL user named by the CN of their certificate", mutable: true,
+		get: func(c *Config) string {
+			if c.TLSAuthClientsUser == "" {
+				return "off"
+			}
+			return c.TLSAuthClientsUser
+		},
+		set: func(c *Config, value string) error {
+			switch {
+			case strings.EqualFold(value, "off"):
+				c.TLSAuthClientsUser = ""
+			case strings.EqualFold(value, "CN"):
+				c.TLSAuthClientsUser = "CN"
+			default:
+				return fmt.Errorf("argument(s) must be one of the following: off, CN")
+			}
+			return nil
+		},
+	},
+	boolParam("tls-replication", "Connect to the primary over TLS", false, func(c *Config) *bool { return &c.TLSReplication }),
+	stringParam("unixsocket", "Path of a Unix socket listened on alongside the TCP ports", false, func(c *Config) *string { return &c.UnixSocket }),
+	param{
+		name: "unixsocketperm", usage: "Octal permissions of the Unix socket file, e.g. 700 (0 keeps the umask ones)",
+		get: func(c *Config) string { return strconv.FormatUint(uint64(c.UnixSocketPerm), 8) },
+		set: func(c *Config, value string) error {
+			perm, err := strconv.ParseUint(value, 8, 32)
+			if err != nil || perm > 0777 {
+				return fmt.Errorf("argument must be an octal number between 0 and 777")
+			}
+			c.UnixSocketPerm = os.FileMode(perm)
+			return nil
+		},
+	},
+	stringParam("metrics-bind", "Address the Prometheus metrics listener binds to", false, func(c *Config) *string { return &c.MetricsBind }),
+	intParam("metrics-port", "Port of the HTTP listener serving the Prometheus metrics on /metrics (0 disables it)", false, 0, 65535, func(c *Config) *int { return &c.MetricsPort }),
+	intParam("databases", "Number of databases, selected with SELECT", false, 1, 1<<20, func(c *Config) *int { return &c.Databases }),
+	stringParam("requirepass", "Password the clients must send with AUTH before running commands", true, func(c *Config) *string { return &c.RequirePass }),
+	stringParam("aclfile", "File of the ACL users, loaded on startup & written by ACL SAVE", false, func(c *Config) *string { return &c.ACLFile }),
+	stringParam("masteruser", "User authenticated with masterauth on the primary (default user when empty)", true, func(c *Config) *string { return &c.MasterUser }),
+	stringParam("masterauth", "Password sent to the primary when the server is a replica", true, func(c *Config) *string { return &c.MasterAuth }),
+	memoryParam("maxmemory", "Memory limit of the keyspace, e.g. 100mb (0 means no limit)", true, 0, func(c *Config) *int64 { return &c.MaxMemory }),
+	param{
+		name: "maxmemory-policy", mutable: true,
+		usage: "Keys evicted when the limit is reached: noeviction, allkeys-lru, volatile-lru, allkeys-lfu, volatile-lfu, allkeys-random, volatile-random or volatile-ttl",
+		get:   func(c *Config) string { return c.MaxMemoryPolicy.String() },
+		set: func(c *Config, value string) error {
+			policy, err := store.ParsePolicy(strings.ToLower(value))
+			if err != nil {
+				return err
+			}
+			c.MaxMemoryPolicy = policy
+			return nil
+		},
+	},
+	stringParam("dir", "Directory of the AOF & the snapshot", false, func(c *Config) *string { return &c.Dir }),
+	stringParam("appendfilename", "Name of the AOF in dir", false, func(c *Config) *string { return &c.AppendFilename }),
+	stringParam("dbfilename", "Name of the snapshot in dir", false, func(c *Config) *string { return &c.DBFilename }),
+	boolParam("aof-load-truncated", "Discard an incomplete last AOF record instead of refusing to start", true, func(c *Config) *bool { return &c.AOFLoadTruncated }),
+	secondsParam("aof-flush-interval", "Seconds between the writes of the queued commands to the AOF", true, func(c *Config) *time.Duration { return &c.AOFFlushInterval }),
+	intParam("aof-buffer-size", "Number of commands queued for the AOF before the writes wait", false, 1, 1<<30, func(c *Config) *int { return &c.AOFBufferSize }),
+	secondsParam("snapshot-interval", "Seconds between the snapshots of the keyspace", true, func(c *Config) *time.Duration { return &c.SnapshotInterval }),
+	intParam("hz", "Runs per second of the active expiry", true, 1, 500, func(c *Config) *int { return &c.Hz }),
+	intParam("slowlog-log-slower-than", "Microseconds over which a command goes to the slow log (0 logs every command, -1 none)", true,
+		-1, math.MaxInt32, func(c *Config) *int { return &c.SlowlogLogSlowerThan }),
+	intParam("slowlog-max-len", "Entries kept by the slow log", true, 0, math.MaxInt32, func(c *Config) *int { return &c.SlowlogMaxLen }),
+	// The backlog is a ring buffer, it can't be empty
+	memoryParam("repl-backlog-size", "Size of the history kept for the partial resyncs of the replicas", false, 16*1024,
+		func(c *Config) *int64 { return &c.ReplBacklogSize }),
+	boolParam("cluster-enabled", "Run as a node of a cluster", false, func(c *Config) *bool { return &c.ClusterEnabled }),
+	stringParam("cluster-config-file", "File where the cluster state of the node is saved", false, func(c *Config) *string { return &c.ClusterConfigFile }),
+	stringParam("cluster-announce-ip", "IP address given to the other nodes of the cluster", false, func(c *Config) *string { return &c.ClusterAnnounceIP }),
+}
+
+func lookup(name string) (*param, bool) {
+	name = strings.ToLower(name)
+	for i := range params {
+		if params[i].name == name {
+			return &params[i], true
+		}
+	}
+	return nil, false
+}
+
+// Get returns the value of a parameter as CONFIG GET & the config file give it
+func (c *Config) Get(name string) (string, bool) {
+	p, ok := lookup(name)
+	if !ok {
+		return "", false
+	}
+	return p.get(c), true
+}
+
+// Set changes a parameter, whether or not it is mutable
+func (c *Config) Set(name, value string) error {
+	p, ok := lookup(name)
+	if !ok {
+		return fmt.Errorf("unknown parameter '%s'", name)
+	}
+	return p.set(c, value)
+}
+
+// Match returns the names & the values of the parameters matching glob patterns, sorted by name
+func (c *Config) Match(patterns ...string) []string {
+	names := make([]string, 0)
+	for _, p := range params {
+		for _, pattern := range patterns {
+			if utils.GlobMatch(strings.ToLower(pattern), p.name) {
+				names = append(names, p.name)
+				break
+			}
+		}
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, 2*len(names))
+	for _, name := range names {
+		value, _ := c.Get(name)
+		pairs = append(pairs, name, value)
+	}
+	return pairs
+}
+
+// SetParams changes parameters from name/value pairs, as CONFIG SET does, & returns the names of those changed
+// Nothing is changed when one of the pairs is invalid or names a parameter that can't change at runtime
+func (c *Config) SetParams(pairs []string) ([]string, error) {
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return nil, fmt.Errorf("wrong number of arguments for 'config|set' command")
+	}
+
+	next := *c
+	names := make([]string, 0, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		p, ok := lookup(pairs[i])
+		if !ok {
+			return nil, fmt.Errorf("Unknown option or number of arguments for CONFIG SET - '%s'", pairs[i])
+		}
+		for _, name := range names {
+			if name == p.name {
+				return nil, fmt.Errorf("CONFIG SET failed (possibly related to argument '%s') - duplicate parameter", pairs[i])
+			}
+		}
+		if !p.mutable {
+			return nil, fmt.Errorf("CONFIG SET failed (possibly related to argument '%s') - can't set immutable config", pairs[i])
+		}
+		err := p.set(&next, pairs[i+1])
+		if err != nil {
+			return nil, fmt.Errorf("CONFIG SET failed (possibly related to argument '%s') - %v", pairs[i], err)
+		}
+		names = append(names, p.name)
+	}
+
+	*c = next
+	return names, nil
+}
@@ -0,0 +1,185 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DNahar74/PulseDB/internal/store"
+)
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pulsedb.conf")
+	content := `# PulseDB
+port 7000
+  bind 127.0.0.1
+requirepass "with \"quotes\" & spaces"
+masterauth 'single quoted'
+maxmemory 100mb
+MAXMEMORY-POLICY allkeys-lru
+appendfilename ""
+
+snapshot-interval 30
+cluster-enabled yes
+unixsocketperm 770
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := Default()
+	if err := c.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	if c.Address() != "127.0.0.1:7000" || c.TLSAddress() != "" {
+		t.Errorf("addresses = %q, %q", c.Address(), c.TLSAddress())
+	}
+	if c.RequirePass != `with "quotes" & spaces` || c.MasterAuth != "single quoted" || c.AppendFilename != "" {
+		t.Errorf("quoted values = %q, %q, %q", c.RequirePass, c.MasterAuth, c.AppendFilename)
+	}
+	if c.MaxMemory != 100<<20 || c.MaxMemoryPolicy != store.AllKeysLRU || c.SnapshotInterval != 30*time.Second {
+		t.Errorf("maxmemory %d, policy %v, snapshot-interval %v", c.MaxMemory, c.MaxMemoryPolicy, c.SnapshotInterval)
+	}
+	if !c.ClusterEnabled || c.UnixSocketPerm != 0770 || c.File != path {
+		t.Errorf("cluster-enabled %v, unixsocketperm %o, file %q", c.ClusterEnabled, c.UnixSocketPerm, c.File)
+	}
+
+	for _, tt := range []struct {
+		content, wantErr string
+	}{
+		{content: "port 7000\nnosuch 1\n", wantErr: ":2: bad directive"},
+		{content: "port\n", wantErr: "wrong number of arguments for 'port'"},
+		{content: "port 99999\n", wantErr: "argument must be between 0 and 65535 inclusive"},
+		{content: "requirepass \"open\n", wantErr: "unbalanced quotes"},
+		{content: "cluster-enabled maybe\n", wantErr: "argument must be 'yes' or 'no'"},
+		{content: "repl-backlog-size 0\n", wantErr: "argument must be at least 16384"},
+	} {
+		_ = os.WriteFile(path, []byte(tt.content), 0644)
+		if err := Default().Load(path); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("Load of %q: error %v, want %q", tt.content, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSetParams(t *testing.T) {
+	c := Default()
+
+	changed, err := c.SetParams([]string{"maxmemory", "1gb", "HZ", "50"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(changed, " ") != "maxmemory hz" || c.MaxMemory != 1<<30 || c.Hz != 50 {
+		t.Errorf("changed %v, maxmemory %d, hz %d", changed, c.MaxMemory, c.Hz)
+	}
+
+	for _, tt := range []struct {
+		pairs   []string
+		wantErr string
+	}{
+		{pairs: []string{"hz", "10", "port", "7000"}, wantErr: "CONFIG SET failed (possibly related to argument 'port') - can't set immutable config"},
+		{pairs: []string{"hz", "10", "nosuch", "1"}, wantErr: "Unknown option or number of arguments for CONFIG SET - 'nosuch'"},
+		{pairs: []string{"hz", "10", "hz", "20"}, wantErr: "duplicate parameter"},
+		{pairs: []string{"hz", "0"}, wantErr: "argument must be between 1 and 500 inclusive"},
+		{pairs: []string{"maxmemory-policy", "sometimes"}, wantErr: "invalid maxmemory-policy"},
+		{pairs: []string{"hz"}, wantErr: "wrong number of arguments"},
+	} {
+		_, err := c.SetParams(tt.pairs)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%v: error %v, want %q", tt.pairs, err, tt.wantErr)
+		}
+	}
+	// A failed CONFIG SET changes none of its parameters
+	if c.Hz != 50 {
+		t.Errorf("hz = %d after failed SetParams", c.Hz)
+	}
+
+	got := strings.Join(c.Match("maxmemory*", "HZ"), " ")
+	if got != "hz 50 maxmemory 1073741824 maxmemory-policy noeviction" {
+		t.Errorf("Match = %q", got)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	if err := Default().Rewrite(); err != ErrNoFile {
+		t.Errorf("Rewrite without a file: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "pulsedb.conf")
+	content := "# Network\nport 7000\nport 7001\n\n# Security\nrequirepass old\nunknown-to-rewrite 1\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := Default()
+	c.File = path
+	c.Port = 7001
+	c.RequirePass = "new # password"
+	c.Hz = 20
+	if err := c.Rewrite(); err != nil {
+		t.Fatal(err)
+	}
+	// A second rewrite doesn't add the header again
+	if err := c.Rewrite(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := os.ReadFile(path)
+	want := "# Network\nport 7001\n\n# Security\nrequirepass \"new # password\"\nunknown-to-rewrite 1\n" + rewriteHeader + "\nhz 20\n"
+	if string(b) != want {
+		t.Errorf("rewritten file:\n%s\nwant:\n%s", b, want)
+	}
+
+	loaded := Default()
+	if err := loaded.Load(path); err == nil || !strings.Contains(err.Error(), "unknown-to-rewrite") {
+		t.Fatalf("Load of the rewritten file: %v", err)
+	}
+	_ = os.WriteFile(path, []byte(strings.Replace(string(b), "unknown-to-rewrite 1\n", "", 1)), 0644)
+	if err := loaded.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.RequirePass != c.RequirePass || loaded.Port != 7001 || loaded.Hz != 20 {
+		t.Errorf("loaded requirepass %q, port %d, hz %d", loaded.RequirePass, loaded.Port, loaded.Hz)
+	}
+}
+
+func TestFlags(t *testing.T) {
+	fs := flag.NewFlagSet("pulsedb", flag.ContinueOnError)
+	flags := RegisterFlags(fs)
+	if err := fs.Parse([]string{"-port", "7002", "-cluster-enabled", "-aof-load-truncated=false"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Parse([]string{"-hz", "nope"}); err == nil {
+		t.Error("an invalid flag value was accepted")
+	}
+	if err := fs.Parse([]string{"-repl-backlog-size", "1kb"}); err == nil {
+		t.Error("a repl-backlog-size under 16kb was accepted")
+	}
+
+	// The flags override the config file
+	c := Default()
+	c.Port = 7000
+	c.Hz = 20
+	if err := flags.Apply(c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Port != 7002 || !c.ClusterEnabled || c.AOFLoadTruncated || c.Hz != 20 {
+		t.Errorf("port %d, cluster-enabled %v, aof-load-truncated %v, hz %d", c.Port, c.ClusterEnabled, c.AOFLoadTruncated, c.Hz)
+	}
+}
+
+func TestMetricsAddress(t *testing.T) {
+	// The metrics have no authentication, they stay on the loopback interface unless metrics-bind is set
+	c := Default()
+	c.MetricsPort = 9121
+	if got := c.MetricsAddress(); got != "127.0.0.1:9121" {
+		t.Errorf("MetricsAddress = %q, want 127.0.0.1:9121", got)
+	}
+	if _, err := c.SetParams([]string{"metrics-bind", "0.0.0.0"}); err == nil {
+		t.Error("CONFIG SET changed metrics-bind while the server runs")
+	}
+	if err := c.Set("metrics-bind", "10.0.0.1"); err != nil || c.MetricsAddress() != "10.0.0.1:9121" {
+		t.Errorf("MetricsAddress after setting metrics-bind = %q, %v", c.MetricsAddress(), err)
+	}
+}
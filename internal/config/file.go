@@ -0,0 +1,230 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+)
+
+//* Config file *//
+
+// ErrNoFile is returned by Rewrite when the server was started without a config file
+var ErrNoFile = errors.New("The server is running without a config file")
+
+// rewriteHeader starts the lines CONFIG REWRITE adds to the end of a file
+const rewriteHeader = "# Generated by CONFIG REWRITE"
+
+// Load reads a redis.conf style file over the settings, where every line is "<name> <value>"
+// Empty lines & lines starting with # are skipped, values with spaces are quoted
+func (c *Config) Load(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	for i, line := range strings.Split(string(content), "\n") {
+		if isComment(line) {
+			continue
+		}
+		args, err := splitArgs(line)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", path, i+1, err)
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		p, ok := lookup(args[0])
+		if !ok {
+			return fmt.Errorf("%s:%d: bad directive or wrong number of arguments '%s'", path, i+1, args[0])
+		}
+		if len(args) != 2 {
+			return fmt.Errorf("%s:%d: wrong number of arguments for '%s'", path, i+1, p.name)
+		}
+		err = p.set(c, args[1])
+		if err != nil {
+			return fmt.Errorf("%s:%d: '%s' %v", path, i+1, p.name, err)
+		}
+	}
+
+	c.File = path
+	return nil
+}
+
+// Rewrite writes the settings back to their file
+// The lines of the settings are updated in place & the comments kept, the settings missing from the file that differ
+// from the defaults are added at its end
+func (c *Config) Rewrite() error {
+	if c.File == "" {
+		return ErrNoFile
+	}
+
+	content, err := os.ReadFile(c.File)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	lines := make([]string, 0)
+	written := make(map[string]bool)
+	hasHeader := false
+	for _, line := range strings.Split(strings.TrimRight(string(content), "\n"), "\n") {
+		args, err := splitArgs(line)
+		if isComment(line) || err != nil || len(args) == 0 {
+			if len(lines) > 0 || line != "" {
+				lines = append(lines, line)
+			}
+			hasHeader = hasHeader || line == rewriteHeader
+			continue
+		}
+
+		p, ok := lookup(args[0])
+		if !ok {
+			lines = append(lines, line)
+			continue
+		}
+		// A setting given more than once is kept at its first line
+		if !written[p.name] {
+			lines = append(lines, p.name+" "+quoteArg(p.get(c)))
+			written[p.name] = true
+		}
+	}
+
+	defaults := Default()
+	for _, p := range params {
+		if written[p.name] || p.get(c) == p.get(defaults) {
+			continue
+		}
+		if !hasHeader {
+			lines = append(lines, rewriteHeader)
+			hasHeader = true
+		}
+		lines = append(lines, p.name+" "+quoteArg(p.get(c)))
+	}
+
+	tmp := c.File + ".tmp"
+	err = os.WriteFile(tmp, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.File)
+}
+
+func isComment(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), "#")
+}
+
+// splitArgs splits a line into its arguments, which are separated by spaces or quoted
+// Double quoted arguments take the escapes \n, \r, \t, \", \\ & \xHH, single quoted ones only \'
+func splitArgs(line string) ([]string, error) {
+	args := make([]string, 0)
+	i := 0
+	for {
+		for i < len(line) && (line[i] == ' ' || line[i] == '\t' || line[i] == '\r') {
+			i++
+		}
+		if i == len(line) {
+			return args, nil
+		}
+
+		var sb strings.Builder
+		switch line[i] {
+		case '"':
+			i++
+			for {
+				if i == len(line) {
+					return nil, errors.New("unbalanced quotes")
+				}
+				ch := line[i]
+				if ch == '"' {
+					i++
+					break
+				}
+				if ch == '\\' && i+1 < len(line) {
+					i++
+					switch line[i] {
+					case 'n':
+						ch = '\n'
+					case 'r':
+						ch = '\r'
+					case 't':
+						ch = '\t'
+					case 'x':
+						if i+2 < len(line) {
+							if b, err := strconv.ParseUint(line[i+1:i+3], 16, 8); err == nil {
+								ch = byte(b)
+								i += 2
+								break
+							}
+						}
+						ch = 'x'
+					default:
+						ch = line[i]
+					}
+				}
+				sb.WriteByte(ch)
+				i++
+			}
+		case '\'':
+			i++
+			for {
+				if i == len(line) {
+					return nil, errors.New("unbalanced quotes")
+				}
+				if line[i] == '\'' {
+					i++
+					break
+				}
+				if line[i] == '\\' && i+1 < len(line) && line[i+1] == '\'' {
+					i++
+				}
+				sb.WriteByte(line[i])
+				i++
+			}
+		default:
+			for i < len(line) && line[i] != ' ' && line[i] != '\t' && line[i] != '\r' {
+				sb.WriteByte(line[i])
+				i++
+			}
+			args = append(args, sb.String())
+			continue
+		}
+
+		// A closing quote must be followed by a space or the end of the line
+		if i < len(line) && line[i] != ' ' && line[i] != '\t' && line[i] != '\r' {
+			return nil, errors.New("closing quote must be followed by a space")
+		}
+		args = append(args, sb.String())
+	}
+}
+
+// quoteArg quotes a value that splitArgs would not read back as one argument
+func quoteArg(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\r\n\"'\\#") {
+		return s
+	}
+
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch ch := s[i]; {
+		case ch == '"' || ch == '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(ch)
+		case ch == '\n':
+			sb.WriteString(`\n`)
+		case ch == '\r':
+			sb.WriteString(`\r`)
+		case ch == '\t':
+			sb.WriteString(`\t`)
+		case ch < ' ' || ch == 0x7f:
+			fmt.Fprintf(&sb, `\x%02x`, ch)
+		default:
+			sb.WriteByte(ch)
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+)
+
+//* Command line *//
+
+// Flags are the parameters given on the command line, applied over the config file
+type Flags struct {
+	set [][2]string
+}
+
+// flagValue records the value of a parameter flag, the parameter is checked when the flags are applied
+type flagValue struct {
+	flags *Flags
+	param *param
+	value string
+}
+
+func (v *flagValue) String() string {
+	return v.value
+}
+
+func (v *flagValue) Set(value string) error {
+	err := v.param.set(Default(), value)
+	if err != nil {
+		return err
+	}
+	v.value = value
+	v.flags.set = append(v.flags.set, [2]string{v.param.name, value})
+	return nil
+}
+
+func (v *flagValue) IsBoolFlag() bool {
+	return v.param.isBool
+}
+
+// RegisterFlags adds a flag named like every parameter to a flag set, with the default value as its default
+func RegisterFlags(fs *flag.FlagSet) *Flags {
+	f := &Flags{}
+	defaults := Default()
+	for i := range params {
+		p := &params[i]
+		fs.Var(&flagValue{flags: f, param: p, value: p.get(defaults)}, p.name, p.usage)
+	}
+	return f
+}
+
+// Apply sets the parameters given on the command line, in their order
+func (f *Flags) Apply(c *Config) error {
+	for _, nv := range f.set {
+		err := c.Set(nv[0], nv[1])
+		if err != nil {
+			return fmt.Errorf("invalid -%s: %v", nv[0], err)
+		}
+	}
+	return nil
+}
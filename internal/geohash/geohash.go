@@ -0,0 +1,215 @@
+// Package geohash encodes coordinates as the 52 bits interleaved geohashes used by Redis as the scores of geo indexes,
+// & computes the distances of the geo commands
+package geohash
+
+import "math"
+
+const (
+	// Step is the number of bits of each coordinate in a geohash
+	Step = 26
+
+	// The limits of the coordinates that can be indexed, those of EPSG:3857 (Web Mercator)
+	LongMin = -180.0
+	LongMax = 180.0
+	LatMin  = -85.05112878
+	LatMax  = 85.05112878
+
+	// earthRadius is the radius used by Redis for the haversine formula, in meters
+	earthRadius = 6372797.560856
+	// mercatorMax is half the circumference of the earth in Web Mercator, in meters
+	mercatorMax = 20037726.37
+
+	alphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+)
+
+// Valid reports whether coordinates can be indexed
+func Valid(long, lat float64) bool {
+	return long >= LongMin && long <= LongMax && lat >= LatMin && lat <= LatMax
+}
+
+// Encode returns the 52 bits geohash of coordinates, with the latitude in the even bits & the longitude in the odd bits
+func Encode(long, lat float64) uint64 {
+	latIndex, longIndex := cellOf(long, lat, Step)
+	return interleave(latIndex, longIndex)
+}
+
+// Decode returns the center of the area of a geohash, which is within 0.6 meters of the encoded coordinates
+func Decode(hash uint64) (float64, float64) {
+	latIndex, longIndex := deinterleave(hash)
+	latMin, latMax := cellRange(latIndex, Step, LatMin, LatMax)
+	longMin, longMax := cellRange(longIndex, Step, LongMin, LongMax)
+
+	long := math.Max(LongMin, math.Min(LongMax, (longMin+longMax)/2))
+	lat := math.Max(LatMin, math.Min(LatMax, (latMin+latMax)/2))
+	return long, lat
+}
+
+// String returns the standard 11 characters geohash of a score, as returned by GEOHASH
+// The standard geohash uses latitudes from -90 to 90, so the coordinates are encoded again
+func String(hash uint64) string {
+	long, lat := Decode(hash)
+	latIndex := uint32((lat + 90) / 180 * (1 << Step))
+	longIndex := uint32((long + 180) / 360 * (1 << Step))
+	bits := interleave(latIndex, longIndex)
+
+	b := make([]byte, 11)
+	for i := range 10 {
+		b[i] = alphabet[bits>>(52-(i+1)*5)&0x1f]
+	}
+	// There are only 52 bits, the 11th character is always the first of the alphabet like in Redis
+	b[10] = alphabet[0]
+	return string(b)
+}
+
+// Distance returns the distance in meters between two points with the haversine formula
+func Distance(long1, lat1, long2, lat2 float64) float64 {
+	lat1r, lat2r := radians(lat1), radians(lat2)
+	u := math.Sin((lat2r - lat1r) / 2)
+	v := math.Sin((radians(long2) - radians(long1)) / 2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(u*u+math.Cos(lat1r)*math.Cos(lat2r)*v*v))
+}
+
+// InBox returns the distance of a point from the center of a box of width & height meters, & false if it is outside
+func InBox(centerLong, centerLat, width, height, long, lat float64) (float64, bool) {
+	// The latitude distance doesn't depend on the longitude, & the longitude distance is measured at the latitude of
+	// the point, like in Redis
+	latDistance := 2 * earthRadius * math.Asin(math.Abs(math.Sin((radians(lat)-radians(centerLat))/2)))
+	if latDistance > height/2 {
+		return 0, false
+	}
+	if Distance(long, lat, centerLong, lat) > width/2 {
+		return 0, false
+	}
+	return Distance(centerLong, centerLat, long, lat), true
+}
+
+// Range is an interval of scores, from Min included to Max excluded
+type Range struct {
+	Min, Max uint64
+}
+
+// Cover returns the ranges of scores holding every point of a search area: the cell of the center & its 8 neighbors,
+// at the deepest level where they contain the bounding box of the area
+// The area is given by a radius for the level to start from & its half width & half height, in meters; the points of
+// the ranges must still be filtered by their actual distance
+func Cover(long, lat, radius, halfWidth, halfHeight float64) []Range {
+	latDelta := degrees(halfHeight / earthRadius)
+	// The box is the widest on its side closest to a pole
+	longDelta := degrees(halfWidth / earthRadius / math.Cos(radians(math.Min(math.Abs(lat)+latDelta, 89.9))))
+
+	step := estimateStep(radius, lat)
+	for ; step > 1; step-- {
+		latIndex, longIndex := cellOf(long, lat, step)
+		cells := float64(uint64(1) << step)
+		latSize, longSize := (LatMax-LatMin)/cells, (LongMax-LongMin)/cells
+
+		north := LatMin + float64(latIndex+2)*latSize
+		south := LatMin + (float64(latIndex)-1)*latSize
+		east := LongMin + float64(longIndex+2)*longSize
+		west := LongMin + (float64(longIndex)-1)*longSize
+		if north >= lat+latDelta && south <= lat-latDelta && east >= long+longDelta && west <= long-longDelta {
+			break
+		}
+	}
+
+	latIndex, longIndex := cellOf(long, lat, step)
+	cells := int64(1) << step
+	shift := uint(2 * (Step - step))
+
+	ranges := make([]Range, 0, 9)
+	seen := make(map[uint64]bool, 9)
+	for dLat := int64(-1); dLat <= 1; dLat++ {
+		la := int64(latIndex) + dLat
+		if la < 0 || la >= cells {
+			continue
+		}
+		for dLong := int64(-1); dLong <= 1; dLong++ {
+			// The longitude wraps around the antimeridian
+			lo := (int64(longIndex) + dLong + cells) % cells
+			hash := interleave(uint32(la), uint32(lo))
+			if seen[hash] {
+				continue
+			}
+			seen[hash] = true
+			ranges = append(ranges, Range{Min: hash << shift, Max: (hash + 1) << shift})
+		}
+	}
+	return ranges
+}
+
+// estimateStep returns the level of the cells whose size is about a search radius
+func estimateStep(radius, lat float64) int {
+	if radius == 0 {
+		return Step
+	}
+	step := 1
+	for radius < mercatorMax {
+		radius *= 2
+		step++
+	}
+	// Make sure the radius is included in most of the cases
+	step -= 2
+
+	// The cells are narrower near the poles
+	if lat > 66 || lat < -66 {
+		step--
+		if lat > 80 || lat < -80 {
+			step--
+		}
+	}
+	return max(1, min(Step, step))
+}
+
+// cellOf returns the indexes of the latitude & the longitude of the cell holding coordinates, at a level of step bits
+func cellOf(long, lat float64, step int) (uint32, uint32) {
+	cells := float64(uint64(1) << step)
+	latIndex := uint64((lat - LatMin) / (LatMax - LatMin) * cells)
+	longIndex := uint64((long - LongMin) / (LongMax - LongMin) * cells)
+	// The maximum coordinates are in the last cell
+	latIndex = min(latIndex, uint64(cells)-1)
+	longIndex = min(longIndex, uint64(cells)-1)
+	return uint32(latIndex), uint32(longIndex)
+}
+
+// cellRange returns the coordinates covered by a cell index at a level of step bits
+func cellRange(index uint32, step int, lo, hi float64) (float64, float64) {
+	size := (hi - lo) / float64(uint64(1)<<step)
+	return lo + float64(index)*size, lo + float64(index+1)*size
+}
+
+// interleave spreads the bits of x in the even bits of the result & the bits of y in the odd bits
+func interleave(x, y uint32) uint64 {
+	return spread(x) | spread(y)<<1
+}
+
+func deinterleave(hash uint64) (uint32, uint32) {
+	return squash(hash), squash(hash >> 1)
+}
+
+func spread(v uint32) uint64 {
+	x := uint64(v)
+	x = (x | x<<16) & 0x0000FFFF0000FFFF
+	x = (x | x<<8) & 0x00FF00FF00FF00FF
+	x = (x | x<<4) & 0x0F0F0F0F0F0F0F0F
+	x = (x | x<<2) & 0x3333333333333333
+	x = (x | x<<1) & 0x5555555555555555
+	return x
+}
+
+func squash(x uint64) uint32 {
+	x &= 0x5555555555555555
+	x = (x | x>>1) & 0x3333333333333333
+	x = (x | x>>2) & 0x0F0F0F0F0F0F0F0F
+	x = (x | x>>4) & 0x00FF00FF00FF00FF
+	x = (x | x>>8) & 0x0000FFFF0000FFFF
+	x = (x | x>>16) & 0x00000000FFFFFFFF
+	return uint32(x)
+}
+
+func radians(d float64) float64 {
+	return d * math.Pi / 180
+}
+
+func degrees(r float64) float64 {
+	return r * 180 / math.Pi
+}
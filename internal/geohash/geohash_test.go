@@ -0,0 +1,88 @@
+package geohash
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+// The examples of the Redis documentation
+const (
+	palermoLong, palermoLat = 13.361389, 38.115556
+	cataniaLong, cataniaLat = 15.087269, 37.502669
+)
+
+func TestEncode(t *testing.T) {
+	if hash := Encode(palermoLong, palermoLat); hash != 3479099956230698 {
+		t.Errorf("Encode(Palermo) = %d, want the score of Redis 3479099956230698", hash)
+	}
+
+	long, lat := Decode(Encode(palermoLong, palermoLat))
+	if math.Abs(long-palermoLong) > 1e-5 || math.Abs(lat-palermoLat) > 1e-5 {
+		t.Errorf("Decode(Encode(Palermo)) = %f,%f", long, lat)
+	}
+	if got := fmt.Sprintf("%.5f %.5f", long, lat); got != "13.36139 38.11556" {
+		t.Errorf("Decode(Palermo) = %s", got)
+	}
+
+	for _, tt := range []struct {
+		long, lat float64
+		want      string
+	}{
+		{palermoLong, palermoLat, "sqc8b49rny0"},
+		{cataniaLong, cataniaLat, "sqdtr74hyu0"},
+	} {
+		if got := String(Encode(tt.long, tt.lat)); got != tt.want {
+			t.Errorf("String(%f,%f) = %s, want %s", tt.long, tt.lat, got, tt.want)
+		}
+	}
+}
+
+func TestDistance(t *testing.T) {
+	d := Distance(palermoLong, palermoLat, cataniaLong, cataniaLat)
+	if math.Abs(d-166274.15) > 1 {
+		t.Errorf("Distance(Palermo, Catania) = %f, want 166274.15", d)
+	}
+
+	if _, ok := InBox(15, 37, 400000, 400000, palermoLong, palermoLat); !ok {
+		t.Error("Palermo is not in the box of 400 km around 15,37")
+	}
+	if _, ok := InBox(15, 37, 200000, 200000, palermoLong, palermoLat); ok {
+		t.Error("Palermo is in the box of 200 km around 15,37")
+	}
+}
+
+func TestCover(t *testing.T) {
+	// Every point within the radius must be in one of the ranges, wherever the center is in its cell
+	for _, center := range [][2]float64{{15, 37}, {0, 0}, {179.99, 10}, {-179.99, -10}, {2.35, 84.9}} {
+		for _, radius := range []float64{10, 5000, 200000, 3000000} {
+			ranges := Cover(center[0], center[1], radius, radius, radius)
+			for i := range 360 {
+				// A point just inside the radius in every direction
+				bearing := float64(i) * math.Pi / 180
+				dLat := degrees(radius * 0.99 / earthRadius * math.Cos(bearing))
+				dLong := degrees(radius * 0.99 / earthRadius * math.Sin(bearing) / math.Cos(radians(center[1])))
+				long, lat := center[0]+dLong, center[1]+dLat
+				if long > LongMax {
+					long -= 360
+				} else if long < LongMin {
+					long += 360
+				}
+				if !Valid(long, lat) || Distance(center[0], center[1], long, lat) > radius {
+					continue
+				}
+
+				hash := Encode(long, lat)
+				covered := false
+				for _, r := range ranges {
+					if hash >= r.Min && hash < r.Max {
+						covered = true
+					}
+				}
+				if !covered {
+					t.Fatalf("%f,%f at %.0f m of %v is not covered", long, lat, radius, center)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,442 @@
+// Package hll implements the HyperLogLog cardinality estimator with the byte layout of Redis, so that a value is
+// interchangeable with one made by Redis (e.g. through GET/SET or DUMP/RESTORE)
+//
+// A value is a 16 bytes header followed by the registers:
+//
+//	+------+---+-----+----------+
+//	| HYLL | E | N/U | Cardin.  |
+//	+------+---+-----+----------+
+//
+// E is the encoding (dense or sparse), the next 3 bytes are unused & the last 8 bytes are the cached cardinality,
+// little endian, with the most significant bit set when the cache is invalid
+// There are 16384 registers of 6 bits, which gives a standard error of 1.04/sqrt(16384) = 0.81%
+package hll
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+const (
+	precision  = 14
+	Registers  = 1 << precision
+	registerQ  = 64 - precision
+	bitsPerReg = 6
+	maxValue   = 1<<bitsPerReg - 1
+
+	headerSize = 16
+	denseSize  = headerSize + (Registers*bitsPerReg+7)/8
+
+	dense  = 0
+	sparse = 1
+
+	// sparseMaxValue is the largest register value the sparse VAL opcode can hold
+	sparseMaxValue = 32
+	// SparseMaxBytes is the size past which a sparse value is converted to dense, hll-sparse-max-bytes in Redis
+	SparseMaxBytes = 3000
+
+	alphaInf = 0.721347520444481703680
+
+	seed = 0xadc83b19
+)
+
+var (
+	// ErrInvalid is returned for a string that is not a HyperLogLog
+	ErrInvalid = errors.New("WRONGTYPE Key is not a valid HyperLogLog string value.")
+	// ErrCorrupt is returned for a HyperLogLog whose sparse registers don't add up
+	ErrCorrupt = errors.New("INVALIDOBJ Corrupted HLL object detected")
+)
+
+// registers holds one register per byte while a value is decoded
+type registers [Registers]uint8
+
+// New returns an empty HyperLogLog, sparse with all its registers at zero & a valid cached cardinality of 0
+func New() []byte {
+	var regs registers
+	b, _ := encodeSparse(&regs)
+	return b
+}
+
+// Valid checks the header of a string, it does not walk the registers
+func Valid(b []byte) bool {
+	if len(b) < headerSize || string(b[:4]) != "HYLL" {
+		return false
+	}
+	switch b[4] {
+	case dense:
+		return len(b) == denseSize
+	case sparse:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsSparse reports whether a value uses the sparse encoding
+func IsSparse(b []byte) bool {
+	return b[4] == sparse
+}
+
+// Add adds elements to a HyperLogLog & returns the new value, with true if any register changed
+// The value given is not modified
+func Add(b []byte, elements ...string) ([]byte, bool, error) {
+	if !Valid(b) {
+		return nil, false, ErrInvalid
+	}
+
+	if b[4] == dense {
+		out := append([]byte(nil), b...)
+		changed := false
+		for _, e := range elements {
+			index, count := position(e)
+			if count > getDense(out[headerSize:], index) {
+				setDense(out[headerSize:], index, count)
+				changed = true
+			}
+		}
+		if changed {
+			invalidate(out)
+		}
+		return out, changed, nil
+	}
+
+	// A sparse value is decoded, updated & encoded again, which is simpler than editing the opcodes in place &
+	// cheap given the cap of SparseMaxBytes
+	regs, err := decode(b)
+	if err != nil {
+		return nil, false, err
+	}
+	changed := false
+	for _, e := range elements {
+		index, count := position(e)
+		if count > regs[index] {
+			regs[index] = count
+			changed = true
+		}
+	}
+	if !changed {
+		return b, false, nil
+	}
+
+	out, ok := encodeSparse(regs)
+	if !ok {
+		out = encodeDense(regs)
+	}
+	invalidate(out)
+	return out, true, nil
+}
+
+// Count returns the estimated cardinality of a HyperLogLog, with the value updated to cache it when the cache was
+// invalid, & true in that case
+func Count(b []byte) (uint64, []byte, bool, error) {
+	if !Valid(b) {
+		return 0, nil, false, ErrInvalid
+	}
+	if b[15]&0x80 == 0 {
+		return binary.LittleEndian.Uint64(b[8:16]), b, false, nil
+	}
+
+	regs, err := decode(b)
+	if err != nil {
+		return 0, nil, false, err
+	}
+	card := estimate(regs)
+
+	out := append([]byte(nil), b...)
+	binary.LittleEndian.PutUint64(out[8:16], card)
+	return card, out, true, nil
+}
+
+// Merge returns the union of HyperLogLogs: the maximum of every register, in a dense value
+// The cardinality of the union is the one of all the elements added to any of them
+func Merge(values ...[]byte) ([]byte, error) {
+	regs, err := union(values)
+	if err != nil {
+		return nil, err
+	}
+	out := encodeDense(regs)
+	invalidate(out)
+	return out, nil
+}
+
+// CountUnion estimates the cardinality of the union of HyperLogLogs without building the merged value
+func CountUnion(values ...[]byte) (uint64, error) {
+	regs, err := union(values)
+	if err != nil {
+		return 0, err
+	}
+	return estimate(regs), nil
+}
+
+func union(values [][]byte) (*registers, error) {
+	var max registers
+	for _, b := range values {
+		if !Valid(b) {
+			return nil, ErrInvalid
+		}
+		regs, err := decode(b)
+		if err != nil {
+			return nil, err
+		}
+		for i, v := range regs {
+			if v > max[i] {
+				max[i] = v
+			}
+		}
+	}
+	return &max, nil
+}
+
+func invalidate(b []byte) {
+	b[15] |= 0x80
+}
+
+// position returns the register of an element & the value it gives the register: the position of the first set bit
+// of the rest of its hash, counting from 1
+func position(element string) (int, uint8) {
+	hash := murmurHash64A([]byte(element), seed)
+	index := int(hash & (Registers - 1))
+	hash >>= precision
+	// The sentinel bit makes sure the count stops at Q+1
+	hash |= 1 << registerQ
+
+	count := uint8(1)
+	for bit := uint64(1); hash&bit == 0; bit <<= 1 {
+		count++
+	}
+	return index, count
+}
+
+// getDense & setDense access a 6 bits register of the dense encoding, stored little endian across 2 bytes
+func getDense(regs []byte, index int) uint8 {
+	byteIndex := index * bitsPerReg / 8
+	fb := uint(index*bitsPerReg) & 7
+	b0 := uint(regs[byteIndex])
+	b1 := uint(0)
+	if byteIndex+1 < len(regs) {
+		b1 = uint(regs[byteIndex+1])
+	}
+	return uint8((b0>>fb | b1<<(8-fb)) & maxValue)
+}
+
+func setDense(regs []byte, index int, value uint8) {
+	byteIndex := index * bitsPerReg / 8
+	fb := uint(index*bitsPerReg) & 7
+	v := uint(value)
+	regs[byteIndex] &^= byte(maxValue << fb)
+	regs[byteIndex] |= byte(v << fb)
+	if byteIndex+1 < len(regs) {
+		regs[byteIndex+1] &^= byte(maxValue >> (8 - fb))
+		regs[byteIndex+1] |= byte(v >> (8 - fb))
+	}
+}
+
+// The opcodes of the sparse encoding:
+//
+//	ZERO  00xxxxxx          a run of xxxxxx+1 registers at 0, up to 64
+//	XZERO 01xxxxxx yyyyyyyy a run of xxxxxxyyyyyyyy+1 registers at 0, up to 16384
+//	VAL   1vvvvvxx          a run of xx+1 registers at vvvvv+1, up to 4 registers with a value up to 32
+const (
+	xzeroBit   = 0x40
+	valBit     = 0x80
+	zeroMaxLen = 64
+	valMaxLen  = 4
+	xzeroMax   = 16384
+)
+
+func decode(b []byte) (*registers, error) {
+	var regs registers
+	if b[4] == dense {
+		for i := range regs {
+			regs[i] = getDense(b[headerSize:], i)
+		}
+		return &regs, nil
+	}
+
+	index := 0
+	for p := headerSize; p < len(b); {
+		op := b[p]
+		switch {
+		case op&valBit != 0:
+			value := (op>>2)&0x1f + 1
+			run := int(op&0x3) + 1
+			if index+run > Registers {
+				return nil, ErrCorrupt
+			}
+			for i := 0; i < run; i++ {
+				regs[index+i] = value
+			}
+			index += run
+			p++
+		case op&xzeroBit != 0:
+			if p+1 >= len(b) {
+				return nil, ErrCorrupt
+			}
+			index += (int(op&0x3f)<<8 | int(b[p+1])) + 1
+			p += 2
+		default:
+			index += int(op&0x3f) + 1
+			p++
+		}
+		if index > Registers {
+			return nil, ErrCorrupt
+		}
+	}
+	if index != Registers {
+		return nil, ErrCorrupt
+	}
+	return &regs, nil
+}
+
+func header(encoding byte) []byte {
+	b := []byte{'H', 'Y', 'L', 'L', encoding, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	return b
+}
+
+func encodeDense(regs *registers) []byte {
+	b := make([]byte, denseSize)
+	copy(b, header(dense))
+	for i, v := range regs {
+		setDense(b[headerSize:], i, v)
+	}
+	return b
+}
+
+// encodeSparse returns false when the registers don't fit the sparse encoding, because a value is too large for a
+// VAL opcode or the result would be larger than SparseMaxBytes
+func encodeSparse(regs *registers) ([]byte, bool) {
+	b := header(sparse)
+	for i := 0; i < Registers; {
+		v := regs[i]
+		run := 1
+		for i+run < Registers && regs[i+run] == v {
+			run++
+		}
+
+		if v == 0 {
+			for left := run; left > 0; {
+				n := min(left, xzeroMax)
+				if n <= zeroMaxLen {
+					b = append(b, byte(n-1))
+				} else {
+					b = append(b, xzeroBit|byte((n-1)>>8), byte(n-1))
+				}
+				left -= n
+			}
+		} else {
+			if v > sparseMaxValue {
+				return nil, false
+			}
+			for left := run; left > 0; {
+				n := min(left, valMaxLen)
+				b = append(b, valBit|(v-1)<<2|byte(n-1))
+				left -= n
+			}
+		}
+
+		if len(b) > SparseMaxBytes {
+			return nil, false
+		}
+		i += run
+	}
+	return b, true
+}
+
+// estimate implements the estimator of Otmar Ertl used by Redis, "New cardinality estimation algorithms for
+// HyperLogLog sketches", which needs no bias correction table
+func estimate(regs *registers) uint64 {
+	var histogram [64]int
+	for _, v := range regs {
+		histogram[v]++
+	}
+
+	m := float64(Registers)
+	z := m * tau((m-float64(histogram[registerQ+1]))/m)
+	for j := registerQ; j >= 1; j-- {
+		z += float64(histogram[j])
+		z *= 0.5
+	}
+	z += m * sigma(float64(histogram[0])/m)
+	return uint64(math.Round(alphaInf * m * m / z))
+}
+
+func sigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+	y, z := 1.0, x
+	for {
+		x *= x
+		prev := z
+		z += x * y
+		y += y
+		if prev == z {
+			return z
+		}
+	}
+}
+
+func tau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+	y, z := 1.0, 1-x
+	for {
+		x = math.Sqrt(x)
+		prev := z
+		y *= 0.5
+		z -= (1 - x) * (1 - x) * y
+		if prev == z {
+			return z / 3
+		}
+	}
+}
+
+// murmurHash64A is the hash Redis uses for the elements, MurmurHash2 64 bits by Austin Appleby
+func murmurHash64A(key []byte, seed uint64) uint64 {
+	const m = 0xc6a4a7935bd1e995
+	const r = 47
+
+	h := seed ^ uint64(len(key))*m
+
+	n := len(key) - len(key)&7
+	for i := 0; i < n; i += 8 {
+		k := binary.LittleEndian.Uint64(key[i:])
+		k *= m
+		k ^= k >> r
+		k *= m
+		h ^= k
+		h *= m
+	}
+
+	tail := key[n:]
+	switch len(tail) {
+	case 7:
+		h ^= uint64(tail[6]) << 48
+		fallthrough
+	case 6:
+		h ^= uint64(tail[5]) << 40
+		fallthrough
+	case 5:
+		h ^= uint64(tail[4]) << 32
+		fallthrough
+	case 4:
+		h ^= uint64(tail[3]) << 24
+		fallthrough
+	case 3:
+		h ^= uint64(tail[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint64(tail[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint64(tail[0])
+		h *= m
+	}
+
+	h ^= h >> r
+	h *= m
+	h ^= h >> r
+	return h
+}
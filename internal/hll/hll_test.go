@@ -0,0 +1,163 @@
+package hll
+
+import (
+	"encoding/binary"
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestEmpty(t *testing.T) {
+	b := New()
+
+	// The empty value of Redis: the header & a single XZERO opcode covering the 16384 registers
+	want := "HYLL\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x7f\xff"
+	if string(b) != want {
+		t.Fatalf("New() = %q, want %q", b, want)
+	}
+	card, _, updated, err := Count(b)
+	if err != nil || card != 0 || updated {
+		t.Errorf("Count of an empty value = %d, %v, %v, want a cached 0", card, updated, err)
+	}
+}
+
+func TestError(t *testing.T) {
+	b := New()
+	next := 0
+	for _, n := range []int{10, 100, 1000, 10000, 100000} {
+		elements := make([]string, 0, n-next)
+		for ; next < n; next++ {
+			elements = append(elements, "element:"+strconv.Itoa(next))
+		}
+
+		var err error
+		b, _, err = Add(b, elements...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		card, _, _, err := Count(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// 3 times the standard error of 0.81%
+		if diff := math.Abs(float64(card)-float64(n)) / float64(n); diff > 0.025 {
+			t.Errorf("Count after %d elements = %d, off by %.2f%%", n, card, diff*100)
+		}
+	}
+}
+
+func TestPromotion(t *testing.T) {
+	b := New()
+	for i := 0; IsSparse(b); i++ {
+		var err error
+		b, _, err = Add(b, strconv.Itoa(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if IsSparse(b) && len(b) > SparseMaxBytes {
+			t.Fatalf("sparse value of %d bytes", len(b))
+		}
+	}
+	if len(b) != denseSize {
+		t.Fatalf("dense value of %d bytes, want %d", len(b), denseSize)
+	}
+
+	// The promotion keeps the registers
+	card, _, _, _ := Count(b)
+	before := card
+	b, changed, _ := Add(b, "0", "1", "2")
+	if changed {
+		t.Error("adding elements already counted changed a register")
+	}
+	if card, _, _, _ = Count(b); card != before {
+		t.Errorf("Count = %d after adding known elements, want %d", card, before)
+	}
+}
+
+func TestRegisters(t *testing.T) {
+	var regs registers
+	for i := range regs {
+		regs[i] = uint8(i % 64)
+	}
+	got, err := decode(encodeDense(&regs))
+	if err != nil || *got != regs {
+		t.Error("the dense encoding does not round trip")
+	}
+
+	// A few registers with every value a VAL opcode can hold, then runs of zeros longer than a ZERO opcode
+	for i := range regs {
+		regs[i] = 0
+		if i < 1000 {
+			regs[i] = uint8(i % 33)
+		}
+	}
+	sparseValue, ok := encodeSparse(&regs)
+	if !ok {
+		t.Fatal("the registers don't fit the sparse encoding")
+	}
+	got, err = decode(sparseValue)
+	if err != nil || *got != regs {
+		t.Error("the sparse encoding does not round trip")
+	}
+
+	regs[0] = sparseMaxValue + 1
+	if _, ok := encodeSparse(&regs); ok {
+		t.Error("a register over 32 was encoded as sparse")
+	}
+}
+
+func TestCache(t *testing.T) {
+	b, _, _ := Add(New(), "a", "b", "c")
+	if b[15]&0x80 == 0 {
+		t.Fatal("the cache is valid after a change")
+	}
+
+	card, b, updated, err := Count(b)
+	if err != nil || card != 3 || !updated {
+		t.Fatalf("Count = %d, %v, %v, want 3 & the cache updated", card, updated, err)
+	}
+	if cached := binary.LittleEndian.Uint64(b[8:16]); cached != 3 {
+		t.Errorf("cached cardinality = %d, want 3", cached)
+	}
+	if _, _, updated, _ := Count(b); updated {
+		t.Error("Count computed a cached cardinality again")
+	}
+
+	if _, changed, _ := Add(b, "a"); changed {
+		t.Error("adding a known element changed a register")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	a, _, _ := Add(New(), "foo", "bar", "zap", "a")
+	b, _, _ := Add(New(), "a", "b", "c", "foo")
+
+	if card, err := CountUnion(a, b); err != nil || card != 6 {
+		t.Errorf("CountUnion = %d, %v, want 6", card, err)
+	}
+	merged, err := Merge(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if IsSparse(merged) {
+		t.Error("the merged value is sparse")
+	}
+	if card, _, _, _ := Count(merged); card != 6 {
+		t.Errorf("Count of the merged value = %d, want 6", card)
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	for _, b := range []string{"", "hello", "HYLL\x02\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00", "HYLL\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"} {
+		if _, _, err := Add([]byte(b)); err != ErrInvalid {
+			t.Errorf("Add(%q) = %v, want ErrInvalid", b, err)
+		}
+	}
+
+	// A sparse value whose opcodes don't cover the 16384 registers
+	corrupt := "HYLL\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x80\x3f"
+	if _, _, _, err := Count([]byte(corrupt)); err != ErrCorrupt {
+		t.Errorf("Count of a corrupt value = %v, want ErrCorrupt", err)
+	}
+}
@@ -0,0 +1,130 @@
+// Package metrics writes metrics in the Prometheus text exposition format, & keeps the latency histograms behind them
+//
+// A metric family is a # HELP & a # TYPE line followed by its samples, one per set of labels:
+//
+//	# HELP pulsedb_commands_total Commands run
+//	# TYPE pulsedb_commands_total counter
+//	pulsedb_commands_total{cmd="get"} 12
+package metrics
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Kinds of metric families
+const (
+	Counter   = "counter"
+	Gauge     = "gauge"
+	Histogram = "histogram"
+)
+
+// latencyBuckets are the upper bounds of the buckets of a Latency, in seconds
+var latencyBuckets = [...]float64{0.00001, 0.00005, 0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Latency is a histogram of durations, from 10µs to 10s, it is ready to use at its zero value & safe for concurrent use
+type Latency struct {
+	// counts holds the observations of every bucket, the last one is +Inf
+	counts [len(latencyBuckets) + 1]atomic.Uint64
+	sum    atomic.Int64
+}
+
+// Observe adds a duration to the histogram
+func (l *Latency) Observe(d time.Duration) {
+	seconds := d.Seconds()
+	i := 0
+	for i < len(latencyBuckets) && seconds > latencyBuckets[i] {
+		i++
+	}
+	l.counts[i].Add(1)
+	l.sum.Add(int64(d))
+}
+
+// Count returns the number of observations
+func (l *Latency) Count() uint64 {
+	var n uint64
+	for i := range l.counts {
+		n += l.counts[i].Load()
+	}
+	return n
+}
+
+// Reset removes every observation
+func (l *Latency) Reset() {
+	for i := range l.counts {
+		l.counts[i].Store(0)
+	}
+	l.sum.Store(0)
+}
+
+// Writer builds an exposition
+type Writer struct {
+	sb strings.Builder
+}
+
+// Family starts a metric family, its samples must follow it
+func (w *Writer) Family(name, kind, help string) {
+	w.sb.WriteString("# HELP " + name + " " + help + "\n")
+	w.sb.WriteString("# TYPE " + name + " " + kind + "\n")
+}
+
+// Sample writes a sample, labels are name & value pairs
+func (w *Writer) Sample(name string, value float64, labels ...string) {
+	w.sb.WriteString(name)
+	w.writeLabels(labels)
+	w.sb.WriteString(" " + formatValue(value) + "\n")
+}
+
+// Latency writes the buckets, the sum & the count of a histogram, labels are name & value pairs
+func (w *Writer) Latency(name string, l *Latency, labels ...string) {
+	var cumulative uint64
+	for i := range l.counts {
+		cumulative += l.counts[i].Load()
+		le := math.Inf(1)
+		if i < len(latencyBuckets) {
+			le = latencyBuckets[i]
+		}
+		w.Sample(name+"_bucket", float64(cumulative), append(labels[:len(labels):len(labels)], "le", formatValue(le))...)
+	}
+	w.Sample(name+"_sum", time.Duration(l.sum.Load()).Seconds(), labels...)
+	w.Sample(name+"_count", float64(cumulative), labels...)
+}
+
+// String returns the exposition written so far
+func (w *Writer) String() string {
+	return w.sb.String()
+}
+
+func (w *Writer) writeLabels(labels []string) {
+	if len(labels) == 0 {
+		return
+	}
+	w.sb.WriteByte('{')
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i > 0 {
+			w.sb.WriteByte(',')
+		}
+		w.sb.WriteString(labels[i] + `="` + escapeLabel(labels[i+1]) + `"`)
+	}
+	w.sb.WriteByte('}')
+}
+
+// escapeLabel escapes the backslashes, the double quotes & the line feeds of a label value
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
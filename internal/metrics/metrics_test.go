@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLatency(t *testing.T) {
+	var l Latency
+	l.Observe(5 * time.Microsecond)
+	l.Observe(time.Millisecond)
+	l.Observe(time.Minute)
+
+	var w Writer
+	w.Family("op_duration_seconds", Histogram, "Duration of the operations.")
+	w.Latency("op_duration_seconds", &l, "op", "get")
+	got := w.String()
+
+	for _, line := range []string{
+		"# TYPE op_duration_seconds histogram\n",
+		`op_duration_seconds_bucket{op="get",le="1e-05"} 1` + "\n",
+		`op_duration_seconds_bucket{op="get",le="0.0005"} 1` + "\n",
+		// A duration equal to a bound goes into its bucket
+		`op_duration_seconds_bucket{op="get",le="0.001"} 2` + "\n",
+		`op_duration_seconds_bucket{op="get",le="10"} 2` + "\n",
+		`op_duration_seconds_bucket{op="get",le="+Inf"} 3` + "\n",
+		`op_duration_seconds_sum{op="get"} 60.001005` + "\n",
+		`op_duration_seconds_count{op="get"} 3` + "\n",
+	} {
+		if !strings.Contains(got, line) {
+			t.Errorf("exposition has no %q:\n%s", line, got)
+		}
+	}
+
+	if l.Count() != 3 {
+		t.Errorf("Count() = %d", l.Count())
+	}
+	l.Reset()
+	if l.Count() != 0 {
+		t.Errorf("Count() after Reset = %d", l.Count())
+	}
+}
+
+func TestSample(t *testing.T) {
+	var w Writer
+	w.Sample("keys", 3, "db", "0")
+	w.Sample("name", 1, "value", "a \"quoted\" \\ line\n")
+	w.Sample("ratio", 0.25)
+
+	want := "keys{db=\"0\"} 3\n" + `name{value="a \"quoted\" \\ line\n"} 1` + "\nratio 0.25\n"
+	if w.String() != want {
+		t.Errorf("exposition = %q, want %q", w.String(), want)
+	}
+}
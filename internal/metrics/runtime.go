@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"runtime"
+	"time"
+)
+
+// startTime is when the process started, as near as the package can tell
+var startTime = time.Now()
+
+// Runtime writes the metrics of the Go runtime, under the names used by the Prometheus Go client
+func (w *Writer) Runtime() {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	w.Family("go_info", Gauge, "Information about the Go environment.")
+	w.Sample("go_info", 1, "version", runtime.Version())
+	w.Family("go_goroutines", Gauge, "Number of goroutines that currently exist.")
+	w.Sample("go_goroutines", float64(runtime.NumGoroutine()))
+
+	for _, m := range []struct {
+		name, kind, help string
+		value            uint64
+	}{
+		{"go_memstats_alloc_bytes", Gauge, "Number of bytes allocated and still in use.", ms.Alloc},
+		{"go_memstats_alloc_bytes_total", Counter, "Total number of bytes allocated, even if freed.", ms.TotalAlloc},
+		{"go_memstats_sys_bytes", Gauge, "Number of bytes obtained from system.", ms.Sys},
+		{"go_memstats_mallocs_total", Counter, "Total number of mallocs.", ms.Mallocs},
+		{"go_memstats_frees_total", Counter, "Total number of frees.", ms.Frees},
+		{"go_memstats_heap_alloc_bytes", Gauge, "Number of heap bytes allocated and still in use.", ms.HeapAlloc},
+		{"go_memstats_heap_sys_bytes", Gauge, "Number of heap bytes obtained from system.", ms.HeapSys},
+		{"go_memstats_heap_idle_bytes", Gauge, "Number of heap bytes waiting to be used.", ms.HeapIdle},
+		{"go_memstats_heap_inuse_bytes", Gauge, "Number of heap bytes that are in use.", ms.HeapInuse},
+		{"go_memstats_heap_released_bytes", Gauge, "Number of heap bytes released to OS.", ms.HeapReleased},
+		{"go_memstats_heap_objects", Gauge, "Number of allocated objects.", ms.HeapObjects},
+		{"go_memstats_stack_inuse_bytes", Gauge, "Number of bytes in use by the stack allocator.", ms.StackInuse},
+		{"go_memstats_next_gc_bytes", Gauge, "Number of heap bytes when next garbage collection will take place.", ms.NextGC},
+		{"go_gc_cycles_total", Counter, "Number of completed GC cycles.", uint64(ms.NumGC)},
+	} {
+		w.Family(m.name, m.kind, m.help)
+		w.Sample(m.name, float64(m.value))
+	}
+
+	w.Family("go_gc_pause_seconds_total", Counter, "Total time the world was stopped by the garbage collector.")
+	w.Sample("go_gc_pause_seconds_total", time.Duration(ms.PauseTotalNs).Seconds())
+	w.Family("go_memstats_last_gc_time_seconds", Gauge, "Number of seconds since 1970 of last garbage collection.")
+	w.Sample("go_memstats_last_gc_time_seconds", float64(ms.LastGC)/1e9)
+	w.Family("process_start_time_seconds", Gauge, "Start time of the process since unix epoch in seconds.")
+	w.Sample("process_start_time_seconds", float64(startTime.UnixNano())/1e9)
+}
@@ -153,6 +153,18 @@ func TestDeserializeBulkString(t *testing.T) {
 			want:    BulkString{Value: "", Length: 0},
 			wantErr: false,
 		},
+		{
+			name:    "BulkString with CRLFs",
+			input:   "$12\r\na\r\nbc\r\n\r\nd\r\n\r\n",
+			want:    BulkString{Value: "a\r\nbc\r\n\r\nd\r\n", Length: 12},
+			wantErr: false,
+		},
+		{
+			name:    "Too short BulkString with CRLFs",
+			input:   "$12\r\na\r\nb\r\n",
+			want:    nil,
+			wantErr: true,
+		},
 		{
 			name:    "Invalid Length",
 			input:   "$3\r\nhello\r\n",
@@ -126,27 +126,25 @@ func DeserializeBulkString(commands []string) (BulkString, int, error) {
 	elementsUsed := 0
 
 	for _, v := range commands[1:] {
-		if len(v) > bsLen {
-			return BulkString{}, 0, errors.New("invalid Bulk String: length mismatch")
-		} else if len(v) == bsLen {
+		elementsUsed++
+		if len(v) >= bsLen {
+			if len(v) > bsLen {
+				return BulkString{}, 0, errors.New("invalid Bulk String: length mismatch")
+			}
 			str += v
-			elementsUsed++
 			bsLen = 0
 			break
-		} else {
-			str += v
-			elementsUsed++
-			str += "\r"
-			bsLen -= len(str)
-
-			if bsLen != 0 {
-				str += "\n"
-				bsLen--
-				if bsLen == 0 {
-					break
-				}
-			}
 		}
+
+		// The string holds a "\r\n", which was removed when the command was split
+		str += v + "\r\n"
+		bsLen -= len(v) + 2
+		if bsLen < 0 {
+			return BulkString{}, 0, errors.New("invalid Bulk String: length mismatch")
+		}
+	}
+	if bsLen != 0 {
+		return BulkString{}, 0, errors.New("invalid Bulk String: length mismatch")
 	}
 
 	return BulkString{Value: str, Length: bsLenCopy}, elementsUsed, nil
@@ -0,0 +1,136 @@
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// MaxBulkLength is the largest BulkString a Reader accepts, like proto-max-bulk-len in Redis
+const MaxBulkLength = 512 << 20
+
+// MaxArrayLength is the largest number of items of an Array a Reader accepts, like the multibulk limit of Redis
+const MaxArrayLength = 1 << 20
+
+// Reader reads RESP values one at a time from a stream, e.g. a client connection
+type Reader struct {
+	rd *bufio.Reader
+}
+
+// NewReader creates a Reader on top of r
+func NewReader(r io.Reader) *Reader {
+	return &Reader{rd: bufio.NewReader(r)}
+}
+
+// Buffered returns the number of bytes that were read from the stream but not consumed yet
+func (r *Reader) Buffered() int {
+	return r.rd.Buffered()
+}
+
+// Discard skips the next n bytes of the stream, such as a separator between values
+func (r *Reader) Discard(n int) (int, error) {
+	return r.rd.Discard(n)
+}
+
+// ReadValue reads the next value from the stream
+// It also returns the number of bytes used by the value, which is needed to track replication offsets
+func (r *Reader) ReadValue() (Type, int, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, 0, err
+	}
+	n := len(line) + 2
+
+	if len(line) == 0 {
+		return nil, n, errors.New("empty input")
+	}
+
+	switch line[0] {
+	case '+':
+		return SimpleString{Value: line[1:]}, n, nil
+	case '-':
+		return SimpleError{Value: line[1:]}, n, nil
+	case ':':
+		num, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, n, err
+		}
+		return Integer{Value: num}, n, nil
+	case '_':
+		return Null{}, n, nil
+	case '$':
+		length, err := readLength(line[1:], MaxBulkLength)
+		if err != nil {
+			return nil, n, fmt.Errorf("invalid bulk length: %w", err)
+		}
+		if length < 0 {
+			return Null{}, n, nil
+		}
+
+		buf := make([]byte, length+2)
+		_, err = io.ReadFull(r.rd, buf)
+		if err != nil {
+			return nil, n, err
+		}
+		if buf[length] != '\r' || buf[length+1] != '\n' {
+			return nil, n, errors.New("invalid Bulk String: length mismatch")
+		}
+		return BulkString{Value: string(buf[:length]), Length: length}, n + length + 2, nil
+	case '*':
+		length, err := readLength(line[1:], MaxArrayLength)
+		if err != nil {
+			return nil, n, fmt.Errorf("invalid multibulk length: %w", err)
+		}
+		if length < 0 {
+			return Null{}, n, nil
+		}
+
+		items := make([]Type, length)
+		for i := range length {
+			v, used, err := r.ReadValue()
+			n += used
+			if err != nil {
+				return nil, n, err
+			}
+			items[i] = v
+		}
+		return Array{Length: length, Items: items}, n, nil
+	default:
+		return nil, n, errors.New("invalid datatype")
+	}
+}
+
+// readLength parses the length of a BulkString or an Array, -1 is the only negative length & stands for a Null
+// The length is checked before anything is allocated for the value
+func readLength(s string, limit int) (int, error) {
+	length, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+	if length < -1 {
+		return 0, errors.New("negative length")
+	}
+	if length > limit {
+		return 0, fmt.Errorf("%d is larger than %d", length, limit)
+	}
+	return length, nil
+}
+
+// readLine reads a line terminated by CRLF, and returns it without the CRLF
+func (r *Reader) readLine() (string, error) {
+	line, err := r.rd.ReadString('\n')
+	if err != nil {
+		if err == io.EOF && len(line) > 0 {
+			return "", io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+
+	if !strings.HasSuffix(line, "\r\n") {
+		return "", errors.New("no CRLF")
+	}
+	return line[:len(line)-2], nil
+}
@@ -0,0 +1,119 @@
+package resp
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReaderReadValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		want     Type
+		wantUsed int
+		wantErr  bool
+	}{
+		{
+			name:     "SimpleString",
+			input:    "+OK\r\n",
+			want:     SimpleString{Value: "OK"},
+			wantUsed: 5,
+		},
+		{
+			name:     "Integer",
+			input:    ":-42\r\n",
+			want:     Integer{Value: -42},
+			wantUsed: 6,
+		},
+		{
+			name:     "BulkString with CRLF inside",
+			input:    "$7\r\nab\r\ncde\r\n",
+			want:     BulkString{Value: "ab\r\ncde", Length: 7},
+			wantUsed: 13,
+		},
+		{
+			name:     "Null BulkString",
+			input:    "$-1\r\n",
+			want:     Null{},
+			wantUsed: 5,
+		},
+		{
+			name:  "Array",
+			input: "*2\r\n$3\r\nGET\r\n$3\r\nkey\r\n",
+			want: Array{Length: 2, Items: []Type{
+				BulkString{Value: "GET", Length: 3},
+				BulkString{Value: "key", Length: 3},
+			}},
+			wantUsed: 22,
+		},
+		{
+			name:    "BulkString length mismatch",
+			input:   "$2\r\nabc\r\n",
+			wantErr: true,
+		},
+		{
+			name:    "Incomplete Array",
+			input:   "*2\r\n$3\r\nGET\r\n",
+			wantErr: true,
+		},
+		{
+			name:    "BulkString longer than the limit",
+			input:   "$9223372036854775807\r\n",
+			wantErr: true,
+		},
+		{
+			name:    "Negative BulkString length",
+			input:   "$-2\r\n",
+			wantErr: true,
+		},
+		{
+			name:    "Array longer than the limit",
+			input:   "*2000000\r\n",
+			wantErr: true,
+		},
+		{
+			name:    "Overflowing Array length",
+			input:   "*99999999999999999999\r\n",
+			wantErr: true,
+		},
+		{
+			name:    "No CRLF",
+			input:   "+OK\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, used, err := NewReader(strings.NewReader(tt.input)).ReadValue()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadValue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadValue() = %v, want %v", got, tt.want)
+			}
+			if used != tt.wantUsed {
+				t.Errorf("ReadValue() used %d bytes, want %d", used, tt.wantUsed)
+			}
+		})
+	}
+}
+
+func TestReaderPipeline(t *testing.T) {
+	r := NewReader(strings.NewReader("*1\r\n$4\r\nPING\r\n*2\r\n$4\r\nECHO\r\n$2\r\nhi\r\n"))
+
+	for range 2 {
+		if _, _, err := r.ReadValue(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	if _, _, err := r.ReadValue(); err != io.EOF {
+		t.Errorf("Expected io.EOF after the last value, got %v", err)
+	}
+}
@@ -0,0 +1,891 @@
+package sentinel
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	mrand "math/rand/v2"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DNahar74/PulseDB/internal/resp"
+	"github.com/DNahar74/PulseDB/internal/utils"
+)
+
+// Config holds the settings of a sentinel
+type Config struct {
+	// Address is where the sentinel listens for clients & other sentinels
+	Address string
+	// Name is the name clients use to ask for the primary
+	Name string
+	// MasterAddr is the initial address of the monitored primary
+	MasterAddr string
+	// Quorum is the number of sentinels that must agree that the primary is down
+	Quorum int
+	// Peers are the addresses of the other sentinels monitoring the same primary
+	Peers []string
+	// AuthPass is the password of the primary & its replicas, sent with AUTH when it is not empty
+	AuthPass string
+	// RequirePass is the password clients & peers must AUTH with, the sentinels monitoring the same primary share it
+	RequirePass string
+
+	// DownAfter is how long an instance may not answer before it is considered down
+	DownAfter time.Duration
+	// FailoverTimeout is how long to wait before retrying a failover that did not complete
+	FailoverTimeout time.Duration
+
+	PingPeriod  time.Duration
+	InfoPeriod  time.Duration
+	HelloPeriod time.Duration
+}
+
+// DefaultConfig returns the default settings, to be completed with the primary & the peers
+func DefaultConfig() Config {
+	return Config{
+		Address:         "0.0.0.0:26379",
+		Name:            "mymaster",
+		Quorum:          2,
+		DownAfter:       30 * time.Second,
+		FailoverTimeout: 3 * time.Minute,
+		PingPeriod:      1 * time.Second,
+		InfoPeriod:      10 * time.Second,
+		HelloPeriod:     2 * time.Second,
+	}
+}
+
+// instance is a primary or replica monitored by the sentinel
+type instance struct {
+	addr string
+
+	lastOK   time.Time
+	lastInfo time.Time
+
+	// Fields reported by INFO replication
+	role       string
+	masterAddr string
+	linkUp     bool
+	offset     int64
+}
+
+func (i *instance) down(after time.Duration) bool {
+	return time.Since(i.lastOK) > after
+}
+
+// Sentinel monitors a primary & its replicas, and promotes a replica when the primary fails
+type Sentinel struct {
+	cfg   Config
+	runID string
+
+	mu sync.Mutex
+
+	// currentEpoch is the latest election epoch seen, configEpoch the epoch of the current primary address
+	currentEpoch int64
+	configEpoch  int64
+
+	// The vote cast by this sentinel, at most one leader per epoch
+	leader      string
+	leaderEpoch int64
+
+	master   *instance
+	replicas map[string]*instance
+
+	// failoverStart is set while a failover started or voted for by this sentinel may be in progress
+	failoverStart time.Time
+
+	listener net.Listener
+	stop     chan struct{}
+}
+
+// New creates a sentinel for the given configuration
+func New(cfg Config) *Sentinel {
+	b := make([]byte, 20)
+	_, _ = rand.Read(b)
+
+	return &Sentinel{
+		cfg:      cfg,
+		runID:    hex.EncodeToString(b),
+		master:   &instance{addr: cfg.MasterAddr, lastOK: time.Now(), role: "master"},
+		replicas: make(map[string]*instance),
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start listens for clients & starts monitoring, it blocks until Close is called
+func (s *Sentinel) Start() error {
+	listener, err := net.Listen("tcp", s.cfg.Address)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.listener = listener
+	s.mu.Unlock()
+
+	fmt.Printf("Sentinel %s monitoring %s at %s, quorum %d\n", s.runID, s.cfg.Name, s.cfg.MasterAddr, s.cfg.Quorum)
+
+	go s.monitor()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-s.stop:
+				return nil
+			default:
+				return err
+			}
+		}
+
+		go s.handleConnection(conn)
+	}
+}
+
+// Close stops the sentinel
+func (s *Sentinel) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case <-s.stop:
+		return nil
+	default:
+	}
+
+	close(s.stop)
+	if s.listener != nil {
+		return s.listener.Close()
+	}
+	return nil
+}
+
+// MasterAddr returns the address of the current primary
+func (s *Sentinel) MasterAddr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.master.addr
+}
+
+//* Monitoring *//
+
+func (s *Sentinel) monitor() {
+	ping := time.NewTicker(s.cfg.PingPeriod)
+	info := time.NewTicker(s.cfg.InfoPeriod)
+	hello := time.NewTicker(s.cfg.HelloPeriod)
+	defer ping.Stop()
+	defer info.Stop()
+	defer hello.Stop()
+
+	s.refreshInfo()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ping.C:
+			s.pingInstances()
+			s.checkMaster()
+		case <-info.C:
+			s.refreshInfo()
+		case <-hello.C:
+			s.sendHello()
+		}
+	}
+}
+
+// instances returns the addresses of the primary & of the replicas
+func (s *Sentinel) instances() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	addrs := []string{s.master.addr}
+	for addr := range s.replicas {
+		addrs = append(addrs, addr)
+	}
+	return addrs
+}
+
+// lookup returns the monitored instance with this address, the caller must hold the lock
+func (s *Sentinel) lookup(addr string) *instance {
+	if s.master.addr == addr {
+		return s.master
+	}
+	return s.replicas[addr]
+}
+
+func (s *Sentinel) pingInstances() {
+	var wg sync.WaitGroup
+
+	for _, addr := range s.instances() {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+
+			reply, err := s.requestInstance(addr, "PING")
+			if err != nil {
+				return
+			}
+			if str, ok := reply.(resp.SimpleString); !ok || str.Value != "PONG" {
+				return
+			}
+
+			s.mu.Lock()
+			if inst := s.lookup(addr); inst != nil {
+				inst.lastOK = time.Now()
+			}
+			s.mu.Unlock()
+		}(addr)
+	}
+
+	wg.Wait()
+}
+
+// refreshInfo reads INFO replication from every instance, to discover replicas & their offsets
+func (s *Sentinel) refreshInfo() {
+	for _, addr := range s.instances() {
+		reply, err := s.requestInstance(addr, "INFO", "replication")
+		if err != nil {
+			continue
+		}
+		bs, ok := reply.(resp.BulkString)
+		if !ok {
+			continue
+		}
+
+		s.applyInfo(addr, parseInfo(bs.Value))
+	}
+}
+
+func (s *Sentinel) applyInfo(addr string, info map[string]string) {
+	s.mu.Lock()
+
+	inst := s.lookup(addr)
+	if inst == nil {
+		s.mu.Unlock()
+		return
+	}
+
+	inst.lastInfo = time.Now()
+	inst.role = info["role"]
+	inst.linkUp = info["master_link_status"] == "up"
+	inst.offset, _ = strconv.ParseInt(info["slave_repl_offset"], 10, 64)
+	inst.masterAddr = ""
+	if info["master_host"] != "" {
+		inst.masterAddr = net.JoinHostPort(info["master_host"], info["master_port"])
+	}
+
+	// The primary lists its replicas, which are added to the monitored instances
+	if inst == s.master {
+		for key, value := range info {
+			if !strings.HasPrefix(key, "slave") || !strings.Contains(value, "ip=") {
+				continue
+			}
+			fields := parseFields(value)
+			replicaAddr := net.JoinHostPort(fields["ip"], fields["port"])
+			if _, ok := s.replicas[replicaAddr]; !ok && replicaAddr != s.master.addr {
+				fmt.Println("Sentinel discovered replica", replicaAddr)
+				s.replicas[replicaAddr] = &instance{addr: replicaAddr, lastOK: time.Now()}
+			}
+		}
+	}
+
+	// Instances that disagree with the current configuration are fixed, unless the primary is down
+	reconfigure := inst != s.master && !s.master.down(s.cfg.DownAfter) && !s.failoverInProgress() &&
+		(inst.role == "master" || inst.masterAddr != s.master.addr)
+	masterAddr := s.master.addr
+
+	s.mu.Unlock()
+
+	if reconfigure {
+		fmt.Printf("Sentinel reconfiguring %s as a replica of %s\n", addr, masterAddr)
+		s.replicaOf(addr, masterAddr)
+	}
+}
+
+// checkMaster starts a failover when enough sentinels agree that the primary is down
+func (s *Sentinel) checkMaster() {
+	s.mu.Lock()
+	sdown := s.master.down(s.cfg.DownAfter)
+	masterAddr := s.master.addr
+	inFailover := s.failoverInProgress()
+	s.mu.Unlock()
+
+	if !sdown || inFailover {
+		return
+	}
+
+	// Objectively down: a quorum of sentinels, including this one, sees the primary as down
+	votes := 1
+	for _, reply := range s.askPeers(masterAddr, 0, "*") {
+		if reply.down {
+			votes++
+		}
+	}
+	if votes < s.cfg.Quorum {
+		return
+	}
+
+	fmt.Printf("Sentinel +odown %s %s #quorum %d/%d\n", s.cfg.Name, masterAddr, votes, s.cfg.Quorum)
+
+	// A random delay makes it unlikely that several sentinels split the votes of the same epoch
+	time.Sleep(mrand.N(s.cfg.PingPeriod))
+
+	// Elect a leader for a new epoch, only the leader performs the failover
+	s.mu.Lock()
+	if s.failoverInProgress() || s.master.addr != masterAddr || !s.master.down(s.cfg.DownAfter) {
+		s.mu.Unlock()
+		return
+	}
+	s.currentEpoch++
+	epoch := s.currentEpoch
+	s.leader, s.leaderEpoch = s.runID, epoch
+	s.failoverStart = time.Now()
+	s.mu.Unlock()
+
+	leaderVotes := 1
+	for _, reply := range s.askPeers(masterAddr, epoch, s.runID) {
+		if reply.leader == s.runID && reply.leaderEpoch == epoch {
+			leaderVotes++
+		}
+	}
+
+	needed := max(s.cfg.Quorum, (len(s.cfg.Peers)+1)/2+1)
+	if leaderVotes < needed {
+		fmt.Printf("Sentinel lost the election for epoch %d with %d/%d votes\n", epoch, leaderVotes, needed)
+		return
+	}
+
+	fmt.Printf("Sentinel elected leader for epoch %d with %d/%d votes\n", epoch, leaderVotes, needed)
+	s.failover(masterAddr, epoch)
+}
+
+// failoverInProgress is true while a failover may be running, the caller must hold the lock
+func (s *Sentinel) failoverInProgress() bool {
+	return !s.failoverStart.IsZero() && time.Since(s.failoverStart) < s.cfg.FailoverTimeout
+}
+
+// failover promotes the best replica & points the other instances to it
+func (s *Sentinel) failover(oldMaster string, epoch int64) {
+	promoted := s.selectReplica()
+	if promoted == "" {
+		fmt.Println("Sentinel -failover-abort-no-good-slave")
+		return
+	}
+
+	fmt.Println("Sentinel +selected-slave", promoted)
+
+	_, err := s.requestInstance(promoted, "REPLICAOF", "NO", "ONE")
+	if err != nil {
+		fmt.Println("Sentinel failed to promote", promoted, err)
+		return
+	}
+
+	// Wait for the replica to report itself as a primary
+	deadline := time.Now().Add(s.cfg.FailoverTimeout)
+	for !s.isMaster(promoted) {
+		if time.Now().After(deadline) {
+			fmt.Println("Sentinel -failover-abort-slave-timeout", promoted)
+			return
+		}
+		time.Sleep(s.cfg.PingPeriod)
+	}
+
+	s.mu.Lock()
+	s.switchMaster(promoted, oldMaster, epoch)
+	others := make([]string, 0)
+	for addr := range s.replicas {
+		if addr != oldMaster {
+			others = append(others, addr)
+		}
+	}
+	s.failoverStart = time.Time{}
+	s.mu.Unlock()
+
+	for _, addr := range others {
+		s.replicaOf(addr, promoted)
+	}
+
+	fmt.Printf("Sentinel +switch-master %s %s %s\n", s.cfg.Name, oldMaster, promoted)
+	s.sendHello()
+}
+
+func (s *Sentinel) isMaster(addr string) bool {
+	reply, err := s.requestInstance(addr, "ROLE")
+	if err != nil {
+		return false
+	}
+
+	arr, ok := reply.(resp.Array)
+	if !ok || len(arr.Items) == 0 {
+		return false
+	}
+	role, ok := arr.Items[0].(resp.BulkString)
+	return ok && role.Value == "master"
+}
+
+// switchMaster updates the configuration to a new primary, the caller must hold the lock
+// The old primary is kept as a replica, so that it is reconfigured when it comes back
+func (s *Sentinel) switchMaster(newMaster, oldMaster string, epoch int64) {
+	s.configEpoch = epoch
+	if epoch > s.currentEpoch {
+		s.currentEpoch = epoch
+	}
+
+	delete(s.replicas, newMaster)
+	s.replicas[oldMaster] = &instance{addr: oldMaster, lastOK: s.master.lastOK}
+	s.master = &instance{addr: newMaster, lastOK: time.Now(), role: "master"}
+}
+
+// selectReplica picks the replica to promote: a reachable one with the largest replication offset
+func (s *Sentinel) selectReplica() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	candidates := make([]*instance, 0)
+	for _, inst := range s.replicas {
+		if inst.down(s.cfg.DownAfter) || inst.lastInfo.IsZero() || inst.role != "slave" {
+			continue
+		}
+		candidates = append(candidates, inst)
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].offset != candidates[j].offset {
+			return candidates[i].offset > candidates[j].offset
+		}
+		return candidates[i].addr < candidates[j].addr
+	})
+
+	return candidates[0].addr
+}
+
+func (s *Sentinel) replicaOf(addr, masterAddr string) {
+	host, port, err := net.SplitHostPort(masterAddr)
+	if err != nil {
+		return
+	}
+
+	_, err = s.requestInstance(addr, "REPLICAOF", host, port)
+	if err != nil {
+		fmt.Println("Sentinel failed to reconfigure", addr, err)
+	}
+}
+
+//* Talking to the other sentinels *//
+
+type downReply struct {
+	down        bool
+	leader      string
+	leaderEpoch int64
+}
+
+// askPeers sends SENTINEL is-master-down-by-addr to every peer
+// With a runID instead of "*", the peers also vote for this sentinel as the leader of the epoch
+func (s *Sentinel) askPeers(masterAddr string, epoch int64, runID string) []downReply {
+	host, port, err := net.SplitHostPort(masterAddr)
+	if err != nil {
+		return nil
+	}
+
+	replies := make([]downReply, len(s.cfg.Peers))
+	var wg sync.WaitGroup
+
+	for i, peer := range s.cfg.Peers {
+		wg.Add(1)
+		go func(i int, peer string) {
+			defer wg.Done()
+
+			reply, err := s.request(peer, "SENTINEL", "is-master-down-by-addr", host, port, strconv.FormatInt(epoch, 10), runID)
+			if err != nil {
+				return
+			}
+			arr, ok := reply.(resp.Array)
+			if !ok || len(arr.Items) != 3 {
+				return
+			}
+
+			down, _ := arr.Items[0].(resp.Integer)
+			leader, _ := arr.Items[1].(resp.BulkString)
+			leaderEpoch, _ := arr.Items[2].(resp.Integer)
+			replies[i] = downReply{down: down.Value == 1, leader: leader.Value, leaderEpoch: int64(leaderEpoch.Value)}
+		}(i, peer)
+	}
+
+	wg.Wait()
+	return replies
+}
+
+// sendHello shares the current primary & its config epoch with the peers
+func (s *Sentinel) sendHello() {
+	s.mu.Lock()
+	masterAddr, epoch := s.master.addr, s.configEpoch
+	s.mu.Unlock()
+
+	host, port, err := net.SplitHostPort(masterAddr)
+	if err != nil {
+		return
+	}
+
+	for _, peer := range s.cfg.Peers {
+		go func(peer string) {
+			_, _ = s.request(peer, "SENTINEL", "hello", s.cfg.Name, host, port, strconv.FormatInt(epoch, 10))
+		}(peer)
+	}
+}
+
+// request opens a connection to a peer, sends a command & returns the reply
+func (s *Sentinel) request(addr string, argv ...string) (resp.Type, error) {
+	return s.send(addr, s.cfg.RequirePass, argv...)
+}
+
+// requestInstance is request for a monitored instance, which is authenticated first when AuthPass is set
+func (s *Sentinel) requestInstance(addr string, argv ...string) (resp.Type, error) {
+	return s.send(addr, s.cfg.AuthPass, argv...)
+}
+
+func (s *Sentinel) send(addr, password string, argv ...string) (resp.Type, error) {
+	timeout := max(s.cfg.PingPeriod, 100*time.Millisecond)
+
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+	reader := resp.NewReader(conn)
+	if password != "" {
+		_, err = utils.SendCommand(conn, reader, "AUTH", password)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return utils.SendCommand(conn, reader, argv...)
+}
+
+//* Serving clients *//
+
+// client is the state of a connection to the sentinel
+type client struct {
+	authenticated bool
+	// peer is set when the connection comes from the host of a configured peer, only peers may announce a primary &
+	// ask for votes
+	peer bool
+}
+
+func (s *Sentinel) handleConnection(conn net.Conn) {
+	defer conn.Close()
+
+	c := &client{authenticated: s.cfg.RequirePass == "", peer: s.isPeer(conn.RemoteAddr())}
+	reader := resp.NewReader(conn)
+	for {
+		v, _, err := reader.ReadValue()
+		if err != nil {
+			if err != io.EOF {
+				_ = writeReply(conn, resp.SimpleError{Value: "Protocol error: " + err.Error()})
+			}
+			return
+		}
+
+		reply, err := s.handleCommand(c, v)
+		if err != nil {
+			reply = resp.SimpleError{Value: err.Error()}
+		}
+
+		err = writeReply(conn, reply)
+		if err != nil {
+			return
+		}
+	}
+}
+
+func writeReply(conn net.Conn, v resp.Type) error {
+	str, err := v.Serialize()
+	if err != nil {
+		return err
+	}
+	_, err = conn.Write([]byte(str))
+	return err
+}
+
+// isPeer reports whether an address is on the host of one of the configured peers
+func (s *Sentinel) isPeer(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+
+	for _, peer := range s.cfg.Peers {
+		host, _, err := net.SplitHostPort(peer)
+		if err != nil {
+			continue
+		}
+		ips, err := net.LookupIP(host)
+		if err != nil {
+			continue
+		}
+		for _, ip := range ips {
+			if ip.Equal(tcpAddr.IP) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *Sentinel) handleCommand(c *client, v resp.Type) (resp.Type, error) {
+	arr, ok := v.(resp.Array)
+	if !ok || len(arr.Items) == 0 {
+		return nil, errors.New("not a valid command format")
+	}
+
+	argv := make([]string, len(arr.Items))
+	for i, item := range arr.Items {
+		bs, ok := item.(resp.BulkString)
+		if !ok {
+			return nil, errors.New("not a valid command format")
+		}
+		argv[i] = bs.Value
+	}
+
+	cmd := strings.ToUpper(argv[0])
+	if cmd == "AUTH" {
+		return s.auth(c, argv[1:])
+	}
+	if !c.authenticated {
+		return nil, errors.New("NOAUTH Authentication required.")
+	}
+
+	switch cmd {
+	case "PING":
+		return resp.SimpleString{Value: "PONG"}, nil
+	case "ROLE":
+		return resp.Array{Length: 2, Items: []resp.Type{
+			bulk("sentinel"),
+			resp.Array{Length: 1, Items: []resp.Type{bulk(s.cfg.Name)}},
+		}}, nil
+	case "SENTINEL":
+		if len(argv) < 2 {
+			return nil, errors.New("wrong number of arguments for 'sentinel' command")
+		}
+		return s.handleSENTINEL(c, strings.ToLower(argv[1]), argv[2:])
+	default:
+		return nil, errors.New("unknown Command")
+	}
+}
+
+// auth handles AUTH password, the sentinel has no users so AUTH username password only accepts default
+func (s *Sentinel) auth(c *client, args []string) (resp.Type, error) {
+	if len(args) == 2 && args[0] == "default" {
+		args = args[1:]
+	}
+	if len(args) != 1 {
+		return nil, errors.New("wrong number of arguments for 'auth' command")
+	}
+	if s.cfg.RequirePass == "" {
+		return nil, errors.New("AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?")
+	}
+	if subtle.ConstantTimeCompare([]byte(args[0]), []byte(s.cfg.RequirePass)) != 1 {
+		c.authenticated = false
+		return nil, errors.New("WRONGPASS invalid username-password pair or user is disabled.")
+	}
+
+	c.authenticated = true
+	return resp.SimpleString{Value: "OK"}, nil
+}
+
+func (s *Sentinel) handleSENTINEL(c *client, sub string, args []string) (resp.Type, error) {
+	switch sub {
+	case "get-master-addr-by-name":
+		if len(args) != 1 {
+			return nil, errors.New("wrong number of arguments for 'sentinel get-master-addr-by-name' command")
+		}
+		if args[0] != s.cfg.Name {
+			return resp.Null{}, nil
+		}
+
+		host, port, err := net.SplitHostPort(s.MasterAddr())
+		if err != nil {
+			return nil, err
+		}
+		return resp.Array{Length: 2, Items: []resp.Type{bulk(host), bulk(port)}}, nil
+	case "myid":
+		return bulk(s.runID), nil
+	case "master":
+		if len(args) != 1 || args[0] != s.cfg.Name {
+			return nil, errors.New("No such master with that name")
+		}
+		return s.masterState(), nil
+	case "replicas", "slaves":
+		if len(args) != 1 || args[0] != s.cfg.Name {
+			return nil, errors.New("No such master with that name")
+		}
+		return s.replicasState(), nil
+	case "is-master-down-by-addr":
+		if !c.peer {
+			return nil, errors.New("NOPERM only the configured sentinels may ask for votes")
+		}
+		if len(args) != 4 {
+			return nil, errors.New("wrong number of arguments for 'sentinel is-master-down-by-addr' command")
+		}
+		epoch, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return s.isMasterDown(net.JoinHostPort(args[0], args[1]), epoch, args[3]), nil
+	case "hello":
+		if !c.peer {
+			return nil, errors.New("NOPERM only the configured sentinels may announce a primary")
+		}
+		if len(args) != 4 {
+			return nil, errors.New("wrong number of arguments for 'sentinel hello' command")
+		}
+		epoch, err := strconv.ParseInt(args[3], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		s.receiveHello(args[0], net.JoinHostPort(args[1], args[2]), epoch)
+		return resp.SimpleString{Value: "OK"}, nil
+	default:
+		return nil, fmt.Errorf("unknown sentinel subcommand '%s'", sub)
+	}
+}
+
+// isMasterDown answers another sentinel, & votes for it as the leader if it asks for the first time in a new epoch
+func (s *Sentinel) isMasterDown(addr string, epoch int64, runID string) resp.Type {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	down := 0
+	if s.master.addr == addr && s.master.down(s.cfg.DownAfter) {
+		down = 1
+	}
+
+	// Votes are only cast for a failover of the monitored primary
+	if runID != "*" && s.master.addr == addr {
+		if epoch > s.currentEpoch {
+			s.currentEpoch = epoch
+		}
+		if s.leaderEpoch < epoch {
+			s.leader, s.leaderEpoch = runID, epoch
+			// Give the leader time to complete its failover before starting one
+			s.failoverStart = time.Now()
+			fmt.Printf("Sentinel voted for %s in epoch %d\n", runID, epoch)
+		}
+	}
+
+	leader := "*"
+	if runID != "*" && s.master.addr == addr {
+		leader = s.leader
+	}
+
+	return resp.Array{Length: 3, Items: []resp.Type{
+		resp.Integer{Value: down},
+		bulk(leader),
+		resp.Integer{Value: int(s.leaderEpoch)},
+	}}
+}
+
+// receiveHello switches to the primary announced by another sentinel, if its configuration is newer
+// Only a monitored replica can become the primary, an unknown address is ignored
+func (s *Sentinel) receiveHello(name, masterAddr string, epoch int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if name != s.cfg.Name || epoch <= s.configEpoch || masterAddr == s.master.addr || s.replicas[masterAddr] == nil {
+		return
+	}
+
+	fmt.Printf("Sentinel +switch-master %s %s %s (config epoch %d)\n", name, s.master.addr, masterAddr, epoch)
+	s.switchMaster(masterAddr, s.master.addr, epoch)
+	s.failoverStart = time.Time{}
+}
+
+func (s *Sentinel) masterState() resp.Type {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return instanceState(s.master, s.cfg.DownAfter, "master")
+}
+
+func (s *Sentinel) replicasState() resp.Type {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	addrs := make([]string, 0, len(s.replicas))
+	for addr := range s.replicas {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+
+	items := make([]resp.Type, 0, len(addrs))
+	for _, addr := range addrs {
+		items = append(items, instanceState(s.replicas[addr], s.cfg.DownAfter, "slave"))
+	}
+	return resp.Array{Length: len(items), Items: items}
+}
+
+func instanceState(inst *instance, downAfter time.Duration, kind string) resp.Type {
+	host, port, _ := net.SplitHostPort(inst.addr)
+	flags := kind
+	if inst.down(downAfter) {
+		flags += ",s_down"
+	}
+
+	fields := []string{
+		"name", inst.addr,
+		"ip", host,
+		"port", port,
+		"flags", flags,
+		"last-ok-ping-reply", strconv.FormatInt(time.Since(inst.lastOK).Milliseconds(), 10),
+		"role-reported", inst.role,
+		"slave-repl-offset", strconv.FormatInt(inst.offset, 10),
+	}
+
+	items := make([]resp.Type, len(fields))
+	for i, f := range fields {
+		items[i] = bulk(f)
+	}
+	return resp.Array{Length: len(items), Items: items}
+}
+
+func bulk(s string) resp.BulkString {
+	return resp.BulkString{Value: s, Length: len(s)}
+}
+
+// parseInfo reads the "field:value" lines of an INFO reply
+func parseInfo(info string) map[string]string {
+	fields := make(map[string]string)
+	for _, line := range strings.Split(info, "\r\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if ok {
+			fields[key] = value
+		}
+	}
+	return fields
+}
+
+// parseFields reads a "k1=v1,k2=v2" value of an INFO field
+func parseFields(value string) map[string]string {
+	fields := make(map[string]string)
+	for _, kv := range strings.Split(value, ",") {
+		k, v, ok := strings.Cut(kv, "=")
+		if ok {
+			fields[k] = v
+		}
+	}
+	return fields
+}
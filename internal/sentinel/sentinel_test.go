@@ -0,0 +1,401 @@
+package sentinel
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DNahar74/PulseDB/internal/resp"
+	"github.com/DNahar74/PulseDB/internal/utils"
+)
+
+// fakeNode is an in-process server answering the commands a sentinel sends to a PulseDB instance
+type fakeNode struct {
+	cluster *fakeCluster
+	addr    string
+
+	mu         sync.Mutex
+	listener   net.Listener
+	masterAddr string
+	offset     int64
+}
+
+// fakeCluster lets a primary list the nodes replicating from it
+type fakeCluster struct {
+	mu    sync.Mutex
+	nodes []*fakeNode
+}
+
+func (fc *fakeCluster) start(t *testing.T, masterAddr string, offset int64) *fakeNode {
+	t.Helper()
+
+	n := &fakeNode{cluster: fc, addr: freeAddr(t), masterAddr: masterAddr, offset: offset}
+	n.listen(t)
+
+	fc.mu.Lock()
+	fc.nodes = append(fc.nodes, n)
+	fc.mu.Unlock()
+
+	return n
+}
+
+func (n *fakeNode) listen(t *testing.T) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", n.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n.mu.Lock()
+	n.listener = l
+	n.mu.Unlock()
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go n.serve(conn)
+		}
+	}()
+}
+
+func (n *fakeNode) kill() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	_ = n.listener.Close()
+}
+
+func (n *fakeNode) getMaster() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.masterAddr
+}
+
+func (n *fakeNode) serve(conn net.Conn) {
+	defer conn.Close()
+
+	reader := resp.NewReader(conn)
+	for {
+		v, _, err := reader.ReadValue()
+		if err != nil {
+			return
+		}
+
+		argv := make([]string, 0)
+		for _, item := range v.(resp.Array).Items {
+			argv = append(argv, item.(resp.BulkString).Value)
+		}
+
+		var reply resp.Type
+		switch strings.ToUpper(argv[0]) {
+		case "PING":
+			reply = resp.SimpleString{Value: "PONG"}
+		case "ROLE":
+			role := "master"
+			if n.getMaster() != "" {
+				role = "slave"
+			}
+			reply = resp.Array{Length: 1, Items: []resp.Type{bulk(role)}}
+		case "INFO":
+			info := n.info()
+			reply = bulk(info)
+		case "REPLICAOF":
+			n.mu.Lock()
+			if strings.EqualFold(argv[1], "NO") {
+				n.masterAddr = ""
+			} else {
+				n.masterAddr = net.JoinHostPort(argv[1], argv[2])
+			}
+			n.mu.Unlock()
+			reply = resp.SimpleString{Value: "OK"}
+		default:
+			reply = resp.SimpleError{Value: "unknown Command"}
+		}
+
+		if writeReply(conn, reply) != nil {
+			return
+		}
+	}
+}
+
+func (n *fakeNode) info() string {
+	n.mu.Lock()
+	masterAddr, offset := n.masterAddr, n.offset
+	n.mu.Unlock()
+
+	lines := []string{"# Replication"}
+	if masterAddr != "" {
+		host, port, _ := net.SplitHostPort(masterAddr)
+		lines = append(lines, "role:slave", "master_host:"+host, "master_port:"+port, "master_link_status:up", fmt.Sprintf("slave_repl_offset:%d", offset))
+		return strings.Join(lines, "\r\n")
+	}
+
+	lines = append(lines, "role:master")
+	n.cluster.mu.Lock()
+	i := 0
+	for _, other := range n.cluster.nodes {
+		if other.getMaster() == n.addr {
+			host, port, _ := net.SplitHostPort(other.addr)
+			lines = append(lines, fmt.Sprintf("slave%d:ip=%s,port=%s,state=online,offset=%d,lag=0", i, host, port, other.offset))
+			i++
+		}
+	}
+	n.cluster.mu.Unlock()
+
+	return strings.Join(lines, "\r\n")
+}
+
+func freeAddr(t *testing.T) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	return l.Addr().String()
+}
+
+func testConfig(address, masterAddr string, peers []string) Config {
+	cfg := DefaultConfig()
+	cfg.Address = address
+	cfg.MasterAddr = masterAddr
+	cfg.Peers = peers
+	cfg.Quorum = 2
+	cfg.DownAfter = 300 * time.Millisecond
+	cfg.FailoverTimeout = 2 * time.Second
+	cfg.PingPeriod = 50 * time.Millisecond
+	cfg.InfoPeriod = 100 * time.Millisecond
+	cfg.HelloPeriod = 100 * time.Millisecond
+	cfg.RequirePass = "secret"
+	return cfg
+}
+
+func startSentinels(t *testing.T, count int, masterAddr string) ([]*Sentinel, []string) {
+	t.Helper()
+
+	addrs := make([]string, count)
+	for i := range addrs {
+		addrs[i] = freeAddr(t)
+	}
+
+	sentinels := make([]*Sentinel, count)
+	for i := range sentinels {
+		peers := make([]string, 0)
+		for j, a := range addrs {
+			if j != i {
+				peers = append(peers, a)
+			}
+		}
+
+		s := New(testConfig(addrs[i], masterAddr, peers))
+		sentinels[i] = s
+		go func() {
+			_ = s.Start()
+		}()
+		t.Cleanup(func() { _ = s.Close() })
+	}
+
+	return sentinels, addrs
+}
+
+// getMasterAddr asks a sentinel for the primary, the way a client would
+func getMasterAddr(addr, name string) (string, error) {
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(time.Second))
+
+	reader := resp.NewReader(conn)
+	_, err = utils.SendCommand(conn, reader, "AUTH", "secret")
+	if err != nil {
+		return "", err
+	}
+	reply, err := utils.SendCommand(conn, reader, "SENTINEL", "get-master-addr-by-name", name)
+	if err != nil {
+		return "", err
+	}
+
+	arr, ok := reply.(resp.Array)
+	if !ok || len(arr.Items) != 2 {
+		return "", errors.New("unexpected reply")
+	}
+	return net.JoinHostPort(arr.Items[0].(resp.BulkString).Value, arr.Items[1].(resp.BulkString).Value), nil
+}
+
+func waitFor(t *testing.T, timeout time.Duration, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+func TestFailover(t *testing.T) {
+	cluster := &fakeCluster{}
+	master := cluster.start(t, "", 0)
+	behind := cluster.start(t, master.addr, 100)
+	ahead := cluster.start(t, master.addr, 200)
+
+	sentinels, addrs := startSentinels(t, 3, master.addr)
+
+	waitFor(t, 5*time.Second, "replica discovery", func() bool {
+		for _, s := range sentinels {
+			s.mu.Lock()
+			n := len(s.replicas)
+			s.mu.Unlock()
+			if n != 2 {
+				return false
+			}
+		}
+		return true
+	})
+
+	addr, err := getMasterAddr(addrs[0], "mymaster")
+	if err != nil || addr != master.addr {
+		t.Fatalf("get-master-addr-by-name = %s, %v, want %s", addr, err, master.addr)
+	}
+
+	master.kill()
+
+	// Every sentinel must end up pointing clients to the replica with the largest offset
+	waitFor(t, 10*time.Second, "the failover", func() bool {
+		for _, a := range addrs {
+			addr, err := getMasterAddr(a, "mymaster")
+			if err != nil || addr != ahead.addr {
+				return false
+			}
+		}
+		return true
+	})
+
+	if ahead.getMaster() != "" {
+		t.Errorf("promoted replica still follows %s", ahead.getMaster())
+	}
+	waitFor(t, 5*time.Second, "the other replica to follow the new primary", func() bool {
+		return behind.getMaster() == ahead.addr
+	})
+
+	// The old primary is turned into a replica when it comes back
+	master.listen(t)
+	waitFor(t, 5*time.Second, "the old primary to be reconfigured", func() bool {
+		return master.getMaster() == ahead.addr
+	})
+}
+
+func TestNoFailoverWithoutQuorum(t *testing.T) {
+	cluster := &fakeCluster{}
+	master := cluster.start(t, "", 0)
+	replica := cluster.start(t, master.addr, 100)
+
+	// A single sentinel cannot reach a quorum of 2
+	s := New(testConfig(freeAddr(t), master.addr, nil))
+	go func() {
+		_ = s.Start()
+	}()
+	t.Cleanup(func() { _ = s.Close() })
+
+	waitFor(t, 5*time.Second, "replica discovery", func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.replicas) == 1
+	})
+
+	master.kill()
+	time.Sleep(time.Second)
+
+	if s.MasterAddr() != master.addr {
+		t.Errorf("sentinel failed over to %s without a quorum", s.MasterAddr())
+	}
+	if replica.getMaster() != master.addr {
+		t.Errorf("replica was reconfigured to %s without a quorum", replica.getMaster())
+	}
+}
+
+func TestPeerCommands(t *testing.T) {
+	cluster := &fakeCluster{}
+	master := cluster.start(t, "", 0)
+	replica := cluster.start(t, master.addr, 100)
+
+	// The peer is on this host, so the connections of the test come from a configured peer
+	address := freeAddr(t)
+	s := New(testConfig(address, master.addr, []string{freeAddr(t)}))
+	go func() {
+		_ = s.Start()
+	}()
+	t.Cleanup(func() { _ = s.Close() })
+	waitFor(t, 5*time.Second, "replica discovery", func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.replicas) == 1
+	})
+
+	conn, err := net.DialTimeout("tcp", address, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	reader := resp.NewReader(conn)
+	host, port, _ := net.SplitHostPort(freeAddr(t))
+
+	if _, err := utils.SendCommand(conn, reader, "SENTINEL", "hello", "mymaster", host, port, "100"); err == nil ||
+		!strings.Contains(err.Error(), "NOAUTH") {
+		t.Errorf("hello without AUTH: %v", err)
+	}
+	if _, err := utils.SendCommand(conn, reader, "AUTH", "wrong"); err == nil {
+		t.Error("AUTH with a wrong password succeeded")
+	}
+	if _, err := utils.SendCommand(conn, reader, "AUTH", "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A primary that isn't one of the monitored instances is never adopted, & no vote is cast for another primary
+	if _, err := utils.SendCommand(conn, reader, "SENTINEL", "hello", "mymaster", host, port, "100"); err != nil {
+		t.Fatal(err)
+	}
+	if s.MasterAddr() != master.addr {
+		t.Errorf("the sentinel switched to the unknown primary %s", s.MasterAddr())
+	}
+	if _, err := utils.SendCommand(conn, reader, "SENTINEL", "is-master-down-by-addr", host, port, "100", "intruder"); err != nil {
+		t.Fatal(err)
+	}
+	s.mu.Lock()
+	leader := s.leader
+	s.mu.Unlock()
+	if leader != "" {
+		t.Errorf("the sentinel voted for %s for a primary it doesn't monitor", leader)
+	}
+
+	replicaHost, replicaPort, _ := net.SplitHostPort(replica.addr)
+	if _, err := utils.SendCommand(conn, reader, "SENTINEL", "hello", "mymaster", replicaHost, replicaPort, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if s.MasterAddr() != replica.addr {
+		t.Errorf("the sentinel didn't switch to the monitored replica announced by a peer, primary = %s", s.MasterAddr())
+	}
+
+	// A sentinel without peers takes no announcement at all
+	lone := New(testConfig(freeAddr(t), master.addr, nil))
+	c := &client{authenticated: true, peer: lone.isPeer(conn.LocalAddr())}
+	if _, err := lone.handleCommand(c, resp.Array{Items: []resp.Type{bulk("SENTINEL"), bulk("hello"), bulk("mymaster"), bulk(host), bulk(port), bulk("100")}}); err == nil {
+		t.Error("a sentinel without peers accepted hello")
+	}
+}
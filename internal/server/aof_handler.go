@@ -1,45 +1,72 @@
 package server
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"strings"
 	"time"
 
+	"github.com/DNahar74/PulseDB/internal/aof"
 	"github.com/DNahar74/PulseDB/internal/command"
-	"github.com/DNahar74/PulseDB/internal/resp"
 	"github.com/DNahar74/PulseDB/internal/store"
 )
 
-func handleAOF(s *store.Store) {
-	file, err := os.OpenFile("./commands.aof", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+// handleAOF writes the queued commands to the AOF every aof-flush-interval
+func (s *Server) handleAOF(path string) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
 		fmt.Println("Error opening file")
 	}
 	for {
-		time.Sleep(1 * time.Second)
-		writeToFile(file, s)
+		time.Sleep(s.settings().AOFFlushInterval)
+		start := time.Now()
+		written, err := writeToFile(file, s.databases)
+		if !written {
+			continue
+		}
+		s.stats.aofWriteLatency.Observe(time.Since(start))
+
+		// The written commands are on disk when the write is followed by a fsync
+		if err == nil {
+			start = time.Now()
+			err = file.Sync()
+			s.stats.aofFsyncLatency.Observe(time.Since(start))
+		}
+		if err != nil {
+			fmt.Println("Error writing commands to AOF file :: ", err)
+		}
+		s.stats.recordAOFWrite(err)
 	}
 }
 
-func writeToFile(file *os.File, s *store.Store) {
-	content := ""
+// writeToFile writes every command queued since the last call to the AOF, & returns whether there was any
+func writeToFile(file *os.File, d *store.Databases) (bool, error) {
+	var sb strings.Builder
 
-	select {
-	case cmd := <-s.AOFChan:
-		content += cmd
-	default:
-		return
+	for {
+		select {
+		case cmd := <-d.AOFChan:
+			sb.WriteString(cmd)
+			sb.WriteString(aof.Separator)
+			continue
+		default:
+		}
+		break
 	}
 
-	_, err := file.WriteString(content + "\n#\n")
-	if err != nil {
-		fmt.Println("Error writing commands to AOF file :: ", err)
+	if sb.Len() == 0 {
+		return false, nil
 	}
+
+	_, err := file.WriteString(sb.String())
+	return true, err
 }
 
-func restoreStorage() error {
-	fileB, err := os.ReadFile("./commands.aof")
+// restoreStorage replays the AOF into the store
+// When loadTruncated is set, an incomplete record at the end of the file is discarded instead of failing the startup
+func restoreStorage(path string, loadTruncated bool) error {
+	fileB, err := os.ReadFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
 			// file doesn't exist, silently skip
@@ -48,18 +75,32 @@ func restoreStorage() error {
 		return err
 	}
 
-	content := string(fileB)
-	cmds := strings.Split(content, "\n#\n")
+	cmds, parseErr := aof.Parse(string(fileB))
+
+	var corrupt *aof.CorruptError
+	if parseErr != nil {
+		if !errors.As(parseErr, &corrupt) || !corrupt.Truncated || !loadTruncated {
+			fmt.Println("Bad AOF file, run pulsedb-check-aof to inspect it:", parseErr)
+			return parseErr
+		}
+	}
 
-	for i, c := range cmds[:len(cmds)-1] {
-		cmd, err := resp.Deserialize(c)
+	// The SELECT commands of the file apply to the commands after them
+	sess := command.NewSession()
+	for i, c := range cmds {
+		err = command.ReplayCommands(sess, c.Command)
 		if err != nil {
-			fmt.Println("Error in cmd", i)
+			fmt.Println("Error in restoring storage. Cmd:", i)
 			return err
 		}
-		_, err = command.HandleCommands(cmd)
+	}
+
+	if corrupt != nil {
+		// Cut the incomplete tail off, so that new commands are not appended after it
+		fmt.Printf("AOF loaded anyway because aof-load-truncated is enabled, discarding %d bytes after offset %d\n", int64(len(fileB))-corrupt.Offset, corrupt.Offset)
+		err = os.Truncate(path, corrupt.Offset)
 		if err != nil {
-			fmt.Println("Error in restoring storage. Cmd:", i)
+			fmt.Println("Error truncating the AOF file:", err)
 			return err
 		}
 	}
@@ -0,0 +1,60 @@
+package server
+
+// backlog is a circular buffer holding the tail of the replication stream
+// It lets a replica that lost its link resume from its offset without a full resync
+type backlog struct {
+	buf     []byte
+	histlen int
+	// end is the replication offset of the last byte written, offsets start at 1
+	end int64
+}
+
+func newBacklog(size int) *backlog {
+	return &backlog{buf: make([]byte, size)}
+}
+
+// firstByte returns the replication offset of the oldest byte in the backlog
+func (b *backlog) firstByte() int64 {
+	return b.end - int64(b.histlen) + 1
+}
+
+// reset empties the backlog, the next byte written will be at offset+1
+func (b *backlog) reset(offset int64) {
+	b.histlen = 0
+	b.end = offset
+}
+
+func (b *backlog) write(p []byte) {
+	size := len(b.buf)
+
+	// Only the last size bytes can be kept
+	if len(p) > size {
+		b.end += int64(len(p) - size)
+		p = p[len(p)-size:]
+	}
+
+	idx := int(b.end % int64(size))
+	n := copy(b.buf[idx:], p)
+	copy(b.buf, p[n:])
+
+	b.end += int64(len(p))
+	b.histlen = min(b.histlen+len(p), size)
+}
+
+// readFrom returns the bytes from offset to the end of the backlog
+// It returns false if the offset is not held in the backlog anymore
+func (b *backlog) readFrom(offset int64) ([]byte, bool) {
+	if offset < b.firstByte() || offset > b.end+1 {
+		return nil, false
+	}
+
+	size := len(b.buf)
+	n := int(b.end - offset + 1)
+	out := make([]byte, n)
+
+	idx := int((offset - 1) % int64(size))
+	copied := copy(out, b.buf[idx:])
+	copy(out[copied:], b.buf)
+
+	return out, true
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"testing"
+)
+
+func TestBacklogReadFrom(t *testing.T) {
+	b := newBacklog(8)
+	b.write([]byte("abcdef"))
+
+	got, ok := b.readFrom(3)
+	if !ok || string(got) != "cdef" {
+		t.Errorf("readFrom(3) = %q, %v, want %q, true", got, ok, "cdef")
+	}
+
+	got, ok = b.readFrom(7)
+	if !ok || len(got) != 0 {
+		t.Errorf("readFrom(7) = %q, %v, want an empty read", got, ok)
+	}
+
+	if _, ok = b.readFrom(8); ok {
+		t.Errorf("readFrom(8) should be past the end of the backlog")
+	}
+}
+
+func TestBacklogWrapAround(t *testing.T) {
+	b := newBacklog(8)
+	b.write([]byte("abcdef"))
+	b.write([]byte("ghijk"))
+
+	if b.firstByte() != 4 {
+		t.Errorf("firstByte() = %d, want 4", b.firstByte())
+	}
+
+	if _, ok := b.readFrom(3); ok {
+		t.Errorf("readFrom(3) should have been overwritten")
+	}
+
+	got, ok := b.readFrom(4)
+	if !ok || string(got) != "defghijk" {
+		t.Errorf("readFrom(4) = %q, %v, want %q, true", got, ok, "defghijk")
+	}
+}
+
+func TestBacklogLargeWrite(t *testing.T) {
+	b := newBacklog(4)
+	b.write([]byte("abcdefghij"))
+
+	got, ok := b.readFrom(7)
+	if !ok || string(got) != "ghij" {
+		t.Errorf("readFrom(7) = %q, %v, want %q, true", got, ok, "ghij")
+	}
+}
+
+func TestBacklogReset(t *testing.T) {
+	b := newBacklog(8)
+	b.write([]byte("abc"))
+	b.reset(100)
+	b.write([]byte("xyz"))
+
+	if _, ok := b.readFrom(1); ok {
+		t.Errorf("readFrom(1) should not be served after a reset")
+	}
+
+	got, ok := b.readFrom(101)
+	if !ok || string(got) != "xyz" {
+		t.Errorf("readFrom(101) = %q, %v, want %q, true", got, ok, "xyz")
+	}
+}
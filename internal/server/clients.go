@@ -0,0 +1,208 @@
+package server
+
+import (
+	"cmp"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/DNahar74/PulseDB/internal/command"
+)
+
+// client is a connection in the registry of the server
+// Its connection updates it around every command, so that the other connections can describe it without touching its
+// session
+type client struct {
+	id      int64
+	addr    string
+	laddr   string
+	conn    net.Conn
+	created time.Time
+
+	mu       sync.Mutex
+	name     string
+	db       int
+	user     string
+	noEvict  bool
+	replica  bool
+	monitor  bool
+	lastCmd  string
+	lastSeen time.Time
+	// qbuf is the size of the commands read but not run yet
+	qbuf int
+	// closeAfterReply is set when the client killed itself
+	closeAfterReply bool
+
+	// omem is the size of the reply being written
+	omem atomic.Int64
+}
+
+// clientOutput is the connection of a client, it records the size of the reply being written
+type clientOutput struct {
+	net.Conn
+	c *client
+}
+
+func (o clientOutput) Write(b []byte) (int, error) {
+	o.c.omem.Store(int64(len(b)))
+	defer o.c.omem.Store(0)
+	return o.Conn.Write(b)
+}
+
+// begin records a command the client is about to run
+func (c *client) begin(name string, qbuf int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lastCmd = strings.ToLower(name)
+	c.lastSeen = time.Now()
+	c.qbuf = qbuf
+}
+
+// end records the state of the session after a command, & reports whether the connection must be closed
+func (c *client) end(sess *command.Session) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.name = sess.Name()
+	c.db = sess.DB()
+	c.user = sess.Username()
+	c.noEvict = sess.NoEvict()
+	c.lastSeen = time.Now()
+	c.qbuf = 0
+	return c.closeAfterReply
+}
+
+// setRole marks a client that turned out to be a replica or a monitor
+func (c *client) setRole(replica, monitor bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.replica = replica
+	c.monitor = monitor
+}
+
+// clientType returns the type of a client for CLIENT LIST TYPE & CLIENT KILL TYPE, the caller must hold its lock
+func (c *client) clientType() string {
+	if c.replica {
+		return "replica"
+	}
+	return "normal"
+}
+
+// info describes a client like CLIENT LIST does in Redis, the caller must hold its lock
+func (c *client) info(now time.Time) string {
+	flags := ""
+	if c.replica {
+		flags += "S"
+	}
+	if c.monitor {
+		flags += "O"
+	}
+	if c.noEvict {
+		flags += "e"
+	}
+	if flags == "" {
+		flags = "N"
+	}
+
+	return fmt.Sprintf("id=%d addr=%s laddr=%s name=%s age=%d idle=%d flags=%s db=%d qbuf=%d omem=%d cmd=%s user=%s resp=2",
+		c.id, c.addr, c.laddr, c.name, int(now.Sub(c.created).Seconds()), int(now.Sub(c.lastSeen).Seconds()), flags,
+		c.db, c.qbuf, c.omem.Load(), c.lastCmd, c.user)
+}
+
+// matches reports whether a client is selected by a filter, the caller must hold its lock
+func (c *client) matches(f command.ClientFilter) bool {
+	return c.id != f.SkipID &&
+		(len(f.IDs) == 0 || slices.Contains(f.IDs, c.id)) &&
+		(f.Addr == "" || f.Addr == c.addr) &&
+		(f.User == "" || f.User == c.user) &&
+		(f.Type == "" || f.Type == c.clientType())
+}
+
+// clientRegistry holds the connected clients
+type clientRegistry struct {
+	mu      sync.Mutex
+	clients map[int64]*client
+}
+
+// add registers the connection of a new session
+func (r *clientRegistry) add(conn net.Conn, sess *command.Session) *client {
+	now := time.Now()
+	c := &client{
+		id:       sess.ID(),
+		addr:     clientAddr(conn),
+		laddr:    conn.LocalAddr().String(),
+		conn:     conn,
+		created:  now,
+		user:     sess.Username(),
+		lastCmd:  "NULL",
+		lastSeen: now,
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.clients == nil {
+		r.clients = map[int64]*client{}
+	}
+	r.clients[c.id] = c
+	return c
+}
+
+// remove drops a client that disconnected
+func (r *clientRegistry) remove(c *client) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.clients, c.id)
+}
+
+// match returns the clients selected by a filter, in the order they connected
+func (r *clientRegistry) match(f command.ClientFilter) []*client {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var clients []*client
+	for _, c := range r.clients {
+		c.mu.Lock()
+		ok := c.matches(f)
+		c.mu.Unlock()
+		if ok {
+			clients = append(clients, c)
+		}
+	}
+	slices.SortFunc(clients, func(a, b *client) int { return cmp.Compare(a.id, b.id) })
+	return clients
+}
+
+// Clients describes the connected clients for CLIENT LIST & CLIENT INFO
+func (s *Server) Clients(f command.ClientFilter) []string {
+	now := time.Now()
+	var lines []string
+	for _, c := range s.clients.match(f) {
+		c.mu.Lock()
+		lines = append(lines, c.info(now))
+		c.mu.Unlock()
+	}
+	return lines
+}
+
+// KillClients closes the connections of the clients for CLIENT KILL, the client running it is closed after its reply
+func (s *Server) KillClients(f command.ClientFilter, self int64) int {
+	clients := s.clients.match(f)
+	for _, c := range clients {
+		if c.id == self {
+			c.mu.Lock()
+			c.closeAfterReply = true
+			c.mu.Unlock()
+			continue
+		}
+		_ = c.conn.Close()
+	}
+	return len(clients)
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/DNahar74/PulseDB/internal/command"
+	"github.com/DNahar74/PulseDB/internal/config"
+)
+
+// GetConfig returns the names & the values of the parameters matching glob patterns, for CONFIG GET
+func (s *Server) GetConfig(patterns []string) []string {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+
+	return s.config.Match(patterns...)
+}
+
+// SetConfig changes parameters while the server runs, for CONFIG SET
+// The settings only change once the new TLS files, if any, are loaded
+func (s *Server) SetConfig(pairs []string) error {
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+
+	next := *s.config
+	changed, err := next.SetParams(pairs)
+	if err != nil {
+		return err
+	}
+
+	err = s.applyConfig(next, changed)
+	if err != nil {
+		return err
+	}
+	*s.config = next
+	return nil
+}
+
+// applyConfig passes the changed parameters to the parts of the server that hold them
+// The settings read by the background tasks & the TLS handshakes are taken from the config itself
+func (s *Server) applyConfig(cfg config.Config, changed []string) error {
+	for _, name := range []string{"tls-cert-file", "tls-key-file", "tls-ca-cert-file", "tls-auth-clients"} {
+		if s.tls == nil || !slices.Contains(changed, name) {
+			continue
+		}
+		cert, cas, err := loadTLSCredentials(cfg)
+		if err != nil {
+			fmt.Println("Error loading the TLS certificates:", err)
+			return fmt.Errorf("CONFIG SET failed (possibly related to argument '%s') - Unable to update TLS configuration. Check server logs.", name)
+		}
+		s.tls.set(cert, cas)
+		break
+	}
+
+	for _, name := range changed {
+		switch name {
+		case "requirepass":
+			s.users.SetRequirePass(cfg.RequirePass)
+		case "masteruser", "masterauth":
+			s.repl.setMasterAuth(cfg.MasterUser, cfg.MasterAuth)
+		case "maxmemory", "maxmemory-policy":
+			s.databases.SetMaxMemory(cfg.MaxMemory, cfg.MaxMemoryPolicy)
+		case "slowlog-log-slower-than", "slowlog-max-len":
+			command.SetSlowlog(cfg.SlowlogLogSlowerThan, cfg.SlowlogMaxLen)
+		}
+	}
+	return nil
+}
+
+// RewriteConfig writes the settings back to the config file, for CONFIG REWRITE
+func (s *Server) RewriteConfig() error {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+
+	return s.config.Rewrite()
+}
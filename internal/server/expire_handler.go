@@ -0,0 +1,19 @@
+package server
+
+import (
+	"time"
+
+	"github.com/DNahar74/PulseDB/internal/command"
+)
+
+// activeExpirySample is the number of hashes of every database checked by a run of the active expiry
+const activeExpirySample = 20
+
+// handleActiveExpiry removes the expired hash fields in the background, the commands only hide them until then
+// It runs hz times per second
+func (s *Server) handleActiveExpiry() {
+	for {
+		time.Sleep(time.Second / time.Duration(s.settings().Hz))
+		command.ExpireHashFields(activeExpirySample)
+	}
+}
@@ -1,38 +1,75 @@
 package server
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"strconv"
+	"strings"
 
 	"github.com/DNahar74/PulseDB/internal/command"
 	"github.com/DNahar74/PulseDB/internal/resp"
-	"github.com/DNahar74/PulseDB/internal/store"
 	"github.com/DNahar74/PulseDB/internal/utils"
 )
 
-// RedisStore is a global variable to hold the Redis data store
+// clientAddr identifies the client of a connection, the clients of the Unix socket have no address of their own & are
+// given the path of the socket
+func clientAddr(conn net.Conn) string {
+	if _, ok := conn.(*net.UnixConn); ok {
+		return conn.LocalAddr().String() + ":0"
+	}
+	return conn.RemoteAddr().String()
+}
 
 // handleConnection takes the connection request for a client and handles the input and output
-func handleConnection(conn net.Conn, s *store.Store) {
+func (s *Server) handleConnection(conn net.Conn) {
 	fmt.Println("Client connected")
-	fmt.Println("address:", conn.RemoteAddr().String())
+	fmt.Println("address:", clientAddr(conn))
 	fmt.Println("")
 	defer func(conn net.Conn) {
 		err := conn.Close()
-		if err != nil {
+		if err != nil && !errors.Is(err, net.ErrClosed) {
 			fmt.Println("Error closing the connection:", err)
 		}
 	}(conn)
 
-	buf := make([]byte, 128)
+	s.stats.connectionsReceived.Add(1)
+	s.stats.connectedClients.Add(1)
+	defer s.stats.connectedClients.Add(-1)
+
+	reader := resp.NewReader(conn)
+	sess := command.NewSession()
+	sess.SetAddr(clientAddr(conn))
+
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		err := s.handshakeTLS(tlsConn, sess)
+		if err != nil {
+			fmt.Println("TLS handshake failed:", err)
+			return
+		}
+	}
+
+	cl := s.clients.add(conn, sess)
+	defer s.clients.remove(cl)
+	out := clientOutput{Conn: conn, c: cl}
+
+	// Set when the client turns out to be a replica
+	var listeningPort string
+	var rep *replica
 
 	// keep reading the input until the client disconnects
 	for {
-		n, err := conn.Read(buf)
+		commands, _, err := reader.ReadValue()
 		if err != nil {
 			// EOF can be used to find if the user disconnected
-			if err.Error() == "EOF" {
-				fmt.Println("Client Disconnected:", conn.RemoteAddr().String())
+			if err == io.EOF {
+				fmt.Println("Client Disconnected:", clientAddr(conn))
+				if rep != nil {
+					s.repl.dropReplica(rep)
+					return
+				}
 				message := resp.BulkString{Value: "DISCONNECTED"}
 				err = utils.SendMessage(conn, message)
 				if err != nil {
@@ -41,44 +78,137 @@ func handleConnection(conn net.Conn, s *store.Store) {
 				}
 				return
 			}
+			if rep != nil {
+				s.repl.dropReplica(rep)
+				return
+			}
+			if errors.Is(err, net.ErrClosed) {
+				fmt.Println("Client killed:", cl.addr)
+				return
+			}
 
+			// The stream cannot be trusted after a protocol error, so the connection is closed
 			fmt.Println("Error reading from connection: ", err.Error())
+			m := resp.SimpleError{Value: "Protocol error: " + err.Error()}
+			_ = utils.SendMessage(conn, m)
+			return
 		}
 
-		cmd := string(buf[:n])
+		// Only an array of BulkStrings is a command, the stream is out of step after anything else
+		name, args, ok := commandName(commands)
+		if !ok {
+			fmt.Println("Invalid command from:", cl.addr)
+			m := resp.SimpleError{Value: "Protocol error: expected an array of bulk strings"}
+			_ = utils.SendMessage(conn, m)
+			if rep != nil {
+				s.repl.dropReplica(rep)
+			}
+			return
+		}
+		cl.begin(name, reader.Buffered())
 
-		fmt.Println("Input:", cmd)
+		// The passwords are kept out of the logs
+		fmt.Println("Input:", command.RedactArgs(append([]string{name}, args...)))
 
-		commands, err := resp.Deserialize(cmd)
-		if err != nil {
-			fmt.Println("Error deserializing commands: ", err.Error())
-			m := resp.SimpleError{Value: err.Error()}
-			err := utils.SendMessage(conn, m)
-			if err != nil {
-				fmt.Println("Error sending response: ", err.Error())
-				return
+		// Replicas only send acknowledgements, which are not answered
+		if rep != nil {
+			if name == "REPLCONF" && len(args) == 2 && strings.EqualFold(args[0], "ACK") {
+				offset, err := strconv.ParseInt(args[1], 10, 64)
+				if err == nil {
+					rep.ack(offset)
+				}
 			}
 			continue
 		}
 
-		val, err := command.HandleCommands(commands)
+		var val resp.Type
+		switch name {
+		case "REPLCONF", "PSYNC", "SYNC":
+			// These commands are handled here, the command package only checks that the client may run them
+			err = command.Authorize(sess, commands)
+			if err != nil {
+				break
+			}
+			if name == "REPLCONF" {
+				val, err = handleREPLCONF(args, &listeningPort)
+				break
+			}
+			rep, err = s.repl.syncReplica(conn, args, listeningPort, name == "PSYNC")
+			if err == nil {
+				cl.setRole(true, false)
+				continue
+			}
+		case "MONITOR":
+			err = command.Authorize(sess, commands)
+			if err == nil {
+				// RESET turns the monitor back into a normal client
+				cl.setRole(false, true)
+				if !monitor(conn, reader) {
+					return
+				}
+				cl.setRole(false, false)
+				continue
+			}
+		default:
+			val, err = command.HandleCommands(sess, commands)
+		}
+
 		if err != nil {
 			fmt.Println("Error handling commands: ", err.Error())
-			m := resp.SimpleError{Value: err.Error()}
-			err := utils.SendMessage(conn, m)
+			val = resp.SimpleError{Value: err.Error()}
+		}
+
+		// A client that killed itself is disconnected after its reply, which CLIENT REPLY may drop
+		closing := cl.end(sess)
+		if sess.Replies() {
+			err = utils.SendMessage(out, val)
 			if err != nil {
 				fmt.Println("Error sending response: ", err.Error())
 				return
 			}
-			continue
 		}
+		if closing {
+			fmt.Println("Client killed:", cl.addr)
+			return
+		}
+	}
+}
+
+// commandName returns the upper case name & the arguments of a command sent as an array of BulkStrings, & reports
+// whether the value is one
+func commandName(commands resp.Type) (string, []string, bool) {
+	arr, ok := commands.(resp.Array)
+	if !ok || len(arr.Items) == 0 {
+		return "", nil, false
+	}
+
+	argv := make([]string, 0, len(arr.Items))
+	for _, item := range arr.Items {
+		bs, ok := item.(resp.BulkString)
+		if !ok {
+			return "", nil, false
+		}
+		argv = append(argv, bs.Value)
+	}
 
-		s.AOFChan <- cmd
+	return strings.ToUpper(argv[0]), argv[1:], true
+}
 
-		err = utils.SendMessage(conn, val)
-		if err != nil {
-			fmt.Println("Error sending response: ", err.Error())
-			continue
+// handleREPLCONF stores the options a replica sends before PSYNC
+func handleREPLCONF(args []string, listeningPort *string) (resp.Type, error) {
+	if len(args)%2 != 0 {
+		return nil, errors.New("syntax error")
+	}
+
+	for i := 0; i < len(args); i += 2 {
+		switch strings.ToLower(args[i]) {
+		case "listening-port":
+			*listeningPort = args[i+1]
+		case "capa", "ack", "ip-address":
+		default:
+			return nil, fmt.Errorf("Unrecognized REPLCONF option: %s", args[i])
 		}
 	}
+
+	return resp.SimpleString{Value: "OK"}, nil
 }
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/DNahar74/PulseDB/internal/command"
+	"github.com/DNahar74/PulseDB/internal/metrics"
+)
+
+// statsSampleInterval is how often the commands processed & the used memory are sampled for INFO
+const statsSampleInterval = 100 * time.Millisecond
+
+// serverStats holds the statistics of the server given by INFO & by the metrics
+type serverStats struct {
+	startTime time.Time
+	runID     string
+
+	connectedClients    atomic.Int64
+	connectionsReceived atomic.Int64
+
+	// mu guards the status of the last AOF write & of the last snapshot
+	mu               sync.Mutex
+	aofLastWrite     time.Time
+	aofLastWriteErr  error
+	lastSave         time.Time
+	lastSaveErr      error
+	lastSaveDuration time.Duration
+
+	// The latencies of the AOF writes & fsyncs, & the durations of the snapshots
+	aofWriteLatency metrics.Latency
+	aofFsyncLatency metrics.Latency
+	saveDuration    metrics.Latency
+}
+
+// recordAOFWrite keeps the result of a write to the AOF
+func (st *serverStats) recordAOFWrite(err error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.aofLastWriteErr = err
+	if err == nil {
+		st.aofLastWrite = time.Now()
+	}
+}
+
+// recordSave keeps the result of a snapshot that started at start
+func (st *serverStats) recordSave(start time.Time, err error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.lastSaveErr = err
+	st.lastSaveDuration = time.Since(start)
+	st.saveDuration.Observe(st.lastSaveDuration)
+	if err == nil {
+		st.lastSave = time.Now()
+	}
+}
+
+// handleStatsSampling samples the statistics behind instantaneous_ops_per_sec & used_memory_peak
+func (s *Server) handleStatsSampling() {
+	for {
+		time.Sleep(statsSampleInterval)
+		command.SampleStats()
+	}
+}
+
+// Info returns the fields of the INFO sections kept by the server
+func (s *Server) Info(section string) []string {
+	cfg := s.settings()
+	st := &s.stats
+
+	switch section {
+	case "server":
+		mode := "standalone"
+		if cfg.ClusterEnabled {
+			mode = "cluster"
+		}
+		uptime := time.Since(st.startTime)
+		executable, _ := os.Executable()
+		return []string{
+			"redis_mode:" + mode,
+			"os:" + runtime.GOOS + " " + runtime.GOARCH,
+			"arch_bits:" + strconv.Itoa(strconv.IntSize),
+			"go_version:" + runtime.Version(),
+			"process_id:" + strconv.Itoa(os.Getpid()),
+			"run_id:" + st.runID,
+			"tcp_port:" + strconv.Itoa(cfg.Port),
+			fmt.Sprintf("server_time_usec:%d", time.Now().UnixMicro()),
+			fmt.Sprintf("uptime_in_seconds:%d", int64(uptime.Seconds())),
+			fmt.Sprintf("uptime_in_days:%d", int64(uptime.Hours()/24)),
+			"hz:" + strconv.Itoa(cfg.Hz),
+			"executable:" + executable,
+			"config_file:" + cfg.File,
+		}
+	case "clients":
+		return []string{
+			fmt.Sprintf("connected_clients:%d", st.connectedClients.Load()),
+			// No command blocks its client
+			"blocked_clients:0",
+		}
+	case "persistence":
+		st.mu.Lock()
+		defer st.mu.Unlock()
+
+		return []string{
+			"loading:0",
+			"aof_enabled:1",
+			"aof_last_write_status:" + status(st.aofLastWriteErr),
+			fmt.Sprintf("aof_last_write_time:%d", unixTime(st.aofLastWrite)),
+			fmt.Sprintf("aof_buffer_length:%d", len(s.databases.AOFChan)),
+			fmt.Sprintf("rdb_last_save_time:%d", unixTime(st.lastSave)),
+			"rdb_last_bgsave_status:" + status(st.lastSaveErr),
+			fmt.Sprintf("rdb_last_bgsave_time_sec:%d", int64(st.lastSaveDuration.Seconds())),
+			fmt.Sprintf("snapshot_interval_sec:%d", int64(cfg.SnapshotInterval.Seconds())),
+		}
+	case "stats":
+		return []string{
+			fmt.Sprintf("total_connections_received:%d", st.connectionsReceived.Load()),
+		}
+	}
+	return nil
+}
+
+// ResetStats clears the statistics of the server, for CONFIG RESETSTAT
+func (s *Server) ResetStats() {
+	s.stats.connectionsReceived.Store(0)
+}
+
+func status(err error) string {
+	if err != nil {
+		return "err"
+	}
+	return "ok"
+}
+
+// unixTime is the Unix time of t, 0 for the zero time
+func unixTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
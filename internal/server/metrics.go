@@ -0,0 +1,96 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/DNahar74/PulseDB/internal/command"
+	"github.com/DNahar74/PulseDB/internal/metrics"
+)
+
+// metricsContentType is the content type of the Prometheus text exposition format
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// startMetrics serves the Prometheus metrics on /metrics over HTTP, the listener is closed with the others by Close
+func (s *Server) startMetrics(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		fmt.Println("Error starting the metrics listener:", err)
+		return err
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		_ = listener.Close()
+		return nil
+	}
+	s.listeners = append(s.listeners, listener)
+	s.mu.Unlock()
+	fmt.Println("Metrics served on", address)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", s.handleMetrics)
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		err := srv.Serve(listener)
+		if err != nil && !errors.Is(err, net.ErrClosed) {
+			fmt.Println("Error serving the metrics:", err)
+		}
+	}()
+	return nil
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, _ *http.Request) {
+	var mw metrics.Writer
+	s.writeMetrics(&mw)
+	command.WriteMetrics(&mw)
+	mw.Runtime()
+
+	w.Header().Set("Content-Type", metricsContentType)
+	_, _ = io.WriteString(w, mw.String())
+}
+
+// writeMetrics writes the metrics of the connections & of the persistence
+func (s *Server) writeMetrics(w *metrics.Writer) {
+	st := &s.stats
+
+	w.Family("pulsedb_uptime_seconds", metrics.Gauge, "Time since the server started.")
+	w.Sample("pulsedb_uptime_seconds", time.Since(st.startTime).Seconds())
+	w.Family("pulsedb_connected_clients", metrics.Gauge, "Client connections open.")
+	w.Sample("pulsedb_connected_clients", float64(st.connectedClients.Load()))
+	w.Family("pulsedb_connections_received_total", metrics.Counter, "Client connections accepted.")
+	w.Sample("pulsedb_connections_received_total", float64(st.connectionsReceived.Load()))
+
+	w.Family("pulsedb_aof_queue_length", metrics.Gauge, "Commands queued for the AOF in AOFChan.")
+	w.Sample("pulsedb_aof_queue_length", float64(len(s.databases.AOFChan)))
+	w.Family("pulsedb_aof_queue_capacity", metrics.Gauge, "Commands AOFChan can hold before the writes wait.")
+	w.Sample("pulsedb_aof_queue_capacity", float64(cap(s.databases.AOFChan)))
+	w.Family("pulsedb_aof_write_duration_seconds", metrics.Histogram, "Time spent writing the queued commands to the AOF.")
+	w.Latency("pulsedb_aof_write_duration_seconds", &st.aofWriteLatency)
+	w.Family("pulsedb_aof_fsync_duration_seconds", metrics.Histogram, "Time spent in the fsyncs of the AOF.")
+	w.Latency("pulsedb_aof_fsync_duration_seconds", &st.aofFsyncLatency)
+	w.Family("pulsedb_snapshot_duration_seconds", metrics.Histogram, "Time spent writing the snapshots.")
+	w.Latency("pulsedb_snapshot_duration_seconds", &st.saveDuration)
+
+	st.mu.Lock()
+	aofOK, saveOK, lastSave := st.aofLastWriteErr == nil, st.lastSaveErr == nil, st.lastSave
+	st.mu.Unlock()
+	w.Family("pulsedb_aof_last_write_ok", metrics.Gauge, "1 when the last write to the AOF succeeded.")
+	w.Sample("pulsedb_aof_last_write_ok", boolValue(aofOK))
+	w.Family("pulsedb_snapshot_last_ok", metrics.Gauge, "1 when the last snapshot succeeded.")
+	w.Sample("pulsedb_snapshot_last_ok", boolValue(saveOK))
+	w.Family("pulsedb_snapshot_last_success_timestamp_seconds", metrics.Gauge, "Unix time of the last successful snapshot.")
+	w.Sample("pulsedb_snapshot_last_success_timestamp_seconds", float64(unixTime(lastSave)))
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/DNahar74/PulseDB/internal/command"
+	"github.com/DNahar74/PulseDB/internal/resp"
+	"github.com/DNahar74/PulseDB/internal/utils"
+)
+
+// monitorWriteTimeout bounds a write to a monitor, a monitor that stops reading is disconnected
+const monitorWriteTimeout = 10 * time.Second
+
+// monitor streams the commands run by every client to a connection, until it disconnects, falls too far behind or
+// sends RESET, & reports whether it sent RESET
+// Only QUIT, RESET & PING are run for a monitor, the other commands are refused
+func monitor(conn net.Conn, reader *resp.Reader) bool {
+	m := command.AddMonitor()
+	defer command.RemoveMonitor(m)
+
+	// The commands of the monitor are read one at a time, the next one is only read once the previous one is handled
+	// so that the connection reads them itself again after RESET
+	commands := make(chan resp.Type)
+	next := make(chan struct{})
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		defer close(commands)
+		for {
+			v, _, err := reader.ReadValue()
+			if err != nil {
+				return
+			}
+			select {
+			case commands <- v:
+			case <-stop:
+				return
+			}
+			select {
+			case <-next:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	var msg resp.Type = resp.SimpleString{Value: "OK"}
+	for {
+		_ = conn.SetWriteDeadline(time.Now().Add(monitorWriteTimeout))
+		err := utils.SendMessage(conn, msg)
+		if err != nil {
+			fmt.Println("Error sending to the monitor:", err)
+			return false
+		}
+
+		select {
+		case line, ok := <-m.Lines():
+			if !ok {
+				fmt.Println("Disconnecting the monitor, it fell too far behind:", clientAddr(conn))
+				return false
+			}
+			msg = resp.SimpleString{Value: line}
+		case v, ok := <-commands:
+			if !ok {
+				fmt.Println("Monitor disconnected:", clientAddr(conn))
+				return false
+			}
+
+			name, _, _ := commandName(v)
+			switch name {
+			case "QUIT":
+				_ = utils.SendMessage(conn, resp.SimpleString{Value: "OK"})
+				return false
+			case "RESET":
+				_ = conn.SetWriteDeadline(time.Time{})
+				_ = utils.SendMessage(conn, resp.SimpleString{Value: "RESET"})
+				return true
+			case "PING":
+				msg = resp.SimpleString{Value: "PONG"}
+			default:
+				msg = resp.SimpleError{Value: "the connection is monitoring, only QUIT, RESET & PING are allowed"}
+			}
+			next <- struct{}{}
+		}
+	}
+}
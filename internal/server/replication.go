@@ -0,0 +1,689 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DNahar74/PulseDB/internal/command"
+	"github.com/DNahar74/PulseDB/internal/resp"
+	"github.com/DNahar74/PulseDB/internal/utils"
+)
+
+const (
+	replicaBufferSize   = 100000 // commands queued for a replica before it is disconnected
+	replPingPeriod      = 10 * time.Second
+	replAckPeriod       = 1 * time.Second
+	replTimeout         = 60 * time.Second
+	replReconnectPeriod = 1 * time.Second
+)
+
+// States of the link of a replica to its primary
+const (
+	linkConnect    = "connect"
+	linkConnecting = "connecting"
+	linkHandshake  = "handshake"
+	linkSync       = "sync"
+	linkConnected  = "connected"
+)
+
+// replication holds the replication state of the server, both as a primary & as a replica
+type replication struct {
+	mu sync.Mutex
+
+	// port announced to the primary when this server is a replica
+	listeningPort string
+	// masterUser & masterAuth authenticate this server to the primary when masterAuth is not empty, they are guarded by
+	// mu as CONFIG SET changes them
+	masterUser string
+	masterAuth string
+	// dial connects to the primary, over TLS with tls-replication
+	dial func(address string, timeout time.Duration) (net.Conn, error)
+
+	// replID identifies the history of the dataset, offset is the number of bytes of that history
+	replID string
+	offset int64
+	// replID2 is the previous replID, valid up to secondOffset, so that replicas of the old primary can resume after a failover
+	replID2      string
+	secondOffset int64
+
+	backlog  *backlog
+	replicas map[*replica]struct{}
+
+	// Set while this server is a replica
+	masterHost string
+	masterPort string
+	link       *masterLink
+	// masterSession applies the stream of the primary, it is kept across partial resyncs so that the selected database is too
+	masterSession *command.Session
+}
+
+// replica is a replica connected to this server
+type replica struct {
+	conn net.Conn
+	ip   string
+	port string
+	ch   chan string
+
+	mu        sync.Mutex
+	state     string
+	ackOffset int64
+	ackTime   time.Time
+}
+
+// masterLink is the connection of this server to its primary
+type masterLink struct {
+	stop chan struct{}
+
+	mu     sync.Mutex
+	conn   net.Conn
+	state  string
+	lastIO time.Time
+}
+
+func newReplication(address string, backlogSize int64) *replication {
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		port = "6380"
+	}
+
+	return &replication{
+		listeningPort: port,
+		dial:          dialTCP,
+		replID:        newReplID(),
+		replID2:       strings.Repeat("0", 40),
+		secondOffset:  -1,
+		backlog:       newBacklog(int(backlogSize)),
+		replicas:      make(map[*replica]struct{}),
+		masterSession: command.NewSession(),
+	}
+}
+
+// setMasterAuth changes the credentials sent to the primary, they are used from the next connection to it
+func (r *replication) setMasterAuth(user, auth string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.masterUser, r.masterAuth = user, auth
+}
+
+func dialTCP(address string, timeout time.Duration) (net.Conn, error) {
+	return net.DialTimeout("tcp", address, timeout)
+}
+
+func newReplID() string {
+	b := make([]byte, 20)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+//* Primary side *//
+
+// Feed appends a command to the replication stream
+func (r *replication) Feed(cmd string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.feedLocked(cmd)
+}
+
+func (r *replication) feedLocked(cmd string) {
+	r.offset += int64(len(cmd))
+	r.backlog.write([]byte(cmd))
+
+	for rep := range r.replicas {
+		select {
+		case rep.ch <- cmd:
+		default:
+			// A replica that cannot keep up is dropped, it will resync when it reconnects
+			fmt.Println("Replica output buffer is full, disconnecting:", rep.conn.RemoteAddr().String())
+			r.dropReplicaLocked(rep)
+		}
+	}
+}
+
+func (r *replication) dropReplicaLocked(rep *replica) {
+	if _, ok := r.replicas[rep]; !ok {
+		return
+	}
+	delete(r.replicas, rep)
+	close(rep.ch)
+	_ = rep.conn.Close()
+}
+
+func (r *replication) dropReplica(rep *replica) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.dropReplicaLocked(rep)
+}
+
+// pingReplicas keeps the replication stream alive, so that replicas can detect a dead primary
+func (r *replication) pingReplicas() {
+	ping, _ := resp.Array{Length: 1, Items: []resp.Type{resp.BulkString{Value: "PING", Length: 4}}}.Serialize()
+
+	for {
+		time.Sleep(replPingPeriod)
+
+		r.mu.Lock()
+		if len(r.replicas) > 0 {
+			r.feedLocked(ping)
+		}
+		r.mu.Unlock()
+	}
+}
+
+// syncReplica handles PSYNC (or SYNC when psync is false) on a connection, which becomes a replica
+// It replies with a partial resync if the requested offset is still in the backlog, and with a full resync otherwise
+func (r *replication) syncReplica(conn net.Conn, args []string, listeningPort string, psync bool) (*replica, error) {
+	ip, port, _ := net.SplitHostPort(conn.RemoteAddr().String())
+	if listeningPort != "" {
+		port = listeningPort
+	}
+
+	rep := &replica{
+		conn:  conn,
+		ip:    ip,
+		port:  port,
+		ch:    make(chan string, replicaBufferSize),
+		state: "wait_bgsave",
+	}
+
+	if psync {
+		if len(args) != 2 {
+			return nil, errors.New("wrong number of arguments for 'psync' command")
+		}
+
+		offset, err := strconv.ParseInt(args[1], 10, 64)
+		if err == nil {
+			if preamble, ok := r.tryPartialSync(rep, args[0], offset); ok {
+				fmt.Println("Partial resynchronization accepted for replica", conn.RemoteAddr().String())
+				go r.serveReplica(rep, preamble)
+				return rep, nil
+			}
+		}
+	}
+
+	var replID string
+	var offset int64
+
+	payload, err := command.Dump(func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		replID, offset = r.replID, r.offset
+		rep.state = "send_bulk"
+		r.replicas[rep] = struct{}{}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Full resynchronization for replica", conn.RemoteAddr().String())
+
+	preamble := ""
+	if psync {
+		preamble = fmt.Sprintf("+FULLRESYNC %s %d\r\n", replID, offset)
+	}
+	preamble += fmt.Sprintf("$%d\r\n%s\r\n", len(payload), payload)
+
+	go r.serveReplica(rep, []byte(preamble))
+	return rep, nil
+}
+
+// tryPartialSync registers the replica if it can resume from offset, & returns what it must be sent first
+func (r *replication) tryPartialSync(rep *replica, replID string, offset int64) ([]byte, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if replID != r.replID && (replID != r.replID2 || offset > r.secondOffset) {
+		return nil, false
+	}
+
+	data, ok := r.backlog.readFrom(offset)
+	if !ok {
+		return nil, false
+	}
+
+	rep.state = "online"
+	r.replicas[rep] = struct{}{}
+
+	preamble := []byte(fmt.Sprintf("+CONTINUE %s\r\n", r.replID))
+	return append(preamble, data...), true
+}
+
+// serveReplica writes the sync preamble & then the replication stream to a replica
+func (r *replication) serveReplica(rep *replica, preamble []byte) {
+	_, err := rep.conn.Write(preamble)
+	if err != nil {
+		fmt.Println("Error sending the sync payload to the replica:", err)
+		r.dropReplica(rep)
+		return
+	}
+
+	rep.mu.Lock()
+	rep.state = "online"
+	rep.mu.Unlock()
+
+	for cmd := range rep.ch {
+		_, err := rep.conn.Write([]byte(cmd))
+		if err != nil {
+			fmt.Println("Error writing to the replica:", err)
+			r.dropReplica(rep)
+			return
+		}
+	}
+}
+
+// ack records the offset acknowledged by a replica with REPLCONF ACK
+func (rep *replica) ack(offset int64) {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	rep.ackOffset = offset
+	rep.ackTime = time.Now()
+}
+
+//* Replica side *//
+
+// IsReplica is true while the server follows a primary
+func (r *replication) IsReplica() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.masterHost != ""
+}
+
+// ReplicaOf makes the server a replica of host:port
+func (r *replication) ReplicaOf(host, port string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.masterHost == host && r.masterPort == port {
+		return nil
+	}
+
+	if r.link != nil {
+		r.link.close()
+	}
+
+	r.masterHost, r.masterPort = host, port
+	r.link = &masterLink{stop: make(chan struct{}), state: linkConnect}
+
+	fmt.Printf("Connecting to MASTER %s:%s\n", host, port)
+	go r.runLink(r.link, net.JoinHostPort(host, port))
+
+	return nil
+}
+
+// NoReplicaOf stops following the primary & turns the server into a primary
+func (r *replication) NoReplicaOf() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.masterHost == "" {
+		return nil
+	}
+
+	r.link.close()
+	r.link = nil
+	r.masterHost, r.masterPort = "", ""
+
+	// Keep the old history valid up to now, so that the other replicas of the old primary can resume from us
+	r.replID2 = r.replID
+	r.secondOffset = r.offset + 1
+	r.replID = newReplID()
+
+	fmt.Println("MASTER MODE enabled, new replication ID:", r.replID)
+	return nil
+}
+
+func (l *masterLink) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	select {
+	case <-l.stop:
+		return
+	default:
+	}
+
+	close(l.stop)
+	if l.conn != nil {
+		_ = l.conn.Close()
+	}
+}
+
+func (l *masterLink) stopped() bool {
+	select {
+	case <-l.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (l *masterLink) setState(state string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.state = state
+	l.lastIO = time.Now()
+}
+
+// runLink keeps the replica connected to its primary until the link is closed
+func (r *replication) runLink(link *masterLink, address string) {
+	for !link.stopped() {
+		err := r.syncWithMaster(link, address)
+		if err != nil && !link.stopped() {
+			fmt.Println("Replication link error:", err)
+		}
+		link.setState(linkConnect)
+
+		select {
+		case <-link.stop:
+		case <-time.After(replReconnectPeriod):
+		}
+	}
+}
+
+func (r *replication) syncWithMaster(link *masterLink, address string) error {
+	link.setState(linkConnecting)
+
+	conn, err := r.dial(address, replTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	link.mu.Lock()
+	if link.stopped() {
+		link.mu.Unlock()
+		return nil
+	}
+	link.conn = conn
+	link.mu.Unlock()
+
+	reader := resp.NewReader(conn)
+
+	// The handshake is a series of commands that must each be answered without an error
+	link.setState(linkHandshake)
+	r.mu.Lock()
+	replID, offset := r.replID, r.offset
+	masterUser, masterAuth := r.masterUser, r.masterAuth
+	r.mu.Unlock()
+
+	handshake := [][]string{
+		{"PING"},
+		{"REPLCONF", "listening-port", r.listeningPort},
+		{"PSYNC", replID, strconv.FormatInt(offset+1, 10)},
+	}
+	if masterAuth != "" {
+		auth := []string{"AUTH", masterAuth}
+		if masterUser != "" {
+			auth = []string{"AUTH", masterUser, masterAuth}
+		}
+		handshake = append([][]string{auth}, handshake...)
+	}
+
+	var reply resp.Type
+	for _, argv := range handshake {
+		reply, err = utils.SendCommand(conn, reader, argv...)
+		if err != nil {
+			return err
+		}
+	}
+
+	status, ok := reply.(resp.SimpleString)
+	if !ok {
+		return fmt.Errorf("unexpected reply to PSYNC: %v", reply)
+	}
+
+	fields := strings.Fields(status.Value)
+	switch {
+	case len(fields) == 3 && fields[0] == "FULLRESYNC":
+		err = r.fullSync(link, reader, fields[1], fields[2])
+		if err != nil {
+			return err
+		}
+	case len(fields) >= 1 && fields[0] == "CONTINUE":
+		fmt.Println("Partial resynchronization with MASTER succeeded")
+		if len(fields) == 2 {
+			r.mu.Lock()
+			if fields[1] != r.replID {
+				r.replID2 = r.replID
+				r.secondOffset = r.offset + 1
+				r.replID = fields[1]
+			}
+			r.mu.Unlock()
+		}
+	default:
+		return fmt.Errorf("unexpected reply to PSYNC: %s", status.Value)
+	}
+
+	link.setState(linkConnected)
+	go r.sendAcks(link, conn)
+
+	return r.streamFromMaster(link, conn, reader)
+}
+
+// fullSync loads the dataset sent by the primary & adopts its replication ID & offset
+func (r *replication) fullSync(link *masterLink, reader *resp.Reader, replID, offsetStr string) error {
+	offset, err := strconv.ParseInt(offsetStr, 10, 64)
+	if err != nil {
+		return err
+	}
+
+	link.setState(linkSync)
+
+	v, _, err := reader.ReadValue()
+	if err != nil {
+		return err
+	}
+	payload, ok := v.(resp.BulkString)
+	if !ok {
+		return errors.New("invalid sync payload from MASTER")
+	}
+
+	err = command.LoadDump(payload.Value)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.replID = replID
+	r.offset = offset
+	r.masterSession = command.NewSession()
+	r.replID2 = strings.Repeat("0", 40)
+	r.secondOffset = -1
+	r.backlog.reset(offset)
+
+	// Our own replicas have a history that does not exist anymore
+	for rep := range r.replicas {
+		r.dropReplicaLocked(rep)
+	}
+
+	fmt.Println("MASTER <-> REPLICA sync: finished with success")
+	return nil
+}
+
+// streamFromMaster applies the commands sent by the primary & forwards them to our own replicas
+func (r *replication) streamFromMaster(link *masterLink, conn net.Conn, reader *resp.Reader) error {
+	r.mu.Lock()
+	sess := r.masterSession
+	r.mu.Unlock()
+
+	for {
+		// The primary pings regularly, a silent link is considered dead
+		_ = conn.SetReadDeadline(time.Now().Add(replTimeout))
+
+		v, n, err := reader.ReadValue()
+		if err != nil {
+			return err
+		}
+		link.setState(linkConnected)
+
+		err = command.ApplyReplicated(sess, v)
+		if err != nil {
+			fmt.Println("Error applying a replicated command:", err)
+		}
+
+		cmd, err := v.Serialize()
+		if err != nil {
+			return err
+		}
+
+		if len(cmd) != n {
+			fmt.Println("Replicated command was re-encoded with a different length, offsets may drift")
+		}
+
+		r.mu.Lock()
+		r.feedLocked(cmd)
+		r.mu.Unlock()
+	}
+}
+
+// sendAcks periodically reports the processed offset to the primary
+func (r *replication) sendAcks(link *masterLink, conn net.Conn) {
+	ticker := time.NewTicker(replAckPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-link.stop:
+			return
+		case <-ticker.C:
+		}
+
+		r.mu.Lock()
+		offset := r.offset
+		r.mu.Unlock()
+
+		str, _ := resp.Array{Length: 3, Items: []resp.Type{
+			resp.BulkString{Value: "REPLCONF", Length: 8},
+			resp.BulkString{Value: "ACK", Length: 3},
+			resp.BulkString{Value: strconv.FormatInt(offset, 10), Length: len(strconv.FormatInt(offset, 10))},
+		}}.Serialize()
+
+		_, err := conn.Write([]byte(str))
+		if err != nil {
+			return
+		}
+	}
+}
+
+//* Introspection *//
+
+// Role returns the reply of the ROLE command
+func (r *replication) Role() resp.Type {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.masterHost != "" {
+		port, _ := strconv.Atoi(r.masterPort)
+		return resp.Array{Length: 5, Items: []resp.Type{
+			resp.BulkString{Value: "slave", Length: 5},
+			resp.BulkString{Value: r.masterHost, Length: len(r.masterHost)},
+			resp.Integer{Value: port},
+			resp.BulkString{Value: r.link.getState(), Length: len(r.link.getState())},
+			resp.Integer{Value: int(r.offset)},
+		}}
+	}
+
+	replicas := make([]resp.Type, 0, len(r.replicas))
+	for rep := range r.replicas {
+		rep.mu.Lock()
+		ack := strconv.FormatInt(rep.ackOffset, 10)
+		rep.mu.Unlock()
+
+		replicas = append(replicas, resp.Array{Length: 3, Items: []resp.Type{
+			resp.BulkString{Value: rep.ip, Length: len(rep.ip)},
+			resp.BulkString{Value: rep.port, Length: len(rep.port)},
+			resp.BulkString{Value: ack, Length: len(ack)},
+		}})
+	}
+
+	return resp.Array{Length: 3, Items: []resp.Type{
+		resp.BulkString{Value: "master", Length: 6},
+		resp.Integer{Value: int(r.offset)},
+		resp.Array{Length: len(replicas), Items: replicas},
+	}}
+}
+
+func (l *masterLink) getState() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.state
+}
+
+// Info returns the fields of the replication section of INFO
+func (r *replication) Info() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fields := make([]string, 0)
+
+	if r.masterHost != "" {
+		r.link.mu.Lock()
+		state, lastIO := r.link.state, r.link.lastIO
+		r.link.mu.Unlock()
+
+		linkStatus := "down"
+		if state == linkConnected {
+			linkStatus = "up"
+		}
+		syncing := 0
+		if state == linkSync {
+			syncing = 1
+		}
+
+		fields = append(fields,
+			"role:slave",
+			"master_host:"+r.masterHost,
+			"master_port:"+r.masterPort,
+			"master_link_status:"+linkStatus,
+			fmt.Sprintf("master_last_io_seconds_ago:%d", int(time.Since(lastIO).Seconds())),
+			fmt.Sprintf("master_sync_in_progress:%d", syncing),
+			fmt.Sprintf("slave_repl_offset:%d", r.offset),
+			"slave_read_only:1",
+		)
+	} else {
+		fields = append(fields, "role:master")
+	}
+
+	fields = append(fields, fmt.Sprintf("connected_slaves:%d", len(r.replicas)))
+
+	i := 0
+	for rep := range r.replicas {
+		rep.mu.Lock()
+		lag := 0
+		if !rep.ackTime.IsZero() {
+			lag = int(time.Since(rep.ackTime).Seconds())
+		}
+		fields = append(fields, fmt.Sprintf("slave%d:ip=%s,port=%s,state=%s,offset=%d,lag=%d", i, rep.ip, rep.port, rep.state, rep.ackOffset, lag))
+		rep.mu.Unlock()
+		i++
+	}
+
+	fields = append(fields,
+		"master_replid:"+r.replID,
+		"master_replid2:"+r.replID2,
+		fmt.Sprintf("master_repl_offset:%d", r.offset),
+		fmt.Sprintf("second_repl_offset:%d", r.secondOffset),
+		"repl_backlog_active:1",
+		fmt.Sprintf("repl_backlog_size:%d", len(r.backlog.buf)),
+		fmt.Sprintf("repl_backlog_first_byte_offset:%d", r.backlog.firstByte()),
+		fmt.Sprintf("repl_backlog_histlen:%d", r.backlog.histlen),
+	)
+
+	return fields
+}
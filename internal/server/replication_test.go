@@ -0,0 +1,177 @@
+package server
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DNahar74/PulseDB/internal/config"
+	"github.com/DNahar74/PulseDB/internal/resp"
+	"github.com/DNahar74/PulseDB/internal/utils"
+)
+
+// startTestServer starts a server on a free loopback port, inside a temporary directory for its persistence files
+// configure can change the settings of the server before it starts
+func startTestServer(t *testing.T, configure ...func(s *Server)) string {
+	t.Helper()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+
+	cfg := config.Default()
+	cfg.Bind = "127.0.0.1"
+	cfg.Port = freePort(t)
+	address := cfg.Address()
+	s := NewServer(cfg)
+	for _, fn := range configure {
+		fn(s)
+	}
+	go func() {
+		_ = s.Start()
+	}()
+
+	for range 50 {
+		conn, err := net.Dial("tcp", address)
+		if err == nil {
+			_ = conn.Close()
+			return address
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	t.Fatalf("server did not start on %s", address)
+	return ""
+}
+
+// freePort returns a loopback port that is free to listen on
+func freePort(t *testing.T) int {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func dialTestServer(t *testing.T, address string) (net.Conn, *resp.Reader) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	return conn, resp.NewReader(conn)
+}
+
+func mustSend(t *testing.T, conn net.Conn, reader *resp.Reader, argv ...string) resp.Type {
+	t.Helper()
+
+	reply, err := utils.SendCommand(conn, reader, argv...)
+	if err != nil {
+		t.Fatalf("%v: %v", argv, err)
+	}
+	return reply
+}
+
+// readStreamed reads the next command of a replication stream, skipping the SELECT commands
+// It returns the command & the number of bytes read
+func readStreamed(t *testing.T, reader *resp.Reader) (string, int) {
+	t.Helper()
+
+	total := 0
+	for {
+		cmd, n, err := reader.ReadValue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		total += n
+
+		str, _ := cmd.Serialize()
+		if !strings.Contains(str, "SELECT") {
+			return str, total
+		}
+	}
+}
+
+func TestReplicationSync(t *testing.T) {
+	address := startTestServer(t)
+
+	client, clientReader := dialTestServer(t, address)
+	mustSend(t, client, clientReader, "SET", "before", "1")
+
+	// Full resync: the dataset is sent as a snapshot, followed by the live stream
+	replicaConn, replicaReader := dialTestServer(t, address)
+	reply := mustSend(t, replicaConn, replicaReader, "PSYNC", "?", "-1")
+
+	fields := strings.Fields(reply.(resp.SimpleString).Value)
+	if len(fields) != 3 || fields[0] != "FULLRESYNC" {
+		t.Fatalf("expected FULLRESYNC, got %v", reply)
+	}
+	replID := fields[1]
+	offset, _ := strconv.ParseInt(fields[2], 10, 64)
+
+	payload, _, err := replicaReader.ReadValue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(payload.(resp.BulkString).Value, "before") {
+		t.Errorf("snapshot %q does not contain the existing key", payload)
+	}
+
+	mustSend(t, client, clientReader, "SET", "after", "2")
+	mustSend(t, client, clientReader, "GET", "after")
+
+	str, n := readStreamed(t, replicaReader)
+	if !strings.Contains(str, "after") {
+		t.Errorf("expected the SET to be streamed, got %q", str)
+	}
+	offset += int64(n)
+	_ = replicaConn.Close()
+
+	// Partial resync: a reconnecting replica only receives what it missed
+	mustSend(t, client, clientReader, "SET", "missed", "3")
+
+	replicaConn, replicaReader = dialTestServer(t, address)
+	reply = mustSend(t, replicaConn, replicaReader, "PSYNC", replID, strconv.FormatInt(offset+1, 10))
+	if !strings.HasPrefix(reply.(resp.SimpleString).Value, "CONTINUE") {
+		t.Fatalf("expected CONTINUE, got %v", reply)
+	}
+
+	str, _ = readStreamed(t, replicaReader)
+	if !strings.Contains(str, "missed") {
+		t.Errorf("expected the missed SET to be sent from the backlog, got %q", str)
+	}
+}
+
+func TestReplicationAuth(t *testing.T) {
+	address := startTestServer(t, func(s *Server) { s.config.RequirePass = "secret" })
+
+	replicaConn, replicaReader := dialTestServer(t, address)
+	for _, argv := range [][]string{{"REPLCONF", "listening-port", "6381"}, {"PSYNC", "?", "-1"}} {
+		_, err := utils.SendCommand(replicaConn, replicaReader, argv...)
+		if err == nil || !strings.Contains(err.Error(), "NOAUTH") {
+			t.Errorf("%v before AUTH: %v", argv, err)
+		}
+	}
+
+	mustSend(t, replicaConn, replicaReader, "AUTH", "secret")
+	reply := mustSend(t, replicaConn, replicaReader, "PSYNC", "?", "-1")
+	if !strings.HasPrefix(reply.(resp.SimpleString).Value, "FULLRESYNC") {
+		t.Errorf("expected FULLRESYNC, got %v", reply)
+	}
+}
@@ -1,59 +1,295 @@
 package server
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io/fs"
 	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
 
+	"github.com/DNahar74/PulseDB/internal/acl"
+	"github.com/DNahar74/PulseDB/internal/cluster"
 	"github.com/DNahar74/PulseDB/internal/command"
+	"github.com/DNahar74/PulseDB/internal/config"
 	"github.com/DNahar74/PulseDB/internal/store"
 )
 
 // Server represents a Redis server configurations
 type Server struct {
-	address string
+	// configMu guards config, which CONFIG SET changes while the server runs
+	configMu sync.RWMutex
+	config   *config.Config
+
+	databases *store.Databases
+	users     *acl.ACL
+	repl      *replication
+	cluster   *cluster.Cluster
+	tls       *tlsCredentials
+	stats     serverStats
+	clients   clientRegistry
+
+	mu        sync.Mutex
+	listeners []net.Listener
+	closed    bool
+}
+
+// NewServer creates a new Server object with its settings
+func NewServer(cfg *config.Config) *Server {
+	return &Server{config: cfg}
 }
 
-// NewServer creates a new Server object
-func NewServer(address string) *Server {
-	return &Server{address: address}
+// settings returns a copy of the settings, which stays the same while CONFIG SET changes them
+func (s *Server) settings() config.Config {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+
+	return *s.config
 }
 
 // Start starts the Redis server
 func (s *Server) Start() error {
-	listener, err := net.Listen("tcp", s.address)
+	cfg := s.settings()
+	s.stats.startTime = time.Now()
+	s.stats.lastSave = s.stats.startTime
+	s.stats.runID = newReplID()
+
+	listeners, err := s.listen(cfg)
 	if err != nil {
-		fmt.Println("Error starting the listener:", err)
 		return err
 	}
-	defer func(listener net.Listener) {
-		err := listener.Close()
-		if err != nil {
-			fmt.Println("Error closing the listener:", err)
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		closeListeners(listeners)
+		return nil
+	}
+	s.listeners = listeners
+	s.mu.Unlock()
+	defer closeListeners(listeners)
+
+	s.databases = store.CreateDatabasesWithAOFBuffer(cfg.Databases, cfg.AOFBufferSize)
+	s.databases.SetMaxMemory(cfg.MaxMemory, cfg.MaxMemoryPolicy)
+	command.InitDatabases(s.databases)
+
+	s.users = acl.New(cfg.ACLFile)
+	s.users.SetRequirePass(cfg.RequirePass)
+	if cfg.ACLFile != "" {
+		// A missing file is created by ACL SAVE
+		err = s.users.Load()
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			fmt.Println("Error loading the ACL file:", err)
+			return err
 		}
-	}(listener)
+	}
+	command.InitACL(s.users)
 
-	fmt.Println("Server listening on", s.address)
+	s.repl = newReplication(announceAddress(cfg), cfg.ReplBacklogSize)
+	s.repl.setMasterAuth(cfg.MasterUser, cfg.MasterAuth)
+	if cfg.TLSReplication {
+		if s.tls == nil {
+			return errors.New("tls-replication needs TLS to be enabled")
+		}
+		s.repl.dial = s.tlsDialer()
+	}
+	command.InitReplication(s.repl)
+	command.InitConfig(s)
+	command.InitInfo(s)
+	command.InitClients(s)
+	command.SetSlowlog(cfg.SlowlogLogSlowerThan, cfg.SlowlogMaxLen)
 
-	var RedisStore = store.CreateStorage()
-	command.InitStore(RedisStore)
+	if cfg.ClusterEnabled {
+		err = s.startCluster(cfg)
+		if err != nil {
+			return err
+		}
+	}
 
-	err = restoreStorage()
+	aofPath := filepath.Join(cfg.Dir, cfg.AppendFilename)
+	err = restoreStorage(aofPath, cfg.AOFLoadTruncated)
 	if err != nil {
 		return err
 	}
 
-	go handleAOF(RedisStore)
-	go handleMemoryState(RedisStore)
+	go s.handleAOF(aofPath)
+	go s.handleMemoryState(filepath.Join(cfg.Dir, cfg.DBFilename))
+	go s.handleActiveExpiry()
+	go s.handleStatsSampling()
+	go s.repl.pingReplicas()
 
+	if address := cfg.MetricsAddress(); address != "" {
+		err = s.startMetrics(address)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The server stops with the first listener that fails, or when it is closed
+	errs := make(chan error, len(listeners))
+	for _, listener := range listeners {
+		go func() {
+			errs <- s.serve(listener)
+		}()
+	}
+	return <-errs
+}
+
+// Close stops accepting connections, the Unix socket file is removed with its listener
+func (s *Server) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	closeListeners(s.listeners)
+	s.listeners = nil
+}
+
+func closeListeners(listeners []net.Listener) {
+	for _, listener := range listeners {
+		err := listener.Close()
+		if err != nil && !errors.Is(err, net.ErrClosed) {
+			fmt.Println("Error closing the listener:", err)
+		}
+	}
+}
+
+// listen opens the plain, TLS & Unix socket listeners of the server
+func (s *Server) listen(cfg config.Config) ([]net.Listener, error) {
+	var listeners []net.Listener
+	closeAll := func() {
+		for _, listener := range listeners {
+			_ = listener.Close()
+		}
+	}
+
+	if address := cfg.Address(); address != "" {
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			fmt.Println("Error starting the listener:", err)
+			return nil, err
+		}
+		listeners = append(listeners, listener)
+		fmt.Println("Server listening on", address)
+	}
+
+	if address := cfg.TLSAddress(); address != "" {
+		cert, cas, err := loadTLSCredentials(cfg)
+		if err != nil {
+			closeAll()
+			fmt.Println("Error loading the TLS certificates:", err)
+			return nil, err
+		}
+		s.tls = &tlsCredentials{cert: cert, cas: cas}
+		listener, err := tls.Listen("tcp", address, s.tlsServerConfig())
+		if err != nil {
+			closeAll()
+			fmt.Println("Error starting the TLS listener:", err)
+			return nil, err
+		}
+		listeners = append(listeners, listener)
+		fmt.Println("Server listening for TLS on", address)
+	}
+
+	if cfg.UnixSocket != "" {
+		listener, err := listenUnix(cfg.UnixSocket, cfg.UnixSocketPerm)
+		if err != nil {
+			closeAll()
+			fmt.Println("Error starting the Unix socket listener:", err)
+			return nil, err
+		}
+		listeners = append(listeners, listener)
+		fmt.Println("Server listening on the Unix socket", cfg.UnixSocket)
+	}
+
+	if len(listeners) == 0 {
+		return nil, errors.New("no address to listen on")
+	}
+	return listeners, nil
+}
+
+// serve accepts the connections of a listener
+func (s *Server) serve(listener net.Listener) error {
 	// Allow multiple connections
 	for {
 		conn, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
 		if err != nil {
 			fmt.Println("Error connecting the client", err)
 			return err
 		}
 
 		// make a goroutine for handling R/W
-		go handleConnection(conn, RedisStore)
+		go s.handleConnection(conn)
+	}
+}
+
+// listenUnix listens on a Unix socket, replacing the socket file left by a server that didn't shut down
+// The file is removed when the listener is closed
+func listenUnix(path string, perm os.FileMode) (net.Listener, error) {
+	info, err := os.Lstat(path)
+	if err == nil {
+		if info.Mode().Type() != os.ModeSocket {
+			return nil, fmt.Errorf("%s exists & is not a socket", path)
+		}
+		err = os.Remove(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
 	}
+	if perm != 0 {
+		err = os.Chmod(path, perm)
+		if err != nil {
+			_ = listener.Close()
+			return nil, err
+		}
+	}
+	return listener, nil
+}
+
+// announceAddress is the address whose port identifies the server to its primary & to the cluster, the TLS one when
+// the server doesn't listen on a plain port
+func announceAddress(cfg config.Config) string {
+	if cfg.Port == 0 {
+		return cfg.TLSAddress()
+	}
+	return cfg.Address()
+}
+
+// startCluster loads the cluster state & starts the cluster bus
+func (s *Server) startCluster(cfg config.Config) error {
+	_, portStr, err := net.SplitHostPort(announceAddress(cfg))
+	if err != nil {
+		return err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return err
+	}
+
+	s.cluster, err = cluster.New(cfg.ClusterAnnounceIP, port, cfg.ClusterConfigFile)
+	if err != nil {
+		fmt.Println("Error loading the cluster config:", err)
+		return err
+	}
+	command.InitCluster(s.cluster)
+
+	go func() {
+		err := s.cluster.Start(cfg.Bind)
+		if err != nil {
+			fmt.Println("Error starting the cluster bus:", err)
+		}
+	}()
+
+	return nil
 }
@@ -0,0 +1,307 @@
+package server
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DNahar74/PulseDB/internal/resp"
+	"github.com/DNahar74/PulseDB/internal/utils"
+)
+
+func TestUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pulsedb.sock")
+
+	// A socket file left by a server that didn't shut down is replaced
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	_ = stale.Close()
+
+	var srv *Server
+	address := startTestServer(t, func(s *Server) {
+		srv = s
+		s.config.UnixSocket = path
+		s.config.UnixSocketPerm = 0700
+	})
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0700 {
+		t.Errorf("socket permissions = %v, want 0700", info.Mode().Perm())
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	reader := resp.NewReader(conn)
+
+	mustSend(t, conn, reader, "SET", "k", "v")
+	tcpConn, tcpReader := dialTestServer(t, address)
+	if reply := mustSend(t, tcpConn, tcpReader, "GET", "k"); reply != (resp.BulkString{Value: "v", Length: 1}) {
+		t.Errorf("GET over TCP of a key set over the Unix socket = %v", reply)
+	}
+
+	// The ACL log identifies the clients of the socket by its path
+	mustSend(t, conn, reader, "ACL", "SETUSER", "bob", "on", "nopass")
+	mustSend(t, conn, reader, "AUTH", "bob", "")
+	if _, err := utils.SendCommand(conn, reader, "GET", "k"); err == nil {
+		t.Fatal("GET by a user without commands succeeded")
+	}
+	entry := mustSend(t, tcpConn, tcpReader, "ACL", "LOG", "1").(resp.Array).Items[0].(resp.Array)
+	if clientInfo := entry.Items[13].(resp.BulkString).Value; !strings.Contains(clientInfo, "addr="+path+":0") {
+		t.Errorf("client info = %q", clientInfo)
+	}
+
+	srv.Close()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("the socket file is still there after Close: %v", err)
+	}
+}
+
+func TestProtocolError(t *testing.T) {
+	address := startTestServer(t, func(s *Server) { s.config.RequirePass = "secret" })
+
+	// Anything but an array of BulkStrings closes the connection with an error, before AUTH as after it
+	for _, input := range []string{"*-1\r\n", "$-1\r\n", ":1\r\n", "*1\r\n:1\r\n", "*0\r\n", "$9223372036854775807\r\n"} {
+		conn, reader := dialTestServer(t, address)
+		if _, err := conn.Write([]byte(input)); err != nil {
+			t.Fatal(err)
+		}
+		reply, _, err := reader.ReadValue()
+		if e, ok := reply.(resp.SimpleError); err != nil || !ok || !strings.HasPrefix(e.Value, "Protocol error") {
+			t.Errorf("reply to %q = %v, %v", input, reply, err)
+		}
+		if _, _, err := reader.ReadValue(); err != io.EOF {
+			t.Errorf("the connection is still open after %q: %v", input, err)
+		}
+	}
+
+	conn, reader := dialTestServer(t, address)
+	mustSend(t, conn, reader, "AUTH", "secret")
+	mustSend(t, conn, reader, "PING")
+}
+
+func TestConfigSet(t *testing.T) {
+	address := startTestServer(t)
+	conn, reader := dialTestServer(t, address)
+
+	mustSend(t, conn, reader, "CONFIG", "SET", "maxmemory", "10mb", "maxmemory-policy", "allkeys-lru")
+	info := mustSend(t, conn, reader, "INFO", "memory").(resp.BulkString).Value
+	if !strings.Contains(info, "maxmemory:10485760") || !strings.Contains(info, "maxmemory_policy:allkeys-lru") {
+		t.Errorf("INFO memory after CONFIG SET:\n%s", info)
+	}
+
+	// The new password applies to the connections made after it
+	mustSend(t, conn, reader, "CONFIG", "SET", "requirepass", "secret")
+	other, otherReader := dialTestServer(t, address)
+	if _, err := utils.SendCommand(other, otherReader, "GET", "k"); err == nil || !strings.Contains(err.Error(), "NOAUTH") {
+		t.Errorf("GET without AUTH after CONFIG SET requirepass: %v", err)
+	}
+	mustSend(t, other, otherReader, "AUTH", "secret")
+
+	reply := mustSend(t, conn, reader, "CONFIG", "GET", "requirepass").(resp.Array)
+	if reply.Length != 2 || reply.Items[1] != (resp.BulkString{Value: "secret", Length: 6}) {
+		t.Errorf("CONFIG GET requirepass = %v", reply)
+	}
+	if _, err := utils.SendCommand(conn, reader, "CONFIG", "REWRITE"); err == nil || !strings.Contains(err.Error(), "without a config file") {
+		t.Errorf("CONFIG REWRITE without a config file: %v", err)
+	}
+}
+
+func TestInfo(t *testing.T) {
+	address := startTestServer(t)
+	conn, reader := dialTestServer(t, address)
+	dialTestServer(t, address)
+
+	info := mustSend(t, conn, reader, "INFO").(resp.BulkString).Value
+	_, port, _ := net.SplitHostPort(address)
+	for _, field := range []string{
+		"tcp_port:" + port,
+		"process_id:" + strconv.Itoa(os.Getpid()),
+		"connected_clients:2",
+		"aof_last_write_status:ok",
+		"rdb_last_bgsave_status:ok",
+	} {
+		if !strings.Contains(info, "\r\n"+field+"\r\n") {
+			t.Errorf("INFO has no %s:\n%s", field, info)
+		}
+	}
+
+	mustSend(t, conn, reader, "CONFIG", "RESETSTAT")
+	info = mustSend(t, conn, reader, "INFO", "stats").(resp.BulkString).Value
+	if !strings.Contains(info, "total_connections_received:0") {
+		t.Errorf("INFO stats after CONFIG RESETSTAT:\n%s", info)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	var metricsAddress string
+	address := startTestServer(t, func(s *Server) {
+		s.config.MetricsPort = freePort(t)
+		metricsAddress = s.config.MetricsAddress()
+	})
+	conn, reader := dialTestServer(t, address)
+	mustSend(t, conn, reader, "CONFIG", "RESETSTAT")
+	mustSend(t, conn, reader, "SET", "k", "v")
+	mustSend(t, conn, reader, "GET", "k")
+
+	var res *http.Response
+	var err error
+	for range 50 {
+		res, err = http.Get("http://" + metricsAddress + "/metrics")
+		if err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+
+	if res.Header.Get("Content-Type") != metricsContentType {
+		t.Errorf("Content-Type = %q", res.Header.Get("Content-Type"))
+	}
+	for _, line := range []string{
+		`pulsedb_commands_total{cmd="get"} 1` + "\n",
+		`pulsedb_command_duration_seconds_count{cmd="set"} 1` + "\n",
+		`pulsedb_keyspace_keys{db="0"} 1` + "\n",
+		"pulsedb_connected_clients 1\n",
+		"# TYPE pulsedb_aof_fsync_duration_seconds histogram\n",
+		"pulsedb_aof_queue_length ",
+		"go_goroutines ",
+	} {
+		if !strings.Contains(string(body), "\n"+line) {
+			t.Errorf("metrics have no %q", line)
+		}
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	address := startTestServer(t)
+	mon, monReader := dialTestServer(t, address)
+	if reply := mustSend(t, mon, monReader, "MONITOR"); reply != (resp.SimpleString{Value: "OK"}) {
+		t.Fatalf("MONITOR = %v", reply)
+	}
+
+	conn, reader := dialTestServer(t, address)
+	mustSend(t, conn, reader, "SET", "k", "v")
+	line, _, err := monReader.ReadValue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "[0 " + conn.LocalAddr().String() + `] "SET" "k" "v"`
+	if s, ok := line.(resp.SimpleString); !ok || !strings.HasSuffix(s.Value, want) {
+		t.Errorf("monitor line = %v, want one ending with %s", line, want)
+	}
+
+	// The monitor only runs QUIT, RESET & PING, RESET turns it back into a normal client
+	if _, err := utils.SendCommand(mon, monReader, "GET", "k"); err == nil || !strings.Contains(err.Error(), "monitoring") {
+		t.Errorf("GET on a monitor: %v", err)
+	}
+	if reply := mustSend(t, mon, monReader, "PING"); reply != (resp.SimpleString{Value: "PONG"}) {
+		t.Errorf("PING on a monitor = %v", reply)
+	}
+	if reply := mustSend(t, mon, monReader, "RESET"); reply != (resp.SimpleString{Value: "RESET"}) {
+		t.Errorf("RESET on a monitor = %v", reply)
+	}
+	mustSend(t, conn, reader, "SET", "k", "w")
+	if reply := mustSend(t, mon, monReader, "GET", "k"); reply != (resp.BulkString{Value: "w", Length: 1}) {
+		t.Errorf("GET after RESET = %v", reply)
+	}
+
+	mustSend(t, mon, monReader, "MONITOR")
+	if reply := mustSend(t, mon, monReader, "QUIT"); reply != (resp.SimpleString{Value: "OK"}) {
+		t.Errorf("QUIT on a monitor = %v", reply)
+	}
+	if _, _, err := monReader.ReadValue(); err != io.EOF {
+		t.Errorf("the monitor is still connected after QUIT: %v", err)
+	}
+}
+
+func TestClient(t *testing.T) {
+	address := startTestServer(t)
+	conn, reader := dialTestServer(t, address)
+	other, otherReader := dialTestServer(t, address)
+
+	mustSend(t, conn, reader, "CLIENT", "SETNAME", "worker")
+	mustSend(t, conn, reader, "SELECT", "3")
+	id := mustSend(t, conn, reader, "CLIENT", "ID").(resp.Integer).Value
+	list := mustSend(t, other, otherReader, "CLIENT", "LIST", "ID", strconv.Itoa(id)).(resp.BulkString).Value
+	want := "id=" + strconv.Itoa(id) + " addr=" + conn.LocalAddr().String()
+	if !strings.HasPrefix(list, want) || !strings.Contains(list, " name=worker ") || !strings.Contains(list, " db=3 ") ||
+		!strings.Contains(list, " cmd=client ") || !strings.Contains(list, " user=default ") || strings.Count(list, "\n") != 1 {
+		t.Errorf("CLIENT LIST = %q", list)
+	}
+	if info := mustSend(t, other, otherReader, "CLIENT", "INFO").(resp.BulkString).Value; strings.Contains(info, "name=worker") {
+		t.Errorf("CLIENT INFO describes another client: %q", info)
+	}
+
+	// The replies dropped by CLIENT REPLY SKIP are not sent at all
+	raw := func(argv ...string) {
+		items := make([]resp.Type, len(argv))
+		for i, a := range argv {
+			items[i] = resp.BulkString{Value: a, Length: len(a)}
+		}
+		str, _ := resp.Array{Length: len(items), Items: items}.Serialize()
+		if _, err := other.Write([]byte(str)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	raw("CLIENT", "REPLY", "SKIP")
+	raw("ECHO", "skipped")
+	if reply := mustSend(t, other, otherReader, "ECHO", "sent"); reply != (resp.BulkString{Value: "sent", Length: 4}) {
+		t.Errorf("reply after CLIENT REPLY SKIP = %v", reply)
+	}
+
+	// A write pause holds the writes back until CLIENT UNPAUSE, the reads still run
+	mustSend(t, other, otherReader, "CLIENT", "PAUSE", "10000", "WRITE")
+	mustSend(t, conn, reader, "EXISTS", "k")
+	raw("SET", "k", "v")
+	_ = other.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, _, err := otherReader.ReadValue(); err == nil {
+		t.Error("SET ran during CLIENT PAUSE WRITE")
+	}
+	mustSend(t, conn, reader, "CLIENT", "UNPAUSE")
+	other, otherReader = dialTestServer(t, address)
+	if reply := mustSend(t, other, otherReader, "EXISTS", "k"); reply != (resp.Integer{Value: 1}) {
+		t.Errorf("the paused SET didn't run after CLIENT UNPAUSE: %v", reply)
+	}
+
+	if reply := mustSend(t, other, otherReader, "CLIENT", "KILL", "ID", strconv.Itoa(id)); reply != (resp.Integer{Value: 1}) {
+		t.Errorf("CLIENT KILL ID = %v", reply)
+	}
+	if _, err := utils.SendCommand(conn, reader, "PING"); err == nil {
+		t.Error("the killed client is still connected")
+	}
+	if _, err := utils.SendCommand(other, otherReader, "CLIENT", "KILL", "127.0.0.1:1"); err == nil || !strings.HasSuffix(err.Error(), "No such client") {
+		t.Errorf("CLIENT KILL of an unknown address: %v", err)
+	}
+
+	// The clients of a disabled user stay connected until they are killed
+	mustSend(t, other, otherReader, "ACL", "SETUSER", "bob", "on", ">secret", "+@all", "~*")
+	bob, bobReader := dialTestServer(t, address)
+	mustSend(t, bob, bobReader, "AUTH", "bob", "secret")
+	mustSend(t, other, otherReader, "ACL", "SETUSER", "bob", "off")
+	if reply := mustSend(t, other, otherReader, "CLIENT", "KILL", "USER", "bob"); reply != (resp.Integer{Value: 1}) {
+		t.Errorf("CLIENT KILL USER of a disabled user = %v", reply)
+	}
+	if _, err := utils.SendCommand(bob, bobReader, "PING"); err == nil {
+		t.Error("the client of the disabled user is still connected")
+	}
+}
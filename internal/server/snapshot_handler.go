@@ -6,45 +6,69 @@ import (
 	"os"
 	"time"
 
+	"github.com/DNahar74/PulseDB/internal/command"
 	"github.com/DNahar74/PulseDB/internal/store"
 )
 
-func handleMemoryState(s *store.Store) {
+// handleMemoryState writes a snapshot of the keyspace every snapshot-interval
+func (s *Server) handleMemoryState(path string) {
 	for {
-		time.Sleep(10 * time.Second)
-		handleFile(s)
+		time.Sleep(s.settings().SnapshotInterval)
+		start := time.Now()
+		s.stats.recordSave(start, handleFile(s.databases, path))
 	}
 }
 
-func handleFile(s *store.Store) {
+func handleFile(d *store.Databases, path string) error {
 	content := ""
 
-	for key, value := range s.Items {
-		if value.Expiry.IsZero() || value.Expiry.After(time.Now()) {
-			content += key + " => \t"
-			str, err := value.Value.Serialize()
-			if err != nil {
-				return
-			}
-			content += str
-		} else {
-			err := s.DEL(key)
-			if err != nil {
-				fmt.Println("error deleting in background worker:", err)
-				return
-			}
+	for i := range d.Len() {
+		// Every database with keys starts with a "db N" line, so that the keys are restored in the right one
+		db, expired, err := snapshotDB(d.DB(i))
+		if err != nil {
+			return err
+		}
+		command.ExpireKeys(i, expired)
+		if len(db) > 0 {
+			content += fmt.Sprintf("db %d\n", i) + db
 		}
 	}
 
 	if len(content) > 0 {
-		file, err := os.Create("./memory.dat")
+		file, err := os.Create(path)
 		if err != nil {
 			fmt.Println("Error creating file")
-			return
+			return err
 		}
+		defer file.Close()
 		_, err = io.WriteString(file, content)
 		if err != nil {
-			return
+			return err
 		}
 	}
+	return nil
+}
+
+// snapshotDB serializes the keys of a database under its read lock, & returns the expired keys it left out so that
+// they are removed afterwards
+func snapshotDB(s *store.Store) (string, []string, error) {
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+
+	content := ""
+	var expired []string
+	now := time.Now()
+	for key, value := range s.Items {
+		if !value.Expiry.IsZero() && !value.Expiry.After(now) {
+			expired = append(expired, key)
+			continue
+		}
+		str, err := value.Value.Serialize()
+		if err != nil {
+			return "", nil, err
+		}
+		content += key + " => \t" + str
+	}
+
+	return content, expired, nil
 }
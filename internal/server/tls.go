@@ -0,0 +1,152 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/DNahar74/PulseDB/internal/command"
+	"github.com/DNahar74/PulseDB/internal/config"
+)
+
+// tlsHandshakeTimeout bounds the handshake of a TLS connection, so that a client that doesn't speak TLS doesn't hold
+// its goroutine
+const tlsHandshakeTimeout = 10 * time.Second
+
+// tlsCredentials holds the certificate of the server & the CAs of the client certificates
+// They are read again by ReloadTLS, the connections made after it use the new files
+type tlsCredentials struct {
+	mu   sync.RWMutex
+	cert *tls.Certificate
+	cas  *x509.CertPool
+}
+
+func (c *tlsCredentials) get() (*tls.Certificate, *x509.CertPool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.cert, c.cas
+}
+
+func (c *tlsCredentials) set(cert *tls.Certificate, cas *x509.CertPool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.cert, c.cas = cert, cas
+}
+
+// loadTLSCredentials reads the certificate, the key & the CA certificates of the TLS settings
+func loadTLSCredentials(cfg config.Config) (*tls.Certificate, *x509.CertPool, error) {
+	if cfg.TLSCertFile == "" || cfg.TLSKeyFile == "" {
+		return nil, nil, errors.New("TLS needs tls-cert-file & tls-key-file")
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if cfg.TLSCACertFile == "" {
+		if cfg.TLSAuthClients != config.TLSAuthClientsNo || cfg.TLSReplication {
+			return nil, nil, errors.New("tls-ca-cert-file is needed to verify the certificates of the peers")
+		}
+		return &cert, nil, nil
+	}
+	pem, err := os.ReadFile(cfg.TLSCACertFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	cas := x509.NewCertPool()
+	if !cas.AppendCertsFromPEM(pem) {
+		return nil, nil, fmt.Errorf("no certificate found in %s", cfg.TLSCACertFile)
+	}
+	return &cert, cas, nil
+}
+
+// ReloadTLS reads the TLS certificate, key & CA certificates again, without closing the connections made with the old
+// ones
+// The files in use are kept when the new ones can't be loaded
+func (s *Server) ReloadTLS() error {
+	if s.tls == nil {
+		return errors.New("TLS is not enabled")
+	}
+	cert, cas, err := loadTLSCredentials(s.settings())
+	if err != nil {
+		return err
+	}
+	s.tls.set(cert, cas)
+	return nil
+}
+
+// tlsServerConfig builds the config of the TLS listener, each handshake takes the credentials loaded last & the
+// current tls-auth-clients
+func (s *Server) tlsServerConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			clientAuth := tls.NoClientCert
+			switch s.settings().TLSAuthClients {
+			case config.TLSAuthClientsOptional:
+				clientAuth = tls.VerifyClientCertIfGiven
+			case config.TLSAuthClientsYes:
+				clientAuth = tls.RequireAndVerifyClientCert
+			}
+
+			cert, cas := s.tls.get()
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*cert},
+				ClientAuth:   clientAuth,
+				ClientCAs:    cas,
+			}, nil
+		},
+	}
+}
+
+// tlsDialer connects a replica to its primary over TLS, the server certificate is verified against the CA certificates
+// & the certificate of this server is given as the client one
+func (s *Server) tlsDialer() func(address string, timeout time.Duration) (net.Conn, error) {
+	return func(address string, timeout time.Duration) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		cert, cas := s.tls.get()
+		config := &tls.Config{
+			MinVersion:   tls.VersionTLS12,
+			ServerName:   host,
+			RootCAs:      cas,
+			Certificates: []tls.Certificate{*cert},
+		}
+		return tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", address, config)
+	}
+}
+
+// handshakeTLS completes the handshake of a TLS connection before its first command
+// With TLSAuthClientsUser set to CN, a client whose certificate was verified is authenticated as the ACL user named by
+// the common name of the certificate, when that user exists & is enabled
+func (s *Server) handshakeTLS(conn *tls.Conn, sess *command.Session) error {
+	_ = conn.SetDeadline(time.Now().Add(tlsHandshakeTimeout))
+	err := conn.Handshake()
+	if err != nil {
+		return err
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	if s.settings().TLSAuthClientsUser != "CN" {
+		return nil
+	}
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil
+	}
+	cn := certs[0].Subject.CommonName
+	if cn != "" && !sess.AuthenticateAs(cn) {
+		fmt.Println("No enabled ACL user for the client certificate CN:", cn)
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DNahar74/PulseDB/internal/resp"
+	"github.com/DNahar74/PulseDB/internal/utils"
+)
+
+// testCA signs the certificates of a test, which are generated on the fly
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "PulseDB test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue signs a certificate for a common name, valid for 127.0.0.1, & returns it & its key in PEM
+func (ca *testCA) issue(t *testing.T, serial int64, cn string) ([]byte, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// writeCert writes a certificate & its key to files of a directory
+func writeCert(t *testing.T, dir, name string, cert, key []byte) (string, string) {
+	t.Helper()
+
+	certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	if err := os.WriteFile(certFile, cert, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, key, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	caFile := filepath.Join(dir, "ca.crt")
+	if err := os.WriteFile(caFile, ca.pem, 0600); err != nil {
+		t.Fatal(err)
+	}
+	cert, key := ca.issue(t, 10, "server")
+	serverCert, serverKey := writeCert(t, dir, "server", cert, key)
+
+	var srv *Server
+	var tlsAddress string
+	address := startTestServer(t, func(s *Server) {
+		srv = s
+		s.config.TLSPort = freePort(t)
+		s.config.TLSCertFile = serverCert
+		s.config.TLSKeyFile = serverKey
+		s.config.TLSCACertFile = caFile
+		s.config.TLSAuthClientsUser = "CN"
+		tlsAddress = s.config.TLSAddress()
+	})
+
+	conn, reader := dialTestServer(t, address)
+	mustSend(t, conn, reader, "ACL", "SETUSER", "analytics", "on", "+@read", "+ping", "+acl|whoami", "~*")
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(ca.pem)
+	dialTLS := func(cn string) (*tls.Conn, *resp.Reader, error) {
+		config := &tls.Config{RootCAs: roots}
+		if cn != "" {
+			cert, err := tls.X509KeyPair(ca.issue(t, 20, cn))
+			if err != nil {
+				t.Fatal(err)
+			}
+			config.Certificates = []tls.Certificate{cert}
+		}
+		conn, err := tls.Dial("tcp", tlsAddress, config)
+		if err != nil {
+			return nil, nil, err
+		}
+		t.Cleanup(func() { _ = conn.Close() })
+		_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+		return conn, resp.NewReader(conn), nil
+	}
+
+	// The client certificate names its user
+	tlsConn, tlsReader, err := dialTLS("analytics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply := mustSend(t, tlsConn, tlsReader, "ACL", "WHOAMI"); reply != (resp.BulkString{Value: "analytics", Length: 9}) {
+		t.Errorf("ACL WHOAMI with the certificate of analytics = %v", reply)
+	}
+	if reply, err := utils.SendCommand(tlsConn, tlsReader, "SET", "k", "v"); err == nil {
+		t.Errorf("SET by a read-only certificate user = %v", reply)
+	}
+
+	// A CN that is not a user keeps the default user
+	tlsConn, tlsReader, err = dialTLS("nobody")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply := mustSend(t, tlsConn, tlsReader, "ACL", "WHOAMI"); reply != (resp.BulkString{Value: "default", Length: 7}) {
+		t.Errorf("ACL WHOAMI with the certificate of an unknown user = %v", reply)
+	}
+
+	// tls-auth-clients defaults to yes, the clients without a certificate are refused
+	if tlsConn, tlsReader, err = dialTLS(""); err == nil {
+		if _, err = utils.SendCommand(tlsConn, tlsReader, "PING"); err == nil {
+			t.Error("a client without a certificate was accepted")
+		}
+	}
+
+	// A new certificate is used by the connections made after the reload
+	cert, key = ca.issue(t, 11, "server")
+	writeCert(t, dir, "server", cert, key)
+	if err := srv.ReloadTLS(); err != nil {
+		t.Fatal(err)
+	}
+	tlsConn, tlsReader, err = dialTLS("analytics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustSend(t, tlsConn, tlsReader, "PING")
+	if serial := tlsConn.ConnectionState().PeerCertificates[0].SerialNumber.Int64(); serial != 11 {
+		t.Errorf("the server certificate after the reload has the serial %d, want 11", serial)
+	}
+
+	// A failed reload keeps the certificate in use
+	if err := os.WriteFile(serverCert, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.ReloadTLS(); err == nil {
+		t.Error("ReloadTLS of an invalid certificate succeeded")
+	}
+	if _, _, err := dialTLS("analytics"); err != nil {
+		t.Errorf("TLS after a failed reload: %v", err)
+	}
+}
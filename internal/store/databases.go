@@ -0,0 +1,86 @@
+package store
+
+import (
+	"sync"
+)
+
+// Databases are the logical databases of a server, selected by their index
+// They share the AOF channel & the memory limit
+type Databases struct {
+	dbs     []*Store
+	AOFChan chan string
+
+	mu          sync.Mutex
+	maxMemory   int64
+	policy      Policy
+	evictedKeys int64
+}
+
+// defaultAOFBufferSize is the number of commands queued for the AOF
+const defaultAOFBufferSize = 100000
+
+// CreateDatabases initializes n empty databases
+func CreateDatabases(n int) *Databases {
+	return CreateDatabasesWithAOFBuffer(n, defaultAOFBufferSize)
+}
+
+// CreateDatabasesWithAOFBuffer initializes n empty databases whose AOF channel holds aofBuffer commands
+func CreateDatabasesWithAOFBuffer(n, aofBuffer int) *Databases {
+	d := &Databases{
+		dbs:     make([]*Store, n),
+		AOFChan: make(chan string, aofBuffer),
+	}
+
+	for i := range d.dbs {
+		d.dbs[i] = CreateStorage()
+		d.dbs[i].AOFChan = d.AOFChan
+	}
+
+	return d
+}
+
+// Len returns the number of databases
+func (d *Databases) Len() int {
+	return len(d.dbs)
+}
+
+// DB returns the database at an index, which must be lower than Len
+func (d *Databases) DB(index int) *Store {
+	return d.dbs[index]
+}
+
+// Swap exchanges the contents of two databases, the clients connected to one of them see the other one right away
+func (d *Databases) Swap(a, b int) {
+	if a == b {
+		return
+	}
+
+	// Lock in index order, so that two swaps can't wait for each other
+	first, second := d.dbs[min(a, b)], d.dbs[max(a, b)]
+	first.Lock.Lock()
+	defer first.Lock.Unlock()
+	second.Lock.Lock()
+	defer second.Lock.Unlock()
+
+	first.Items, second.Items = second.Items, first.Items
+	first.volatile, second.volatile = second.volatile, first.volatile
+	first.used, second.used = second.used, first.used
+	first.index, second.index = second.index, first.index
+	first.hashes, second.hashes = second.hashes, first.hashes
+}
+
+// FlushAll deletes every key of every database
+func (d *Databases) FlushAll() {
+	for _, db := range d.dbs {
+		db.FLUSH()
+	}
+}
+
+// UsedMemory returns the estimated memory used by the entries of every database, in bytes
+func (d *Databases) UsedMemory() int64 {
+	used := int64(0)
+	for _, db := range d.dbs {
+		used += db.UsedMemory()
+	}
+	return used
+}
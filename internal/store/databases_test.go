@@ -0,0 +1,27 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSwapDatabases(t *testing.T) {
+	d := CreateDatabases(2)
+	fill(d.DB(0), "k", 3, time.Now().Add(time.Hour))
+	used := d.DB(0).UsedMemory()
+
+	d.Swap(0, 1)
+	if d.DB(0).Size() != 0 || d.DB(0).UsedMemory() != 0 {
+		t.Errorf("database 0 has %d keys after the swap", d.DB(0).Size())
+	}
+	if d.DB(1).Size() != 3 || d.DB(1).UsedMemory() != used {
+		t.Errorf("database 1 has %d keys & %d bytes after the swap", d.DB(1).Size(), d.DB(1).UsedMemory())
+	}
+
+	// The expiry tracking moves with the keys
+	d.SetMaxMemory(1, VolatileRandom)
+	evicted, _ := d.Evict()
+	if len(evicted) != 3 || evicted[0].DB != 1 {
+		t.Errorf("Evict() = %v, want the 3 keys of database 1", evicted)
+	}
+}
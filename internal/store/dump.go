@@ -0,0 +1,82 @@
+package store
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc64"
+	"strings"
+
+	"github.com/DNahar74/PulseDB/internal/resp"
+)
+
+// dumpVersion is written after the value, so that a payload from an incompatible version is refused
+const dumpVersion = 1
+
+var crcTable = crc64.MakeTable(crc64.ECMA)
+
+// ErrBadPayload is returned when a DUMP payload is truncated or its checksum does not match
+var ErrBadPayload = errors.New("DUMP payload version or checksum are wrong")
+
+// Dump serializes a value for DUMP & MIGRATE
+// The payload is the RESP form of the value, followed by a 2 bytes version & a CRC64 of everything before it
+func Dump(v resp.Type) (string, error) {
+	str, err := v.Serialize()
+	if err != nil {
+		return "", err
+	}
+
+	b := []byte(str)
+	b = binary.LittleEndian.AppendUint16(b, dumpVersion)
+	b = binary.LittleEndian.AppendUint64(b, crc64.Checksum(b, crcTable))
+
+	return string(b), nil
+}
+
+// Restore reads back a value serialized by Dump
+func Restore(payload string) (resp.Type, error) {
+	if len(payload) < 10 {
+		return nil, ErrBadPayload
+	}
+
+	body := payload[:len(payload)-8]
+	sum := binary.LittleEndian.Uint64([]byte(payload[len(payload)-8:]))
+	if crc64.Checksum([]byte(body), crcTable) != sum {
+		return nil, ErrBadPayload
+	}
+	if binary.LittleEndian.Uint16([]byte(body[len(body)-2:])) != dumpVersion {
+		return nil, ErrBadPayload
+	}
+	body = body[:len(body)-2]
+
+	reader := resp.NewReader(strings.NewReader(body))
+	v, n, err := reader.ReadValue()
+	if err != nil || n != len(body) {
+		return nil, ErrBadPayload
+	}
+
+	// Strings are serialized as BulkStrings, & the other types as an array starting with their tag
+	switch v := v.(type) {
+	case resp.BulkString:
+		return NewString(v.Value), nil
+	case resp.Array:
+		if len(v.Items) == 0 {
+			break
+		}
+		switch v.Items[0] {
+		case resp.BulkString{Value: geoTag, Length: len(geoTag)}:
+			g, err := restoreGeoIndex(v.Items[1:])
+			if err != nil {
+				return nil, ErrBadPayload
+			}
+			return g, nil
+		case resp.BulkString{Value: hashTag, Length: len(hashTag)}:
+			h, err := restoreHash(v.Items[1:])
+			if err != nil {
+				return nil, ErrBadPayload
+			}
+			return h, nil
+		}
+	}
+	// Nothing else is ever dumped, so it can't go into the keyspace
+	return nil, ErrBadPayload
+}
@@ -0,0 +1,387 @@
+package store
+
+import (
+	"errors"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/DNahar74/PulseDB/internal/resp"
+)
+
+// Policy decides which keys are evicted when the store uses more than its maxmemory
+type Policy int
+
+// The eviction policies, named like the maxmemory-policy values of Redis
+const (
+	NoEviction Policy = iota
+	AllKeysLRU
+	VolatileLRU
+	AllKeysLFU
+	VolatileLFU
+	AllKeysRandom
+	VolatileRandom
+	VolatileTTL
+)
+
+var policyNames = []string{
+	NoEviction:     "noeviction",
+	AllKeysLRU:     "allkeys-lru",
+	VolatileLRU:    "volatile-lru",
+	AllKeysLFU:     "allkeys-lfu",
+	VolatileLFU:    "volatile-lfu",
+	AllKeysRandom:  "allkeys-random",
+	VolatileRandom: "volatile-random",
+	VolatileTTL:    "volatile-ttl",
+}
+
+func (p Policy) String() string {
+	return policyNames[p]
+}
+
+// ParsePolicy reads a maxmemory-policy value
+func ParsePolicy(name string) (Policy, error) {
+	for p, n := range policyNames {
+		if n == name {
+			return Policy(p), nil
+		}
+	}
+	return NoEviction, errors.New("invalid maxmemory-policy")
+}
+
+func (p Policy) volatileOnly() bool {
+	return p == VolatileLRU || p == VolatileLFU || p == VolatileRandom || p == VolatileTTL
+}
+
+// ErrOOM is returned when the store is over its maxmemory & no key can be evicted
+var ErrOOM = errors.New("OOM command not allowed when used memory > 'maxmemory'.")
+
+const (
+	// evictionSamples is the number of keys sampled to find a good candidate, like maxmemory-samples
+	evictionSamples = 5
+	// evictionPoolSize is the number of best candidates kept between samplings
+	evictionPoolSize = 16
+
+	// lfuInitVal is the counter of a new key, so that it is not evicted before it has a chance to be used
+	lfuInitVal   = 5
+	lfuLogFactor = 10
+	// lfuDecayTime is the number of minutes after which an unused counter is decremented by one
+	lfuDecayTime = 1
+
+	// entryOverhead estimates the memory used by the map entry, the Data & its access tracking
+	entryOverhead = 96
+)
+
+// access tracks how recently & how frequently an entry is used
+// Its fields are atomic, so that reads can update it while holding the read lock
+type access struct {
+	// lastAccess is the Unix time in milliseconds of the last access
+	lastAccess atomic.Int64
+	// lfu packs the time of the last decrement in minutes (upper 16 bits) & a logarithmic Morris counter (lower 8 bits)
+	lfu atomic.Uint32
+}
+
+func newAccess() *access {
+	a := &access{}
+	a.lastAccess.Store(time.Now().UnixMilli())
+	a.lfu.Store(lfuMinutes()<<8 | lfuInitVal)
+	return a
+}
+
+// lfuMinutes is the current time in minutes, wrapped on 16 bits
+func lfuMinutes() uint32 {
+	return uint32(time.Now().Unix()/60) & 0xffff
+}
+
+// touch records an access to the entry
+func (a *access) touch() {
+	if a == nil {
+		return
+	}
+
+	a.lastAccess.Store(time.Now().UnixMilli())
+
+	counter := lfuLogIncr(a.decayedCounter())
+	a.lfu.Store(lfuMinutes()<<8 | uint32(counter))
+}
+
+// idle returns the time since the last access
+func (a *access) idle() time.Duration {
+	return time.Since(time.UnixMilli(a.lastAccess.Load()))
+}
+
+// decayedCounter returns the LFU counter, decremented by one for every decay period since the last decrement
+func (a *access) decayedCounter() uint8 {
+	v := a.lfu.Load()
+	last, counter := v>>8, uint8(v&0xff)
+
+	now := lfuMinutes()
+	elapsed := now - last
+	if now < last {
+		elapsed = 0xffff - last + now
+	}
+
+	periods := elapsed / lfuDecayTime
+	if periods >= uint32(counter) {
+		return 0
+	}
+	return counter - uint8(periods)
+}
+
+// lfuLogIncr increments a Morris counter: the higher the counter, the less likely it is to grow
+func lfuLogIncr(counter uint8) uint8 {
+	if counter == math.MaxUint8 {
+		return counter
+	}
+
+	base := float64(counter) - lfuInitVal
+	if base < 0 {
+		base = 0
+	}
+	if rand.Float64() < 1.0/(base*lfuLogFactor+1) {
+		counter++
+	}
+	return counter
+}
+
+// entrySize estimates the memory used by an entry
+func entrySize(key string, data Data) int64 {
+	return int64(len(key) + valueSize(data.Value) + entryOverhead)
+}
+
+func valueSize(v resp.Type) int {
+	switch v := v.(type) {
+	case String:
+		if v.isInt {
+			return 8
+		}
+		return len(v.str) + 16
+	case resp.BulkString:
+		return len(v.Value) + 16
+	case resp.SimpleString:
+		return len(v.Value) + 16
+	case resp.Integer:
+		return 8
+	case *GeoIndex:
+		return 64 + v.size
+	case *Hash:
+		return 64 + v.size
+	case resp.Array:
+		size := 24
+		for _, item := range v.Items {
+			size += valueSize(item)
+		}
+		return size
+	default:
+		str, err := v.Serialize()
+		if err != nil {
+			return 0
+		}
+		return len(str)
+	}
+}
+
+// SetMaxMemory sets the memory limit in bytes, 0 means no limit, & the eviction policy
+func (d *Databases) SetMaxMemory(limit int64, policy Policy) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.maxMemory = limit
+	d.policy = policy
+}
+
+// MaxMemory returns the memory limit & the eviction policy
+func (d *Databases) MaxMemory() (int64, Policy) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.maxMemory, d.policy
+}
+
+// EvictedKeys returns the number of keys evicted since the start
+func (d *Databases) EvictedKeys() int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.evictedKeys
+}
+
+// Stats are the keyspace statistics of every database, since the start or the last ResetStats
+type Stats struct {
+	Hits        int64
+	Misses      int64
+	ExpiredKeys int64
+	EvictedKeys int64
+}
+
+// Stats returns the keyspace statistics of every database
+func (d *Databases) Stats() Stats {
+	stats := Stats{EvictedKeys: d.EvictedKeys()}
+	for _, db := range d.dbs {
+		stats.Hits += db.hits.Load()
+		stats.Misses += db.misses.Load()
+		stats.ExpiredKeys += db.expiredKeys.Load()
+	}
+	return stats
+}
+
+// ResetStats sets the keyspace statistics back to 0
+func (d *Databases) ResetStats() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.evictedKeys = 0
+	for _, db := range d.dbs {
+		db.hits.Store(0)
+		db.misses.Store(0)
+		db.expiredKeys.Store(0)
+	}
+}
+
+// Evicted is a key removed to free memory
+type Evicted struct {
+	DB  int
+	Key string
+}
+
+// candidate is a key that may be evicted, the one with the highest score goes first
+type candidate struct {
+	db    int
+	key   string
+	score float64
+}
+
+// Evict removes keys according to the eviction policy until the databases fit in their maxmemory
+// It returns the evicted keys, so that their deletion can be propagated, & ErrOOM when the databases still do not fit
+func (d *Databases) Evict() ([]Evicted, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.maxMemory <= 0 || d.UsedMemory() <= d.maxMemory {
+		return nil, nil
+	}
+	if d.policy == NoEviction {
+		return nil, ErrOOM
+	}
+
+	evicted := make([]Evicted, 0)
+	pool := make([]candidate, 0, evictionPoolSize)
+
+	for d.UsedMemory() > d.maxMemory {
+		samples := make([]candidate, 0)
+		for i, db := range d.dbs {
+			samples = append(samples, db.sample(i, d.policy)...)
+		}
+
+		found := false
+		if d.policy == AllKeysRandom || d.policy == VolatileRandom {
+			for len(samples) > 0 && !found {
+				j := rand.IntN(len(samples))
+				c := samples[j]
+				samples = append(samples[:j], samples[j+1:]...)
+				found = d.dbs[c.db].evictKey(c.key, d.policy)
+				if found {
+					evicted = append(evicted, Evicted{DB: c.db, Key: c.key})
+				}
+			}
+		} else {
+			pool = mergePool(pool, samples)
+			for len(pool) > 0 && !found {
+				c := pool[0]
+				pool = pool[1:]
+				found = d.dbs[c.db].evictKey(c.key, d.policy)
+				if found {
+					evicted = append(evicted, Evicted{DB: c.db, Key: c.key})
+				}
+			}
+		}
+
+		if !found {
+			return evicted, ErrOOM
+		}
+		d.evictedKeys++
+	}
+
+	return evicted, nil
+}
+
+// sample returns up to evictionSamples keys of the database that the policy may evict, with their score
+// The iteration order of Go maps is random, which makes the first keys a sample
+func (s *Store) sample(db int, policy Policy) []candidate {
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+
+	now := time.Now()
+	samples := make([]candidate, 0, evictionSamples)
+	add := func(key string) bool {
+		samples = append(samples, candidate{db: db, key: key, score: score(policy, s.Items[key], now)})
+		return len(samples) < evictionSamples
+	}
+
+	if policy.volatileOnly() {
+		for key := range s.volatile {
+			if !add(key) {
+				break
+			}
+		}
+		return samples
+	}
+
+	for key := range s.Items {
+		if !add(key) {
+			break
+		}
+	}
+	return samples
+}
+
+// score tells how good an entry is to evict under the policy
+func score(policy Policy, data Data, now time.Time) float64 {
+	switch policy {
+	case AllKeysLFU, VolatileLFU:
+		return float64(math.MaxUint8 - data.access.decayedCounter())
+	case VolatileTTL:
+		// The key that expires first goes first
+		return -float64(data.Expiry.Sub(now))
+	default:
+		return float64(data.access.idle())
+	}
+}
+
+// mergePool adds a new sample to the pool of candidates, keeping the best ones
+func mergePool(pool, samples []candidate) []candidate {
+	for _, c := range samples {
+		present := false
+		for _, p := range pool {
+			if p.db == c.db && p.key == c.key {
+				present = true
+				break
+			}
+		}
+		if !present {
+			pool = append(pool, c)
+		}
+	}
+
+	sort.Slice(pool, func(i, j int) bool { return pool[i].score > pool[j].score })
+	if len(pool) > evictionPoolSize {
+		pool = pool[:evictionPoolSize]
+	}
+	return pool
+}
+
+// evictKey deletes a candidate if it still exists & may still be evicted
+func (s *Store) evictKey(key string, policy Policy) bool {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+
+	data, ok := s.Items[key]
+	if !ok || (policy.volatileOnly() && data.Expiry.IsZero()) {
+		return false
+	}
+
+	s.deleteLocked(key)
+	return true
+}
@@ -0,0 +1,212 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DNahar74/PulseDB/internal/resp"
+)
+
+func TestMemoryAccounting(t *testing.T) {
+	s := CreateStorage()
+
+	s.SET("a", Data{Value: resp.BulkString{Value: "value", Length: 5}})
+	s.SET("b", Data{Value: resp.Integer{Value: 1}, Expiry: time.Now().Add(time.Hour)})
+	used := s.UsedMemory()
+	if used <= 0 {
+		t.Fatalf("UsedMemory() = %d after SET", used)
+	}
+
+	// Replacing a value only accounts for the new one
+	s.SET("a", Data{Value: resp.BulkString{Value: strings.Repeat("x", 1000), Length: 1000}})
+	if got := s.UsedMemory(); got-used != 995 {
+		t.Errorf("UsedMemory() grew by %d, want 995", got-used)
+	}
+
+	_ = s.DEL("a")
+	_ = s.DEL("b")
+	if got := s.UsedMemory(); got != 0 {
+		t.Errorf("UsedMemory() = %d after deleting every key", got)
+	}
+
+	s.SET("c", Data{Value: resp.Integer{Value: 1}})
+	s.FLUSH()
+	if got := s.UsedMemory(); got != 0 {
+		t.Errorf("UsedMemory() = %d after FLUSH", got)
+	}
+}
+
+// fill adds count keys named prefix000, prefix001... & returns the memory used by one of them
+func fill(s *Store, prefix string, count int, expiry time.Time) int64 {
+	for i := range count {
+		s.SET(fmt.Sprintf("%s%03d", prefix, i), Data{Value: resp.Integer{Value: i}, Expiry: expiry})
+	}
+	return entrySize(prefix+"000", Data{Value: resp.Integer{}})
+}
+
+// evict runs an eviction & returns the names of the evicted keys
+func evict(d *Databases) ([]string, error) {
+	evicted, err := d.Evict()
+	keys := make([]string, len(evicted))
+	for i, e := range evicted {
+		keys[i] = e.Key
+	}
+	return keys, err
+}
+
+func countPrefix(keys []string, prefix string) int {
+	n := 0
+	for _, k := range keys {
+		if strings.HasPrefix(k, prefix) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestEvictNoEviction(t *testing.T) {
+	d := CreateDatabases(1)
+	s := d.DB(0)
+	size := fill(s, "k", 10, time.Time{})
+	d.SetMaxMemory(5*size, NoEviction)
+
+	evicted, err := evict(d)
+	if !errors.Is(err, ErrOOM) || len(evicted) != 0 {
+		t.Errorf("Evict() = %v, %v, want ErrOOM & no eviction", evicted, err)
+	}
+}
+
+func TestEvictLRU(t *testing.T) {
+	d := CreateDatabases(1)
+	s := d.DB(0)
+	size := fill(s, "cold", 80, time.Time{})
+	fill(s, "hot", 20, time.Time{})
+
+	for key, data := range s.Items {
+		if strings.HasPrefix(key, "cold") {
+			data.access.lastAccess.Store(time.Now().Add(-time.Hour).UnixMilli())
+		}
+	}
+
+	d.SetMaxMemory(50*size, AllKeysLRU)
+	evicted, err := evict(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(evicted) != 50 || s.UsedMemory() > 50*size {
+		t.Fatalf("evicted %d keys, used memory %d", len(evicted), s.UsedMemory())
+	}
+	// Sampling is approximate, but the recently used keys should survive
+	if n := countPrefix(evicted, "hot"); n > 2 {
+		t.Errorf("evicted %d recently used keys", n)
+	}
+}
+
+func TestEvictLFU(t *testing.T) {
+	d := CreateDatabases(1)
+	s := d.DB(0)
+	size := fill(s, "rare", 80, time.Time{})
+	fill(s, "frequent", 20, time.Time{})
+
+	for key, data := range s.Items {
+		if strings.HasPrefix(key, "frequent") {
+			data.access.lfu.Store(lfuMinutes()<<8 | 100)
+		} else {
+			data.access.lfu.Store(lfuMinutes()<<8 | 1)
+		}
+	}
+
+	d.SetMaxMemory(50*size, AllKeysLFU)
+	evicted, err := evict(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := countPrefix(evicted, "frequent"); n > 2 {
+		t.Errorf("evicted %d frequently used keys", n)
+	}
+}
+
+func TestEvictVolatile(t *testing.T) {
+	policies := []Policy{VolatileLRU, VolatileLFU, VolatileRandom, VolatileTTL}
+
+	for _, policy := range policies {
+		t.Run(policy.String(), func(t *testing.T) {
+			d := CreateDatabases(1)
+			s := d.DB(0)
+			size := fill(s, "persistent", 10, time.Time{})
+			fill(s, "volatile", 10, time.Now().Add(time.Hour))
+
+			// Keys without an expiry are never evicted, so the store can't get under 5 keys
+			d.SetMaxMemory(5*size, policy)
+			evicted, err := evict(d)
+			if !errors.Is(err, ErrOOM) {
+				t.Errorf("Evict() error = %v, want ErrOOM", err)
+			}
+			if len(evicted) != 10 || countPrefix(evicted, "volatile") != 10 {
+				t.Errorf("evicted %v, want the 10 volatile keys", evicted)
+			}
+		})
+	}
+}
+
+func TestEvictVolatileTTL(t *testing.T) {
+	d := CreateDatabases(1)
+	s := d.DB(0)
+	size := fill(s, "soon", 50, time.Now().Add(time.Minute))
+	fill(s, "late", 50, time.Now().Add(time.Hour))
+
+	d.SetMaxMemory(70*size, VolatileTTL)
+	evicted, err := evict(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := countPrefix(evicted, "late"); n > 5 {
+		t.Errorf("evicted %d keys expiring later", n)
+	}
+}
+
+func TestEvictAllKeysRandom(t *testing.T) {
+	d := CreateDatabases(1)
+	s := d.DB(0)
+	size := fill(s, "k", 100, time.Time{})
+
+	d.SetMaxMemory(30*size, AllKeysRandom)
+	evicted, err := evict(d)
+	if err != nil || len(evicted) != 70 || len(s.Items) != 30 {
+		t.Errorf("Evict() = %d keys, %v, %d left", len(evicted), err, len(s.Items))
+	}
+	if d.EvictedKeys() != 70 {
+		t.Errorf("EvictedKeys() = %d, want 70", d.EvictedKeys())
+	}
+}
+
+func TestEvictAcrossDatabases(t *testing.T) {
+	d := CreateDatabases(2)
+	size := fill(d.DB(0), "k", 10, time.Time{})
+	fill(d.DB(1), "k", 10, time.Time{})
+
+	// The limit applies to the sum of the databases
+	d.SetMaxMemory(10*size, AllKeysRandom)
+	evicted, err := d.Evict()
+	if err != nil || len(evicted) != 10 {
+		t.Fatalf("Evict() = %d keys, %v", len(evicted), err)
+	}
+	if d.DB(0).Size()+d.DB(1).Size() != 10 || d.UsedMemory() != 10*size {
+		t.Errorf("%d & %d keys left, used memory %d", d.DB(0).Size(), d.DB(1).Size(), d.UsedMemory())
+	}
+}
+
+func TestMorrisCounter(t *testing.T) {
+	counter := uint8(lfuInitVal)
+	for range 1000 {
+		counter = lfuLogIncr(counter)
+	}
+
+	// The counter is logarithmic: 1000 hits move it well above the initial value, but far from saturation
+	if counter <= lfuInitVal+5 || counter >= 100 {
+		t.Errorf("counter after 1000 increments = %d", counter)
+	}
+}
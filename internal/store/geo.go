@@ -0,0 +1,136 @@
+package store
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+
+	"github.com/DNahar74/PulseDB/internal/resp"
+)
+
+// geoTag is the first item of the RESP form of a geo index, which tells it apart from other arrays in DUMP payloads
+const geoTag = "geo"
+
+// GeoIndex is the value of a geo key: members ordered by score, the 52 bits geohash of their coordinates, & then by name
+// Like in Redis it is a sorted set, the members of an area are found with a few ranges of scores
+// It is modified in place, through Store.Mutate so that the memory accounting follows
+type GeoIndex struct {
+	scores  map[string]uint64
+	entries []geoEntry
+	// size is the estimated memory of the members
+	size int
+}
+
+type geoEntry struct {
+	member string
+	score  uint64
+}
+
+func (e geoEntry) less(o geoEntry) bool {
+	if e.score != o.score {
+		return e.score < o.score
+	}
+	return e.member < o.member
+}
+
+// NewGeoIndex creates an empty geo index
+func NewGeoIndex() *GeoIndex {
+	return &GeoIndex{scores: make(map[string]uint64)}
+}
+
+// Len returns the number of members
+func (g *GeoIndex) Len() int {
+	return len(g.entries)
+}
+
+// Score returns the score of a member, & false if it is not in the index
+func (g *GeoIndex) Score(member string) (uint64, bool) {
+	score, ok := g.scores[member]
+	return score, ok
+}
+
+// Add sets the score of a member, & returns whether the member is new & whether its score changed
+func (g *GeoIndex) Add(member string, score uint64) (bool, bool) {
+	old, ok := g.scores[member]
+	if ok && old == score {
+		return false, false
+	}
+	if ok {
+		g.remove(geoEntry{member: member, score: old})
+	} else {
+		g.size += len(member) + 48
+	}
+
+	entry := geoEntry{member: member, score: score}
+	i := sort.Search(len(g.entries), func(i int) bool { return !g.entries[i].less(entry) })
+	g.entries = append(g.entries, geoEntry{})
+	copy(g.entries[i+1:], g.entries[i:])
+	g.entries[i] = entry
+	g.scores[member] = score
+
+	return !ok, ok
+}
+
+func (g *GeoIndex) remove(entry geoEntry) {
+	i := sort.Search(len(g.entries), func(i int) bool { return !g.entries[i].less(entry) })
+	g.entries = append(g.entries[:i], g.entries[i+1:]...)
+}
+
+// Range calls fn for the members with a score from min included to max excluded, in order, until fn returns false
+func (g *GeoIndex) Range(min, max uint64, fn func(member string, score uint64) bool) bool {
+	i := sort.Search(len(g.entries), func(i int) bool { return g.entries[i].score >= min })
+	for ; i < len(g.entries) && g.entries[i].score < max; i++ {
+		if !fn(g.entries[i].member, g.entries[i].score) {
+			return false
+		}
+	}
+	return true
+}
+
+// Clone returns a copy of the index that can be modified separately
+func (g *GeoIndex) Clone() *GeoIndex {
+	c := &GeoIndex{
+		scores:  make(map[string]uint64, len(g.scores)),
+		entries: append([]geoEntry(nil), g.entries...),
+		size:    g.size,
+	}
+	for member, score := range g.scores {
+		c.scores[member] = score
+	}
+	return c
+}
+
+// Serialize sends the index as an array of its tag followed by the members & their scores, which Restore reads back
+func (g *GeoIndex) Serialize() (string, error) {
+	items := make([]resp.Type, 0, 1+2*len(g.entries))
+	items = append(items, resp.BulkString{Value: geoTag, Length: len(geoTag)})
+	for _, e := range g.entries {
+		score := strconv.FormatUint(e.score, 10)
+		items = append(items,
+			resp.BulkString{Value: e.member, Length: len(e.member)},
+			resp.BulkString{Value: score, Length: len(score)},
+		)
+	}
+	return resp.Array{Length: len(items), Items: items}.Serialize()
+}
+
+// restoreGeoIndex rebuilds an index from the items of its RESP form, after the tag
+func restoreGeoIndex(items []resp.Type) (*GeoIndex, error) {
+	if len(items)%2 != 0 {
+		return nil, errors.New("invalid geo index")
+	}
+	g := NewGeoIndex()
+	for i := 0; i < len(items); i += 2 {
+		member, ok1 := items[i].(resp.BulkString)
+		score, ok2 := items[i+1].(resp.BulkString)
+		if !ok1 || !ok2 {
+			return nil, errors.New("invalid geo index")
+		}
+		n, err := strconv.ParseUint(score.Value, 10, 64)
+		if err != nil {
+			return nil, errors.New("invalid geo index")
+		}
+		g.Add(member.Value, n)
+	}
+	return g, nil
+}
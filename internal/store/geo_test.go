@@ -0,0 +1,85 @@
+package store
+
+import "testing"
+
+func TestGeoIndex(t *testing.T) {
+	g := NewGeoIndex()
+
+	if added, _ := g.Add("b", 20); !added {
+		t.Error("Add of a new member returned false")
+	}
+	g.Add("a", 20)
+	g.Add("c", 10)
+	if added, changed := g.Add("c", 30); added || !changed {
+		t.Errorf("Add of a moved member = %v, %v", added, changed)
+	}
+	if added, changed := g.Add("c", 30); added || changed {
+		t.Errorf("Add of an unchanged member = %v, %v", added, changed)
+	}
+
+	// The members are ordered by score & then by name
+	members := make([]string, 0)
+	g.Range(0, 100, func(member string, _ uint64) bool {
+		members = append(members, member)
+		return true
+	})
+	if len(members) != 3 || members[0] != "a" || members[1] != "b" || members[2] != "c" {
+		t.Errorf("Range = %v, want [a b c]", members)
+	}
+
+	count := 0
+	g.Range(20, 30, func(string, uint64) bool {
+		count++
+		return true
+	})
+	if count != 2 {
+		t.Errorf("Range [20, 30) visited %d members, want 2", count)
+	}
+
+	clone := g.Clone()
+	clone.Add("d", 1)
+	if _, ok := g.Score("d"); ok {
+		t.Error("adding to a clone changed the original")
+	}
+}
+
+func TestGeoIndexDump(t *testing.T) {
+	g := NewGeoIndex()
+	g.Add("Palermo", 3479099956230698)
+	g.Add("Catania", 3479447370796909)
+
+	payload, err := Dump(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := Restore(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, ok := v.(*GeoIndex)
+	if !ok || restored.Len() != 2 {
+		t.Fatalf("Restore = %#v, want the geo index", v)
+	}
+	if score, _ := restored.Score("Catania"); score != 3479447370796909 {
+		t.Errorf("restored score = %d", score)
+	}
+	if TypeName(restored) != "zset" {
+		t.Errorf("TypeName = %s, want zset", TypeName(restored))
+	}
+}
+
+func TestMutate(t *testing.T) {
+	s := CreateStorage()
+	g := NewGeoIndex()
+	s.SET("k", Data{Value: g})
+
+	before := s.UsedMemory()
+	s.Mutate("k", func() { g.Add("member", 1) })
+	if s.UsedMemory() <= before {
+		t.Errorf("used memory %d after adding a member, was %d", s.UsedMemory(), before)
+	}
+	_ = s.DEL("k")
+	if s.UsedMemory() != 0 {
+		t.Errorf("used memory %d once the key is deleted", s.UsedMemory())
+	}
+}
@@ -0,0 +1,257 @@
+package store
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/DNahar74/PulseDB/internal/resp"
+)
+
+// hashTag is the first item of the RESP form of a hash
+const hashTag = "hash"
+
+// hashFieldOverhead is the estimated memory of a field besides its name & value
+const hashFieldOverhead = 48
+
+// Hash is the value of a hash key: fields with a value & an optional expiry
+// An expired field stays until a write command or the active expiry removes it, but it is never returned, & the key is
+// gone once all its fields expired
+// It is modified in place, through Store.Mutate so that the memory accounting follows
+type Hash struct {
+	fields map[string]hashField
+	// volatile holds the fields with an expiry
+	volatile map[string]struct{}
+	// size is the estimated memory of the fields
+	size int
+}
+
+type hashField struct {
+	value  string
+	expiry time.Time
+}
+
+func (f hashField) expired(now time.Time) bool {
+	return !f.expiry.IsZero() && !f.expiry.After(now)
+}
+
+// NewHash creates an empty hash
+func NewHash() *Hash {
+	return &Hash{fields: make(map[string]hashField), volatile: make(map[string]struct{})}
+}
+
+// Get returns the value of a field, & false if it does not exist or expired
+func (h *Hash) Get(field string, now time.Time) (string, bool) {
+	f, ok := h.fields[field]
+	if !ok || f.expired(now) {
+		return "", false
+	}
+	return f.value, true
+}
+
+// Set sets the value of a field & clears its expiry, & returns true if the field is new
+func (h *Hash) Set(field, value string, now time.Time) bool {
+	old, ok := h.fields[field]
+	if ok {
+		h.size -= len(field) + len(old.value) + hashFieldOverhead
+	}
+	h.fields[field] = hashField{value: value}
+	delete(h.volatile, field)
+	h.size += len(field) + len(value) + hashFieldOverhead
+
+	return !ok || old.expired(now)
+}
+
+// Delete removes a field, & returns false if it did not exist or expired
+func (h *Hash) Delete(field string, now time.Time) bool {
+	f, ok := h.fields[field]
+	if !ok {
+		return false
+	}
+	h.remove(field)
+	return !f.expired(now)
+}
+
+func (h *Hash) remove(field string) {
+	f := h.fields[field]
+	h.size -= len(field) + len(f.value) + hashFieldOverhead
+	delete(h.fields, field)
+	delete(h.volatile, field)
+}
+
+// Len returns the number of fields that have not expired
+func (h *Hash) Len(now time.Time) int {
+	n := len(h.fields)
+	for field := range h.volatile {
+		if h.fields[field].expired(now) {
+			n--
+		}
+	}
+	return n
+}
+
+// Range calls fn for every field that has not expired, in no particular order
+func (h *Hash) Range(now time.Time, fn func(field, value string)) {
+	for field, f := range h.fields {
+		if !f.expired(now) {
+			fn(field, f.value)
+		}
+	}
+}
+
+// Expiry returns the expiry of a field, which is zero for a field without one, & false if it does not exist or expired
+func (h *Hash) Expiry(field string, now time.Time) (time.Time, bool) {
+	f, ok := h.fields[field]
+	if !ok || f.expired(now) {
+		return time.Time{}, false
+	}
+	return f.expiry, true
+}
+
+// SetExpiry sets the expiry of an existing field, or clears it with a zero time
+func (h *Hash) SetExpiry(field string, expiry time.Time) {
+	f, ok := h.fields[field]
+	if !ok {
+		return
+	}
+	f.expiry = expiry
+	h.fields[field] = f
+	if expiry.IsZero() {
+		delete(h.volatile, field)
+	} else {
+		h.volatile[field] = struct{}{}
+	}
+}
+
+// Volatile reports whether some fields have an expiry
+func (h *Hash) Volatile() bool {
+	return len(h.volatile) > 0
+}
+
+// Expired reports whether the hash has no field left that has not expired
+func (h *Hash) Expired(now time.Time) bool {
+	if len(h.fields) > len(h.volatile) {
+		return false
+	}
+	for field := range h.volatile {
+		if !h.fields[field].expired(now) {
+			return false
+		}
+	}
+	return true
+}
+
+// RemoveExpired removes the expired fields & returns their names
+func (h *Hash) RemoveExpired(now time.Time) []string {
+	removed := make([]string, 0)
+	for field := range h.volatile {
+		if h.fields[field].expired(now) {
+			removed = append(removed, field)
+		}
+	}
+	for _, field := range removed {
+		h.remove(field)
+	}
+	return removed
+}
+
+// Clone returns a copy of the hash that can be modified separately
+func (h *Hash) Clone() *Hash {
+	c := &Hash{
+		fields:   make(map[string]hashField, len(h.fields)),
+		volatile: make(map[string]struct{}, len(h.volatile)),
+		size:     h.size,
+	}
+	for field, f := range h.fields {
+		c.fields[field] = f
+	}
+	for field := range h.volatile {
+		c.volatile[field] = struct{}{}
+	}
+	return c
+}
+
+// Serialize sends the hash as an array of its tag followed by the fields, their values & their expiry in unix
+// milliseconds or 0, which Restore reads back
+func (h *Hash) Serialize() (string, error) {
+	items := make([]resp.Type, 0, 1+3*len(h.fields))
+	items = append(items, resp.BulkString{Value: hashTag, Length: len(hashTag)})
+	for field, f := range h.fields {
+		expiry := "0"
+		if !f.expiry.IsZero() {
+			expiry = strconv.FormatInt(f.expiry.UnixMilli(), 10)
+		}
+		items = append(items,
+			resp.BulkString{Value: field, Length: len(field)},
+			resp.BulkString{Value: f.value, Length: len(f.value)},
+			resp.BulkString{Value: expiry, Length: len(expiry)},
+		)
+	}
+	return resp.Array{Length: len(items), Items: items}.Serialize()
+}
+
+// restoreHash rebuilds a hash from the items of its RESP form, after the tag
+// The fields that expired in the meantime are kept, they are removed like any other expired field
+func restoreHash(items []resp.Type) (*Hash, error) {
+	if len(items)%3 != 0 {
+		return nil, errors.New("invalid hash")
+	}
+	h := NewHash()
+	for i := 0; i < len(items); i += 3 {
+		field, ok1 := items[i].(resp.BulkString)
+		value, ok2 := items[i+1].(resp.BulkString)
+		expiry, ok3 := items[i+2].(resp.BulkString)
+		if !ok1 || !ok2 || !ok3 {
+			return nil, errors.New("invalid hash")
+		}
+		ms, err := strconv.ParseInt(expiry.Value, 10, 64)
+		if err != nil {
+			return nil, errors.New("invalid hash")
+		}
+		h.Set(field.Value, value.Value, time.Time{})
+		if ms != 0 {
+			h.SetExpiry(field.Value, time.UnixMilli(ms))
+		}
+	}
+	return h, nil
+}
+
+// ExpiredFields are the fields of a key removed by the active expiry
+type ExpiredFields struct {
+	Key    string
+	Fields []string
+}
+
+// ExpireHashFields removes the expired fields of at most limit hashes with volatile fields, & the hashes left empty
+// It is the active expiry of the fields, the lookups only hide them
+func (s *Store) ExpireHashFields(now time.Time, limit int) []ExpiredFields {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+
+	expired := make([]ExpiredFields, 0)
+	// The iteration order of Go maps is random, so every call samples other hashes
+	for key := range s.hashes {
+		if limit == 0 {
+			break
+		}
+		limit--
+
+		data := s.Items[key]
+		h := data.Value.(*Hash)
+
+		s.used -= entrySize(key, data)
+		fields := h.RemoveExpired(now)
+		s.used += entrySize(key, data)
+		if len(fields) == 0 {
+			continue
+		}
+
+		expired = append(expired, ExpiredFields{Key: key, Fields: fields})
+		if len(h.fields) == 0 {
+			s.expireLocked(key)
+		} else if !h.Volatile() {
+			delete(s.hashes, key)
+		}
+	}
+	return expired
+}
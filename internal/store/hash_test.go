@@ -0,0 +1,83 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHashFieldExpiry(t *testing.T) {
+	now := time.Now()
+	h := NewHash()
+	h.Set("token", "abc", now)
+	h.Set("profile", "{}", now)
+	h.SetExpiry("token", now.Add(-time.Second))
+
+	if _, ok := h.Get("token", now); ok {
+		t.Error("an expired field was returned")
+	}
+	if h.Len(now) != 1 {
+		t.Errorf("Len = %d, want 1", h.Len(now))
+	}
+	if !h.Set("token", "def", now) {
+		t.Error("setting an expired field did not count as a new field")
+	}
+	if expiry, ok := h.Expiry("token", now); !ok || !expiry.IsZero() {
+		t.Error("setting a field kept its expiry")
+	}
+
+	h.SetExpiry("token", now.Add(-time.Second))
+	if removed := h.RemoveExpired(now); len(removed) != 1 || removed[0] != "token" {
+		t.Errorf("RemoveExpired = %v, want [token]", removed)
+	}
+	if h.Volatile() {
+		t.Error("the hash still has volatile fields")
+	}
+}
+
+func TestHashGoesWithLastField(t *testing.T) {
+	s := CreateStorage()
+	h := NewHash()
+	h.Set("a", "1", time.Now())
+	s.SET("k", Data{Value: h})
+
+	s.Mutate("k", func() { h.SetExpiry("a", time.Now().Add(-time.Millisecond)) })
+	if _, ok := s.Lookup("k"); ok {
+		t.Error("a hash whose fields all expired is still found")
+	}
+
+	expired := s.ExpireHashFields(time.Now(), 10)
+	if len(expired) != 1 || expired[0].Key != "k" || len(expired[0].Fields) != 1 {
+		t.Errorf("ExpireHashFields = %v, want the field a of k", expired)
+	}
+	if s.Size() != 0 || s.UsedMemory() != 0 {
+		t.Errorf("%d keys & %d bytes left once the last field expired", s.Size(), s.UsedMemory())
+	}
+}
+
+func TestHashDump(t *testing.T) {
+	now := time.Now()
+	h := NewHash()
+	h.Set("a", "1", now)
+	h.Set("b", "2\r\n", now)
+	expiry := time.UnixMilli(now.Add(time.Hour).UnixMilli())
+	h.SetExpiry("b", expiry)
+
+	payload, err := Dump(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := Restore(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, ok := v.(*Hash)
+	if !ok || restored.Len(now) != 2 {
+		t.Fatalf("Restore = %#v, want the hash", v)
+	}
+	if got, ok := restored.Expiry("b", now); !ok || !got.Equal(expiry) {
+		t.Errorf("restored expiry = %v, want %v", got, expiry)
+	}
+	if TypeName(restored) != "hash" {
+		t.Errorf("TypeName = %s, want hash", TypeName(restored))
+	}
+}
@@ -0,0 +1,143 @@
+package store
+
+import (
+	"hash/maphash"
+	"math/bits"
+	"time"
+
+	"github.com/DNahar74/PulseDB/internal/resp"
+)
+
+// scanBuckets is the number of buckets of the scan index, a SCAN cursor is the index of the next bucket to visit
+const scanBuckets = 1 << 16
+
+// scanSeed is shared by every store, so that a key stays in the same bucket when it moves to another database
+var scanSeed = maphash.MakeSeed()
+
+// scanIndex groups the keys by a hash that never changes, which gives SCAN a stable order over the random order of Go maps
+// A key present during a whole scan stays in its bucket, & every bucket after the cursor is still to be visited,
+// so the key is returned whatever is added or deleted in the meantime
+type scanIndex struct {
+	buckets map[uint16]map[string]struct{}
+	// nonEmpty has a bit set for every bucket with keys, so that empty buckets are skipped quickly
+	nonEmpty [scanBuckets / 64]uint64
+}
+
+func newScanIndex() *scanIndex {
+	return &scanIndex{buckets: make(map[uint16]map[string]struct{})}
+}
+
+func scanBucket(key string) uint16 {
+	return uint16(maphash.String(scanSeed, key) >> 48)
+}
+
+func (x *scanIndex) add(key string) {
+	b := scanBucket(key)
+	bucket, ok := x.buckets[b]
+	if !ok {
+		bucket = make(map[string]struct{})
+		x.buckets[b] = bucket
+		x.nonEmpty[b/64] |= 1 << (b % 64)
+	}
+	bucket[key] = struct{}{}
+}
+
+func (x *scanIndex) remove(key string) {
+	b := scanBucket(key)
+	bucket, ok := x.buckets[b]
+	if !ok {
+		return
+	}
+	delete(bucket, key)
+	if len(bucket) == 0 {
+		delete(x.buckets, b)
+		x.nonEmpty[b/64] &^= 1 << (b % 64)
+	}
+}
+
+// next returns the first bucket with keys at or after a bucket, & false when there is none
+func (x *scanIndex) next(from int) (int, bool) {
+	for word := from / 64; word < len(x.nonEmpty); word++ {
+		bitsLeft := x.nonEmpty[word]
+		if word == from/64 {
+			bitsLeft &= ^uint64(0) << (from % 64)
+		}
+		if bitsLeft != 0 {
+			return word*64 + bits.TrailingZeros64(bitsLeft), true
+		}
+	}
+	return 0, false
+}
+
+// Scan returns the keys of the buckets from the cursor on, visiting buckets until at least count keys are found
+// It returns the cursor of the next call, which is 0 once every bucket was visited
+// Like in Redis, count is a hint: a call may return more keys, or fewer when expired keys are skipped
+func (s *Store) Scan(cursor uint64, count int) (uint64, []string) {
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+
+	keys := make([]string, 0, count)
+	if cursor >= scanBuckets {
+		return 0, keys
+	}
+
+	now := time.Now()
+	b := int(cursor)
+	for len(keys) < count {
+		var ok bool
+		b, ok = s.index.next(b)
+		if !ok {
+			return 0, keys
+		}
+		for key := range s.index.buckets[uint16(b)] {
+			if !expired(s.Items[key], now) {
+				keys = append(keys, key)
+			}
+		}
+		b++
+	}
+
+	if b >= scanBuckets {
+		return 0, keys
+	}
+	return uint64(b), keys
+}
+
+// RandomKey returns a key that has not expired, & false when the store is empty
+func (s *Store) RandomKey() (string, bool) {
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+
+	// The iteration order of Go maps is random
+	now := time.Now()
+	for key, data := range s.Items {
+		if !expired(data, now) {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// Touch records an access to a key for the eviction policies, & returns false if it does not exist
+func (s *Store) Touch(key string) bool {
+	data, ok := s.Lookup(key)
+	if ok {
+		data.access.touch()
+	}
+	return ok
+}
+
+// TypeName returns the name of the type of a value, as reported by TYPE
+func TypeName(v resp.Type) string {
+	switch v.(type) {
+	case String, resp.BulkString, resp.SimpleString, resp.Integer:
+		return "string"
+	case *GeoIndex:
+		// Like in Redis, where the geo commands work on sorted sets
+		return "zset"
+	case *Hash:
+		return "hash"
+	default:
+		return "none"
+	}
+}
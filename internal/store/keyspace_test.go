@@ -0,0 +1,71 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DNahar74/PulseDB/internal/resp"
+)
+
+func TestScanGuarantee(t *testing.T) {
+	s := CreateStorage()
+	fill(s, "stable", 1000, time.Time{})
+	fill(s, "removed", 500, time.Time{})
+
+	seen := make(map[string]int)
+	cursor, calls := uint64(0), 0
+	for {
+		next, keys := s.Scan(cursor, 10)
+		for _, key := range keys {
+			seen[key]++
+		}
+
+		// Keys are added & deleted while the scan is running
+		s.SET(fmt.Sprintf("added%03d", calls), Data{Value: resp.Integer{Value: calls}})
+		if calls < 500 {
+			_ = s.DEL(fmt.Sprintf("removed%03d", calls))
+		}
+
+		calls++
+		cursor = next
+		if cursor == 0 {
+			break
+		}
+	}
+
+	for i := range 1000 {
+		key := fmt.Sprintf("stable%03d", i)
+		if seen[key] != 1 {
+			t.Errorf("%s returned %d times", key, seen[key])
+		}
+	}
+	if calls < 100 {
+		t.Errorf("the scan finished in %d calls, want about 150 with COUNT 10", calls)
+	}
+}
+
+func TestScanSkipsExpired(t *testing.T) {
+	s := CreateStorage()
+	fill(s, "live", 5, time.Time{})
+	fill(s, "dead", 5, time.Now().Add(-time.Second))
+
+	keys := make([]string, 0)
+	cursor := uint64(0)
+	for {
+		next, batch := s.Scan(cursor, 100)
+		keys = append(keys, batch...)
+		if cursor = next; cursor == 0 {
+			break
+		}
+	}
+	if len(keys) != 5 || countPrefix(keys, "live") != 5 {
+		t.Errorf("Scan() = %v, want the 5 live keys", keys)
+	}
+
+	// A flushed store starts with an empty index
+	s.FLUSH()
+	if _, keys := s.Scan(0, 100); len(keys) != 0 {
+		t.Errorf("Scan() after FLUSH = %v", keys)
+	}
+}
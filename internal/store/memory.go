@@ -5,8 +5,11 @@ package store
 
 import (
 	"errors"
+	"math"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/DNahar74/PulseDB/internal/resp"
@@ -16,6 +19,9 @@ import (
 type Data struct {
 	Value  resp.Type
 	Expiry time.Time
+
+	// access is shared by the copies of an entry, it tracks its use for the eviction policies
+	access *access
 }
 
 // Store is a map of keys to Data items
@@ -23,30 +29,123 @@ type Store struct {
 	Items   map[string]Data
 	Lock    sync.RWMutex
 	AOFChan chan string
+
+	// volatile holds the keys that have an expiry
+	volatile map[string]struct{}
+	// used is the estimated memory of every entry, in bytes
+	used int64
+	// index orders the keys for SCAN
+	index *scanIndex
+	// hashes holds the keys of the hashes with fields that have an expiry, for their active expiry
+	hashes map[string]struct{}
+
+	// hits & misses count the lookups that found a key or not, expiredKeys the keys deleted because they expired
+	hits        atomic.Int64
+	misses      atomic.Int64
+	expiredKeys atomic.Int64
 }
 
 // CreateStorage initializes a new store instance
 func CreateStorage() *Store {
 	s := &Store{
-		Items:   make(map[string]Data),
-		Lock:    sync.RWMutex{},
-		AOFChan: make(chan string, 100000), // 100000 ops/sec
+		Items:    make(map[string]Data),
+		Lock:     sync.RWMutex{},
+		AOFChan:  make(chan string, 100000), // 100000 ops/sec
+		volatile: make(map[string]struct{}),
+		index:    newScanIndex(),
+		hashes:   make(map[string]struct{}),
 	}
 
 	return s
 }
 
-// GET gets a value for a key in the store
+// setLocked adds or replaces an entry & keeps the memory accounting, the caller must hold the write lock
+func (s *Store) setLocked(key string, data Data) {
+	if old, ok := s.Items[key]; ok {
+		s.used -= entrySize(key, old)
+		if data.access == nil {
+			data.access = old.access
+		}
+	} else {
+		s.index.add(key)
+	}
+	if data.access == nil {
+		data.access = newAccess()
+	}
+
+	s.Items[key] = data
+	s.used += entrySize(key, data)
+
+	if data.Expiry.IsZero() {
+		delete(s.volatile, key)
+	} else {
+		s.volatile[key] = struct{}{}
+	}
+	s.trackHash(key, data)
+}
+
+// trackHash records whether a key is a hash with fields that have an expiry, the caller must hold the write lock
+func (s *Store) trackHash(key string, data Data) {
+	if h, ok := data.Value.(*Hash); ok && h.Volatile() {
+		s.hashes[key] = struct{}{}
+	} else {
+		delete(s.hashes, key)
+	}
+}
+
+// deleteLocked removes an entry & keeps the memory accounting, the caller must hold the write lock
+func (s *Store) deleteLocked(key string) {
+	if old, ok := s.Items[key]; ok {
+		s.used -= entrySize(key, old)
+		delete(s.Items, key)
+		delete(s.volatile, key)
+		delete(s.hashes, key)
+		s.index.remove(key)
+	}
+}
+
+// DeleteExpired removes a key found expired under the read lock, unless it was replaced in the meantime, & reports
+// whether it was removed
+func (s *Store) DeleteExpired(key string) bool {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+
+	if data, ok := s.Items[key]; ok && expired(data, time.Now()) {
+		s.expireLocked(key)
+		return true
+	}
+	return false
+}
+
+// expireLocked removes an expired entry & counts it, the caller must hold the write lock
+func (s *Store) expireLocked(key string) {
+	s.deleteLocked(key)
+	s.expiredKeys.Add(1)
+}
+
+func expired(data Data, now time.Time) bool {
+	if !data.Expiry.IsZero() && data.Expiry.Before(now) {
+		return true
+	}
+	// A hash goes with its last field
+	if h, ok := data.Value.(*Hash); ok && h.Expired(now) {
+		return true
+	}
+	return false
+}
+
+// GET gets a value for a key in the store, the values that are not strings are refused with ErrWrongType
 func (s *Store) GET(key string) (Data, error) {
 	s.Lock.RLock()
 
 	data, ok := s.Items[key]
 	if !ok {
 		s.Lock.RUnlock()
+		s.misses.Add(1)
 		return Data{}, errors.New("key not found")
 	}
 
-	if !data.Expiry.IsZero() && data.Expiry.Before(time.Now()) {
+	if expired(data, time.Now()) {
 		// run a goroutine for deleting expired key also, it cannot be the default zero
 
 		//? Running a DEL goroutine has issues because it tries to upgrade a read lock to a write lock which is not safe or predictable
@@ -54,24 +153,25 @@ func (s *Store) GET(key string) (Data, error) {
 		// go s.DEL(key)
 
 		s.Lock.RUnlock()
-
-		s.Lock.Lock()
-		delete(s.Items, key)
-		s.Lock.Unlock()
+		s.DeleteExpired(key)
+		s.misses.Add(1)
 
 		return Data{}, errors.New("expiration time has passed")
 	}
 
 	s.Lock.RUnlock()
+	s.hits.Add(1)
+	data.access.touch()
 
-	if iv, ok := data.Value.(resp.Integer); ok {
-		v := strconv.Itoa(iv.Value)
-		return Data{
-			Value:  resp.BulkString{Value: v, Length: len(v)},
-			Expiry: data.Expiry,
-		}, nil
+	str, ok := AsString(data.Value)
+	if !ok {
+		return Data{}, ErrWrongType
 	}
-	return data, nil
+	v := str.String()
+	return Data{
+		Value:  resp.BulkString{Value: v, Length: len(v)},
+		Expiry: data.Expiry,
+	}, nil
 }
 
 // SET gets a key-value pair and adds it to the storage
@@ -79,7 +179,23 @@ func (s *Store) SET(key string, value Data) {
 	s.Lock.Lock()
 	defer s.Lock.Unlock()
 
-	s.Items[key] = value
+	s.setLocked(key, value)
+}
+
+// Mutate runs fn, which modifies the value of a key in place, & updates the memory accounting of the key
+// It does nothing if the key does not exist
+func (s *Store) Mutate(key string, fn func()) {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+
+	data, ok := s.Items[key]
+	if !ok {
+		return
+	}
+	s.used -= entrySize(key, data)
+	fn()
+	s.used += entrySize(key, data)
+	s.trackHash(key, data)
 }
 
 // DEL gets a key and deletes it from storage
@@ -90,10 +206,10 @@ func (s *Store) DEL(key string) error {
 	if data, ok := s.Items[key]; ok {
 		//? The checking & deletion are in this order because it is impossible to check stuff after deletion
 		if !data.Expiry.IsZero() && data.Expiry.Before(time.Now()) {
-			delete(s.Items, key)
+			s.expireLocked(key)
 			return errors.New("expiration time has passed")
 		}
-		delete(s.Items, key)
+		s.deleteLocked(key)
 		return nil
 	}
 
@@ -102,24 +218,196 @@ func (s *Store) DEL(key string) error {
 
 // INCR increments the value of a key
 func (s *Store) INCR(key string) (resp.Type, error) {
+	data, err := s.INCRBY(key, 1)
+	if err != nil {
+		return nil, err
+	}
+	n, _ := data.Value.(String).Int()
+	return resp.Integer{Value: int(n)}, nil
+}
+
+// Errors of the commands on values
+var (
+	ErrWrongType  = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+	ErrNotInteger = errors.New("value is not an integer or out of range")
+	ErrNotFloat   = errors.New("value is not a valid float")
+	ErrOverflow   = errors.New("increment or decrement would overflow")
+	ErrNaN        = errors.New("increment would produce NaN or Infinity")
+)
+
+// liveLocked returns the entry of a key, deleting it if it expired, the caller must hold the write lock
+func (s *Store) liveLocked(key string) (Data, bool) {
+	data, ok := s.Items[key]
+	if ok && expired(data, time.Now()) {
+		s.expireLocked(key)
+		return Data{}, false
+	}
+	return data, ok
+}
+
+// INCRBY adds delta to the integer value of a key & returns the new entry
+// A missing key starts at 0, an existing one keeps its TTL
+func (s *Store) INCRBY(key string, delta int64) (Data, error) {
 	s.Lock.Lock()
 	defer s.Lock.Unlock()
 
-	if data, ok := s.Items[key]; ok {
-		if !data.Expiry.IsZero() && data.Expiry.Before(time.Now()) {
-			delete(s.Items, key)
-			return nil, errors.New("expiration time has passed")
+	data, ok := s.liveLocked(key)
+
+	current := int64(0)
+	if ok {
+		str, isString := AsString(data.Value)
+		if !isString {
+			return Data{}, ErrWrongType
+		}
+		n, isInt := str.Int()
+		if !isInt {
+			return Data{}, ErrNotInteger
 		}
+		current = n
+	}
+
+	if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+		return Data{}, ErrOverflow
+	}
+
+	data.Value = NewInt(current + delta)
+	data.access.touch()
+	s.setLocked(key, data)
+	return data, nil
+}
+
+// INCRBYFLOAT adds delta to the numeric value of a key & returns the new entry, whose value is a formatted number
+// A missing key starts at 0, an existing one keeps its TTL
+func (s *Store) INCRBYFLOAT(key string, delta float64) (Data, error) {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
 
-		if val, ok := data.Value.(resp.Integer); ok {
-			val.Value++
-			data.Value = val
-			s.Items[key] = data
-			return val, nil
+	data, ok := s.liveLocked(key)
+
+	current := 0.0
+	if ok {
+		str, isString := AsString(data.Value)
+		if !isString {
+			return Data{}, ErrWrongType
+		}
+		f, err := ParseFloat(str.String())
+		if err != nil {
+			return Data{}, err
 		}
+		current = f
+	}
+
+	result := current + delta
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		return Data{}, ErrNaN
+	}
 
-		return nil, errors.New("value is not an integer")
+	data.Value = NewString(FormatFloat(result))
+	data.access.touch()
+	s.setLocked(key, data)
+	return data, nil
+}
+
+// ParseFloat reads a float the way Redis does: no spaces around it, & neither NaN nor infinity
+func ParseFloat(str string) (float64, error) {
+	f, err := strconv.ParseFloat(str, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) || strings.TrimSpace(str) != str {
+		return 0, ErrNotFloat
 	}
+	return f, nil
+}
+
+// FormatFloat formats a float like Redis does for INCRBYFLOAT: no exponent, & no trailing zeros
+func FormatFloat(f float64) string {
+	if f == 0 {
+		// Avoid "-0"
+		return "0"
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// FLUSH deletes every key in the store
+func (s *Store) FLUSH() {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+
+	s.Items = make(map[string]Data)
+	s.volatile = make(map[string]struct{})
+	s.hashes = make(map[string]struct{})
+	s.used = 0
+	s.index = newScanIndex()
+}
+
+// Lookup returns the data of a key as stored, without converting its value
+// Expired keys are reported as missing
+func (s *Store) Lookup(key string) (Data, bool) {
+	return s.LookupAt(key, time.Now())
+}
+
+// LookupAt is Lookup at a given time, nothing has expired at the zero time
+// It doesn't count the keyspace hits & misses, see CountLookup
+func (s *Store) LookupAt(key string, now time.Time) (Data, bool) {
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+
+	data, ok := s.Items[key]
+	if !ok || (!now.IsZero() && expired(data, now)) {
+		return Data{}, false
+	}
+	return data, true
+}
+
+// Touch records an access to an entry for the eviction policies, the copies of the entry share it
+func (d Data) Touch() {
+	d.access.touch()
+}
+
+// CountLookup counts a lookup made by a read command as a keyspace hit or miss, the lookups of the write commands are
+// not counted
+func (s *Store) CountLookup(hit bool) {
+	if hit {
+		s.hits.Add(1)
+	} else {
+		s.misses.Add(1)
+	}
+}
+
+// KEYS returns every key that has not expired
+func (s *Store) KEYS() []string {
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+
+	now := time.Now()
+	keys := make([]string, 0, len(s.Items))
+	for key, data := range s.Items {
+		if expired(data, now) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// UsedMemory returns the estimated memory used by the entries, in bytes
+func (s *Store) UsedMemory() int64 {
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+
+	return s.used
+}
+
+// Size returns the number of keys, including the expired ones that were not deleted yet
+func (s *Store) Size() int {
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+
+	return len(s.Items)
+}
+
+// Volatile returns the number of keys that have an expiry, including the expired ones that were not deleted yet
+func (s *Store) Volatile() int {
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
 
-	return nil, errors.New("key not found")
+	return len(s.volatile)
 }
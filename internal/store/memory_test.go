@@ -1,7 +1,9 @@
 package store
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 	"sync"
@@ -345,9 +347,81 @@ func TestIncrementExpiry(t *testing.T) {
 
 	time.Sleep(2 * time.Second)
 
-	_, err := s.INCR(key)
-	if err == nil {
-		t.Errorf("Expected error incrementing an expired key, but did not get an error")
+	// An expired key is a missing key, which starts at 0 without a TTL
+	data, err := s.INCRBY(key, 1)
+	if err != nil {
+		t.Fatalf("Got an unexpected error incrementing an expired key: %v", err)
+	}
+	if data.Value.(String).String() != "1" || !data.Expiry.IsZero() {
+		t.Errorf("Expected the expired key to be recreated at 1 without a TTL, got %v", data)
+	}
+}
+
+func TestIncrementBy(t *testing.T) {
+	s := CreateStorage()
+
+	expiry := time.Now().Add(time.Hour)
+	s.SET("counter", Data{Value: resp.BulkString{Value: "10", Length: 2}, Expiry: expiry})
+
+	data, err := s.INCRBY("counter", -15)
+	if err != nil {
+		t.Fatalf("Got an unexpected error: %v", err)
+	}
+	if data.Value.(String).String() != "-5" || !data.Expiry.Equal(expiry) {
+		t.Errorf("Expected -5 with the TTL kept, got %v", data)
+	}
+
+	s.SET("max", Data{Value: resp.Integer{Value: math.MaxInt64}})
+	if _, err := s.INCRBY("max", 1); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Expected an overflow error, got %v", err)
+	}
+	s.SET("min", Data{Value: resp.Integer{Value: math.MinInt64}})
+	if _, err := s.INCRBY("min", -1); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Expected an overflow error, got %v", err)
+	}
+
+	s.SET("padded", Data{Value: resp.BulkString{Value: "007", Length: 3}})
+	if _, err := s.INCRBY("padded", 1); !errors.Is(err, ErrNotInteger) {
+		t.Errorf("Expected a not an integer error, got %v", err)
+	}
+}
+
+func TestIncrementByFloat(t *testing.T) {
+	s := CreateStorage()
+
+	tests := []struct {
+		delta float64
+		want  string
+	}{
+		{10.5, "10.5"},
+		{0.1, "10.6"},
+		{-5, "5.6"},
+		{-5.6, "0"},
+		{5e3, "5000"},
+	}
+
+	for _, tt := range tests {
+		data, err := s.INCRBYFLOAT("float", tt.delta)
+		if err != nil {
+			t.Fatalf("Got an unexpected error: %v", err)
+		}
+		if got := data.Value.(String).String(); got != tt.want {
+			t.Errorf("INCRBYFLOAT %v = %s, want %s", tt.delta, got, tt.want)
+		}
+	}
+
+	// Small numbers are not written with an exponent
+	if data, _ := s.INCRBYFLOAT("tiny", 2e-17); data.Value.(String).String() != "0.00000000000000002" {
+		t.Errorf("INCRBYFLOAT 2e-17 = %v", data.Value)
+	}
+
+	if _, err := s.INCRBYFLOAT("float", math.Inf(1)); !errors.Is(err, ErrNaN) {
+		t.Errorf("Expected a NaN or Infinity error, got %v", err)
+	}
+	for _, str := range []string{"abc", " 1", "nan", "inf", ""} {
+		if _, err := ParseFloat(str); err == nil {
+			t.Errorf("ParseFloat(%q) succeeded", str)
+		}
 	}
 }
 
@@ -0,0 +1,140 @@
+package store
+
+import (
+	"strconv"
+
+	"github.com/DNahar74/PulseDB/internal/resp"
+)
+
+// The encodings of a string, as reported by OBJECT ENCODING
+const (
+	// EncodingInt is a number in its canonical form, kept as an integer
+	EncodingInt = "int"
+	// EncodingEmbstr is a short string that is only ever replaced as a whole
+	EncodingEmbstr = "embstr"
+	// EncodingRaw is a long string, or a string modified in place by APPEND or SETRANGE
+	EncodingRaw = "raw"
+)
+
+// embstrSizeLimit is the longest string with the embstr encoding, like in Redis
+const embstrSizeLimit = 44
+
+// String is the value of a string key
+// It always gives back the bytes it was created from: only the canonical form of a number, such as "12" but not
+// "012" or "+12", is kept as an integer
+type String struct {
+	str   string
+	num   int64
+	isInt bool
+	// raw is set for the strings built by an in place modification
+	raw bool
+}
+
+// NewString creates the value of a string from its bytes
+func NewString(s string) String {
+	if len(s) <= 20 {
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil && strconv.FormatInt(n, 10) == s {
+			return String{num: n, isInt: true}
+		}
+	}
+	return String{str: s, raw: len(s) > embstrSizeLimit}
+}
+
+// NewRawString creates the value of a string modified in place, which is never kept as an integer
+func NewRawString(s string) String {
+	return String{str: s, raw: true}
+}
+
+// NewInt creates the value of a string from a number
+func NewInt(n int64) String {
+	return String{num: n, isInt: true}
+}
+
+// String returns the bytes of the string
+func (s String) String() string {
+	if s.isInt {
+		return strconv.FormatInt(s.num, 10)
+	}
+	return s.str
+}
+
+// Int returns the number held by the string, & false if it does not hold one in its canonical form
+func (s String) Int() (int64, bool) {
+	if s.isInt {
+		return s.num, true
+	}
+	if len(s.str) <= 20 {
+		if n, err := strconv.ParseInt(s.str, 10, 64); err == nil && strconv.FormatInt(n, 10) == s.str {
+			return n, true
+		}
+	}
+	return 0, false
+}
+
+// Len returns the number of bytes of the string
+func (s String) Len() int {
+	if s.isInt {
+		return len(strconv.FormatInt(s.num, 10))
+	}
+	return len(s.str)
+}
+
+// Encoding returns the name of the encoding of the string
+func (s String) Encoding() string {
+	switch {
+	case s.isInt:
+		return EncodingInt
+	case s.raw:
+		return EncodingRaw
+	default:
+		return EncodingEmbstr
+	}
+}
+
+// Serialize sends the string as a BulkString
+func (s String) Serialize() (string, error) {
+	str := s.String()
+	return resp.BulkString{Value: str, Length: len(str)}.Serialize()
+}
+
+// AsString returns a string value, accepting the RESP types that hold a string, & false for the other types
+func AsString(v resp.Type) (String, bool) {
+	switch v := v.(type) {
+	case String:
+		return v, true
+	case resp.BulkString:
+		return NewString(v.Value), true
+	case resp.SimpleString:
+		return NewString(v.Value), true
+	case resp.Integer:
+		return NewInt(int64(v.Value)), true
+	default:
+		return String{}, false
+	}
+}
+
+// Encoding returns the encoding of a value, as reported by OBJECT ENCODING
+func Encoding(v resp.Type) string {
+	if s, ok := AsString(v); ok {
+		return s.Encoding()
+	}
+	switch v.(type) {
+	case *GeoIndex:
+		return "skiplist"
+	case *Hash:
+		return "hashtable"
+	}
+	return "unknown"
+}
+
+// Clone returns a copy of a value that can be modified without changing the original, for COPY
+// Strings are never modified in place, they are shared
+func Clone(v resp.Type) resp.Type {
+	switch v := v.(type) {
+	case *GeoIndex:
+		return v.Clone()
+	case *Hash:
+		return v.Clone()
+	}
+	return v
+}
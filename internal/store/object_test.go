@@ -0,0 +1,74 @@
+package store
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/DNahar74/PulseDB/internal/resp"
+)
+
+func TestStringEncodings(t *testing.T) {
+	tests := []struct {
+		value    string
+		encoding string
+	}{
+		{"12", EncodingInt},
+		{"-9223372036854775808", EncodingInt},
+		{"9223372036854775808", EncodingEmbstr},
+		{"007", EncodingEmbstr},
+		{"+1", EncodingEmbstr},
+		{"-0", EncodingEmbstr},
+		{" 1", EncodingEmbstr},
+		{"hello", EncodingEmbstr},
+		{"\x00binary\xff", EncodingEmbstr},
+		{strings.Repeat("x", 44), EncodingEmbstr},
+		{strings.Repeat("x", 45), EncodingRaw},
+	}
+
+	for _, tt := range tests {
+		s := NewString(tt.value)
+		if s.Encoding() != tt.encoding {
+			t.Errorf("encoding of %q = %s, want %s", tt.value, s.Encoding(), tt.encoding)
+		}
+		// Whatever the encoding, the bytes are kept
+		if s.String() != tt.value || s.Len() != len(tt.value) {
+			t.Errorf("NewString(%q) gives back %q", tt.value, s.String())
+		}
+	}
+
+	if s := NewRawString("12"); s.Encoding() != EncodingRaw {
+		t.Errorf("encoding of a string modified in place = %s, want raw", s.Encoding())
+	}
+	if n, ok := NewRawString("12").Int(); !ok || n != 12 {
+		t.Errorf("Int() of a raw number = %d, %v", n, ok)
+	}
+}
+
+func TestRestoreString(t *testing.T) {
+	payload, err := Dump(NewString("007"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := Restore(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, ok := v.(String); !ok || s.String() != "007" {
+		t.Errorf("Restore() = %#v, want the string 007", v)
+	}
+
+	// A payload with a valid checksum but a value Dump never produces is refused
+	for _, v := range []resp.Type{
+		resp.Integer{Value: 1},
+		resp.SimpleError{Value: "ERR"},
+		resp.Array{Length: 1, Items: []resp.Type{resp.BulkString{Value: "x", Length: 1}}},
+	} {
+		payload, err := Dump(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Restore(payload); err != ErrBadPayload {
+			t.Errorf("Restore() of %#v: error %v, want ErrBadPayload", v, err)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package utils
+
+// GlobMatch reports whether a string matches a glob-style pattern, with the syntax of the Redis KEYS command:
+// * matches any sequence, ? any character, [abc], [^abc] & [a-z] a set of characters, & \ escapes the next character
+// The match runs in O(len(pattern) * len(s)): on a mismatch only the last star is retried one character further,
+// because every other element of a pattern matches exactly one character
+func GlobMatch(pattern, s string) bool {
+	// The rest of the pattern after the last star & the rest of s it is being tried against, if there was a star
+	starPattern, starS := "", ""
+	star := false
+
+	for len(s) > 0 || len(pattern) > 0 {
+		if len(pattern) > 0 && pattern[0] == '*' {
+			// Consecutive stars are the same as one
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			starPattern, starS, star = pattern, s, true
+			continue
+		}
+
+		rest, ok := matchOne(pattern, s)
+		if ok {
+			pattern, s = rest, s[1:]
+			continue
+		}
+
+		// Let the last star swallow one more character
+		if !star || len(starS) == 0 {
+			return false
+		}
+		starS = starS[1:]
+		pattern, s = starPattern, starS
+	}
+
+	return true
+}
+
+// matchOne matches the first element of a pattern that isn't a star against the first character of s, & returns the
+// rest of the pattern after it
+func matchOne(pattern, s string) (string, bool) {
+	if len(pattern) == 0 || len(s) == 0 {
+		return "", false
+	}
+
+	switch pattern[0] {
+	case '?':
+		return pattern[1:], true
+
+	case '[':
+		ok, rest := matchClass(pattern[1:], s[0])
+		return rest, ok
+
+	case '\\':
+		if len(pattern) >= 2 {
+			pattern = pattern[1:]
+		}
+	}
+	return pattern[1:], s[0] == pattern[0]
+}
+
+// matchClass matches a character against the set that follows a [, & returns the rest of the pattern after the ]
+// An unterminated set extends to the end of the pattern, like in Redis
+func matchClass(pattern string, c byte) (bool, string) {
+	not := len(pattern) > 0 && pattern[0] == '^'
+	if not {
+		pattern = pattern[1:]
+	}
+
+	match := false
+	for len(pattern) > 0 && pattern[0] != ']' {
+		switch {
+		case pattern[0] == '\\' && len(pattern) >= 2:
+			if pattern[1] == c {
+				match = true
+			}
+			pattern = pattern[2:]
+		case len(pattern) >= 3 && pattern[1] == '-':
+			start, end := pattern[0], pattern[2]
+			if start > end {
+				start, end = end, start
+			}
+			if c >= start && c <= end {
+				match = true
+			}
+			pattern = pattern[3:]
+		default:
+			if pattern[0] == c {
+				match = true
+			}
+			pattern = pattern[1:]
+		}
+	}
+	if len(pattern) > 0 {
+		// Skip the ]
+		pattern = pattern[1:]
+	}
+
+	return match != not, pattern
+}
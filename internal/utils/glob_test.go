@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		s       string
+		want    bool
+	}{
+		{"*", "", true},
+		{"*", "anything", true},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h*llo", "heeeello", true},
+		{"h*llo", "hello world", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"h[b-a]llo", "hallo", true},
+		{"h[a-b]llo", "hcllo", false},
+		{`h\*llo`, "h*llo", true},
+		{`h\*llo`, "hello", false},
+		{`[\]]`, "]", true},
+		{"user:*:name", "user:42:name", true},
+		{"user:*:name", "user:42:age", false},
+		{"**a", "bba", true},
+		{"a*b*c", "axxbyyc", true},
+		{"a*b*c", "axxbyy", false},
+		{"[abc", "b", true},
+		{"*a?", "aab", true},
+		{"*[ab]", "xxb", true},
+		{"a*", "ba", false},
+		{`h\`, `h\`, true},
+		{"", "", true},
+		{"", "a", false},
+	}
+
+	for _, tt := range tests {
+		if got := GlobMatch(tt.pattern, tt.s); got != tt.want {
+			t.Errorf("GlobMatch(%q, %q) = %v, want %v", tt.pattern, tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestGlobMatchBacktracking(t *testing.T) {
+	// Every star retried against every suffix takes exponential time on this pattern, see CVE-2022-36021
+	pattern := "*a*a*a*a*a*a*a*a*a*a*a*a*b"
+	s := strings.Repeat("a", 200)
+
+	start := time.Now()
+	if GlobMatch(pattern, s) {
+		t.Errorf("GlobMatch(%q, %q) = true", pattern, s)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("GlobMatch took %v", elapsed)
+	}
+	if !GlobMatch(pattern, s+"b") {
+		t.Errorf("GlobMatch(%q, %q) = false", pattern, s+"b")
+	}
+}
@@ -3,6 +3,9 @@ package utils
 import (
 	"fmt"
 	"net"
+	"os"
+	"strconv"
+	"strings"
 
 	"github.com/DNahar74/PulseDB/internal/resp"
 )
@@ -25,3 +28,92 @@ func SendMessage(conn net.Conn, message resp.Type) error {
 
 	return nil
 }
+
+// SendCommand sends a command to a server as an array of BulkStrings & reads its reply
+// An error reply is returned as an error
+func SendCommand(conn net.Conn, reader *resp.Reader, argv ...string) (resp.Type, error) {
+	items := make([]resp.Type, len(argv))
+	for i, a := range argv {
+		items[i] = resp.BulkString{Value: a, Length: len(a)}
+	}
+
+	str, err := resp.Array{Length: len(items), Items: items}.Serialize()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = conn.Write([]byte(str))
+	if err != nil {
+		return nil, err
+	}
+
+	reply, _, err := reader.ReadValue()
+	if err != nil {
+		return nil, err
+	}
+	if e, ok := reply.(resp.SimpleError); ok {
+		return nil, fmt.Errorf("error reply to %s: %s", argv[0], e.Value)
+	}
+	return reply, nil
+}
+
+// ParseMemory reads a memory size such as 1048576, 100kb, 64mb or 1gb, the way redis.conf does
+// k, m & g are powers of 1000 while kb, mb & gb are powers of 1024
+func ParseMemory(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		factor int64
+	}{
+		{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30},
+		{"k", 1000}, {"m", 1000 * 1000}, {"g", 1000 * 1000 * 1000},
+		{"b", 1},
+	}
+
+	lower := strings.ToLower(strings.TrimSpace(s))
+	factor := int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(lower, u.suffix) {
+			lower = strings.TrimSuffix(lower, u.suffix)
+			factor = u.factor
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(lower, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid memory size: %s", s)
+	}
+	return n * factor, nil
+}
+
+// FormatMemory prints a size in bytes the way INFO does, e.g. 1.50M
+func FormatMemory(n int64) string {
+	switch {
+	case n < 1<<10:
+		return strconv.FormatInt(n, 10) + "B"
+	case n < 1<<20:
+		return fmt.Sprintf("%.2fK", float64(n)/(1<<10))
+	case n < 1<<30:
+		return fmt.Sprintf("%.2fM", float64(n)/(1<<20))
+	default:
+		return fmt.Sprintf("%.2fG", float64(n)/(1<<30))
+	}
+}
+
+// ResidentMemory returns the resident set size of the process in bytes, read from /proc/self/statm
+// It reports false on the systems without /proc
+func ResidentMemory() (int64, bool) {
+	statm, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0, false
+	}
+	fields := strings.Fields(string(statm))
+	if len(fields) < 2 {
+		return 0, false
+	}
+	pages, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return pages * int64(os.Getpagesize()), true
+}